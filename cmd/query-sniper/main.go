@@ -8,6 +8,7 @@ import (
 	"syscall"
 
 	"github.com/persona-id/query-sniper/internal/configuration"
+	"github.com/persona-id/query-sniper/internal/server"
 	"github.com/persona-id/query-sniper/internal/sniper"
 )
 
@@ -27,18 +28,70 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	manager := sniper.NewManager(settings)
+
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGHUP)
 
-	go handleSignals(cancel, sigChan)
+	go handleSignals(cancel, sigChan, func() { reloadConfig(manager) }, manager.Dump, cycleLogLevel)
+
+	// start the HTTP server for the metrics and health endpoints, if it's been configured.
+	if settings.HTTP.Address != "" {
+		go func() {
+			err := server.Serve(ctx, settings.HTTP.Address, server.NewHandler(manager, settings.HTTP.ReadyIntervals))
+			if err != nil {
+				slog.Error("Error in server.Serve()", slog.Any("err", err))
+			}
+		}()
+	}
+
+	// start the admin API for runtime overrides, if it's been configured.
+	if settings.Admin.Address != "" {
+		if settings.Admin.AllowRemote {
+			slog.Warn("The admin API may be listening on a non-loopback address; anyone who can reach it with a token can pause the snipers",
+				slog.String("address", settings.Admin.Address),
+			)
+		}
+
+		go func() {
+			err := server.Serve(ctx, settings.Admin.Address, server.NewAdminHandler(manager, settings.Admin.Tokens))
+			if err != nil {
+				slog.Error("Error in server.Serve() for the admin API", slog.Any("err", err))
+			}
+		}()
+	}
+
+	manager.Run(ctx)
+}
+
+// reloadConfig re-reads and validates the configuration, and hands it to the manager to apply
+// to the running snipers. An invalid configuration is logged and rejected, and the current
+// snipers keep running with their existing settings.
+func reloadConfig(manager *sniper.Manager) {
+	settings, err := configuration.Configure()
+	if err != nil {
+		slog.Error("Error reloading the configuration, keeping the current configuration", slog.Any("err", err))
+
+		return
+	}
+
+	slog.Info("Reloading configuration", slog.Int("databases", len(settings.Databases)))
 
-	sniper.Run(ctx, settings)
+	manager.Reload(settings)
+}
+
+// cycleLogLevel moves the logger to the next level in the cycle of the configured level, DEBUG and
+// TRACE, and logs the new level.
+func cycleLogLevel() {
+	level := configuration.CycleLogLevel()
+
+	slog.Warn("Changed the log level", slog.String("level", configuration.LevelName(level)))
 }
 
 // handleSignals processes OS signals in a separate goroutine.
-// It cancels the context on shutdown signals (SIGINT, SIGTERM) and logs
-// other signals (SIGUSR1, SIGUSR2, SIGHUP).
-func handleSignals(cancel context.CancelFunc, sigChan <-chan os.Signal) {
+// It cancels the context on shutdown signals (SIGINT, SIGTERM), calls reload on SIGHUP,
+// dump on SIGUSR1 and cycleLogLevel on SIGUSR2, and logs any other signals.
+func handleSignals(cancel context.CancelFunc, sigChan <-chan os.Signal, reload, dump, cycleLogLevel func()) {
 	for sig := range sigChan {
 		switch sig {
 		case syscall.SIGINT, syscall.SIGTERM:
@@ -47,13 +100,20 @@ func handleSignals(cancel context.CancelFunc, sigChan <-chan os.Signal) {
 
 			return
 
-		case syscall.SIGUSR1, syscall.SIGUSR2:
-			slog.Info("Received SIGUSR signal", slog.String("signal", sig.String()))
-			// TODO: implement SIGUSR{1,2} handler functionality.
+		case syscall.SIGUSR1:
+			slog.Info("Received SIGUSR signal, dumping the sniper state", slog.String("signal", sig.String()))
+
+			dump()
+
+		case syscall.SIGUSR2:
+			slog.Info("Received SIGUSR signal, cycling the log level", slog.String("signal", sig.String()))
+
+			cycleLogLevel()
 
 		case syscall.SIGHUP:
 			slog.Info("Received SIGHUP signal", slog.String("signal", sig.String()))
-			// TODO: implement SIGHUP handler functionality (e.g., reload config).
+
+			reload()
 
 		default:
 			slog.Warn("Received unhandled signal", slog.String("signal", sig.String()))
@@ -88,7 +88,7 @@ func TestHandleSignals(t *testing.T) {
 				done := make(chan bool, 1)
 
 				go func() {
-					handleSignals(cancel, sigChan)
+					handleSignals(cancel, sigChan, func() {}, func() {}, func() {})
 
 					done <- true
 				}()
@@ -166,7 +166,7 @@ func TestHandleSignalsChannelClosed(t *testing.T) {
 		done := make(chan bool, 1)
 
 		go func() {
-			handleSignals(cancel, sigChan)
+			handleSignals(cancel, sigChan, func() {}, func() {}, func() {})
 
 			done <- true
 		}()
@@ -206,7 +206,7 @@ func TestHandleSignalsMultipleShutdownSignals(t *testing.T) {
 		done := make(chan bool, 1)
 
 		go func() {
-			handleSignals(cancel, sigChan)
+			handleSignals(cancel, sigChan, func() {}, func() {}, func() {})
 
 			done <- true
 		}()
@@ -234,6 +234,103 @@ func TestHandleSignalsMultipleShutdownSignals(t *testing.T) {
 	})
 }
 
+func TestHandleSignalsReload(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		t.Helper()
+
+		var buf safeBuffer
+
+		logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+			Level: slog.LevelDebug,
+		}))
+		slog.SetDefault(logger)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		sigChan := make(chan os.Signal, 1)
+
+		reloads := make(chan struct{}, 2)
+
+		done := make(chan bool, 1)
+
+		go func() {
+			handleSignals(cancel, sigChan, func() { reloads <- struct{}{} }, func() {}, func() {})
+
+			done <- true
+		}()
+
+		sigChan <- syscall.SIGHUP
+
+		sigChan <- syscall.SIGHUP
+
+		close(sigChan)
+		<-done
+
+		if len(reloads) != 2 {
+			t.Errorf("expected reload to be called once per SIGHUP (2), got %d", len(reloads))
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Error("context should not have been cancelled by SIGHUP")
+		default:
+		}
+	})
+}
+
+func TestHandleSignalsUserSignals(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		t.Helper()
+
+		var buf safeBuffer
+
+		logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+			Level: slog.LevelDebug,
+		}))
+		slog.SetDefault(logger)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		sigChan := make(chan os.Signal, 3)
+
+		dumps := make(chan struct{}, 3)
+		cycles := make(chan struct{}, 3)
+
+		done := make(chan bool, 1)
+
+		go func() {
+			handleSignals(cancel, sigChan, func() {}, func() { dumps <- struct{}{} }, func() { cycles <- struct{}{} })
+
+			done <- true
+		}()
+
+		sigChan <- syscall.SIGUSR1
+
+		sigChan <- syscall.SIGUSR2
+
+		sigChan <- syscall.SIGUSR2
+
+		close(sigChan)
+		<-done
+
+		if len(dumps) != 1 {
+			t.Errorf("expected dump to be called once per SIGUSR1 (1), got %d", len(dumps))
+		}
+
+		if len(cycles) != 2 {
+			t.Errorf("expected cycleLogLevel to be called once per SIGUSR2 (2), got %d", len(cycles))
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Error("context should not have been cancelled by SIGUSR1 or SIGUSR2")
+		default:
+		}
+	})
+}
+
 type safeBuffer struct {
 	buf bytes.Buffer
 	mu  sync.Mutex
@@ -1,14 +1,25 @@
 package configuration
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
 	"time"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/goforj/godump"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+
+	"github.com/persona-id/query-sniper/internal/redact"
+	"github.com/persona-id/query-sniper/internal/schedule"
 )
 
 var (
@@ -23,36 +34,306 @@ var (
 	ErrInvalidQueryLimit       = errors.New("invalid query limit")
 	ErrInvalidTransactionLimit = errors.New("invalid transaction limit")
 	ErrInvalidSSLConfig        = errors.New("invalid SSL configuration")
+	ErrInvalidRuleAction       = errors.New("invalid rule action")
+	ErrInvalidRuleDigest       = errors.New("invalid rule digest regex")
+	ErrInvalidRuleLimit        = errors.New("invalid rule limit")
+	ErrInvalidQueryHintsLimit  = errors.New("invalid query hints max limit")
+	ErrInvalidQueryHintsKey    = errors.New("invalid query hints comment key")
+	ErrInvalidWebhookURL       = errors.New("invalid webhook URL")
+	ErrInvalidKillThreshold    = errors.New("invalid kill threshold")
+	ErrInvalidSeverity         = errors.New("invalid severity")
+	ErrInvalidDatadogAddress   = errors.New("invalid datadog address")
+	ErrInvalidWebhookTemplate  = errors.New("invalid webhook template")
+	ErrInvalidWebhookRetries   = errors.New("invalid webhook retries")
+	ErrInvalidLockWaitLimit    = errors.New("invalid lock wait limit")
+	ErrInvalidMetadataLock     = errors.New("invalid metadata lock settings")
+	ErrInvalidIdleTxnLimit     = errors.New("invalid idle transaction limit")
+	ErrInvalidSightings        = errors.New("invalid required sightings")
+	ErrInvalidKillBudget       = errors.New("invalid kill budget")
+	ErrInvalidAdaptive         = errors.New("invalid adaptive thresholds")
+	ErrInvalidSchedule         = errors.New("invalid schedule")
+	ErrInvalidLeaderLock       = errors.New("invalid leader lock name")
+	ErrInvalidReadyIntervals   = errors.New("invalid ready intervals")
+	ErrInvalidAdminConfig      = errors.New("invalid admin API configuration")
+	ErrInvalidAuditConfig      = errors.New("invalid audit configuration")
+	ErrInvalidAuditDatabase    = errors.New("invalid audit database configuration")
+	ErrInvalidQueryText        = errors.New("invalid query text configuration")
+	ErrInvalidQueryTags        = errors.New("invalid query tags configuration")
 )
 
+// DatabaseConfig holds the configuration for a single database. This is sorted by datatype to satisfy
+// the fieldalignment linter rule.
+type DatabaseConfig struct {
+	Address            string           `mapstructure:"address"`
+	Schema             string           `mapstructure:"schema"` // TODO(kuzmik): add support for multiple schemas.
+	SSLCert            string           `mapstructure:"ssl_cert"`
+	SSLKey             string           `mapstructure:"ssl_key"`
+	SSLCA              string           `mapstructure:"ssl_ca"`
+	Username           string           `mapstructure:"username"`
+	Password           string           `mapstructure:"password"`
+	MetadataLockAction string           `mapstructure:"metadata_lock_action"` // what to kill when DDL waits past metadata_lock_limit; defaults to kill_waiter
+	Rules              []Rule           `mapstructure:"rules"`
+	Schedules          []ScheduleConfig `mapstructure:"schedules"` // threshold profiles for maintenance windows, evaluated in order
+	QueryHints         struct {
+		CommentKey string        `mapstructure:"comment_key"` // key of the /* key=30s */ comment; defaults to sniper_timeout
+		MaxLimit   time.Duration `mapstructure:"max_limit"`   // ceiling for the per-query timeouts
+		Enabled    bool          `mapstructure:"enabled"`
+	} `mapstructure:"query_hints"` // honor MAX_EXECUTION_TIME hints and timeout comments in place of long_query_limit
+	Adaptive             AdaptiveConfig `mapstructure:"adaptive"` // scale long_query_limit and long_transaction_limit down as the server gets busier
+	Interval             time.Duration  `mapstructure:"interval"`
+	LongQueryLimit       time.Duration  `mapstructure:"long_query_limit"`
+	LongTransactionLimit time.Duration  `mapstructure:"long_transaction_limit"`
+	LockWaitLimit        time.Duration  `mapstructure:"lock_wait_limit"`        // kill the root blocker of a lock chain once its waiters have waited this long; disabled if 0
+	MetadataLockLimit    time.Duration  `mapstructure:"metadata_lock_limit"`    // act on DDL waiting for a metadata lock this long; disabled if 0
+	IdleTransactionLimit time.Duration  `mapstructure:"idle_transaction_limit"` // kill sessions sleeping with an open transaction this long; disabled if 0
+	BreakerCooldown      time.Duration  `mapstructure:"breaker_cooldown"`       // how long the kill circuit breaker stays open; defaults to 5m
+	Port                 int            `mapstructure:"port"`
+	RequiredSightings    int            `mapstructure:"required_sightings"`   // consecutive ticks an offender must be seen over its limit before it's killed; defaults to 1
+	MaxKillsPerMinute    int            `mapstructure:"max_kills_per_minute"` // trip the circuit breaker into dry run past this many kills a minute; disabled if 0
+	DryRun               bool           `mapstructure:"dry_run"`
+	CaptureExplain       bool           `mapstructure:"capture_explain"` // capture the plan of a process with EXPLAIN FOR CONNECTION just before killing it
+}
+
+// AdaptiveConfig configures the optional adaptive thresholds. On every tick the sniper reads the
+// server's Threads_running and Innodb_row_lock_current_waits, and the database's (and its rules')
+// long query and transaction limits are multiplied by the lowest scale of the steps that the load has
+// reached.
+type AdaptiveConfig struct {
+	Steps    []AdaptiveStep `mapstructure:"steps"`
+	MinLimit time.Duration  `mapstructure:"min_limit"` // the limits are never scaled below this; defaults to 1s
+	Enabled  bool           `mapstructure:"enabled"`
+}
+
+// AdaptiveStep is a step of the adaptive curve. The step is reached once either of its thresholds is;
+// a threshold of 0 is ignored.
+type AdaptiveStep struct {
+	Scale          float64 `mapstructure:"scale"`           // the factor the limits are multiplied by, in (0, 1]
+	ThreadsRunning int     `mapstructure:"threads_running"` // reached at this many running threads
+	RowLockWaits   int     `mapstructure:"row_lock_waits"`  // reached at this many sessions waiting for a row lock
+}
+
+// ScheduleConfig is a scheduled threshold profile. Its window opens every time the cron expression
+// fires, in the given timezone, and stays open for duration; while it's open, the profile's settings
+// replace the database's. The first open window of a database wins.
+type ScheduleConfig struct {
+	DryRun               *bool         `mapstructure:"dry_run"`  // overrides dry_run if set; safe mode still wins
+	Name                 string        `mapstructure:"name"`     // shown in the logs as the active profile
+	Cron                 string        `mapstructure:"cron"`     // standard five field cron expression for when the window opens
+	Timezone             string        `mapstructure:"timezone"` // IANA timezone of the cron expression, eg America/New_York; defaults to UTC
+	Duration             time.Duration `mapstructure:"duration"` // how long the window stays open
+	LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
+	LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
+}
+
+// DefaultProfile is the name of the active profile when none of a database's schedules are open.
+const DefaultProfile = "default"
+
+// Metadata lock actions.
+const (
+	MetadataLockActionKillWaiter = "kill_waiter" // kill the DDL statement that is waiting for the lock
+	MetadataLockActionKillHolder = "kill_holder" // kill the connections holding the lock
+)
+
+// Rule is a kill policy rule for a database. The rules are evaluated in order, and the first rule
+// that matches a process or transaction decides how it's handled. Empty match fields match
+// anything; empty limits fall back to the database's limits.
+type Rule struct {
+	Name                 string        `mapstructure:"name"`
+	User                 string        `mapstructure:"user"`             // exact match on the mysql user
+	Schema               string        `mapstructure:"schema"`           // exact match on the current schema
+	Host                 string        `mapstructure:"host"`             // exact match on the client host, without the port
+	Command              string        `mapstructure:"command"`          // case insensitive match on the processlist command, eg Query or Execute
+	Digest               string        `mapstructure:"digest"`           // regular expression matched against the digest text
+	StatementPrefix      string        `mapstructure:"statement_prefix"` // case insensitive prefix of the digest text, eg SELECT
+	Action               string        `mapstructure:"action"`           // one of the RuleAction* values; defaults to the sniper's normal KILL
+	LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
+	LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
+	Exempt               bool          `mapstructure:"exempt"` // never kill anything this rule matches
+}
+
+// Valid values for Rule.Action.
+const (
+	RuleActionKillQuery      = "kill_query"      // KILL QUERY; terminates the statement but keeps the connection
+	RuleActionKillConnection = "kill_connection" // KILL CONNECTION
+	RuleActionLog            = "log"             // only log the offender, never kill it
+)
+
+// SlackConfig configures the optional slack notifications. The webhook URL is a secret, so it
+// should be set in the credentials file.
+type SlackConfig struct {
+	Channels    map[string]string `mapstructure:"channels"`     // per-database channel overrides, keyed by database name
+	WebhookURL  string            `mapstructure:"webhook_url"`  // slack incoming webhook; slack notifications are disabled if empty
+	Channel     string            `mapstructure:"channel"`      // the default channel; the webhook's own channel if empty
+	MinInterval time.Duration     `mapstructure:"min_interval"` // minimum time between messages to a channel; defaults to 1m
+}
+
+// PagerDutyConfig configures the optional pagerduty alerting. The routing key is a secret, so it
+// should be set in the credentials file.
+type PagerDutyConfig struct {
+	RoutingKey    string        `mapstructure:"routing_key"`    // events v2 integration key; pagerduty alerting is disabled if empty
+	Severity      string        `mapstructure:"severity"`       // critical, error, warning or info; defaults to critical
+	Window        time.Duration `mapstructure:"window"`         // the window that kills are counted over; defaults to 1m
+	KillThreshold int           `mapstructure:"kill_threshold"` // an incident is opened when a database has more kills than this in the window
+	CountDryRun   bool          `mapstructure:"count_dry_run"`  // count the kills a database would have made in dry run too; off by default
+}
+
+// DatadogConfig configures the optional DogStatsD metrics and datadog events.
+type DatadogConfig struct {
+	Address   string   `mapstructure:"address"`   // the dogstatsd agent's UDP address; datadog is disabled if empty
+	Namespace string   `mapstructure:"namespace"` // prefix for the metric names; defaults to query_sniper.
+	Tags      []string `mapstructure:"tags"`      // extra tags added to every metric and event, e.g. env:production
+}
+
+// WebhookConfig configures a generic webhook, which is sent a signed JSON POST for every detection
+// and kill. The secret should be set in the credentials file.
+type WebhookConfig struct {
+	Headers      map[string]string `mapstructure:"headers"`       // extra headers added to every request
+	MaxRetries   *int              `mapstructure:"max_retries"`   // how many times a failed request is retried; defaults to 3 if unset, and 0 turns retries off
+	URL          string            `mapstructure:"url"`           // the URL to POST to
+	Secret       string            `mapstructure:"secret"`        // HMAC-SHA256 signing key; requests are unsigned if empty
+	Template     string            `mapstructure:"template"`      // text/template for the request body; the default JSON payload if empty
+	RetryBackoff time.Duration     `mapstructure:"retry_backoff"` // the delay before the first retry, doubled for each retry after; defaults to 1s
+}
+
+// AuditConfig configures the audit sinks, which record every detection and kill on their own,
+// whatever the log level.
+type AuditConfig struct {
+	File AuditFileConfig `mapstructure:"file"`
+}
+
+// AuditFileConfig configures the JSONL audit log, which is rotated by size and age.
+type AuditFileConfig struct {
+	Path       string        `mapstructure:"path"`        // the audit log; disabled if empty. Rotated files are named after it, with a timestamp
+	MaxAge     time.Duration `mapstructure:"max_age"`     // rotate once the file has been open this long; defaults to 24h
+	MaxSizeMB  int           `mapstructure:"max_size_mb"` // rotate before the file grows past this many megabytes; defaults to 100
+	MaxBackups int           `mapstructure:"max_backups"` // how many rotated files to keep; all of them are kept if 0
+}
+
+// AuditDatabaseConfig configures the MySQL table that every detection and kill is recorded in, either
+// on one of the configured databases or on a separate DSN.
+type AuditDatabaseConfig struct {
+	Database       string        `mapstructure:"database"`          // the name of one of the databases to write to; mutually exclusive with dsn
+	DSN            string        `mapstructure:"dsn"`               // a go-sql-driver/mysql DSN to write to; a secret, so set it in the credentials file
+	SpillPath      string        `mapstructure:"spill_path"`        // rows that can't be written while the audit database is down are appended here, and replayed once it's back; dropped if empty
+	FlushInterval  time.Duration `mapstructure:"flush_interval"`    // how often the buffered rows are written; defaults to 1s
+	BufferSize     int           `mapstructure:"buffer_size"`       // how many rows can be waiting to be written before new ones are dropped; defaults to 1000
+	SpillMaxSizeMB int           `mapstructure:"spill_max_size_mb"` // rows are dropped once the spill file grows past this many megabytes; defaults to 100
+}
+
+// Enabled returns whether an audit database is configured.
+func (config AuditDatabaseConfig) Enabled() bool {
+	return config.Database != "" || config.DSN != ""
+}
+
+// QueryTextConfig configures the opt-in logging of the live query text (pl.info) of the processes the
+// snipers kill. The text is only logged once it's been through the redact package's pipeline.
+type QueryTextConfig struct {
+	RedactColumns  []string `mapstructure:"redact_columns"`  // columns whose values are replaced with [REDACTED]
+	RedactPatterns []string `mapstructure:"redact_patterns"` // regexes to replace with [REDACTED], on top of the built-in email and SSN patterns
+	MaxLength      int      `mapstructure:"max_length"`      // the redacted text is truncated to this many characters; defaults to 1024
+	Enabled        bool     `mapstructure:"enabled"`
+}
+
+// QueryTagsConfig configures the parsing of marginalia (/* controller:books */) and sqlcommenter
+// (/* controller='books' */) tags out of the live query text of the processes the snipers kill.
+type QueryTagsConfig struct {
+	MetricLabels []string `mapstructure:"metric_labels"` // tag keys counted by query_sniper_tagged_processes_killed_total; keep them low cardinality
+	Enabled      bool     `mapstructure:"enabled"`
+}
+
+// queryHintsCommentKey matches the comment keys that query_hints accept. The key is matched in the hunter
+// query with LIKE, so it's limited to characters that need no escaping there.
+var queryHintsCommentKey = regexp.MustCompile(`^\w[\w.\-]*$`)
+
+// perRequestTags are the marginalia and sqlcommenter tags whose values are unique to each request or
+// job, so they can't be metric labels.
+var perRequestTags = []string{"traceparent", "tracestate", "request_id", "job_id", "line"}
+
+// validate checks that the metric labels are set, and aren't tags with a value per request.
+func (config QueryTagsConfig) validate() error {
+	for _, label := range config.MetricLabels {
+		if strings.TrimSpace(label) == "" {
+			return fmt.Errorf("%w: metric_labels must not be empty", ErrInvalidQueryTags)
+		}
+
+		if slices.Contains(perRequestTags, strings.ToLower(label)) {
+			return fmt.Errorf("%w: %s has a value per request, so it can't be one of the metric_labels", ErrInvalidQueryTags, label)
+		}
+	}
+
+	return nil
+}
+
 // Config struct to hold the viper config. This is sorted by datatype to satisfy the fieldalignment linter rule.
 type Config struct {
-	Databases map[string]struct {
-		Address              string        `mapstructure:"address"`
-		Schema               string        `mapstructure:"schema"` // TODO(kuzmik): add support for multiple schemas.
-		SSLCert              string        `mapstructure:"ssl_cert"`
-		SSLKey               string        `mapstructure:"ssl_key"`
-		SSLCA                string        `mapstructure:"ssl_ca"`
-		Username             string        `mapstructure:"username"`
-		Password             string        `mapstructure:"password"`
-		Interval             time.Duration `mapstructure:"interval"`
-		LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-		LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-		Port                 int           `mapstructure:"port"`
-		DryRun               bool          `mapstructure:"dry_run"`
-	} `mapstructure:"databases"`
-	CredentialFile string `mapstructure:"credential_file"`
-	Log            struct {
+	Databases      map[string]DatabaseConfig `mapstructure:"databases"`
+	CredentialFile string                    `mapstructure:"credential_file"`
+	Admin          struct {
+		Tokens      map[string]string `mapstructure:"tokens"`       // bearer tokens by caller name; the name is the caller's identity in the audit log
+		Address     string            `mapstructure:"address"`      // address for the admin API; disabled if empty
+		AllowRemote bool              `mapstructure:"allow_remote"` // allow the admin API to listen on a non-loopback address
+	} `mapstructure:"admin"`
+	HTTP struct {
+		Address        string `mapstructure:"address"`         // address for the HTTP server (/metrics, /healthz, /readyz and /status); disabled if empty
+		ReadyIntervals int    `mapstructure:"ready_intervals"` // intervals a sniper may go without a successful hunt before /readyz fails; defaults to 3
+	} `mapstructure:"http"`
+	Log struct {
 		Format        string `mapstructure:"format"`
 		Level         string `mapstructure:"level"`
 		IncludeCaller bool   `mapstructure:"include_caller"`
 	} `mapstructure:"log"`
-	SafeMode bool `mapstructure:"safe-mode"`
+	Notifications struct {
+		Webhooks  map[string]WebhookConfig `mapstructure:"webhooks"`
+		Datadog   DatadogConfig            `mapstructure:"datadog"`
+		Slack     SlackConfig              `mapstructure:"slack"`
+		PagerDuty PagerDutyConfig          `mapstructure:"pagerduty"`
+	} `mapstructure:"notifications"`
+	QueryText      QueryTextConfig     `mapstructure:"query_text"`     // log the redacted pl.info of killed processes
+	QueryTags      QueryTagsConfig     `mapstructure:"query_tags"`     // parse marginalia and sqlcommenter tags out of pl.info
+	AuditDatabase  AuditDatabaseConfig `mapstructure:"audit_database"` // record every detection and kill in query_sniper.kill_events; disabled if neither database nor dsn is set
+	Audit          AuditConfig         `mapstructure:"audit"`
+	SafeMode       bool                `mapstructure:"safe-mode"`
+	LeaderElection bool                `mapstructure:"leader_election"` // only the replica holding a database's GET_LOCK lock kills on it
+}
+
+// DSN builds the go-sql-driver/mysql DSN for the database.
+func (config DatabaseConfig) DSN() string {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/", config.Username, config.Password, config.Address, config.Port)
+
+	// Configure SSL/TLS based on provided certificates:
+	// - CA-only mode: Just ssl_ca for encrypted connections without client auth
+	// - Mutual TLS mode: All three (ssl_ca, ssl_cert, ssl_key) for mutual authentication
+	// - Invalid partial combinations (cert without CA, etc.) are ignored
+	if config.SSLCA != "" && config.SSLCert == "" && config.SSLKey == "" {
+		// CA-only mode: Basic encrypted connection
+		dsn += "?tls=true&tls_ca=" + config.SSLCA
+	} else if config.SSLCert != "" && config.SSLKey != "" && config.SSLCA != "" {
+		// Mutual TLS mode: Full mutual authentication
+		dsn += fmt.Sprintf("?tls=true&tls_cert=%s&tls_key=%s&tls_ca=%s", config.SSLCert, config.SSLKey, config.SSLCA)
+	}
+
+	return dsn
+}
+
+// maxLockNameLength is the longest name MySQL allows for a GET_LOCK lock.
+const maxLockNameLength = 64
+
+// LeaderLockName returns the name of the GET_LOCK lock that the replicas of the sniper for the named
+// database elect their leader with.
+func LeaderLockName(database string) string {
+	return "query_sniper:" + database
 }
 
 // Configure loads the configuration from the specified file, and merges the
 // credentials file into the configuration.
+//
+// Configure is also called to reload the configuration on SIGHUP, so it must be safe to
+// call more than once.
 func Configure() (*Config, error) {
+	// start from a clean slate, otherwise a reload would read the credentials file
+	// (the last config file set below) in place of the main config file.
+	viper.Reset()
+
 	if file := os.Getenv("SNIPER_CONFIG_FILE"); file != "" {
 		// if the config file path is specified in the env, load that
 		viper.SetConfigFile(file)
@@ -64,12 +345,10 @@ func Configure() (*Config, error) {
 		viper.AddConfigPath("configs")
 	}
 
-	// setup the pflags for the application.
-	pflag.Bool("show-config", false, "Show the config; valid values are [true OR false], defaults to false")
-	pflag.Bool("safe-mode", false, "Enable safe mode globally, and will override all database dry_run settings; valid values are [true OR false], defaults to false")
-	pflag.Bool("log.include_caller", false, "Include the caller in the logs; valid values are [true OR false], defaults to false")
-	pflag.String("log.format", "JSON", "Format of the logs; valid values are [JSON OR TEXT], defaults to JSON")
-	pflag.String("log.level", "INFO", "the log level for the agent; valid values are [TRACE, DEBUG, INFO, WARN, ERROR, FATAL], defaults to INFO")
+	// setup the pflags for the application; they can only be defined once, so skip this on reloads.
+	if pflag.Lookup("show-config") == nil {
+		defineFlags()
+	}
 
 	// read the config file, or return an error if it doesn't exist.
 	err := viper.ReadInConfig()
@@ -117,6 +396,7 @@ func Configure() (*Config, error) {
 	// if the show-config flag is set, dump the redacted config and exit.
 	if viper.GetBool("show-config") {
 		godump.Dump(settings.Redact())
+		godump.Dump(map[string]any{"active_profiles": settings.ActiveProfiles(time.Now())})
 
 		os.Exit(0)
 	}
@@ -133,25 +413,21 @@ func Configure() (*Config, error) {
 	return settings, nil
 }
 
+// defineFlags sets up the pflags for the application.
+func defineFlags() {
+	pflag.Bool("show-config", false, "Show the config; valid values are [true OR false], defaults to false")
+	pflag.Bool("safe-mode", false, "Enable safe mode globally, and will override all database dry_run settings; valid values are [true OR false], defaults to false")
+	pflag.Bool("log.include_caller", false, "Include the caller in the logs; valid values are [true OR false], defaults to false")
+	pflag.String("log.format", "JSON", "Format of the logs; valid values are [JSON OR TEXT], defaults to JSON")
+	pflag.String("log.level", "INFO", "the log level for the agent; valid values are [TRACE, DEBUG, INFO, WARN, ERROR, FATAL], defaults to INFO")
+}
+
 // Redact returns a copy of *Config, but in its place returns a copy of the config with
 // the password redacted, for use when dumping the config to the console.
 func (settings *Config) Redact() Config {
 	redacted := *settings
 
-	redacted.Databases = make(map[string]struct {
-		Address              string        `mapstructure:"address"`
-		Schema               string        `mapstructure:"schema"`
-		SSLCert              string        `mapstructure:"ssl_cert"`
-		SSLKey               string        `mapstructure:"ssl_key"`
-		SSLCA                string        `mapstructure:"ssl_ca"`
-		Username             string        `mapstructure:"username"`
-		Password             string        `mapstructure:"password"`
-		Interval             time.Duration `mapstructure:"interval"`
-		LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-		LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-		Port                 int           `mapstructure:"port"`
-		DryRun               bool          `mapstructure:"dry_run"`
-	})
+	redacted.Databases = make(map[string]DatabaseConfig)
 
 	for name, db := range settings.Databases {
 		dbCopy := db
@@ -159,6 +435,46 @@ func (settings *Config) Redact() Config {
 		redacted.Databases[name] = dbCopy
 	}
 
+	if redacted.Notifications.Slack.WebhookURL != "" {
+		redacted.Notifications.Slack.WebhookURL = "[REDACTED]"
+	}
+
+	if len(settings.Notifications.Webhooks) > 0 {
+		redacted.Notifications.Webhooks = make(map[string]WebhookConfig, len(settings.Notifications.Webhooks))
+		for name, webhook := range settings.Notifications.Webhooks {
+			if webhook.Secret != "" {
+				webhook.Secret = "[REDACTED]"
+			}
+
+			// headers usually carry an API key or basic auth, so none of their values are shown.
+			if len(webhook.Headers) > 0 {
+				headers := make(map[string]string, len(webhook.Headers))
+				for header := range webhook.Headers {
+					headers[header] = "[REDACTED]"
+				}
+
+				webhook.Headers = headers
+			}
+
+			redacted.Notifications.Webhooks[name] = webhook
+		}
+	}
+
+	if redacted.Notifications.PagerDuty.RoutingKey != "" {
+		redacted.Notifications.PagerDuty.RoutingKey = "[REDACTED]"
+	}
+
+	if redacted.AuditDatabase.DSN != "" {
+		redacted.AuditDatabase.DSN = "[REDACTED]"
+	}
+
+	if len(settings.Admin.Tokens) > 0 {
+		redacted.Admin.Tokens = make(map[string]string, len(settings.Admin.Tokens))
+		for caller := range settings.Admin.Tokens {
+			redacted.Admin.Tokens[caller] = "[REDACTED]"
+		}
+	}
+
 	return redacted
 }
 
@@ -167,6 +483,62 @@ func (settings *Config) Validate() error {
 		return ErrNoDatabasesConfigured
 	}
 
+	err := validateWebhookURL(settings.Notifications.Slack.WebhookURL)
+	if err != nil {
+		return fmt.Errorf("notifications.slack.webhook_url is invalid: %w", err)
+	}
+
+	err = settings.Notifications.PagerDuty.validate()
+	if err != nil {
+		return fmt.Errorf("notifications.pagerduty is invalid: %w", err)
+	}
+
+	for name, webhook := range settings.Notifications.Webhooks {
+		err = webhook.validate()
+		if err != nil {
+			return fmt.Errorf("notifications.webhooks.%s is invalid: %w", name, err)
+		}
+	}
+
+	err = settings.Audit.File.validate()
+	if err != nil {
+		return fmt.Errorf("audit.file is invalid: %w", err)
+	}
+
+	// the query_text patterns and columns also redact the query tags.
+	if settings.QueryText.Enabled || settings.QueryTags.Enabled {
+		_, err = redact.New(settings.QueryText.RedactColumns, settings.QueryText.RedactPatterns, settings.QueryText.MaxLength)
+		if err != nil {
+			return fmt.Errorf("query_text is invalid: %w: %w", ErrInvalidQueryText, err)
+		}
+	}
+
+	err = settings.QueryTags.validate()
+	if err != nil {
+		return fmt.Errorf("query_tags is invalid: %w", err)
+	}
+
+	err = settings.validateAuditDatabase()
+	if err != nil {
+		return fmt.Errorf("audit_database is invalid: %w", err)
+	}
+
+	err = settings.validateAdmin()
+	if err != nil {
+		return fmt.Errorf("admin is invalid: %w", err)
+	}
+
+	if settings.HTTP.ReadyIntervals < 0 {
+		return fmt.Errorf("http.ready_intervals is invalid: %w: must not be negative", ErrInvalidReadyIntervals)
+	}
+
+	if address := settings.Notifications.Datadog.Address; address != "" {
+		_, _, err = net.SplitHostPort(address)
+		if err != nil {
+			return fmt.Errorf("notifications.datadog.address is invalid: %w: %w", ErrInvalidDatadogAddress, err)
+		}
+	}
+
 	for name, db := range settings.Databases {
 		if db.Username == "" {
 			return fmt.Errorf("username is missing for database %s: %w", name, ErrEmptyUsername)
@@ -200,6 +572,39 @@ func (settings *Config) Validate() error {
 			return fmt.Errorf("long_transaction_limit %d is invalid for database %s: %w", db.LongTransactionLimit, name, ErrInvalidTransactionLimit)
 		}
 
+		if settings.LeaderElection && len(LeaderLockName(name)) > maxLockNameLength {
+			return fmt.Errorf("lock name %s for database %s is longer than %d characters, use a shorter database name: %w",
+				LeaderLockName(name), name, maxLockNameLength, ErrInvalidLeaderLock)
+		}
+
+		if db.LockWaitLimit < 0 {
+			return fmt.Errorf("lock_wait_limit %d is invalid for database %s: %w", db.LockWaitLimit, name, ErrInvalidLockWaitLimit)
+		}
+
+		if db.MaxKillsPerMinute < 0 || db.BreakerCooldown < 0 {
+			return fmt.Errorf("max_kills_per_minute %d or breaker_cooldown %s is invalid for database %s: %w",
+				db.MaxKillsPerMinute, db.BreakerCooldown, name, ErrInvalidKillBudget)
+		}
+
+		if db.RequiredSightings < 0 {
+			return fmt.Errorf("required_sightings %d is invalid for database %s: %w", db.RequiredSightings, name, ErrInvalidSightings)
+		}
+
+		if db.IdleTransactionLimit < 0 {
+			return fmt.Errorf("idle_transaction_limit %d is invalid for database %s: %w", db.IdleTransactionLimit, name, ErrInvalidIdleTxnLimit)
+		}
+
+		if db.MetadataLockLimit < 0 {
+			return fmt.Errorf("metadata_lock_limit %d is invalid for database %s: %w", db.MetadataLockLimit, name, ErrInvalidMetadataLock)
+		}
+
+		switch db.MetadataLockAction {
+		case "", MetadataLockActionKillWaiter, MetadataLockActionKillHolder:
+		default:
+			return fmt.Errorf("metadata_lock_action %q is invalid for database %s, must be %s or %s: %w",
+				db.MetadataLockAction, name, MetadataLockActionKillWaiter, MetadataLockActionKillHolder, ErrInvalidMetadataLock)
+		}
+
 		// Validate SSL certificate configuration
 		sslCA := db.SSLCA != ""
 		sslCert := db.SSLCert != ""
@@ -221,6 +626,312 @@ func (settings *Config) Validate() error {
 				"(3) all three (ssl_ca, ssl_cert, ssl_key) for mutual TLS",
 				name, ErrInvalidSSLConfig)
 		}
+
+		if db.QueryHints.Enabled && db.QueryHints.MaxLimit <= 0 {
+			return fmt.Errorf("query_hints.max_limit %d is invalid for database %s, it must be set when query_hints are enabled: %w",
+				db.QueryHints.MaxLimit, name, ErrInvalidQueryHintsLimit)
+		}
+
+		if db.QueryHints.CommentKey != "" && !queryHintsCommentKey.MatchString(db.QueryHints.CommentKey) {
+			return fmt.Errorf("query_hints.comment_key %q is invalid for database %s, it may only contain letters, digits, _, . and -: %w",
+				db.QueryHints.CommentKey, name, ErrInvalidQueryHintsKey)
+		}
+
+		err = db.Adaptive.validate()
+		if err != nil {
+			return fmt.Errorf("adaptive is invalid for database %s: %w", name, err)
+		}
+
+		for i, profile := range db.Schedules {
+			err = profile.validate()
+			if err != nil {
+				return fmt.Errorf("schedule %d (%s) is invalid for database %s: %w", i, profile.Name, name, err)
+			}
+		}
+
+		for i, rule := range db.Rules {
+			err = rule.validate()
+			if err != nil {
+				return fmt.Errorf("rule %d (%s) is invalid for database %s: %w", i, rule.Name, name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validate checks that the rule's action, digest regex and limits are valid.
+func (rule Rule) validate() error {
+	switch rule.Action {
+	case "", RuleActionKillQuery, RuleActionKillConnection, RuleActionLog:
+	default:
+		return fmt.Errorf("action %q must be one of %s, %s or %s: %w",
+			rule.Action, RuleActionKillQuery, RuleActionKillConnection, RuleActionLog, ErrInvalidRuleAction)
+	}
+
+	if rule.Digest != "" {
+		_, err := regexp.Compile(rule.Digest)
+		if err != nil {
+			return fmt.Errorf("digest %q: %w: %w", rule.Digest, ErrInvalidRuleDigest, err)
+		}
+	}
+
+	if rule.LongQueryLimit < 0 || rule.LongTransactionLimit < 0 {
+		return fmt.Errorf("long_query_limit %v and long_transaction_limit %v can't be negative: %w",
+			rule.LongQueryLimit, rule.LongTransactionLimit, ErrInvalidRuleLimit)
+	}
+
+	return nil
+}
+
+// validate checks that the adaptive curve has steps when it's enabled, and that every step has a
+// threshold and a scale that lowers the limits.
+func (adaptive AdaptiveConfig) validate() error {
+	if adaptive.MinLimit < 0 {
+		return fmt.Errorf("min_limit %v can't be negative: %w", adaptive.MinLimit, ErrInvalidAdaptive)
+	}
+
+	if adaptive.Enabled && len(adaptive.Steps) == 0 {
+		return fmt.Errorf("steps must be set when adaptive is enabled: %w", ErrInvalidAdaptive)
+	}
+
+	for i, step := range adaptive.Steps {
+		if step.Scale <= 0 || step.Scale > 1 {
+			return fmt.Errorf("step %d scale %v must be greater than 0 and at most 1: %w", i, step.Scale, ErrInvalidAdaptive)
+		}
+
+		if step.ThreadsRunning < 0 || step.RowLockWaits < 0 || (step.ThreadsRunning == 0 && step.RowLockWaits == 0) {
+			return fmt.Errorf("step %d needs a positive threads_running or row_lock_waits threshold: %w", i, ErrInvalidAdaptive)
+		}
+	}
+
+	return nil
+}
+
+// validate checks that the schedule has a name, a valid window and no negative limits.
+func (profile ScheduleConfig) validate() error {
+	if profile.Name == "" || profile.Name == DefaultProfile {
+		return fmt.Errorf("name %q must be set, and can't be %s: %w", profile.Name, DefaultProfile, ErrInvalidSchedule)
+	}
+
+	_, err := profile.Window()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSchedule, err)
+	}
+
+	if profile.LongQueryLimit < 0 || profile.LongTransactionLimit < 0 {
+		return fmt.Errorf("long_query_limit %v and long_transaction_limit %v can't be negative: %w",
+			profile.LongQueryLimit, profile.LongTransactionLimit, ErrInvalidSchedule)
+	}
+
+	return nil
+}
+
+// Window returns the schedule's window.
+func (profile ScheduleConfig) Window() (schedule.Window, error) {
+	window, err := schedule.NewWindow(profile.Cron, profile.Timezone, profile.Duration)
+	if err != nil {
+		return schedule.Window{}, fmt.Errorf("error parsing the window: %w", err)
+	}
+
+	return window, nil
+}
+
+// ActiveProfiles returns the name of the active profile of every database at the given time, for
+// --show-config.
+func (settings *Config) ActiveProfiles(now time.Time) map[string]string {
+	active := make(map[string]string, len(settings.Databases))
+
+	for name, db := range settings.Databases {
+		active[name] = DefaultProfile
+
+		for _, config := range db.Schedules {
+			window, err := config.Window()
+			if err != nil {
+				active[name] = fmt.Sprintf("invalid schedule %s: %v", config.Name, err)
+
+				break
+			}
+
+			if window.Active(now) {
+				active[name] = config.Name
+
+				break
+			}
+		}
+	}
+
+	return active
+}
+
+// validate checks that the audit log's rotation settings aren't negative.
+func (config AuditFileConfig) validate() error {
+	if config.MaxAge < 0 {
+		return fmt.Errorf("%w: max_age must not be negative", ErrInvalidAuditConfig)
+	}
+
+	if config.MaxSizeMB < 0 {
+		return fmt.Errorf("%w: max_size_mb must not be negative", ErrInvalidAuditConfig)
+	}
+
+	if config.MaxBackups < 0 {
+		return fmt.Errorf("%w: max_backups must not be negative", ErrInvalidAuditConfig)
+	}
+
+	return nil
+}
+
+// validateAuditDatabase checks that the audit database, if enabled, is either one of the databases or
+// a DSN that parses, and that its buffer settings aren't negative.
+func (settings *Config) validateAuditDatabase() error {
+	config := settings.AuditDatabase
+
+	if !config.Enabled() {
+		return nil
+	}
+
+	if config.Database != "" && config.DSN != "" {
+		return fmt.Errorf("%w: only one of database and dsn can be set", ErrInvalidAuditDatabase)
+	}
+
+	if _, ok := settings.Databases[config.Database]; config.Database != "" && !ok {
+		return fmt.Errorf("%w: database %s isn't configured", ErrInvalidAuditDatabase, config.Database)
+	}
+
+	if config.DSN != "" {
+		// don't wrap the parse error; it can include the password.
+		_, err := mysql.ParseDSN(config.DSN)
+		if err != nil {
+			return fmt.Errorf("%w: dsn doesn't parse", ErrInvalidAuditDatabase)
+		}
+	}
+
+	if config.FlushInterval < 0 || config.BufferSize < 0 || config.SpillMaxSizeMB < 0 {
+		return fmt.Errorf("%w: flush_interval, buffer_size and spill_max_size_mb must not be negative", ErrInvalidAuditDatabase)
+	}
+
+	return nil
+}
+
+// AuditDSN returns the DSN of the audit database: its own DSN, or that of the database it names.
+func (settings *Config) AuditDSN() string {
+	if settings.AuditDatabase.DSN != "" {
+		return settings.AuditDatabase.DSN
+	}
+
+	return settings.Databases[settings.AuditDatabase.Database].DSN()
+}
+
+// validateAdmin checks that the admin API, if enabled, has a valid address and at least one token,
+// and that none of its tokens are empty. The address must be a loopback address unless allow_remote
+// is set, since anyone who can reach the API with a token can stop the snipers.
+func (settings *Config) validateAdmin() error {
+	if settings.Admin.Address == "" {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(settings.Admin.Address)
+	if err != nil {
+		return fmt.Errorf("%w: address: %w", ErrInvalidAdminConfig, err)
+	}
+
+	if !settings.Admin.AllowRemote && !isLoopback(host) {
+		return fmt.Errorf("%w: address %s isn't a loopback address; set allow_remote to listen on it", ErrInvalidAdminConfig, settings.Admin.Address)
+	}
+
+	if len(settings.Admin.Tokens) == 0 {
+		return fmt.Errorf("%w: at least one token is required", ErrInvalidAdminConfig)
+	}
+
+	for caller, token := range settings.Admin.Tokens {
+		if token == "" {
+			return fmt.Errorf("%w: the token of %s is empty", ErrInvalidAdminConfig, caller)
+		}
+	}
+
+	return nil
+}
+
+// isLoopback returns whether the host is localhost or a loopback IP. An empty host listens on every
+// interface, so it isn't.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
+
+// validateWebhookURL checks that a webhook URL, if set, is an absolute http(s) URL.
+func validateWebhookURL(webhookURL string) error {
+	if webhookURL == "" {
+		return nil
+	}
+
+	parsed, err := url.Parse(webhookURL)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidWebhookURL, err)
+	}
+
+	if (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return fmt.Errorf("%w: must be an absolute http or https URL", ErrInvalidWebhookURL)
+	}
+
+	return nil
+}
+
+func (config PagerDutyConfig) validate() error {
+	if config.RoutingKey == "" {
+		return nil
+	}
+
+	if config.KillThreshold <= 0 {
+		return fmt.Errorf("%w: kill_threshold must be greater than zero", ErrInvalidKillThreshold)
+	}
+
+	if config.Window < 0 {
+		return fmt.Errorf("%w: window must not be negative", ErrInvalidKillThreshold)
+	}
+
+	switch config.Severity {
+	case "", "critical", "error", "warning", "info":
+		return nil
+	default:
+		return fmt.Errorf("%w: %q must be one of critical, error, warning or info", ErrInvalidSeverity, config.Severity)
+	}
+}
+
+// WebhookTemplateFuncs are the functions available to the webhook payload templates. They're defined
+// here, rather than in the notify package, so that validation parses the templates with the same ones.
+var WebhookTemplateFuncs = template.FuncMap{
+	"json": func(value any) (string, error) {
+		encoded, err := json.Marshal(value)
+
+		return string(encoded), err
+	},
+}
+
+func (config WebhookConfig) validate() error {
+	if config.URL == "" {
+		return fmt.Errorf("%w: url is required", ErrInvalidWebhookURL)
+	}
+
+	err := validateWebhookURL(config.URL)
+	if err != nil {
+		return err
+	}
+
+	if (config.MaxRetries != nil && *config.MaxRetries < 0) || config.RetryBackoff < 0 {
+		return fmt.Errorf("%w: max_retries and retry_backoff must not be negative", ErrInvalidWebhookRetries)
+	}
+
+	if config.Template != "" {
+		_, err = template.New("webhook").Funcs(WebhookTemplateFuncs).Parse(config.Template)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidWebhookTemplate, err)
+		}
 	}
 
 	return nil
@@ -4,8 +4,10 @@ package configuration
 import (
 	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -603,6 +605,19 @@ func TestConfigFile(t *testing.T) {
 				if got := replica.Password; got != "replica_pass" {
 					t.Errorf("Replica DB Password = %v, want %v", got, "replica_pass")
 				}
+
+				analytics := config.Databases["test_analytics"]
+				if got := len(analytics.Rules); got != 2 {
+					t.Fatalf("Analytics DB Rules = %v, want 2 rules", got)
+				}
+
+				if got := analytics.Rules[0].LongQueryLimit; got != 600*time.Second {
+					t.Errorf("Analytics DB Rules[0].LongQueryLimit = %v, want %v", got, 600*time.Second)
+				}
+
+				if got := analytics.Rules[1]; got.Digest != "^ALTER TABLE" || !got.Exempt {
+					t.Errorf("Analytics DB Rules[1] = %+v, want an exempt rule with digest ^ALTER TABLE", got)
+				}
 			},
 		},
 	}
@@ -644,6 +659,138 @@ func TestConfigFile(t *testing.T) {
 	}
 }
 
+func TestConfigure_Reload(t *testing.T) {
+	viper.Reset()
+
+	// Reset pflags to avoid "flag redefined" errors from the other tests
+	originalCommandLine := pflag.CommandLine
+	pflag.CommandLine = pflag.NewFlagSet(os.Args[0], pflag.ExitOnError)
+
+	t.Cleanup(func() {
+		pflag.CommandLine = originalCommandLine
+	})
+
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.yaml")
+	credsPath := filepath.Join(tempDir, "creds.yaml")
+
+	writeFile := func(path string, content string) {
+		t.Helper()
+
+		err := os.WriteFile(path, []byte(content), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the credentials file is only referenced from the config file, so a reload has to find
+	// the config file again rather than re-reading the last file viper loaded.
+	writeFile(configPath, fmt.Sprintf(`
+credential_file: %s
+databases:
+  primary:
+    address: 127.0.0.1
+    port: 3306
+    schema: test_db
+    interval: 30s
+    long_query_limit: 60s
+`, credsPath))
+
+	//nolint:gosec
+	writeFile(credsPath, `
+databases:
+  primary:
+    username: test_user
+    password: test_pass
+`)
+
+	t.Setenv("SNIPER_CONFIG_FILE", configPath)
+
+	config, err := Configure()
+	if err != nil {
+		t.Fatalf("Configure() unexpected error = %v", err)
+	}
+
+	if got := config.Databases["primary"].LongQueryLimit; got != 60*time.Second {
+		t.Errorf("Configure() primary LongQueryLimit = %v, want 60s", got)
+	}
+
+	writeFile(configPath, fmt.Sprintf(`
+credential_file: %s
+databases:
+  primary:
+    address: 127.0.0.1
+    port: 3306
+    schema: test_db
+    interval: 30s
+    long_query_limit: 5s
+  replica:
+    address: 127.0.0.1
+    port: 3307
+    schema: test_db
+    interval: 30s
+    long_query_limit: 60s
+`, credsPath))
+
+	//nolint:gosec
+	writeFile(credsPath, `
+databases:
+  primary:
+    username: test_user
+    password: test_pass
+  replica:
+    username: replica_user
+    password: replica_pass
+`)
+
+	config, err = Configure()
+	if err != nil {
+		t.Fatalf("Configure() on reload unexpected error = %v", err)
+	}
+
+	if got := config.Databases["primary"].LongQueryLimit; got != 5*time.Second {
+		t.Errorf("Configure() on reload primary LongQueryLimit = %v, want 5s", got)
+	}
+
+	if got := config.Databases["replica"].Username; got != "replica_user" {
+		t.Errorf("Configure() on reload replica Username = %v, want replica_user", got)
+	}
+}
+
+func TestActiveProfiles(t *testing.T) {
+	t.Parallel()
+
+	settings := &Config{
+		Databases: map[string]DatabaseConfig{
+			"primary": {
+				Schedules: []ScheduleConfig{
+					{Name: "nightly-batch", Cron: "0 1 * * *", Timezone: "America/New_York", Duration: 4 * time.Hour},
+					{Name: "always", Cron: "* * * * *", Duration: time.Minute},
+				},
+			},
+			"replica": {
+				Schedules: []ScheduleConfig{
+					{Name: "new-years-day", Cron: "0 0 1 1 *", Duration: 24 * time.Hour},
+				},
+			},
+			"unscheduled": {},
+		},
+	}
+
+	// 02:00 in New York.
+	got := settings.ActiveProfiles(time.Date(2025, time.June, 2, 6, 0, 0, 0, time.UTC))
+
+	want := map[string]string{
+		"primary":     "nightly-batch",
+		"replica":     DefaultProfile,
+		"unscheduled": DefaultProfile,
+	}
+
+	if !maps.Equal(got, want) {
+		t.Errorf("ActiveProfiles() = %v, want %v", got, want)
+	}
+}
+
 func TestConfigure_ShowConfig(t *testing.T) {
 	// Note: The show-config flag causes os.Exit(0) which makes it difficult to test
 	// in a unit test environment. In a real scenario, you would use subprocess testing
@@ -666,20 +813,7 @@ func TestConfig_Redact(t *testing.T) {
 			Level:         "INFO",
 			IncludeCaller: true,
 		},
-		Databases: map[string]struct {
-			Address              string        `mapstructure:"address"`
-			Schema               string        `mapstructure:"schema"`
-			SSLCert              string        `mapstructure:"ssl_cert"`
-			SSLKey               string        `mapstructure:"ssl_key"`
-			SSLCA                string        `mapstructure:"ssl_ca"`
-			Username             string        `mapstructure:"username"`
-			Password             string        `mapstructure:"password"`
-			Interval             time.Duration `mapstructure:"interval"`
-			LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-			LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-			Port                 int           `mapstructure:"port"`
-			DryRun               bool          `mapstructure:"dry_run"`
-		}{
+		Databases: map[string]DatabaseConfig{
 			"primary": {
 				Address:              "127.0.0.1",
 				Schema:               "test_db",
@@ -803,20 +937,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "valid configuration",
 			config: &Config{
-				Databases: map[string]struct {
-					Address              string        `mapstructure:"address"`
-					Schema               string        `mapstructure:"schema"`
-					SSLCert              string        `mapstructure:"ssl_cert"`
-					SSLKey               string        `mapstructure:"ssl_key"`
-					SSLCA                string        `mapstructure:"ssl_ca"`
-					Username             string        `mapstructure:"username"`
-					Password             string        `mapstructure:"password"`
-					Interval             time.Duration `mapstructure:"interval"`
-					LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-					LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-					Port                 int           `mapstructure:"port"`
-					DryRun               bool          `mapstructure:"dry_run"`
-				}{
+				Databases: map[string]DatabaseConfig{
 					"primary": {
 						Address:              "127.0.0.1",
 						Schema:               "test_db",
@@ -842,20 +963,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "empty username",
 			config: &Config{
-				Databases: map[string]struct {
-					Address              string        `mapstructure:"address"`
-					Schema               string        `mapstructure:"schema"`
-					SSLCert              string        `mapstructure:"ssl_cert"`
-					SSLKey               string        `mapstructure:"ssl_key"`
-					SSLCA                string        `mapstructure:"ssl_ca"`
-					Username             string        `mapstructure:"username"`
-					Password             string        `mapstructure:"password"`
-					Interval             time.Duration `mapstructure:"interval"`
-					LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-					LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-					Port                 int           `mapstructure:"port"`
-					DryRun               bool          `mapstructure:"dry_run"`
-				}{
+				Databases: map[string]DatabaseConfig{
 					"primary": {
 						Address:              "127.0.0.1",
 						Port:                 3306,
@@ -875,20 +983,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "empty password",
 			config: &Config{
-				Databases: map[string]struct {
-					Address              string        `mapstructure:"address"`
-					Schema               string        `mapstructure:"schema"`
-					SSLCert              string        `mapstructure:"ssl_cert"`
-					SSLKey               string        `mapstructure:"ssl_key"`
-					SSLCA                string        `mapstructure:"ssl_ca"`
-					Username             string        `mapstructure:"username"`
-					Password             string        `mapstructure:"password"`
-					Interval             time.Duration `mapstructure:"interval"`
-					LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-					LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-					Port                 int           `mapstructure:"port"`
-					DryRun               bool          `mapstructure:"dry_run"`
-				}{
+				Databases: map[string]DatabaseConfig{
 					"primary": {
 						Address:              "127.0.0.1",
 						Port:                 3306,
@@ -908,20 +1003,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "empty address",
 			config: &Config{
-				Databases: map[string]struct {
-					Address              string        `mapstructure:"address"`
-					Schema               string        `mapstructure:"schema"`
-					SSLCert              string        `mapstructure:"ssl_cert"`
-					SSLKey               string        `mapstructure:"ssl_key"`
-					SSLCA                string        `mapstructure:"ssl_ca"`
-					Username             string        `mapstructure:"username"`
-					Password             string        `mapstructure:"password"`
-					Interval             time.Duration `mapstructure:"interval"`
-					LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-					LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-					Port                 int           `mapstructure:"port"`
-					DryRun               bool          `mapstructure:"dry_run"`
-				}{
+				Databases: map[string]DatabaseConfig{
 					"primary": {
 						Address:              "", // empty address
 						Schema:               "test_db",
@@ -940,20 +1022,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "invalid port - zero",
 			config: &Config{
-				Databases: map[string]struct {
-					Address              string        `mapstructure:"address"`
-					Schema               string        `mapstructure:"schema"`
-					SSLCert              string        `mapstructure:"ssl_cert"`
-					SSLKey               string        `mapstructure:"ssl_key"`
-					SSLCA                string        `mapstructure:"ssl_ca"`
-					Username             string        `mapstructure:"username"`
-					Password             string        `mapstructure:"password"`
-					Interval             time.Duration `mapstructure:"interval"`
-					LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-					LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-					Port                 int           `mapstructure:"port"`
-					DryRun               bool          `mapstructure:"dry_run"`
-				}{
+				Databases: map[string]DatabaseConfig{
 					"primary": {
 						Address:              "127.0.0.1",
 						Schema:               "test_db",
@@ -973,20 +1042,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "empty schema",
 			config: &Config{
-				Databases: map[string]struct {
-					Address              string        `mapstructure:"address"`
-					Schema               string        `mapstructure:"schema"`
-					SSLCert              string        `mapstructure:"ssl_cert"`
-					SSLKey               string        `mapstructure:"ssl_key"`
-					SSLCA                string        `mapstructure:"ssl_ca"`
-					Username             string        `mapstructure:"username"`
-					Password             string        `mapstructure:"password"`
-					Interval             time.Duration `mapstructure:"interval"`
-					LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-					LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-					Port                 int           `mapstructure:"port"`
-					DryRun               bool          `mapstructure:"dry_run"`
-				}{
+				Databases: map[string]DatabaseConfig{
 					"primary": {
 						Address:              "127.0.0.1",
 						Port:                 3306,
@@ -1006,20 +1062,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "invalid interval",
 			config: &Config{
-				Databases: map[string]struct {
-					Address              string        `mapstructure:"address"`
-					Schema               string        `mapstructure:"schema"`
-					SSLCert              string        `mapstructure:"ssl_cert"`
-					SSLKey               string        `mapstructure:"ssl_key"`
-					SSLCA                string        `mapstructure:"ssl_ca"`
-					Username             string        `mapstructure:"username"`
-					Password             string        `mapstructure:"password"`
-					Interval             time.Duration `mapstructure:"interval"`
-					LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-					LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-					Port                 int           `mapstructure:"port"`
-					DryRun               bool          `mapstructure:"dry_run"`
-				}{
+				Databases: map[string]DatabaseConfig{
 					"primary": {
 						Address:              "127.0.0.1",
 						Port:                 3306,
@@ -1039,20 +1082,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "invalid query limit",
 			config: &Config{
-				Databases: map[string]struct {
-					Address              string        `mapstructure:"address"`
-					Schema               string        `mapstructure:"schema"`
-					SSLCert              string        `mapstructure:"ssl_cert"`
-					SSLKey               string        `mapstructure:"ssl_key"`
-					SSLCA                string        `mapstructure:"ssl_ca"`
-					Username             string        `mapstructure:"username"`
-					Password             string        `mapstructure:"password"`
-					Interval             time.Duration `mapstructure:"interval"`
-					LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-					LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-					Port                 int           `mapstructure:"port"`
-					DryRun               bool          `mapstructure:"dry_run"`
-				}{
+				Databases: map[string]DatabaseConfig{
 					"primary": {
 						Address:              "127.0.0.1",
 						Port:                 3306,
@@ -1072,20 +1102,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "invalid transaction limit",
 			config: &Config{
-				Databases: map[string]struct {
-					Address              string        `mapstructure:"address"`
-					Schema               string        `mapstructure:"schema"`
-					SSLCert              string        `mapstructure:"ssl_cert"`
-					SSLKey               string        `mapstructure:"ssl_key"`
-					SSLCA                string        `mapstructure:"ssl_ca"`
-					Username             string        `mapstructure:"username"`
-					Password             string        `mapstructure:"password"`
-					Interval             time.Duration `mapstructure:"interval"`
-					LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-					LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-					Port                 int           `mapstructure:"port"`
-					DryRun               bool          `mapstructure:"dry_run"`
-				}{
+				Databases: map[string]DatabaseConfig{
 					"primary": {
 						Address:              "127.0.0.1",
 						Port:                 3306,
@@ -1105,20 +1122,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "invalid port - too high",
 			config: &Config{
-				Databases: map[string]struct {
-					Address              string        `mapstructure:"address"`
-					Schema               string        `mapstructure:"schema"`
-					SSLCert              string        `mapstructure:"ssl_cert"`
-					SSLKey               string        `mapstructure:"ssl_key"`
-					SSLCA                string        `mapstructure:"ssl_ca"`
-					Username             string        `mapstructure:"username"`
-					Password             string        `mapstructure:"password"`
-					Interval             time.Duration `mapstructure:"interval"`
-					LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-					LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-					Port                 int           `mapstructure:"port"`
-					DryRun               bool          `mapstructure:"dry_run"`
-				}{
+				Databases: map[string]DatabaseConfig{
 					"primary": {
 						Address:              "127.0.0.1",
 						Schema:               "test_db",
@@ -1138,20 +1142,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "zero transaction limit allowed",
 			config: &Config{
-				Databases: map[string]struct {
-					Address              string        `mapstructure:"address"`
-					Schema               string        `mapstructure:"schema"`
-					SSLCert              string        `mapstructure:"ssl_cert"`
-					SSLKey               string        `mapstructure:"ssl_key"`
-					SSLCA                string        `mapstructure:"ssl_ca"`
-					Username             string        `mapstructure:"username"`
-					Password             string        `mapstructure:"password"`
-					Interval             time.Duration `mapstructure:"interval"`
-					LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-					LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-					Port                 int           `mapstructure:"port"`
-					DryRun               bool          `mapstructure:"dry_run"`
-				}{
+				Databases: map[string]DatabaseConfig{
 					"primary": {
 						Address:              "127.0.0.1",
 						Port:                 3306,
@@ -1171,20 +1162,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "SSL fields are optional",
 			config: &Config{
-				Databases: map[string]struct {
-					Address              string        `mapstructure:"address"`
-					Schema               string        `mapstructure:"schema"`
-					SSLCert              string        `mapstructure:"ssl_cert"`
-					SSLKey               string        `mapstructure:"ssl_key"`
-					SSLCA                string        `mapstructure:"ssl_ca"`
-					Username             string        `mapstructure:"username"`
-					Password             string        `mapstructure:"password"`
-					Interval             time.Duration `mapstructure:"interval"`
-					LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-					LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-					Port                 int           `mapstructure:"port"`
-					DryRun               bool          `mapstructure:"dry_run"`
-				}{
+				Databases: map[string]DatabaseConfig{
 					"primary": {
 						Address:              "127.0.0.1",
 						Port:                 3306,
@@ -1207,20 +1185,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "valid SSL configuration - no SSL fields (unencrypted)",
 			config: &Config{
-				Databases: map[string]struct {
-					Address              string        `mapstructure:"address"`
-					Schema               string        `mapstructure:"schema"`
-					SSLCert              string        `mapstructure:"ssl_cert"`
-					SSLKey               string        `mapstructure:"ssl_key"`
-					SSLCA                string        `mapstructure:"ssl_ca"`
-					Username             string        `mapstructure:"username"`
-					Password             string        `mapstructure:"password"`
-					Interval             time.Duration `mapstructure:"interval"`
-					LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-					LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-					Port                 int           `mapstructure:"port"`
-					DryRun               bool          `mapstructure:"dry_run"`
-				}{
+				Databases: map[string]DatabaseConfig{
 					"primary": {
 						Address:              "127.0.0.1",
 						Schema:               "test_db",
@@ -1244,20 +1209,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "valid SSL configuration - CA only mode",
 			config: &Config{
-				Databases: map[string]struct {
-					Address              string        `mapstructure:"address"`
-					Schema               string        `mapstructure:"schema"`
-					SSLCert              string        `mapstructure:"ssl_cert"`
-					SSLKey               string        `mapstructure:"ssl_key"`
-					SSLCA                string        `mapstructure:"ssl_ca"`
-					Username             string        `mapstructure:"username"`
-					Password             string        `mapstructure:"password"`
-					Interval             time.Duration `mapstructure:"interval"`
-					LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-					LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-					Port                 int           `mapstructure:"port"`
-					DryRun               bool          `mapstructure:"dry_run"`
-				}{
+				Databases: map[string]DatabaseConfig{
 					"primary": {
 						Address:              "127.0.0.1",
 						Schema:               "test_db",
@@ -1281,20 +1233,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "valid SSL configuration - mutual TLS mode",
 			config: &Config{
-				Databases: map[string]struct {
-					Address              string        `mapstructure:"address"`
-					Schema               string        `mapstructure:"schema"`
-					SSLCert              string        `mapstructure:"ssl_cert"`
-					SSLKey               string        `mapstructure:"ssl_key"`
-					SSLCA                string        `mapstructure:"ssl_ca"`
-					Username             string        `mapstructure:"username"`
-					Password             string        `mapstructure:"password"`
-					Interval             time.Duration `mapstructure:"interval"`
-					LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-					LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-					Port                 int           `mapstructure:"port"`
-					DryRun               bool          `mapstructure:"dry_run"`
-				}{
+				Databases: map[string]DatabaseConfig{
 					"primary": {
 						Address:              "127.0.0.1",
 						Schema:               "test_db",
@@ -1318,20 +1257,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "invalid SSL configuration - cert only",
 			config: &Config{
-				Databases: map[string]struct {
-					Address              string        `mapstructure:"address"`
-					Schema               string        `mapstructure:"schema"`
-					SSLCert              string        `mapstructure:"ssl_cert"`
-					SSLKey               string        `mapstructure:"ssl_key"`
-					SSLCA                string        `mapstructure:"ssl_ca"`
-					Username             string        `mapstructure:"username"`
-					Password             string        `mapstructure:"password"`
-					Interval             time.Duration `mapstructure:"interval"`
-					LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-					LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-					Port                 int           `mapstructure:"port"`
-					DryRun               bool          `mapstructure:"dry_run"`
-				}{
+				Databases: map[string]DatabaseConfig{
 					"primary": {
 						Address:              "127.0.0.1",
 						Schema:               "test_db",
@@ -1355,20 +1281,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "invalid SSL configuration - key only",
 			config: &Config{
-				Databases: map[string]struct {
-					Address              string        `mapstructure:"address"`
-					Schema               string        `mapstructure:"schema"`
-					SSLCert              string        `mapstructure:"ssl_cert"`
-					SSLKey               string        `mapstructure:"ssl_key"`
-					SSLCA                string        `mapstructure:"ssl_ca"`
-					Username             string        `mapstructure:"username"`
-					Password             string        `mapstructure:"password"`
-					Interval             time.Duration `mapstructure:"interval"`
-					LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-					LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-					Port                 int           `mapstructure:"port"`
-					DryRun               bool          `mapstructure:"dry_run"`
-				}{
+				Databases: map[string]DatabaseConfig{
 					"primary": {
 						Address:              "127.0.0.1",
 						Schema:               "test_db",
@@ -1392,20 +1305,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "invalid SSL configuration - cert and key without CA",
 			config: &Config{
-				Databases: map[string]struct {
-					Address              string        `mapstructure:"address"`
-					Schema               string        `mapstructure:"schema"`
-					SSLCert              string        `mapstructure:"ssl_cert"`
-					SSLKey               string        `mapstructure:"ssl_key"`
-					SSLCA                string        `mapstructure:"ssl_ca"`
-					Username             string        `mapstructure:"username"`
-					Password             string        `mapstructure:"password"`
-					Interval             time.Duration `mapstructure:"interval"`
-					LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-					LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-					Port                 int           `mapstructure:"port"`
-					DryRun               bool          `mapstructure:"dry_run"`
-				}{
+				Databases: map[string]DatabaseConfig{
 					"primary": {
 						Address:              "127.0.0.1",
 						Schema:               "test_db",
@@ -1429,20 +1329,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "invalid SSL configuration - cert and CA without key",
 			config: &Config{
-				Databases: map[string]struct {
-					Address              string        `mapstructure:"address"`
-					Schema               string        `mapstructure:"schema"`
-					SSLCert              string        `mapstructure:"ssl_cert"`
-					SSLKey               string        `mapstructure:"ssl_key"`
-					SSLCA                string        `mapstructure:"ssl_ca"`
-					Username             string        `mapstructure:"username"`
-					Password             string        `mapstructure:"password"`
-					Interval             time.Duration `mapstructure:"interval"`
-					LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-					LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-					Port                 int           `mapstructure:"port"`
-					DryRun               bool          `mapstructure:"dry_run"`
-				}{
+				Databases: map[string]DatabaseConfig{
 					"primary": {
 						Address:              "127.0.0.1",
 						Schema:               "test_db",
@@ -1466,20 +1353,7 @@ func TestConfig_Validate(t *testing.T) {
 		{
 			name: "invalid SSL configuration - key and CA without cert",
 			config: &Config{
-				Databases: map[string]struct {
-					Address              string        `mapstructure:"address"`
-					Schema               string        `mapstructure:"schema"`
-					SSLCert              string        `mapstructure:"ssl_cert"`
-					SSLKey               string        `mapstructure:"ssl_key"`
-					SSLCA                string        `mapstructure:"ssl_ca"`
-					Username             string        `mapstructure:"username"`
-					Password             string        `mapstructure:"password"`
-					Interval             time.Duration `mapstructure:"interval"`
-					LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-					LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-					Port                 int           `mapstructure:"port"`
-					DryRun               bool          `mapstructure:"dry_run"`
-				}{
+				Databases: map[string]DatabaseConfig{
 					"primary": {
 						Address:              "127.0.0.1",
 						Schema:               "test_db",
@@ -1500,23 +1374,1160 @@ func TestConfig_Validate(t *testing.T) {
 			wantErr:     true,
 			expectedErr: ErrInvalidSSLConfig,
 		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			t.Parallel()
-
-			err := tt.config.Validate()
-			if (err != nil) != tt.wantErr {
-				t.Errorf("Config.Validate() error = %v, wantErr %v", err, tt.wantErr)
-
-				return
-			}
-
-			if tt.expectedErr != nil {
-				if !errors.Is(err, tt.expectedErr) {
-					t.Errorf("Config.Validate() error = %v, expected error type %v", err, tt.expectedErr)
-				}
+		{
+			name: "valid rules",
+			config: &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+						Rules: []Rule{
+							{Name: "reporting", User: "reporting", LongQueryLimit: 30 * time.Second},
+							{Name: "migrations", Digest: "^ALTER TABLE", Exempt: true},
+							{Name: "batch", Host: "10.0.0.5", Action: RuleActionLog},
+							{Name: "web", User: "web", Action: RuleActionKillQuery},
+						},
+					},
+				},
+			},
+			wantErr:     false,
+			expectedErr: nil,
+		},
+		{
+			name: "invalid rule action",
+			config: &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+						Rules: []Rule{
+							{Name: "bad", Action: "shoot"},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			expectedErr: ErrInvalidRuleAction,
+		},
+		{
+			name: "invalid rule digest regex",
+			config: &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+						Rules: []Rule{
+							{Name: "bad", Digest: "(unclosed"},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			expectedErr: ErrInvalidRuleDigest,
+		},
+		{
+			name: "negative rule limit",
+			config: &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+						Rules: []Rule{
+							{Name: "bad", LongQueryLimit: -time.Second},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			expectedErr: ErrInvalidRuleLimit,
+		},
+		{
+			name: "query hints enabled without a max limit",
+			config: &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+						QueryHints: struct {
+							CommentKey string        `mapstructure:"comment_key"`
+							MaxLimit   time.Duration `mapstructure:"max_limit"`
+							Enabled    bool          `mapstructure:"enabled"`
+						}{Enabled: true},
+					},
+				},
+			},
+			wantErr:     true,
+			expectedErr: ErrInvalidQueryHintsLimit,
+		},
+		{
+			name: "query hints comment key with a quote",
+			config: &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+						QueryHints: struct {
+							CommentKey string        `mapstructure:"comment_key"`
+							MaxLimit   time.Duration `mapstructure:"max_limit"`
+							Enabled    bool          `mapstructure:"enabled"`
+						}{Enabled: true, CommentKey: "timeout' OR 1=1 --", MaxLimit: time.Minute},
+					},
+				},
+			},
+			wantErr:     true,
+			expectedErr: ErrInvalidQueryHintsKey,
+		},
+		{
+			name: "negative lock wait limit",
+			config: &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						LockWaitLimit:        -time.Second,
+						Port:                 3306,
+					},
+				},
+			},
+			wantErr:     true,
+			expectedErr: ErrInvalidLockWaitLimit,
+		},
+		{
+			name: "negative idle transaction limit",
+			config: &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						IdleTransactionLimit: -time.Second,
+						Port:                 3306,
+					},
+				},
+			},
+			wantErr:     true,
+			expectedErr: ErrInvalidIdleTxnLimit,
+		},
+		{
+			name: "negative required sightings",
+			config: &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+						RequiredSightings:    -1,
+					},
+				},
+			},
+			wantErr:     true,
+			expectedErr: ErrInvalidSightings,
+		},
+		{
+			name: "negative kill budget",
+			config: &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+						MaxKillsPerMinute:    -1,
+					},
+				},
+			},
+			wantErr:     true,
+			expectedErr: ErrInvalidKillBudget,
+		},
+		{
+			name: "negative metadata lock limit",
+			config: &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						MetadataLockLimit:    -time.Second,
+						Port:                 3306,
+					},
+				},
+			},
+			wantErr:     true,
+			expectedErr: ErrInvalidMetadataLock,
+		},
+		{
+			name: "unknown metadata lock action",
+			config: &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						MetadataLockAction:   "kill_everyone",
+						Port:                 3306,
+					},
+				},
+			},
+			wantErr:     true,
+			expectedErr: ErrInvalidMetadataLock,
+		},
+		{
+			name: "valid adaptive thresholds",
+			config: &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+						Adaptive: AdaptiveConfig{
+							Enabled:  true,
+							MinLimit: 2 * time.Second,
+							Steps: []AdaptiveStep{
+								{ThreadsRunning: 50, Scale: 0.5},
+								{ThreadsRunning: 200, RowLockWaits: 20, Scale: 0.25},
+							},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "adaptive enabled without steps",
+			config: &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+						Adaptive: AdaptiveConfig{
+							Enabled: true,
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			expectedErr: ErrInvalidAdaptive,
+		},
+		{
+			name: "adaptive step scale out of range",
+			config: &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+						Adaptive: AdaptiveConfig{
+							Enabled: true,
+							Steps:   []AdaptiveStep{{ThreadsRunning: 50, Scale: 1.5}},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			expectedErr: ErrInvalidAdaptive,
+		},
+		{
+			name: "adaptive step without a threshold",
+			config: &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+						Adaptive: AdaptiveConfig{
+							Enabled: true,
+							Steps:   []AdaptiveStep{{Scale: 0.5}},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			expectedErr: ErrInvalidAdaptive,
+		},
+		{
+			name: "valid schedule",
+			config: &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+						Schedules: []ScheduleConfig{
+							{Name: "nightly-batch", Cron: "0 1 * * *", Timezone: "America/New_York", Duration: 4 * time.Hour, LongQueryLimit: 10 * time.Minute},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "schedule without a name",
+			config: &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+						Schedules: []ScheduleConfig{
+							{Cron: "0 1 * * *", Duration: time.Hour},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			expectedErr: ErrInvalidSchedule,
+		},
+		{
+			name: "schedule with an invalid cron",
+			config: &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+						Schedules: []ScheduleConfig{
+							{Name: "nightly-batch", Cron: "0 1 * *", Duration: time.Hour},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			expectedErr: ErrInvalidSchedule,
+		},
+		{
+			name: "schedule with an invalid timezone",
+			config: &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+						Schedules: []ScheduleConfig{
+							{Name: "nightly-batch", Cron: "0 1 * * *", Timezone: "Nowhere/Special", Duration: time.Hour},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			expectedErr: ErrInvalidSchedule,
+		},
+		{
+			name: "schedule without a duration",
+			config: &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+						Schedules: []ScheduleConfig{
+							{Name: "nightly-batch", Cron: "0 1 * * *"},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			expectedErr: ErrInvalidSchedule,
+		},
+		{
+			name: "schedule with a negative limit",
+			config: &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+						Schedules: []ScheduleConfig{
+							{Name: "nightly-batch", Cron: "0 1 * * *", Duration: time.Hour, LongQueryLimit: -time.Second},
+						},
+					},
+				},
+			},
+			wantErr:     true,
+			expectedErr: ErrInvalidSchedule,
+		},
+		{
+			name: "leader lock name too long",
+			config: &Config{
+				LeaderElection: true,
+				Databases: map[string]DatabaseConfig{
+					"a-database-name-that-is-far-too-long-for-a-mysql-lock": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+					},
+				},
+			},
+			wantErr:     true,
+			expectedErr: ErrInvalidLeaderLock,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tt.config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Config.Validate() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Errorf("Config.Validate() error = %v, expected error type %v", err, tt.expectedErr)
+				}
+			}
+		})
+	}
+}
+
+func TestConfig_NotificationsWebhooks(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expectedErr error
+		name        string
+		webhookURL  string
+		wantErr     bool
+	}{
+		{
+			name:       "no webhook",
+			webhookURL: "",
+			wantErr:    false,
+		},
+		{
+			name:       "valid webhook",
+			webhookURL: "https://hooks.slack.com/services/T000/B000/XXXX",
+			wantErr:    false,
+		},
+		{
+			name:        "relative webhook",
+			webhookURL:  "hooks.slack.com/services/T000/B000/XXXX",
+			wantErr:     true,
+			expectedErr: ErrInvalidWebhookURL,
+		},
+		{
+			name:        "unsupported scheme",
+			webhookURL:  "ftp://hooks.slack.com/services/T000/B000/XXXX",
+			wantErr:     true,
+			expectedErr: ErrInvalidWebhookURL,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			config := &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+					},
+				},
+			}
+			config.Notifications.Slack.WebhookURL = tt.webhookURL
+
+			err := config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Config.Validate() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+
+			if tt.expectedErr != nil && !errors.Is(err, tt.expectedErr) {
+				t.Errorf("Config.Validate() error = %v, expected error type %v", err, tt.expectedErr)
+			}
+
+			redacted := config.Redact()
+			if tt.webhookURL != "" && redacted.Notifications.Slack.WebhookURL != "[REDACTED]" {
+				t.Errorf("Slack webhook not redacted: got %v", redacted.Notifications.Slack.WebhookURL)
+			}
+
+			if config.Notifications.Slack.WebhookURL != tt.webhookURL {
+				t.Errorf("Original config was modified: got %v, want %v",
+					config.Notifications.Slack.WebhookURL, tt.webhookURL)
+			}
+		})
+	}
+}
+
+func TestConfig_PagerDuty(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expectedErr error
+		name        string
+		pagerDuty   PagerDutyConfig
+		wantErr     bool
+	}{
+		{
+			name:      "disabled",
+			pagerDuty: PagerDutyConfig{},
+			wantErr:   false,
+		},
+		{
+			name:      "valid",
+			pagerDuty: PagerDutyConfig{RoutingKey: "routing-key", Severity: "warning", Window: time.Minute, KillThreshold: 20},
+			wantErr:   false,
+		},
+		{
+			name:        "missing threshold",
+			pagerDuty:   PagerDutyConfig{RoutingKey: "routing-key"},
+			wantErr:     true,
+			expectedErr: ErrInvalidKillThreshold,
+		},
+		{
+			name:        "negative window",
+			pagerDuty:   PagerDutyConfig{RoutingKey: "routing-key", Window: -time.Minute, KillThreshold: 20},
+			wantErr:     true,
+			expectedErr: ErrInvalidKillThreshold,
+		},
+		{
+			name:        "invalid severity",
+			pagerDuty:   PagerDutyConfig{RoutingKey: "routing-key", Severity: "sev1", KillThreshold: 20},
+			wantErr:     true,
+			expectedErr: ErrInvalidSeverity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			config := &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+					},
+				},
+			}
+			config.Notifications.PagerDuty = tt.pagerDuty
+
+			err := config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Config.Validate() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+
+			if tt.expectedErr != nil && !errors.Is(err, tt.expectedErr) {
+				t.Errorf("Config.Validate() error = %v, expected error type %v", err, tt.expectedErr)
+			}
+
+			redacted := config.Redact()
+			if tt.pagerDuty.RoutingKey != "" && redacted.Notifications.PagerDuty.RoutingKey != "[REDACTED]" {
+				t.Errorf("PagerDuty routing key not redacted: got %v", redacted.Notifications.PagerDuty.RoutingKey)
+			}
+		})
+	}
+}
+
+func TestConfig_DatadogAddress(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		address string
+		wantErr bool
+	}{
+		{name: "disabled", address: "", wantErr: false},
+		{name: "host and port", address: "127.0.0.1:8125", wantErr: false},
+		{name: "hostname and port", address: "datadog-agent:8125", wantErr: false},
+		{name: "missing port", address: "127.0.0.1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			config := &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+					},
+				},
+			}
+			config.Notifications.Datadog.Address = tt.address
+
+			err := config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Config.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr && !errors.Is(err, ErrInvalidDatadogAddress) {
+				t.Errorf("Config.Validate() error = %v, expected error type %v", err, ErrInvalidDatadogAddress)
+			}
+		})
+	}
+}
+
+func TestConfig_ReadyIntervals(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		intervals int
+		wantErr   bool
+	}{
+		{name: "default", intervals: 0, wantErr: false},
+		{name: "set", intervals: 5, wantErr: false},
+		{name: "negative", intervals: -1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			config := &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+					},
+				},
+			}
+			config.HTTP.ReadyIntervals = tt.intervals
+
+			err := config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Config.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr && !errors.Is(err, ErrInvalidReadyIntervals) {
+				t.Errorf("Config.Validate() error = %v, expected error type %v", err, ErrInvalidReadyIntervals)
+			}
+		})
+	}
+}
+
+func TestConfig_Admin(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		tokens      map[string]string
+		name        string
+		address     string
+		allowRemote bool
+		wantErr     bool
+	}{
+		{name: "disabled", address: "", wantErr: false},
+		{name: "enabled", address: "127.0.0.1:9091", tokens: map[string]string{"alice": "s3cret"}, wantErr: false},
+		{name: "localhost", address: "localhost:9091", tokens: map[string]string{"alice": "s3cret"}, wantErr: false},
+		{name: "ipv6 loopback", address: "[::1]:9091", tokens: map[string]string{"alice": "s3cret"}, wantErr: false},
+		{name: "all interfaces", address: ":9091", tokens: map[string]string{"alice": "s3cret"}, wantErr: true},
+		{name: "remote", address: "10.0.0.5:9091", tokens: map[string]string{"alice": "s3cret"}, wantErr: true},
+		{name: "remote allowed", address: "0.0.0.0:9091", tokens: map[string]string{"alice": "s3cret"}, allowRemote: true, wantErr: false},
+		{name: "missing port", address: "127.0.0.1", tokens: map[string]string{"alice": "s3cret"}, wantErr: true},
+		{name: "no tokens", address: "127.0.0.1:9091", wantErr: true},
+		{name: "empty token", address: "127.0.0.1:9091", tokens: map[string]string{"alice": "s3cret", "bob": ""}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			config := &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+					},
+				},
+			}
+			config.Admin.Address = tt.address
+			config.Admin.AllowRemote = tt.allowRemote
+			config.Admin.Tokens = tt.tokens
+
+			err := config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Config.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr && !errors.Is(err, ErrInvalidAdminConfig) {
+				t.Errorf("Config.Validate() error = %v, expected error type %v", err, ErrInvalidAdminConfig)
+			}
+
+			redacted := config.Redact()
+			for caller, token := range redacted.Admin.Tokens {
+				if token != "[REDACTED]" {
+					t.Errorf("Redact() admin token of %s = %q, want [REDACTED]", caller, token)
+				}
+			}
+
+			if tt.tokens["alice"] != "" && config.Admin.Tokens["alice"] != tt.tokens["alice"] {
+				t.Error("Redact() modified the original admin tokens")
+			}
+		})
+	}
+}
+
+func TestConfig_AuditFile(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		file    AuditFileConfig
+		wantErr bool
+	}{
+		{name: "disabled", file: AuditFileConfig{}, wantErr: false},
+		{name: "defaults", file: AuditFileConfig{Path: "/var/log/query-sniper/audit.jsonl"}, wantErr: false},
+		{name: "rotation", file: AuditFileConfig{Path: "audit.jsonl", MaxAge: time.Hour, MaxSizeMB: 10, MaxBackups: 7}, wantErr: false},
+		{name: "negative max age", file: AuditFileConfig{Path: "audit.jsonl", MaxAge: -time.Hour}, wantErr: true},
+		{name: "negative max size", file: AuditFileConfig{Path: "audit.jsonl", MaxSizeMB: -1}, wantErr: true},
+		{name: "negative max backups", file: AuditFileConfig{Path: "audit.jsonl", MaxBackups: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			config := &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+					},
+				},
+			}
+			config.Audit.File = tt.file
+
+			err := config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Config.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr && !errors.Is(err, ErrInvalidAuditConfig) {
+				t.Errorf("Config.Validate() error = %v, expected error type %v", err, ErrInvalidAuditConfig)
+			}
+		})
+	}
+}
+
+func TestConfig_AuditDatabase(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		wantDSN string
+		audit   AuditDatabaseConfig
+		wantErr bool
+	}{
+		{name: "disabled", audit: AuditDatabaseConfig{}, wantErr: false},
+		{name: "one of the databases", audit: AuditDatabaseConfig{Database: "primary"}, wantDSN: "test_user:secret_password@tcp(127.0.0.1:3306)/", wantErr: false},
+		{name: "separate dsn", audit: AuditDatabaseConfig{DSN: "audit:s3cret@tcp(audit.internal:3306)/"}, wantDSN: "audit:s3cret@tcp(audit.internal:3306)/", wantErr: false},
+		{name: "both", audit: AuditDatabaseConfig{Database: "primary", DSN: "audit:s3cret@tcp(audit.internal:3306)/"}, wantErr: true},
+		{name: "unknown database", audit: AuditDatabaseConfig{Database: "missing"}, wantErr: true},
+		{name: "invalid dsn", audit: AuditDatabaseConfig{DSN: "audit:s3cret@tcp(audit.internal:3306)"}, wantErr: true},
+		{name: "negative buffer size", audit: AuditDatabaseConfig{Database: "primary", BufferSize: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			config := &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+					},
+				},
+				AuditDatabase: tt.audit,
+			}
+
+			err := config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Config.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAuditDatabase) {
+					t.Errorf("Config.Validate() error = %v, expected error type %v", err, ErrInvalidAuditDatabase)
+				}
+
+				if strings.Contains(err.Error(), "s3cret") {
+					t.Errorf("Config.Validate() error = %v, leaks the dsn password", err)
+				}
+
+				return
+			}
+
+			if got := config.AuditDSN(); tt.wantDSN != "" && got != tt.wantDSN {
+				t.Errorf("AuditDSN() = %q, want %q", got, tt.wantDSN)
+			}
+
+			if redacted := config.Redact(); tt.audit.DSN != "" && redacted.AuditDatabase.DSN != "[REDACTED]" {
+				t.Errorf("Redact() audit dsn = %q, want [REDACTED]", redacted.AuditDatabase.DSN)
+			}
+		})
+	}
+}
+
+func TestConfig_QueryText(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		queryText QueryTextConfig
+		wantErr   bool
+	}{
+		{name: "disabled", queryText: QueryTextConfig{RedactPatterns: []string{"("}}, wantErr: false},
+		{name: "defaults", queryText: QueryTextConfig{Enabled: true}, wantErr: false},
+		{name: "columns and patterns", queryText: QueryTextConfig{Enabled: true, RedactColumns: []string{"ssn"}, RedactPatterns: []string{`acct_[0-9a-f]{8}`}, MaxLength: 512}, wantErr: false},
+		{name: "bad pattern", queryText: QueryTextConfig{Enabled: true, RedactPatterns: []string{"("}}, wantErr: true},
+		{name: "empty column", queryText: QueryTextConfig{Enabled: true, RedactColumns: []string{""}}, wantErr: true},
+		{name: "negative max length", queryText: QueryTextConfig{Enabled: true, MaxLength: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			config := &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+					},
+				},
+				QueryText: tt.queryText,
+			}
+
+			err := config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Config.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr && !errors.Is(err, ErrInvalidQueryText) {
+				t.Errorf("Config.Validate() error = %v, expected error type %v", err, ErrInvalidQueryText)
+			}
+		})
+	}
+}
+
+func TestConfig_QueryTags(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		queryTags QueryTagsConfig
+		wantErr   bool
+	}{
+		{name: "disabled", queryTags: QueryTagsConfig{}, wantErr: false},
+		{name: "enabled without metric labels", queryTags: QueryTagsConfig{Enabled: true}, wantErr: false},
+		{name: "metric labels", queryTags: QueryTagsConfig{Enabled: true, MetricLabels: []string{"controller", "job"}}, wantErr: false},
+		{name: "empty metric label", queryTags: QueryTagsConfig{Enabled: true, MetricLabels: []string{"controller", " "}}, wantErr: true},
+		{name: "per request metric label", queryTags: QueryTagsConfig{Enabled: true, MetricLabels: []string{"controller", "traceparent"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			config := &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+					},
+				},
+				QueryTags: tt.queryTags,
+			}
+
+			err := config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Config.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr && !errors.Is(err, ErrInvalidQueryTags) {
+				t.Errorf("Config.Validate() error = %v, expected error type %v", err, ErrInvalidQueryTags)
+			}
+		})
+	}
+}
+
+func TestConfig_Webhooks(t *testing.T) {
+	t.Parallel()
+
+	five, zero, negative := 5, 0, -1
+
+	tests := []struct {
+		expectedErr error
+		name        string
+		webhook     WebhookConfig
+		wantErr     bool
+	}{
+		{
+			name: "valid",
+			webhook: WebhookConfig{
+				URL:        "https://tickets.internal/hooks/sniper",
+				Secret:     "shh",
+				Headers:    map[string]string{"Authorization": "Bearer api-key"},
+				MaxRetries: &five,
+			},
+			wantErr: false,
+		},
+		{
+			name:    "retries turned off",
+			webhook: WebhookConfig{URL: "https://tickets.internal/hooks/sniper", MaxRetries: &zero},
+			wantErr: false,
+		},
+		{
+			name:    "valid template",
+			webhook: WebhookConfig{URL: "https://tickets.internal/hooks/sniper", Template: `{"db": {{ json .DB }}}`},
+			wantErr: false,
+		},
+		{
+			name:        "missing url",
+			webhook:     WebhookConfig{Secret: "shh"},
+			wantErr:     true,
+			expectedErr: ErrInvalidWebhookURL,
+		},
+		{
+			name:        "negative retries",
+			webhook:     WebhookConfig{URL: "https://tickets.internal/hooks/sniper", MaxRetries: &negative},
+			wantErr:     true,
+			expectedErr: ErrInvalidWebhookRetries,
+		},
+		{
+			name:        "invalid template",
+			webhook:     WebhookConfig{URL: "https://tickets.internal/hooks/sniper", Template: `{"db": {{ .DB }`},
+			wantErr:     true,
+			expectedErr: ErrInvalidWebhookTemplate,
+		},
+		{
+			name:        "unknown template function",
+			webhook:     WebhookConfig{URL: "https://tickets.internal/hooks/sniper", Template: `{{ yaml .DB }}`},
+			wantErr:     true,
+			expectedErr: ErrInvalidWebhookTemplate,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			config := &Config{
+				Databases: map[string]DatabaseConfig{
+					"primary": {
+						Address:              "127.0.0.1",
+						Schema:               "test_db",
+						Username:             "test_user",
+						Password:             "secret_password",
+						Interval:             30 * time.Second,
+						LongQueryLimit:       60 * time.Second,
+						LongTransactionLimit: 120 * time.Second,
+						Port:                 3306,
+					},
+				},
+			}
+			config.Notifications.Webhooks = map[string]WebhookConfig{"tickets": tt.webhook}
+
+			err := config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Config.Validate() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+
+			if tt.expectedErr != nil && !errors.Is(err, tt.expectedErr) {
+				t.Errorf("Config.Validate() error = %v, expected error type %v", err, tt.expectedErr)
+			}
+
+			redacted := config.Redact()
+			if tt.webhook.Secret != "" && redacted.Notifications.Webhooks["tickets"].Secret != "[REDACTED]" {
+				t.Errorf("Webhook secret not redacted: got %v", redacted.Notifications.Webhooks["tickets"].Secret)
+			}
+
+			for header, value := range redacted.Notifications.Webhooks["tickets"].Headers {
+				if value != "[REDACTED]" {
+					t.Errorf("Webhook header %s not redacted: got %v", header, value)
+				}
+			}
+
+			if config.Notifications.Webhooks["tickets"].Secret != tt.webhook.Secret {
+				t.Errorf("Original config was modified: got %v, want %v",
+					config.Notifications.Webhooks["tickets"].Secret, tt.webhook.Secret)
+			}
+
+			if len(tt.webhook.Headers) > 0 && config.Notifications.Webhooks["tickets"].Headers["Authorization"] != tt.webhook.Headers["Authorization"] {
+				t.Errorf("Original webhook headers were modified: got %v", config.Notifications.Webhooks["tickets"].Headers)
 			}
 		})
 	}
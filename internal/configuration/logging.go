@@ -4,7 +4,9 @@ import (
 	"log/slog"
 	"os"
 	"runtime/debug"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/lmittmann/tint"
@@ -15,6 +17,14 @@ const (
 	LevelFatal = slog.Level(12)
 )
 
+// logLevel is the level of the logger set up by SetupLogger. It's a slog.LevelVar so that
+// CycleLogLevel can change it at runtime without rebuilding the handler.
+var logLevel = struct {
+	current    slog.LevelVar
+	configured slog.Level // the level from settings.log.level, which CycleLogLevel returns to
+	mu         sync.Mutex
+}{}
+
 // SetupLogger sets up the slog logger as the default logger.
 // Uses settings.log.* to configure aspects of the logger handler.
 func SetupLogger(settings *Config) {
@@ -32,6 +42,11 @@ func SetupLogger(settings *Config) {
 		level = slog.LevelInfo // default fallback level
 	}
 
+	logLevel.mu.Lock()
+	logLevel.configured = level
+	logLevel.current.Set(level)
+	logLevel.mu.Unlock()
+
 	var handler slog.Handler
 
 	LevelNames := map[slog.Leveler]string{
@@ -42,7 +57,7 @@ func SetupLogger(settings *Config) {
 	if strings.ToUpper(settings.Log.Format) == "JSON" { //nolint:nestif
 		handler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
 			AddSource: settings.Log.IncludeCaller,
-			Level:     level,
+			Level:     &logLevel.current,
 			ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
 				if a.Key == slog.LevelKey {
 					if logLevel, ok := a.Value.Any().(slog.Level); ok {
@@ -61,7 +76,7 @@ func SetupLogger(settings *Config) {
 	} else {
 		handler = tint.NewHandler(os.Stdout, &tint.Options{
 			AddSource: settings.Log.IncludeCaller,
-			Level:     level,
+			Level:     &logLevel.current,
 			NoColor:   false,
 			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
 				if a.Key == slog.LevelKey {
@@ -105,6 +120,45 @@ func SetupLogger(settings *Config) {
 	slog.SetDefault(logger)
 }
 
+// CycleLogLevel moves the logger set up by SetupLogger to the next level in the cycle of the configured
+// level, DEBUG and TRACE (skipping the ones the configured level already covers), and returns the
+// new level.
+func CycleLogLevel() slog.Level {
+	logLevel.mu.Lock()
+	defer logLevel.mu.Unlock()
+
+	cycle := []slog.Level{logLevel.configured}
+	for _, level := range []slog.Level{slog.LevelDebug, LevelTrace} {
+		if level < logLevel.configured {
+			cycle = append(cycle, level)
+		}
+	}
+
+	next := cycle[0]
+
+	if i := slices.Index(cycle, logLevel.current.Level()); i >= 0 {
+		next = cycle[(i+1)%len(cycle)]
+	}
+
+	logLevel.current.Set(next)
+
+	return next
+}
+
+// LevelName returns the name that the logger prints for the level.
+func LevelName(level slog.Level) string {
+	switch level { //nolint:exhaustive
+	case LevelTrace:
+		return "TRACE"
+
+	case LevelFatal:
+		return "FATAL"
+
+	default:
+		return level.String()
+	}
+}
+
 // LogBuildInfo logs debug information about the service, namely configuration values
 // and build info.
 func LogBuildInfo() {
@@ -400,6 +400,58 @@ func TestSetupLogger(t *testing.T) {
 	}
 }
 
+//nolint:paralleltest // CycleLogLevel changes the level of the default logger.
+func TestCycleLogLevel(t *testing.T) {
+	t.Cleanup(func() {
+		logLevel.configured = slog.LevelInfo
+		logLevel.current.Set(slog.LevelInfo)
+	})
+
+	tests := []struct {
+		name       string
+		want       []slog.Level
+		configured slog.Level
+	}{
+		{
+			name:       "from INFO",
+			configured: slog.LevelInfo,
+			want:       []slog.Level{slog.LevelDebug, LevelTrace, slog.LevelInfo, slog.LevelDebug},
+		},
+		{
+			name:       "from WARN",
+			configured: slog.LevelWarn,
+			want:       []slog.Level{slog.LevelDebug, LevelTrace, slog.LevelWarn},
+		},
+		{
+			name:       "from DEBUG",
+			configured: slog.LevelDebug,
+			want:       []slog.Level{LevelTrace, slog.LevelDebug, LevelTrace},
+		},
+		{
+			name:       "from TRACE",
+			configured: LevelTrace,
+			want:       []slog.Level{LevelTrace, LevelTrace},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logLevel.configured = tt.configured
+			logLevel.current.Set(tt.configured)
+
+			for i, want := range tt.want {
+				if got := CycleLogLevel(); got != want {
+					t.Fatalf("CycleLogLevel() #%d = %s, want %s", i+1, LevelName(got), LevelName(want))
+				}
+
+				if got := logLevel.current.Level(); got != want {
+					t.Fatalf("CycleLogLevel() #%d left the logger at %s, want %s", i+1, LevelName(got), LevelName(want))
+				}
+			}
+		})
+	}
+}
+
 func TestLogBuildInfo(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,246 @@
+// Package metrics holds the prometheus collectors for the sniper. All of the collectors are
+// registered to Registry, which is exposed over HTTP by the server package.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "query_sniper"
+
+const (
+	// OtherTagValue is the value label of TaggedProcessesKilled for the values of a tag past MaxTagValues.
+	OtherTagValue = "other"
+
+	// MaxTagValues is how many distinct values of a tag are counted by TaggedProcessesKilled for each
+	// database. The registry is never pruned, so a tag with a value per request must not add a series per kill.
+	MaxTagValues = 100
+)
+
+// Hunter names, used as the value of the "hunter" label on HunterDuration.
+const (
+	HunterQueries          = "queries"
+	HunterTransactions     = "transactions"
+	HunterLockWaits        = "lock_waits"
+	HunterMetadataLock     = "metadata_locks"
+	HunterIdleTransactions = "idle_transactions"
+)
+
+// Kill kinds, used as the value of the "kind" label on KillFailures.
+const (
+	KindProcess         = "process"
+	KindTransaction     = "transaction"
+	KindBlocker         = "blocker"
+	KindMetadataLock    = "metadata_lock"
+	KindIdleTransaction = "idle_transaction"
+)
+
+// Registry is the prometheus registry that all sniper metrics are registered to. We use our
+// own registry rather than the global default so that tests and libraries can't pollute it.
+var Registry = prometheus.NewRegistry()
+
+// labels used by the detection and kill counters.
+var offenderLabels = []string{"db", "schema", "user", "dry_run"}
+
+var (
+	// ProcessesDetected counts the processes found by the long running query hunter.
+	ProcessesDetected = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "processes_detected_total",
+		Help:      "Number of long running processes detected.",
+	}, offenderLabels)
+
+	// ProcessesKilled counts the processes that were killed (or would have been, when dry_run is true).
+	ProcessesKilled = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "processes_killed_total",
+		Help:      "Number of long running processes killed; dry_run=\"true\" counts processes that would have been killed.",
+	}, offenderLabels)
+
+	// TaggedProcessesKilled counts the processes that were killed (or would have been, when dry_run is
+	// true) by the values of their query tags in the query_tags.metric_labels allowlist, such as the
+	// controller or job that ran them. Use CountTaggedKill, which bounds the values of each tag.
+	TaggedProcessesKilled = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tagged_processes_killed_total",
+		Help:      "Number of long running processes killed by the value of their allowlisted query tags; dry_run=\"true\" counts processes that would have been killed.",
+	}, []string{"db", "tag", "value", "dry_run"})
+
+	// TransactionsDetected counts the transactions found by the long running transaction hunter.
+	TransactionsDetected = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transactions_detected_total",
+		Help:      "Number of long running transactions detected.",
+	}, offenderLabels)
+
+	// TransactionsKilled counts the transactions that were killed (or would have been, when dry_run is true).
+	TransactionsKilled = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transactions_killed_total",
+		Help:      "Number of long running transactions killed; dry_run=\"true\" counts transactions that would have been killed.",
+	}, offenderLabels)
+
+	// IdleTransactionsDetected counts the sessions found sleeping with an open transaction past the limit.
+	IdleTransactionsDetected = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "idle_transactions_detected_total",
+		Help:      "Number of sessions detected idle in an open transaction past the idle transaction limit.",
+	}, offenderLabels)
+
+	// IdleTransactionsKilled counts the idle sessions that were killed (or would have been, when dry_run is true).
+	IdleTransactionsKilled = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "idle_transactions_killed_total",
+		Help:      "Number of sessions idle in an open transaction killed; dry_run=\"true\" counts sessions that would have been killed.",
+	}, offenderLabels)
+
+	// BlockersDetected counts the root blockers of lock chains found by the lock wait hunter.
+	BlockersDetected = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "blockers_detected_total",
+		Help:      "Number of sessions detected blocking other sessions' locks past the lock wait limit.",
+	}, offenderLabels)
+
+	// BlockersKilled counts the root blockers that were killed (or would have been, when dry_run is true).
+	BlockersKilled = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "blockers_killed_total",
+		Help:      "Number of blocking sessions killed; dry_run=\"true\" counts sessions that would have been killed.",
+	}, offenderLabels)
+
+	// WaitersUnblocked counts the sessions that were waiting on a killed blocker's locks.
+	WaitersUnblocked = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "waiters_unblocked_total",
+		Help:      "Number of sessions waiting on the locks of killed blockers; dry_run=\"true\" counts sessions that would have been unblocked.",
+	}, []string{"db", "dry_run"})
+
+	// MetadataLocksDetected counts the DDL statements found waiting on a metadata lock past the limit.
+	MetadataLocksDetected = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "metadata_locks_detected_total",
+		Help:      "Number of DDL statements detected waiting on a metadata lock past the metadata lock limit.",
+	}, offenderLabels)
+
+	// MetadataLocksKilled counts the sessions killed to clear a metadata lock pile-up (or that would
+	// have been, when dry_run is true); the labels are those of the killed session.
+	MetadataLocksKilled = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "metadata_locks_killed_total",
+		Help:      "Number of waiting DDL statements or lock holders killed to clear metadata lock pile-ups; dry_run=\"true\" counts sessions that would have been killed.",
+	}, offenderLabels)
+
+	// CircuitBreakerTrips counts the times a sniper ran out of kill budget and dropped into dry run.
+	CircuitBreakerTrips = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "circuit_breaker_trips_total",
+		Help:      "Number of times the kill circuit breaker tripped because max_kills_per_minute was exceeded.",
+	}, []string{"db"})
+
+	// CircuitBreakerOpen is 1 while a sniper's circuit breaker is open, and 0 otherwise.
+	CircuitBreakerOpen = promauto.With(Registry).NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "circuit_breaker_open",
+		Help:      "Whether the kill circuit breaker is open, keeping the sniper in dry run.",
+	}, []string{"db"})
+
+	// AdaptiveScale is the factor a sniper's long query and transaction limits were scaled by on its last
+	// tick; 1 unless adaptive thresholds are enabled and the server is busy.
+	AdaptiveScale = promauto.With(Registry).NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "adaptive_scale",
+		Help:      "Factor the long query and transaction limits were scaled by for the server load.",
+	}, []string{"db"})
+
+	// Leader is 1 while this replica holds a sniper's leader lock, and 0 while it's a follower. It's only
+	// set when leader election is enabled.
+	Leader = promauto.With(Registry).NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "leader",
+		Help:      "Whether this replica is the leader that kills on the database, with leader election enabled.",
+	}, []string{"db"})
+
+	// SniperHealth is 1 for a sniper's current health state (starting, healthy, degraded or down), and 0
+	// for the others.
+	SniperHealth = promauto.With(Registry).NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sniper_health",
+		Help:      "The sniper's health state; 1 for the current state, and 0 for the others.",
+	}, []string{"db", "state"})
+
+	// KillFailures counts the KILL commands that returned an error.
+	KillFailures = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kill_failures_total",
+		Help:      "Number of KILL commands that failed.",
+	}, []string{"db", "kind"})
+
+	// HunterDuration tracks how long the hunter queries take to run.
+	HunterDuration = promauto.With(Registry).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "hunter_duration_seconds",
+		Help:      "Time taken to run the hunter queries against the database.",
+		Buckets:   []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5},
+	}, []string{"db", "hunter"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler returns the http.Handler that serves the metrics in the Registry.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// OffenderLabels returns the label values for the detection and kill counters, in the order
+// they were declared.
+func OffenderLabels(db string, schema string, user string, dryRun bool) []string {
+	return []string{db, schema, user, strconv.FormatBool(dryRun)}
+}
+
+// tagValues tracks the values of each database's tags that have a TaggedProcessesKilled series.
+var tagValues = struct {
+	seen map[[2]string]map[string]bool // keyed by db and tag
+	mu   sync.Mutex
+}{seen: make(map[[2]string]map[string]bool)}
+
+// CountTaggedKill increments TaggedProcessesKilled for the tag's value, or for OtherTagValue once the tag
+// already has MaxTagValues values on the database.
+func CountTaggedKill(db string, tag string, value string, dryRun bool) {
+	tagValues.mu.Lock()
+
+	values, ok := tagValues.seen[[2]string{db, tag}]
+	if !ok {
+		values = make(map[string]bool)
+		tagValues.seen[[2]string{db, tag}] = values
+	}
+
+	if !values[value] {
+		if len(values) < MaxTagValues {
+			values[value] = true
+		} else {
+			value = OtherTagValue
+		}
+	}
+
+	tagValues.mu.Unlock()
+
+	TaggedProcessesKilled.WithLabelValues(db, tag, value, strconv.FormatBool(dryRun)).Inc()
+}
+
+// ObserveHunter records the time elapsed since start in HunterDuration.
+func ObserveHunter(db string, hunter string, start time.Time) {
+	HunterDuration.WithLabelValues(db, hunter).Observe(time.Since(start).Seconds())
+}
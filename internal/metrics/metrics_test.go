@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/goleak"
+)
+
+func TestOffenderLabels(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		want   []string
+		dryRun bool
+	}{
+		{
+			name:   "dry run",
+			dryRun: true,
+			want:   []string{"primary", "web", "app", "true"},
+		},
+		{
+			name:   "not dry run",
+			dryRun: false,
+			want:   []string{"primary", "web", "app", "false"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := OffenderLabels("primary", "web", "app", tt.dryRun)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("OffenderLabels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObserveHunter(t *testing.T) {
+	t.Parallel()
+
+	ObserveHunter("observe_test", HunterQueries, time.Now().Add(-time.Second))
+
+	count := testutil.CollectAndCount(HunterDuration, "query_sniper_hunter_duration_seconds")
+	if count == 0 {
+		t.Error("expected at least one hunter_duration_seconds series after ObserveHunter()")
+	}
+}
+
+func TestCountTaggedKill(t *testing.T) {
+	t.Parallel()
+
+	for i := range MaxTagValues + 10 {
+		CountTaggedKill("tagged_test", "request_id", strconv.Itoa(i), false)
+	}
+
+	CountTaggedKill("tagged_test", "request_id", "0", false)
+
+	if got := testutil.ToFloat64(TaggedProcessesKilled.WithLabelValues("tagged_test", "request_id", "0", "false")); got != 2 {
+		t.Errorf("tagged_processes_killed_total{value=0} = %v, want 2", got)
+	}
+
+	// the values past the cap share a single series.
+	if got := testutil.ToFloat64(TaggedProcessesKilled.WithLabelValues("tagged_test", "request_id", OtherTagValue, "false")); got != 10 {
+		t.Errorf("tagged_processes_killed_total{value=other} = %v, want 10", got)
+	}
+
+	series := testutil.CollectAndCount(TaggedProcessesKilled, "query_sniper_tagged_processes_killed_total")
+	if series != MaxTagValues+1 {
+		t.Errorf("tagged_processes_killed_total has %d series, want %d", series, MaxTagValues+1)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	ProcessesKilled.WithLabelValues(OffenderLabels("handler_test", "web", "app", false)...).Inc()
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Handler() status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		`query_sniper_processes_killed_total{db="handler_test",dry_run="false",schema="web",user="app"} 1`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Handler() body missing %q", want)
+		}
+	}
+}
+
+// TestMain is used to verify that there are no leaks during the tests.
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
@@ -0,0 +1,314 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+)
+
+const (
+	// DefaultAuditMaxAge is how long the audit log is written to before it's rotated, when max_age isn't set.
+	DefaultAuditMaxAge = 24 * time.Hour
+
+	// DefaultAuditMaxSizeMB is the size the audit log is rotated at, when max_size_mb isn't set.
+	DefaultAuditMaxSizeMB = 100
+
+	// auditRotationLayout is the timestamp added to the names of rotated audit logs; it sorts by time.
+	auditRotationLayout = "20060102T150405.000"
+
+	auditFileMode = 0o600
+	auditDirMode  = 0o750
+)
+
+// ErrAuditLogClosed is returned when events arrive after the audit log has been closed on shutdown.
+var ErrAuditLogClosed = errors.New("audit log is closed")
+
+// AuditRecord is a line of the audit log: an offender that a sniper detected, and what it did about it.
+// NB: this struct is sorted by datatype to satisfy the fieldalignment linter.
+type AuditRecord struct {
+	Timestamp     time.Time         `json:"timestamp"`
+	Admin         *AdminChange      `json:"admin,omitempty"` // who applied the override, and the state it changed, for admin events
+	Tags          map[string]string `json:"tags,omitempty"`  // the marginalia or sqlcommenter tags, when query_tags is on
+	DB            string            `json:"db"`
+	Kind          string            `json:"kind"`
+	User          string            `json:"user"`
+	Schema        string            `json:"schema"`
+	Command       string            `json:"command"`
+	DigestText    string            `json:"digest_text"`
+	Explain       string            `json:"explain,omitempty"` // the JSON plan, captured just before the kill
+	Rule          string            `json:"rule,omitempty"`
+	Action        string            `json:"action,omitempty"` // one of the configuration.RuleAction* values
+	Outcome       string            `json:"outcome"`
+	Error         string            `json:"error,omitempty"`
+	Runtime       float64           `json:"runtime"` // in seconds
+	ProcessID     int               `json:"process_id"`
+	TransactionID int               `json:"transaction_id,omitempty"`
+	DryRun        bool              `json:"dry_run"`
+}
+
+// NewAuditRecord returns the audit record of the event.
+func NewAuditRecord(event Event) AuditRecord {
+	record := AuditRecord{
+		Timestamp:     event.Time,
+		Admin:         event.Admin,
+		DB:            event.DB,
+		Kind:          event.Kind,
+		User:          event.User,
+		Schema:        event.Schema,
+		Command:       event.Command,
+		DigestText:    event.DigestText,
+		Explain:       event.Explain,
+		Tags:          event.Tags,
+		Rule:          event.Rule,
+		Action:        event.Action,
+		Outcome:       event.Outcome,
+		Runtime:       event.Runtime.Seconds(),
+		ProcessID:     event.ProcessID,
+		TransactionID: event.TransactionID,
+		DryRun:        event.DryRun,
+	}
+
+	if event.Err != nil {
+		record.Error = event.Err.Error()
+	}
+
+	return record
+}
+
+// AuditLog appends a JSON line for every event to a file, whatever the log level, for security and
+// compliance to query later. The file is rotated once it has been open for max_age or would grow past
+// max_size_mb, and is synced to disk after every batch of events, so that a crash doesn't lose the
+// record of a kill. It's closed by Run when the context is cancelled.
+type AuditLog struct {
+	openedAt   time.Time
+	file       *os.File
+	now        func() time.Time
+	path       string
+	maxAge     time.Duration
+	maxSize    int64
+	size       int64
+	maxBackups int
+	mu         sync.Mutex
+	closed     bool
+}
+
+// NewAuditLog creates a new AuditLog from the given config. The file is opened on the first event.
+func NewAuditLog(config configuration.AuditFileConfig) *AuditLog {
+	audit := &AuditLog{
+		maxAge:     config.MaxAge,
+		maxBackups: config.MaxBackups,
+		maxSize:    int64(config.MaxSizeMB) << 20, //nolint:mnd // megabytes
+		now:        time.Now,
+		path:       config.Path,
+	}
+
+	if audit.maxAge == 0 {
+		audit.maxAge = DefaultAuditMaxAge
+	}
+
+	if audit.maxSize == 0 {
+		audit.maxSize = DefaultAuditMaxSizeMB << 20 //nolint:mnd // megabytes
+	}
+
+	return audit
+}
+
+// Notify appends the events to the audit log, and syncs it to disk.
+func (audit *AuditLog) Notify(_ context.Context, events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+
+	if audit.closed {
+		return fmt.Errorf("%w: dropped %d events", ErrAuditLogClosed, len(events))
+	}
+
+	for _, event := range events {
+		line, err := json.Marshal(NewAuditRecord(event))
+		if err != nil {
+			return fmt.Errorf("error marshalling audit record: %w", err)
+		}
+
+		line = append(line, '\n')
+
+		err = audit.rotateFor(len(line))
+		if err != nil {
+			return err
+		}
+
+		n, err := audit.file.Write(line)
+		audit.size += int64(n)
+
+		if err != nil {
+			return fmt.Errorf("error writing the audit log: %w", err)
+		}
+	}
+
+	err := audit.file.Sync()
+	if err != nil {
+		return fmt.Errorf("error syncing the audit log: %w", err)
+	}
+
+	return nil
+}
+
+// Run closes the audit log once the context is cancelled.
+func (audit *AuditLog) Run(ctx context.Context) {
+	<-ctx.Done()
+
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+
+	audit.closed = true
+
+	if audit.file == nil {
+		return
+	}
+
+	err := audit.file.Close()
+	if err != nil {
+		slog.Error("Error closing the audit log", slog.String("path", audit.path), slog.Any("err", err))
+	}
+
+	audit.file = nil
+}
+
+// rotateFor opens the audit log if it isn't open yet, and rotates it first if it has been open for
+// longer than max_age, or if a line of the given length would take it past max_size_mb. A line longer
+// than max_size_mb is still written, to a file of its own.
+func (audit *AuditLog) rotateFor(length int) error {
+	if audit.file != nil {
+		expired := audit.now().Sub(audit.openedAt) >= audit.maxAge
+		full := audit.size > 0 && audit.size+int64(length) > audit.maxSize
+
+		if !expired && !full {
+			return nil
+		}
+
+		err := audit.rotate()
+		if err != nil {
+			return err
+		}
+	}
+
+	return audit.open()
+}
+
+// open opens the audit log for appending, creating it and its directory if they don't exist.
+func (audit *AuditLog) open() error {
+	err := os.MkdirAll(filepath.Dir(audit.path), auditDirMode)
+	if err != nil {
+		return fmt.Errorf("error creating the audit log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(audit.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, auditFileMode)
+	if err != nil {
+		return fmt.Errorf("error opening the audit log: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+
+		return fmt.Errorf("error opening the audit log: %w", err)
+	}
+
+	audit.file = file
+	audit.openedAt = audit.now()
+	audit.size = info.Size()
+
+	return nil
+}
+
+// rotate closes the audit log, renames it with the current time, and removes the oldest rotated files
+// past max_backups.
+func (audit *AuditLog) rotate() error {
+	err := audit.file.Close()
+	audit.file = nil
+
+	if err != nil {
+		return fmt.Errorf("error closing the audit log for rotation: %w", err)
+	}
+
+	prefix, ext := audit.rotatedName()
+
+	err = os.Rename(audit.path, prefix+audit.now().UTC().Format(auditRotationLayout)+ext)
+	if err != nil {
+		return fmt.Errorf("error rotating the audit log: %w", err)
+	}
+
+	if audit.maxBackups == 0 {
+		return nil
+	}
+
+	rotated, err := audit.rotatedLogs()
+	if err != nil {
+		return fmt.Errorf("error listing the rotated audit logs: %w", err)
+	}
+
+	for _, old := range rotated[:max(len(rotated)-audit.maxBackups, 0)] {
+		err = os.Remove(old)
+		if err != nil {
+			slog.Error("Error removing an old audit log", slog.String("path", old), slog.Any("err", err))
+		}
+	}
+
+	return nil
+}
+
+// rotatedLogs returns the paths of the rotated audit logs, oldest first. Only the files named exactly
+// like a rotated log, with a timestamp in auditRotationLayout, are listed, so that pruning never removes
+// another file that happens to share the audit log's prefix and extension, like audit-archive.jsonl.
+func (audit *AuditLog) rotatedLogs() ([]string, error) {
+	prefix, ext := audit.rotatedName()
+	dir, prefix := filepath.Split(prefix)
+
+	entries, err := os.ReadDir(filepath.Dir(audit.path))
+	if err != nil {
+		return nil, err
+	}
+
+	var rotated []string
+
+	for _, entry := range entries {
+		timestamp, ok := strings.CutPrefix(entry.Name(), prefix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		timestamp, ok = strings.CutSuffix(timestamp, ext)
+		if !ok {
+			continue
+		}
+
+		if _, err = time.Parse(auditRotationLayout, timestamp); err == nil {
+			rotated = append(rotated, dir+entry.Name())
+		}
+	}
+
+	// the timestamps sort by time.
+	slices.Sort(rotated)
+
+	return rotated, nil
+}
+
+// rotatedName returns the prefix and extension of the rotated audit logs: audit.jsonl is rotated to
+// audit-<timestamp>.jsonl.
+func (audit *AuditLog) rotatedName() (string, string) {
+	ext := filepath.Ext(audit.path)
+
+	return strings.TrimSuffix(audit.path, ext) + "-", ext
+}
@@ -0,0 +1,579 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	// Import the MySQL driver for the audit database.
+	_ "github.com/go-sql-driver/mysql"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+)
+
+const (
+	// DefaultAuditTableFlushInterval is how often the buffered rows are written when flush_interval isn't set.
+	DefaultAuditTableFlushInterval = time.Second
+
+	// DefaultAuditTableBufferSize is how many rows can be waiting to be written when buffer_size isn't set.
+	DefaultAuditTableBufferSize = 1000
+
+	// DefaultAuditSpillMaxSizeMB is the size the spill file can grow to when spill_max_size_mb isn't set.
+	DefaultAuditSpillMaxSizeMB = 100
+
+	// AuditTableSchema and AuditTableName are where the rows are written: query_sniper.kill_events.
+	AuditTableSchema = "query_sniper"
+	AuditTableName   = "kill_events"
+
+	// auditTableBatchSize is the most rows written by a single INSERT.
+	auditTableBatchSize = 100
+
+	// auditTableTimeout bounds every statement, so that a hung audit database only delays the writer.
+	auditTableTimeout = 5 * time.Second
+
+	// auditTableCreateBackoff is the delay before creating the table is retried after it fails, doubling
+	// with every failure up to auditTableMaxCreateBackoff.
+	auditTableCreateBackoff    = time.Second
+	auditTableMaxCreateBackoff = time.Minute
+)
+
+var (
+	// ErrAuditTableQueueFull is returned when rows are dropped because the write queue is full.
+	ErrAuditTableQueueFull = errors.New("audit table write queue is full")
+
+	// ErrAuditTableNotCreated is returned when rows can't be written because creating the table failed,
+	// and it isn't time to retry yet.
+	ErrAuditTableNotCreated = errors.New("audit table has not been created")
+)
+
+// auditTableColumns are the columns of the kill_events table written for every row, in order.
+var auditTableColumns = []string{
+	"timestamp", "db", "kind", "process_id", "transaction_id", "user", "schema", "command",
+	"runtime", "digest_text", "explain", "tags", "rule", "action", "dry_run", "outcome", "error",
+}
+
+// auditTableDDL creates the kill_events table, if it doesn't exist yet.
+var auditTableDDL = []string{
+	"CREATE DATABASE IF NOT EXISTS `" + AuditTableSchema + "`",
+	"CREATE TABLE IF NOT EXISTS `" + AuditTableSchema + "`.`" + AuditTableName + "` (" + `
+		id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+		timestamp DATETIME(6) NOT NULL,
+		db VARCHAR(255) NOT NULL,
+		kind VARCHAR(32) NOT NULL,
+		process_id BIGINT UNSIGNED NOT NULL,
+		transaction_id BIGINT UNSIGNED NULL,
+		user VARCHAR(255) NOT NULL,
+		` + "`schema`" + ` VARCHAR(255) NOT NULL,
+		command VARCHAR(32) NOT NULL,
+		runtime DOUBLE NOT NULL,
+		digest_text TEXT NOT NULL,
+		` + "`explain`" + ` JSON NULL,
+		tags JSON NULL,
+		rule VARCHAR(255) NULL,
+		action VARCHAR(32) NULL,
+		dry_run BOOLEAN NOT NULL,
+		outcome VARCHAR(32) NOT NULL,
+		error TEXT NULL,
+		PRIMARY KEY (id),
+		KEY timestamp (timestamp),
+		KEY db_timestamp (db, timestamp)
+	) ENGINE=InnoDB`,
+}
+
+// AuditTable inserts a row for every detection and kill into query_sniper.kill_events on the audit
+// database, which it creates if it's missing. Notify only queues the rows; they're written in batches
+// by Run, so a slow or dead audit database never blocks a sniper. Rows are dropped when the queue is
+// full. Batches that can't be written are appended to the spill file, if there is one, and replayed
+// once the audit database is back.
+type AuditTable struct {
+	createRetry   time.Time // when creating the table can be retried, after it failed
+	db            *sql.DB   // opened by Run
+	queue         chan AuditRecord
+	dsn           string
+	spillPath     string
+	interval      time.Duration
+	createBackoff time.Duration // how long to wait before retrying the next time creating the table fails
+	maxSpillSize  int64
+	created       bool // whether the table has been created, or found to exist
+	spilled       bool // whether the spill file may have rows to replay
+}
+
+// NewAuditTable creates a new AuditTable writing to the database at dsn. Nothing is written, and the
+// database isn't connected to, until Run is called.
+func NewAuditTable(config configuration.AuditDatabaseConfig, dsn string) *AuditTable {
+	table := &AuditTable{
+		createBackoff: auditTableCreateBackoff,
+		dsn:           dsn,
+		interval:      config.FlushInterval,
+		maxSpillSize:  int64(config.SpillMaxSizeMB) << 20, //nolint:mnd // megabytes
+		spillPath:     config.SpillPath,
+	}
+
+	if table.interval == 0 {
+		table.interval = DefaultAuditTableFlushInterval
+	}
+
+	if table.maxSpillSize == 0 {
+		table.maxSpillSize = DefaultAuditSpillMaxSizeMB << 20 //nolint:mnd // megabytes
+	}
+
+	bufferSize := config.BufferSize
+	if bufferSize == 0 {
+		bufferSize = DefaultAuditTableBufferSize
+	}
+
+	table.queue = make(chan AuditRecord, bufferSize)
+
+	// a spill file left behind by the last run is replayed with the first batch.
+	if table.spillPath != "" {
+		if info, statErr := os.Stat(table.spillPath); statErr == nil && info.Size() > 0 {
+			table.spilled = true
+		}
+	}
+
+	return table
+}
+
+// Notify queues a row for each event. It never blocks; if the queue is full, the rows are dropped and
+// ErrAuditTableQueueFull is returned. Circuit breaker and admin events aren't about an offender, so they
+// have no row.
+func (table *AuditTable) Notify(_ context.Context, events []Event) error {
+	dropped := 0
+
+	for _, event := range events {
+		if event.Kind == KindCircuitBreaker || event.Kind == KindAdmin {
+			continue
+		}
+
+		select {
+		case table.queue <- NewAuditRecord(event):
+		default:
+			dropped++
+		}
+	}
+
+	if dropped > 0 {
+		return fmt.Errorf("%w: dropped %d rows", ErrAuditTableQueueFull, dropped)
+	}
+
+	return nil
+}
+
+// Run creates the table, and then writes the queued rows every flush_interval, or as soon as a batch is
+// full, until the context is cancelled. The rows still queued then are given one last chance to be
+// written before they're spilled.
+func (table *AuditTable) Run(ctx context.Context) {
+	db, err := sql.Open("mysql", table.dsn)
+	if err != nil {
+		// the DSN has already been validated, so this shouldn't happen.
+		slog.Error("Error opening the audit database, the audit table is disabled", slog.Any("err", err))
+
+		return
+	}
+	defer db.Close()
+
+	// a single writer never needs more than one connection.
+	db.SetMaxOpenConns(1)
+
+	table.db = db
+
+	// the table is created up front, so that a missing grant is reported at startup rather than with
+	// the first kill. If it fails, it's retried with a backoff before the writes, which spill until then.
+	err = table.create(ctx)
+	if err != nil {
+		slog.Error("Error creating the audit table, retrying before the next write",
+			slog.Duration("retry_in", time.Until(table.createRetry)),
+			slog.Any("err", err),
+		)
+	}
+
+	ticker := time.NewTicker(table.interval)
+	defer ticker.Stop()
+
+	batch := make([]AuditRecord, 0, auditTableBatchSize)
+
+	for {
+		select {
+		case <-ctx.Done():
+			for len(table.queue) > 0 {
+				batch = append(batch, <-table.queue)
+			}
+
+			// the spill file is left for the next run, rather than delaying the shutdown.
+			if len(batch) > 0 {
+				table.write(context.WithoutCancel(ctx), batch)
+			}
+
+			return
+
+		case record := <-table.queue:
+			batch = append(batch, record)
+			if len(batch) < auditTableBatchSize {
+				continue
+			}
+
+			table.flush(ctx, batch)
+			batch = batch[:0]
+
+		case <-ticker.C:
+			table.flush(ctx, batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// flush writes the batch, and then replays the spill file. If the batch can't be written, it's spilled
+// and the spill file is left for a later flush.
+func (table *AuditTable) flush(ctx context.Context, batch []AuditRecord) {
+	if len(batch) == 0 && !table.spilled {
+		return
+	}
+
+	if table.write(ctx, batch) && table.spilled {
+		table.replay(ctx)
+	}
+}
+
+// write inserts the batch, or spills it if it can't be written. It returns whether it was written.
+func (table *AuditTable) write(ctx context.Context, batch []AuditRecord) bool {
+	err := table.insert(ctx, batch)
+	if err != nil {
+		slog.Error("Error writing to the audit database",
+			slog.Int("rows", len(batch)),
+			slog.Bool("spilled", table.spillPath != ""),
+			slog.Any("err", err),
+		)
+
+		table.spill(batch)
+
+		return false
+	}
+
+	return true
+}
+
+// insert creates the table if it hasn't been yet, and inserts the records in batches.
+func (table *AuditTable) insert(ctx context.Context, records []AuditRecord) error {
+	err := table.create(ctx)
+	if err != nil {
+		return err
+	}
+
+	for batch := range slices.Chunk(records, auditTableBatchSize) {
+		err = table.exec(ctx, auditInsertQuery(len(batch)), auditInsertArgs(batch)...)
+		if err != nil {
+			return fmt.Errorf("error inserting into %s.%s: %w", AuditTableSchema, AuditTableName, err)
+		}
+	}
+
+	return nil
+}
+
+// create creates the kill_events table if it doesn't exist. Once it fails, it isn't retried until the
+// backoff has passed, and ErrAuditTableNotCreated is returned in the meantime.
+func (table *AuditTable) create(ctx context.Context) error {
+	if table.created {
+		return nil
+	}
+
+	if wait := time.Until(table.createRetry); wait > 0 {
+		return fmt.Errorf("%w: retrying in %s", ErrAuditTableNotCreated, wait.Round(time.Millisecond))
+	}
+
+	for _, ddl := range auditTableDDL {
+		err := table.exec(ctx, ddl)
+		if err != nil {
+			table.createRetry = time.Now().Add(table.createBackoff)
+			table.createBackoff = min(table.createBackoff*2, auditTableMaxCreateBackoff)
+
+			return fmt.Errorf("error creating %s.%s: %w", AuditTableSchema, AuditTableName, err)
+		}
+	}
+
+	table.created = true
+	table.createBackoff = auditTableCreateBackoff
+
+	return nil
+}
+
+// exec runs the statement with a timeout.
+func (table *AuditTable) exec(ctx context.Context, query string, args ...any) error {
+	ctx, cancel := context.WithTimeout(ctx, auditTableTimeout)
+	defer cancel()
+
+	_, err := table.db.ExecContext(ctx, query, args...)
+
+	return err //nolint:wrapcheck // wrapped by the callers
+}
+
+// spill appends the records to the spill file as JSON lines, or drops them if there's no spill file
+// or it's full.
+func (table *AuditTable) spill(records []AuditRecord) {
+	if len(records) == 0 {
+		return
+	}
+
+	if table.spillPath == "" {
+		slog.Error("Dropped audit rows, the audit database is unavailable and there is no spill_path", slog.Int("rows", len(records)))
+
+		return
+	}
+
+	lines, err := spillLines(records)
+	if err == nil {
+		err = table.appendSpill(lines)
+	}
+
+	if err != nil {
+		slog.Error("Dropped audit rows, they couldn't be spilled",
+			slog.String("spill_path", table.spillPath),
+			slog.Int("rows", len(records)),
+			slog.Any("err", err),
+		)
+
+		return
+	}
+
+	table.spilled = true
+}
+
+// appendSpill appends the lines to the spill file, unless that would take it past spill_max_size_mb.
+func (table *AuditTable) appendSpill(lines []byte) error {
+	err := os.MkdirAll(filepath.Dir(table.spillPath), auditDirMode)
+	if err != nil {
+		return fmt.Errorf("error creating the spill directory: %w", err)
+	}
+
+	file, err := os.OpenFile(table.spillPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, auditFileMode)
+	if err != nil {
+		return fmt.Errorf("error opening the spill file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("error opening the spill file: %w", err)
+	}
+
+	if info.Size()+int64(len(lines)) > table.maxSpillSize {
+		return fmt.Errorf("spill file is full: %d of %d bytes", info.Size(), table.maxSpillSize)
+	}
+
+	_, err = file.Write(lines)
+	if err != nil {
+		return fmt.Errorf("error writing the spill file: %w", err)
+	}
+
+	err = file.Sync()
+	if err != nil {
+		return fmt.Errorf("error syncing the spill file: %w", err)
+	}
+
+	return nil
+}
+
+// replay inserts the rows in the spill file, and removes it. If the audit database goes away again
+// partway through, the rows that weren't written are left in the spill file.
+func (table *AuditTable) replay(ctx context.Context) {
+	records, err := readSpill(table.spillPath)
+	if err != nil {
+		slog.Error("Error reading the spill file", slog.String("spill_path", table.spillPath), slog.Any("err", err))
+
+		return
+	}
+
+	written := 0
+
+	for batch := range slices.Chunk(records, auditTableBatchSize) {
+		err = table.insert(ctx, batch)
+		if err != nil {
+			break
+		}
+
+		written += len(batch)
+	}
+
+	if written == len(records) {
+		err = os.Remove(table.spillPath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			slog.Error("Error removing the replayed spill file", slog.String("spill_path", table.spillPath), slog.Any("err", err))
+
+			return
+		}
+
+		table.spilled = false
+
+		slog.Info("Replayed the spilled audit rows", slog.Int("rows", written))
+
+		return
+	}
+
+	slog.Warn("Stopped replaying the spilled audit rows, the audit database is unavailable",
+		slog.Int("rows", written),
+		slog.Int("remaining", len(records)-written),
+		slog.Any("err", err),
+	)
+
+	err = table.rewriteSpill(records[written:])
+	if err != nil {
+		slog.Error("Error rewriting the spill file, its rows may be replayed twice",
+			slog.String("spill_path", table.spillPath),
+			slog.Any("err", err),
+		)
+	}
+}
+
+// rewriteSpill replaces the spill file with the records, through a temporary file so that a crash
+// doesn't lose them.
+func (table *AuditTable) rewriteSpill(records []AuditRecord) error {
+	lines, err := spillLines(records)
+	if err != nil {
+		return err
+	}
+
+	temporary := table.spillPath + ".tmp"
+
+	err = os.WriteFile(temporary, lines, auditFileMode)
+	if err != nil {
+		return fmt.Errorf("error writing the spill file: %w", err)
+	}
+
+	err = os.Rename(temporary, table.spillPath)
+	if err != nil {
+		return fmt.Errorf("error replacing the spill file: %w", err)
+	}
+
+	return nil
+}
+
+// spillLines returns the records as JSON lines.
+func spillLines(records []AuditRecord) ([]byte, error) {
+	var lines []byte
+
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return nil, fmt.Errorf("error marshalling audit row: %w", err)
+		}
+
+		lines = append(append(lines, line...), '\n')
+	}
+
+	return lines, nil
+}
+
+// readSpill returns the records in the spill file.
+func readSpill(path string) ([]AuditRecord, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error opening the spill file: %w", err)
+	}
+	defer file.Close()
+
+	var records []AuditRecord
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20) //nolint:mnd // long digests make for long lines
+
+	for scanner.Scan() {
+		var record AuditRecord
+
+		err = json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			// a torn last line from a crash; the rows before it are still good.
+			slog.Warn("Skipping an unreadable line of the spill file", slog.String("spill_path", path), slog.Any("err", err))
+
+			continue
+		}
+
+		records = append(records, record)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return records, fmt.Errorf("error reading the spill file: %w", err)
+	}
+
+	return records, nil
+}
+
+// auditInsertQuery returns the INSERT statement for the given number of rows.
+func auditInsertQuery(rows int) string {
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(auditTableColumns)), ", ") + ")"
+
+	return "INSERT INTO `" + AuditTableSchema + "`.`" + AuditTableName + "` (`" +
+		strings.Join(auditTableColumns, "`, `") + "`) VALUES " +
+		strings.TrimSuffix(strings.Repeat(placeholders+", ", rows), ", ")
+}
+
+// auditInsertArgs returns the arguments of the INSERT statement for the records, in the order of
+// auditTableColumns.
+func auditInsertArgs(records []AuditRecord) []any {
+	args := make([]any, 0, len(records)*len(auditTableColumns))
+
+	for _, record := range records {
+		var transactionID any
+		if record.TransactionID != 0 {
+			transactionID = record.TransactionID
+		}
+
+		args = append(args,
+			record.Timestamp.UTC(),
+			record.DB,
+			record.Kind,
+			record.ProcessID,
+			transactionID,
+			record.User,
+			record.Schema,
+			record.Command,
+			record.Runtime,
+			record.DigestText,
+			nullIfEmpty(record.Explain),
+			tagsJSON(record.Tags),
+			nullIfEmpty(record.Rule),
+			nullIfEmpty(record.Action),
+			record.DryRun,
+			record.Outcome,
+			nullIfEmpty(record.Error),
+		)
+	}
+
+	return args
+}
+
+// tagsJSON returns the tags as a JSON object, or nil if there are none, so that they're written as NULL.
+func tagsJSON(tags map[string]string) any {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	encoded, err := json.Marshal(tags)
+	if err != nil {
+		return nil
+	}
+
+	return string(encoded)
+}
+
+// nullIfEmpty returns nil for an empty string, so that it's written as NULL.
+func nullIfEmpty(value string) any {
+	if value == "" {
+		return nil
+	}
+
+	return value
+}
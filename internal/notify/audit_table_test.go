@@ -0,0 +1,249 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+)
+
+// unreachableDSN points at a port nothing listens on, so that every write to the audit database fails.
+const unreachableDSN = "sniper:secret@tcp(127.0.0.1:1)/?timeout=1s"
+
+func TestAuditTable_Notify(t *testing.T) {
+	t.Parallel()
+
+	table := NewAuditTable(configuration.AuditDatabaseConfig{BufferSize: 2}, unreachableDSN)
+
+	events := []Event{
+		{DB: "primary", Kind: KindProcess, Outcome: OutcomeKilled, ProcessID: 1},
+		{DB: "primary", Kind: KindCircuitBreaker, Outcome: OutcomeTripped},
+		{DB: "primary", Kind: KindAdmin, Outcome: OutcomeApplied, Admin: &AdminChange{Caller: "alice", Action: "pause"}},
+		{DB: "primary", Kind: KindProcess, Outcome: OutcomeKilled, ProcessID: 2},
+		{DB: "primary", Kind: KindProcess, Outcome: OutcomeKilled, ProcessID: 3},
+	}
+
+	err := table.Notify(context.Background(), events)
+	if !errors.Is(err, ErrAuditTableQueueFull) {
+		t.Errorf("Notify() error = %v, want %v", err, ErrAuditTableQueueFull)
+	}
+
+	// the breaker and admin events have no row, so only the last process is dropped.
+	if len(table.queue) != 2 {
+		t.Fatalf("Notify() queued %d rows, want 2", len(table.queue))
+	}
+
+	if record := <-table.queue; record.ProcessID != 1 {
+		t.Errorf("Notify() queued process %d first, want 1", record.ProcessID)
+	}
+}
+
+func TestAuditTable_SpillWhileDown(t *testing.T) {
+	t.Parallel()
+
+	spillPath := filepath.Join(t.TempDir(), "spill", "kill_events.jsonl")
+
+	table := NewAuditTable(configuration.AuditDatabaseConfig{SpillPath: spillPath, FlushInterval: 10 * time.Millisecond}, unreachableDSN)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		table.Run(ctx)
+	}()
+
+	events := []Event{
+		{DB: "primary", Kind: KindProcess, Outcome: OutcomeKilled, ProcessID: 1},
+		{DB: "primary", Kind: KindTransaction, Outcome: OutcomeDryRun, ProcessID: 2, TransactionID: 20, DryRun: true},
+	}
+
+	err := table.Notify(ctx, events)
+	if err != nil {
+		t.Fatalf("Notify() unexpected error = %v", err)
+	}
+
+	// the rows are spilled once the first write fails.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		records, _ := readSpill(spillPath)
+		if len(records) == len(events) || time.Now().After(deadline) {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+
+	records, err := readSpill(spillPath)
+	if err != nil {
+		t.Fatalf("readSpill() unexpected error = %v", err)
+	}
+
+	if len(records) != len(events) || records[1].TransactionID != 20 || !records[1].DryRun {
+		t.Errorf("spilled rows = %+v, want the two events", records)
+	}
+
+	// a restarted sniper replays the rows left behind.
+	if restarted := NewAuditTable(configuration.AuditDatabaseConfig{SpillPath: spillPath}, unreachableDSN); !restarted.spilled {
+		t.Error("NewAuditTable() didn't pick up the spill file left behind")
+	}
+}
+
+func TestAuditTable_CreateBackoff(t *testing.T) {
+	t.Parallel()
+
+	table := NewAuditTable(configuration.AuditDatabaseConfig{}, unreachableDSN)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		table.Run(ctx)
+	}()
+
+	// Run tries to create the table straight away, before anything is written.
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after the context was cancelled")
+	}
+
+	if table.created || table.createRetry.IsZero() || table.createBackoff != 2*auditTableCreateBackoff {
+		t.Fatalf("Run() left created = %v, retry = %v, backoff = %v, want a failed attempt backing off",
+			table.created, table.createRetry, table.createBackoff)
+	}
+
+	// until the backoff has passed, creating the table isn't retried.
+	err := table.create(context.Background())
+	if !errors.Is(err, ErrAuditTableNotCreated) {
+		t.Errorf("create() error = %v, want %v", err, ErrAuditTableNotCreated)
+	}
+
+	// once it has, it is, and the backoff doubles again.
+	table.createRetry = time.Now()
+
+	err = table.create(context.Background())
+	if err == nil || errors.Is(err, ErrAuditTableNotCreated) {
+		t.Errorf("create() error = %v, want a connection error", err)
+	}
+
+	if table.createBackoff != 4*auditTableCreateBackoff {
+		t.Errorf("createBackoff = %v, want %v", table.createBackoff, 4*auditTableCreateBackoff)
+	}
+}
+
+func TestAuditTable_Spill(t *testing.T) {
+	t.Parallel()
+
+	records := []AuditRecord{{DB: "primary", ProcessID: 1}, {DB: "primary", ProcessID: 2}}
+
+	tests := []struct {
+		name         string
+		maxSpillSize int64
+		wantRecords  int
+		spillPath    bool
+		wantSpilled  bool
+	}{
+		{name: "no spill path", spillPath: false, maxSpillSize: 1 << 20, wantRecords: 0, wantSpilled: false},
+		{name: "spilled", spillPath: true, maxSpillSize: 1 << 20, wantRecords: 2, wantSpilled: true},
+		{name: "spill file is full", spillPath: true, maxSpillSize: 16, wantRecords: 0, wantSpilled: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "kill_events.jsonl")
+
+			table := &AuditTable{maxSpillSize: tt.maxSpillSize}
+			if tt.spillPath {
+				table.spillPath = path
+			}
+
+			table.spill(records)
+
+			if table.spilled != tt.wantSpilled {
+				t.Errorf("spill() spilled = %v, want %v", table.spilled, tt.wantSpilled)
+			}
+
+			spilled, err := readSpill(path)
+			if err != nil {
+				t.Fatalf("readSpill() unexpected error = %v", err)
+			}
+
+			if len(spilled) != tt.wantRecords {
+				t.Errorf("spill file has %d rows, want %d", len(spilled), tt.wantRecords)
+			}
+		})
+	}
+}
+
+func TestReadSpill_TornLine(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "kill_events.jsonl")
+
+	err := os.WriteFile(path, []byte(`{"db":"primary","process_id":1}`+"\n"+`{"db":"prim`), 0o600)
+	if err != nil {
+		t.Fatalf("error writing the spill file: %v", err)
+	}
+
+	records, err := readSpill(path)
+	if err != nil {
+		t.Fatalf("readSpill() unexpected error = %v", err)
+	}
+
+	if len(records) != 1 || records[0].ProcessID != 1 {
+		t.Errorf("readSpill() = %+v, want the first row and the torn one skipped", records)
+	}
+
+	table := &AuditTable{spillPath: path}
+
+	err = table.rewriteSpill(records[:0])
+	if err != nil {
+		t.Fatalf("rewriteSpill() unexpected error = %v", err)
+	}
+
+	if records, _ = readSpill(path); len(records) != 0 {
+		t.Errorf("readSpill() after rewriting = %+v, want none", records)
+	}
+}
+
+func TestAuditInsertQuery(t *testing.T) {
+	t.Parallel()
+
+	query := auditInsertQuery(2)
+
+	if !strings.HasPrefix(query, "INSERT INTO `query_sniper`.`kill_events` (`timestamp`, `db`, ") {
+		t.Errorf("auditInsertQuery() = %q, want an insert into query_sniper.kill_events", query)
+	}
+
+	if got := strings.Count(query, "?"); got != 2*len(auditTableColumns) {
+		t.Errorf("auditInsertQuery(2) has %d placeholders, want %d", got, 2*len(auditTableColumns))
+	}
+
+	args := auditInsertArgs([]AuditRecord{{ProcessID: 1}, {ProcessID: 2, TransactionID: 20, Explain: `{"query_block":{}}`, Tags: map[string]string{"controller": "books"}, Rule: "web"}})
+	if len(args) != 2*len(auditTableColumns) {
+		t.Fatalf("auditInsertArgs() returned %d args, want %d", len(args), 2*len(auditTableColumns))
+	}
+
+	// empty transaction ids, plans, tags, rules, actions and errors are written as NULL.
+	second := args[len(auditTableColumns):]
+	if args[4] != nil || args[10] != nil || args[11] != nil || args[12] != nil ||
+		second[4] != 20 || second[10] != `{"query_block":{}}` || second[11] != `{"controller":"books"}` || second[12] != "web" {
+		t.Errorf("auditInsertArgs() = %v, want NULLs for the empty values", args)
+	}
+}
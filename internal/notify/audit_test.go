@@ -0,0 +1,331 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+)
+
+var errTestKill = errors.New("kill failed")
+
+// newTestAuditLog returns an audit log in a temporary directory, with a clock that the test moves.
+func newTestAuditLog(t *testing.T, config configuration.AuditFileConfig) (*AuditLog, *time.Time) {
+	t.Helper()
+
+	config.Path = filepath.Join(t.TempDir(), "audit", "kills.jsonl")
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	audit := NewAuditLog(config)
+	audit.now = func() time.Time { return now }
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		audit.Run(ctx)
+	})
+
+	return audit, &now
+}
+
+// readAuditLog returns the records in the audit log file.
+func readAuditLog(t *testing.T, path string) []AuditRecord {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("error opening the audit log: %v", err)
+	}
+	defer file.Close()
+
+	var records []AuditRecord
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record AuditRecord
+
+		err = json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			t.Fatalf("audit log line %q isn't JSON: %v", scanner.Text(), err)
+		}
+
+		records = append(records, record)
+	}
+
+	return records
+}
+
+func TestAuditLog_Notify(t *testing.T) {
+	t.Parallel()
+
+	audit, now := newTestAuditLog(t, configuration.AuditFileConfig{})
+
+	events := []Event{
+		{
+			Time:          *now,
+			DB:            "primary",
+			Kind:          KindTransaction,
+			Outcome:       OutcomeKilled,
+			Action:        configuration.RuleActionKillConnection,
+			User:          "app",
+			Schema:        "orders",
+			DigestText:    "UPDATE `orders` SET `state` = ?",
+			Explain:       `{"query_block":{"select_id":1}}`,
+			Runtime:       90 * time.Second,
+			ProcessID:     7,
+			TransactionID: 1234,
+		},
+		{
+			Time:      *now,
+			DB:        "primary",
+			Kind:      KindProcess,
+			Outcome:   OutcomeFailed,
+			Err:       errTestKill,
+			Tags:      map[string]string{"controller": "books"},
+			ProcessID: 8,
+			DryRun:    true,
+		},
+	}
+
+	err := audit.Notify(context.Background(), events)
+	if err != nil {
+		t.Fatalf("Notify() unexpected error = %v", err)
+	}
+
+	err = audit.Notify(context.Background(), events[:1])
+	if err != nil {
+		t.Fatalf("Notify() unexpected error = %v", err)
+	}
+
+	records := readAuditLog(t, audit.path)
+	if len(records) != 3 {
+		t.Fatalf("audit log has %d records, want 3 appended", len(records))
+	}
+
+	want := AuditRecord{
+		Timestamp:     *now,
+		DB:            "primary",
+		Kind:          KindTransaction,
+		Outcome:       OutcomeKilled,
+		Action:        configuration.RuleActionKillConnection,
+		User:          "app",
+		Schema:        "orders",
+		DigestText:    "UPDATE `orders` SET `state` = ?",
+		Explain:       `{"query_block":{"select_id":1}}`,
+		Runtime:       90,
+		ProcessID:     7,
+		TransactionID: 1234,
+	}
+
+	if !reflect.DeepEqual(records[0], want) {
+		t.Errorf("audit record = %+v, want %+v", records[0], want)
+	}
+
+	if records[1].Error != errTestKill.Error() || !records[1].DryRun || records[1].Tags["controller"] != "books" {
+		t.Errorf("audit record = %+v, want the kill error, dry run and tags", records[1])
+	}
+
+	change := AdminChange{Caller: "alice", Action: "set_dry_run", OldState: "dry_run=configured", NewState: "dry_run=true"}
+
+	err = audit.Notify(context.Background(), []Event{{Time: *now, DB: "primary", Kind: KindAdmin, Outcome: OutcomeApplied, Admin: &change}})
+	if err != nil {
+		t.Fatalf("Notify() unexpected error = %v", err)
+	}
+
+	records = readAuditLog(t, audit.path)
+	if len(records) != 4 || records[3].Kind != KindAdmin || records[3].Admin == nil || *records[3].Admin != change {
+		t.Errorf("audit records = %+v, want the admin change appended", records)
+	}
+}
+
+func TestAuditLog_Rotate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		advance      time.Duration // how far the clock moves before the second event
+		wantRotated  int
+		wantCurrent  int
+		wantCombined int
+	}{
+		{
+			name:         "neither too old nor too big",
+			advance:      time.Hour,
+			wantRotated:  0,
+			wantCurrent:  2,
+			wantCombined: 2,
+		},
+		{
+			name:         "too old",
+			advance:      DefaultAuditMaxAge,
+			wantRotated:  1,
+			wantCurrent:  1,
+			wantCombined: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			audit, now := newTestAuditLog(t, configuration.AuditFileConfig{})
+
+			event := Event{DB: "primary", Kind: KindProcess, Outcome: OutcomeKilled}
+
+			err := audit.Notify(context.Background(), []Event{event})
+			if err != nil {
+				t.Fatalf("Notify() unexpected error = %v", err)
+			}
+
+			*now = now.Add(tt.advance)
+
+			err = audit.Notify(context.Background(), []Event{event})
+			if err != nil {
+				t.Fatalf("Notify() unexpected error = %v", err)
+			}
+
+			prefix, ext := audit.rotatedName()
+
+			rotated, _ := filepath.Glob(prefix + "*" + ext)
+			if len(rotated) != tt.wantRotated {
+				t.Fatalf("rotated audit logs = %v, want %d", rotated, tt.wantRotated)
+			}
+
+			current := readAuditLog(t, audit.path)
+			if len(current) != tt.wantCurrent {
+				t.Errorf("audit log has %d records, want %d", len(current), tt.wantCurrent)
+			}
+
+			combined := len(current)
+			for _, path := range rotated {
+				combined += len(readAuditLog(t, path))
+			}
+
+			if combined != tt.wantCombined {
+				t.Errorf("audit logs have %d records in all, want %d", combined, tt.wantCombined)
+			}
+		})
+	}
+}
+
+func TestAuditLog_RotateBySize(t *testing.T) {
+	t.Parallel()
+
+	audit, now := newTestAuditLog(t, configuration.AuditFileConfig{MaxBackups: 2})
+
+	// a single line is enough to fill a tiny audit log, so every event after the first rotates it.
+	audit.maxSize = 1
+
+	for range 5 {
+		err := audit.Notify(context.Background(), []Event{{DB: "primary", Kind: KindProcess, Outcome: OutcomeKilled}})
+		if err != nil {
+			t.Fatalf("Notify() unexpected error = %v", err)
+		}
+
+		*now = now.Add(time.Second)
+	}
+
+	prefix, ext := audit.rotatedName()
+
+	rotated, _ := filepath.Glob(prefix + "*" + ext)
+	if len(rotated) != 2 {
+		t.Errorf("rotated audit logs = %v, want the newest 2 of 4 kept", rotated)
+	}
+
+	if records := readAuditLog(t, audit.path); len(records) != 1 {
+		t.Errorf("audit log has %d records, want 1", len(records))
+	}
+}
+
+func TestAuditLog_RotateKeepsOtherFiles(t *testing.T) {
+	t.Parallel()
+
+	audit, now := newTestAuditLog(t, configuration.AuditFileConfig{MaxBackups: 1})
+	audit.maxSize = 1
+
+	event := Event{DB: "primary", Kind: KindProcess, Outcome: OutcomeKilled}
+
+	err := audit.Notify(context.Background(), []Event{event})
+	if err != nil {
+		t.Fatalf("Notify() unexpected error = %v", err)
+	}
+
+	// files that share the audit log's prefix and extension, but aren't rotated audit logs, and sort
+	// before them.
+	dir := filepath.Dir(audit.path)
+	others := []string{"kills-0-archive.jsonl", "kills-20250101.jsonl", "kills-2025.01.01T00.jsonl"}
+
+	for _, name := range others {
+		err = os.WriteFile(filepath.Join(dir, name), []byte("keep me\n"), 0o600)
+		if err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+
+	for range 3 {
+		*now = now.Add(time.Second)
+
+		err = audit.Notify(context.Background(), []Event{event})
+		if err != nil {
+			t.Fatalf("Notify() unexpected error = %v", err)
+		}
+	}
+
+	for _, name := range others {
+		if _, err = os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s was removed by the rotation: %v", name, err)
+		}
+	}
+
+	rotated, err := audit.rotatedLogs()
+	if err != nil {
+		t.Fatalf("rotatedLogs() error = %v", err)
+	}
+
+	if want := []string{filepath.Join(dir, "kills-20260301T120003.000.jsonl")}; !slices.Equal(rotated, want) {
+		t.Errorf("rotatedLogs() = %v, want %v", rotated, want)
+	}
+}
+
+func TestAuditLog_Reopen(t *testing.T) {
+	t.Parallel()
+
+	audit, _ := newTestAuditLog(t, configuration.AuditFileConfig{})
+
+	event := Event{DB: "primary", Kind: KindProcess, Outcome: OutcomeKilled}
+
+	err := audit.Notify(context.Background(), []Event{event})
+	if err != nil {
+		t.Fatalf("Notify() unexpected error = %v", err)
+	}
+
+	// a restarted sniper appends to the audit log it left behind.
+	restarted := NewAuditLog(configuration.AuditFileConfig{Path: audit.path})
+
+	err = restarted.Notify(context.Background(), []Event{event})
+	if err != nil {
+		t.Fatalf("Notify() unexpected error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	restarted.Run(ctx)
+
+	if records := readAuditLog(t, audit.path); len(records) != 2 {
+		t.Errorf("audit log has %d records, want 2", len(records))
+	}
+
+	err = restarted.Notify(context.Background(), []Event{event})
+	if !errors.Is(err, ErrAuditLogClosed) {
+		t.Errorf("Notify() after Run returned error = %v, want %v", err, ErrAuditLogClosed)
+	}
+}
@@ -0,0 +1,277 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+)
+
+const (
+	// DefaultDatadogNamespace is the prefix for the metric names when namespace isn't set.
+	DefaultDatadogNamespace = "query_sniper."
+
+	// datadogQueueSize is the number of datagrams that can be waiting to be sent before new ones are dropped.
+	datadogQueueSize = 1024
+
+	// datadogDialBackoff is the delay before retrying a failed dial, doubled for each failure after, up
+	// to datadogMaxDialBackoff.
+	datadogDialBackoff    = time.Second
+	datadogMaxDialBackoff = time.Minute
+)
+
+// ErrDatadogQueueFull is returned when datagrams are dropped because the send queue is full.
+var ErrDatadogQueueFull = errors.New("datadog send queue is full")
+
+// datadogTagReplacer removes the characters that would break the dogstatsd format from tags.
+var datadogTagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+// Datadog sends DogStatsD counters for the detections and kills, and a datadog event for every real
+// KILL, to a dogstatsd agent over UDP. Notify only queues the datagrams; they're sent by Run, so a
+// slow or dead agent never blocks a sniper. Datagrams are dropped when the queue is full.
+type Datadog struct {
+	dial        func(ctx context.Context) (net.Conn, error)
+	queue       chan string
+	address     string
+	namespace   string
+	tags        []string
+	dialBackoff time.Duration
+}
+
+// NewDatadog creates a new Datadog notifier from the given config. Nothing is sent until Run is called.
+func NewDatadog(config configuration.DatadogConfig) *Datadog {
+	namespace := config.Namespace
+	if namespace == "" {
+		namespace = DefaultDatadogNamespace
+	}
+
+	if !strings.HasSuffix(namespace, ".") {
+		namespace += "."
+	}
+
+	datadog := &Datadog{
+		address:     config.Address,
+		dialBackoff: datadogDialBackoff,
+		namespace:   namespace,
+		queue:       make(chan string, datadogQueueSize),
+		tags:        config.Tags,
+	}
+
+	datadog.dial = func(ctx context.Context) (net.Conn, error) {
+		var dialer net.Dialer
+
+		return dialer.DialContext(ctx, "udp", datadog.address)
+	}
+
+	return datadog
+}
+
+// Notify queues the metrics and events for the given events. It never blocks; if the queue is
+// full, the datagrams are dropped and ErrDatadogQueueFull is returned.
+func (datadog *Datadog) Notify(_ context.Context, events []Event) error {
+	dropped := 0
+
+	for _, event := range events {
+		for _, datagram := range datadog.datagrams(event) {
+			select {
+			case datadog.queue <- datagram:
+			default:
+				dropped++
+			}
+		}
+	}
+
+	if dropped > 0 {
+		return fmt.Errorf("%w: dropped %d datagrams", ErrDatadogQueueFull, dropped)
+	}
+
+	return nil
+}
+
+// Run sends the queued datagrams to the agent until the context is cancelled.
+func (datadog *Datadog) Run(ctx context.Context) {
+	conn := datadog.connect(ctx)
+	if conn == nil {
+		return
+	}
+	defer conn.Close()
+
+	var err error
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case datagram := <-datadog.queue:
+			_, err = conn.Write([]byte(datagram))
+			if err != nil {
+				// this is usually ECONNREFUSED because the agent isn't running; there's nothing to do but drop it.
+				slog.Debug("Error sending datagram to the dogstatsd agent",
+					slog.String("address", datadog.address),
+					slog.Any("err", err),
+				)
+			}
+		}
+	}
+}
+
+// connect dials the agent, retrying with an exponential backoff until it succeeds or the context is
+// cancelled, in which case it returns nil. UDP is connectionless, so dialing only fails if the address
+// can't be resolved, which is usually a transient DNS failure (e.g. the agent's service isn't up yet).
+// The datagrams queued in the meantime are sent once it connects, or dropped if the queue fills up.
+func (datadog *Datadog) connect(ctx context.Context) net.Conn {
+	backoff := datadog.dialBackoff
+
+	for {
+		conn, err := datadog.dial(ctx)
+		if err == nil {
+			return conn
+		}
+
+		slog.Error("Error connecting to the dogstatsd agent, retrying",
+			slog.String("address", datadog.address),
+			slog.Duration("retry_in", backoff),
+			slog.Any("err", err),
+		)
+
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, datadogMaxDialBackoff)
+	}
+}
+
+// datagrams returns the dogstatsd datagrams for an event. These mirror the prometheus metrics: every
+// event counts as detected, and dry run kills count as killed.
+func (datadog *Datadog) datagrams(event Event) []string {
+	if event.Kind == KindCircuitBreaker {
+		tags := datadog.withTags("db:" + event.DB)
+
+		return []string{datadog.count(datadog.namespace+"circuit_breaker.tripped", tags), datadog.breakerEvent(event, tags)}
+	}
+
+	if event.Kind == KindAdmin {
+		if event.Admin == nil {
+			return nil
+		}
+
+		tags := datadog.withTags("db:"+event.DB, "action:"+event.Admin.Action, "caller:"+event.Admin.Caller)
+
+		return []string{datadog.count(datadog.namespace+"admin.actions", tags), datadog.adminEvent(event, tags)}
+	}
+
+	tags := datadog.eventTags(event)
+	var prefix string
+
+	switch event.Kind {
+	case KindTransaction:
+		prefix = datadog.namespace + "transactions."
+	case KindBlocker:
+		prefix = datadog.namespace + "blockers."
+	case KindMetadataLock:
+		prefix = datadog.namespace + "metadata_locks."
+	case KindIdleTransaction:
+		prefix = datadog.namespace + "idle_transactions."
+	default:
+		prefix = datadog.namespace + "processes."
+	}
+
+	datagrams := []string{datadog.count(prefix+"detected", tags)}
+
+	switch event.Outcome {
+	case OutcomeDryRun:
+		datagrams = append(datagrams, datadog.count(prefix+"killed", tags))
+
+	case OutcomeKilled:
+		datagrams = append(datagrams, datadog.count(prefix+"killed", tags), datadog.event(event, tags))
+
+	case OutcomeFailed:
+		datagrams = append(datagrams, datadog.count(datadog.namespace+"kill_failures", datadog.withTags("db:"+event.DB, "kind:"+event.Kind)))
+	}
+
+	return datagrams
+}
+
+// count formats a counter increment.
+func (datadog *Datadog) count(name, tags string) string {
+	return name + ":1|c|#" + tags
+}
+
+// event formats a datadog event for a real KILL.
+func (datadog *Datadog) event(event Event, tags string) string {
+	title := fmt.Sprintf("query-sniper killed a %s on %s", event.Kind, event.DB)
+
+	text := fmt.Sprintf("process %d (user %s, schema %s) had been running for %s",
+		event.ProcessID, event.User, event.Schema, event.Runtime)
+	if event.Waiters > 0 {
+		text += fmt.Sprintf(", %d sessions were waiting on its locks", event.Waiters)
+	}
+
+	if event.Rule != "" {
+		text += ", matched rule " + event.Rule
+	}
+
+	if event.DigestText != "" {
+		text += "\n" + event.DigestText
+	}
+
+	// newlines have to be escaped in the event text.
+	text = strings.ReplaceAll(text, "\n", `\n`)
+
+	return "_e{" + strconv.Itoa(len(title)) + "," + strconv.Itoa(len(text)) + "}:" + title + "|" + text +
+		"|t:warning|s:query-sniper|k:query-sniper-" + event.DB + "|#" + tags
+}
+
+// breakerEvent formats an error datadog event for a circuit breaker trip.
+func (datadog *Datadog) breakerEvent(event Event, tags string) string {
+	title := "query-sniper circuit breaker tripped on " + event.DB
+	text := fmt.Sprint(event.Err)
+
+	return "_e{" + strconv.Itoa(len(title)) + "," + strconv.Itoa(len(text)) + "}:" + title + "|" + text +
+		"|t:error|s:query-sniper|k:query-sniper-" + event.DB + "|#" + tags
+}
+
+// adminEvent formats an info datadog event for an override applied through the admin API.
+func (datadog *Datadog) adminEvent(event Event, tags string) string {
+	title := "query-sniper admin: " + event.Admin.Caller + " applied " + event.Admin.Action
+	if event.DB != "" {
+		title += " on " + event.DB
+	}
+
+	text := event.Admin.transition()
+
+	return "_e{" + strconv.Itoa(len(title)) + "," + strconv.Itoa(len(text)) + "}:" + title + "|" + text +
+		"|t:info|s:query-sniper|k:query-sniper-admin|#" + tags
+}
+
+// eventTags returns the tags for an event's counters.
+func (datadog *Datadog) eventTags(event Event) string {
+	return datadog.withTags(
+		"db:"+event.DB,
+		"schema:"+event.Schema,
+		"user:"+event.User,
+		"dry_run:"+strconv.FormatBool(event.DryRun),
+	)
+}
+
+// withTags joins the given tags and the configured tags.
+func (datadog *Datadog) withTags(tags ...string) string {
+	tags = append(tags, datadog.tags...)
+
+	for i, tag := range tags {
+		tags[i] = datadogTagReplacer.Replace(tag)
+	}
+
+	return strings.Join(tags, ",")
+}
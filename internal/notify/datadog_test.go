@@ -0,0 +1,309 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+)
+
+func TestDatadog_Datagrams(t *testing.T) {
+	t.Parallel()
+
+	datadog := NewDatadog(configuration.DatadogConfig{
+		Address:   "127.0.0.1:8125",
+		Namespace: "sniper",
+		Tags:      []string{"env:test"},
+	})
+
+	tags := "db:primary,schema:web,user:app,dry_run:false,env:test"
+
+	tests := []struct {
+		name    string
+		outcome string
+		want    []string
+	}{
+		{
+			name:    "logged",
+			outcome: OutcomeLogged,
+			want:    []string{"sniper.processes.detected:1|c|#" + tags},
+		},
+		{
+			name:    "dry run",
+			outcome: OutcomeDryRun,
+			want: []string{
+				"sniper.processes.detected:1|c|#" + tags,
+				"sniper.processes.killed:1|c|#" + tags,
+			},
+		},
+		{
+			name:    "failed",
+			outcome: OutcomeFailed,
+			want: []string{
+				"sniper.processes.detected:1|c|#" + tags,
+				"sniper.kill_failures:1|c|#db:primary,kind:process,env:test",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := datadog.datagrams(testEvent("primary", tt.outcome))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("datagrams() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDatadog_KillEvent(t *testing.T) {
+	t.Parallel()
+
+	datadog := NewDatadog(configuration.DatadogConfig{Address: "127.0.0.1:8125"})
+
+	event := testEvent("primary", OutcomeKilled)
+	event.Kind = KindTransaction
+	event.Rule = "web"
+	event.User = "a|b,c" // tags can't contain | or ,
+
+	got := datadog.datagrams(event)
+	if len(got) != 3 {
+		t.Fatalf("datagrams() returned %d datagrams, want 3: %q", len(got), got)
+	}
+
+	if want := "query_sniper.transactions.killed:1|c|#db:primary,schema:web,user:a_b_c,dry_run:false"; got[1] != want {
+		t.Errorf("killed datagram = %q, want %q", got[1], want)
+	}
+
+	title := "query-sniper killed a transaction on primary"
+	text := `process 42 (user a|b,c, schema web) had been running for 1m30s, matched rule web\nSELECT SLEEP (?)`
+
+	// the event text is length prefixed, so it may contain | and , as is.
+	prefix := "_e{" + strconv.Itoa(len(title)) + "," + strconv.Itoa(len(text)) + "}:" + title + "|" + text + "|"
+	if !strings.HasPrefix(got[2], prefix) {
+		t.Errorf("event datagram = %q, want a %q event with the digest text", got[2], title)
+	}
+
+	if !strings.Contains(got[2], "|t:warning|s:query-sniper|k:query-sniper-primary|#db:primary") {
+		t.Errorf("event datagram = %q, want the alert type, source, aggregation key and tags", got[2])
+	}
+}
+
+func TestDatadog_CircuitBreaker(t *testing.T) {
+	t.Parallel()
+
+	datadog := NewDatadog(configuration.DatadogConfig{Address: "127.0.0.1:8125"})
+
+	got := datadog.datagrams(breakerEvent("primary"))
+	if len(got) != 2 {
+		t.Fatalf("datagrams() returned %d datagrams, want 2: %q", len(got), got)
+	}
+
+	if want := "query_sniper.circuit_breaker.tripped:1|c|#db:primary"; got[0] != want {
+		t.Errorf("counter datagram = %q, want %q", got[0], want)
+	}
+
+	if !strings.Contains(got[1], "query-sniper circuit breaker tripped on primary|kill budget exceeded") ||
+		!strings.Contains(got[1], "|t:error|") {
+		t.Errorf("event datagram = %q, want an error event for the trip", got[1])
+	}
+}
+
+func TestDatadog_Admin(t *testing.T) {
+	t.Parallel()
+
+	datadog := NewDatadog(configuration.DatadogConfig{Address: "127.0.0.1:8125"})
+
+	got := datadog.datagrams(Event{
+		DB:      "primary",
+		Kind:    KindAdmin,
+		Outcome: OutcomeApplied,
+		Admin:   &AdminChange{Caller: "alice", Action: "pause", OldState: "running", NewState: "paused"},
+	})
+	if len(got) != 2 {
+		t.Fatalf("datagrams() returned %d datagrams, want 2: %q", len(got), got)
+	}
+
+	if want := "query_sniper.admin.actions:1|c|#db:primary,action:pause,caller:alice"; got[0] != want {
+		t.Errorf("counter datagram = %q, want %q", got[0], want)
+	}
+
+	if !strings.Contains(got[1], "query-sniper admin: alice applied pause on primary|running -> paused") ||
+		!strings.Contains(got[1], "|t:info|") {
+		t.Errorf("event datagram = %q, want an info event for the change", got[1])
+	}
+}
+
+func TestDatadog_Run(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket() error = %v", err)
+	}
+	defer listener.Close()
+
+	datadog := NewDatadog(configuration.DatadogConfig{Address: listener.LocalAddr().String()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		datadog.Run(ctx)
+	}()
+
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	err = datadog.Notify(ctx, []Event{testEvent("primary", OutcomeDryRun)})
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	var received []string
+
+	buf := make([]byte, 1024)
+
+	for range 2 {
+		_ = listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+		n, _, readErr := listener.ReadFrom(buf)
+		if readErr != nil {
+			t.Fatalf("ReadFrom() error = %v", readErr)
+		}
+
+		received = append(received, string(buf[:n]))
+	}
+
+	want := []string{
+		"query_sniper.processes.detected:1|c|#db:primary,schema:web,user:app,dry_run:false",
+		"query_sniper.processes.killed:1|c|#db:primary,schema:web,user:app,dry_run:false",
+	}
+
+	if !slices.Equal(received, want) {
+		t.Errorf("received %q, want %q", received, want)
+	}
+}
+
+func TestDatadog_RunRetriesDial(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket() error = %v", err)
+	}
+	defer listener.Close()
+
+	datadog := NewDatadog(configuration.DatadogConfig{Address: listener.LocalAddr().String()})
+	datadog.dialBackoff = time.Millisecond
+
+	// the first dials fail, as if the agent's address didn't resolve yet.
+	dial, failures := datadog.dial, 0
+	datadog.dial = func(ctx context.Context) (net.Conn, error) {
+		if failures < 3 {
+			failures++
+
+			return nil, errors.New("no such host")
+		}
+
+		return dial(ctx)
+	}
+
+	// queued before Run connects, and sent once it does.
+	err = datadog.Notify(context.Background(), []Event{testEvent("primary", OutcomeLogged)})
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		datadog.Run(ctx)
+	}()
+
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	buf := make([]byte, 1024)
+	_ = listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	n, _, err := listener.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("ReadFrom() error = %v", err)
+	}
+
+	if want := "query_sniper.processes.detected:1|c|#db:primary,schema:web,user:app,dry_run:false"; string(buf[:n]) != want {
+		t.Errorf("received %q, want %q", buf[:n], want)
+	}
+}
+
+func TestDatadog_RunCancelledWhileDialing(t *testing.T) {
+	t.Parallel()
+
+	datadog := NewDatadog(configuration.DatadogConfig{Address: "127.0.0.1:8125"})
+	datadog.dial = func(context.Context) (net.Conn, error) {
+		return nil, errors.New("no such host")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		datadog.Run(ctx)
+	}()
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() didn't return after the context was cancelled")
+	}
+}
+
+func TestDatadog_NotifyNeverBlocks(t *testing.T) {
+	t.Parallel()
+
+	// Run is never started, so nothing drains the queue.
+	datadog := NewDatadog(configuration.DatadogConfig{Address: "127.0.0.1:8125"})
+
+	events := make([]Event, datadogQueueSize)
+	for i := range events {
+		events[i] = testEvent("primary", OutcomeDryRun)
+	}
+
+	done := make(chan error)
+
+	go func() {
+		done <- datadog.Notify(context.Background(), events)
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrDatadogQueueFull) {
+			t.Errorf("Notify() error = %v, want %v", err, ErrDatadogQueueFull)
+		}
+
+	case <-time.After(5 * time.Second):
+		t.Fatal("Notify() blocked on a full queue")
+	}
+}
@@ -0,0 +1,229 @@
+// Package notify delivers the detections and kills made by the snipers to external services.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+)
+
+// Event kinds.
+const (
+	KindProcess         = "process"
+	KindTransaction     = "transaction"
+	KindBlocker         = "blocker"          // the root of a lock wait chain
+	KindMetadataLock    = "metadata_lock"    // a DDL statement waiting on a metadata lock, or a holder of that lock
+	KindIdleTransaction = "idle_transaction" // a session sleeping with an open transaction
+	KindCircuitBreaker  = "circuit_breaker"  // the sniper's kill circuit breaker, rather than an offender
+	KindAdmin           = "admin"            // a runtime override applied through the admin API, rather than an offender
+)
+
+// Event outcomes.
+const (
+	OutcomeDryRun  = "dry_run" // the offender would have been killed, but the sniper is in dry run mode
+	OutcomeLogged  = "logged"  // the offender's rule only allows logging it
+	OutcomeKilled  = "killed"
+	OutcomeFailed  = "failed"  // the KILL returned an error
+	OutcomeTripped = "tripped" // the kill budget ran out, and the sniper dropped into dry run; for KindCircuitBreaker events
+	OutcomeApplied = "applied" // the override was applied; for KindAdmin events
+	OutcomePending = "pending" // the offender is over its limit, but waiting for its sightings to confirm it; only sent to the audit sinks
+)
+
+// Event describes a single process or transaction that a sniper detected, and what it did about it.
+// NB: this struct is sorted by datatype to satisfy the fieldalignment linter.
+type Event struct {
+	Time          time.Time         // when the sniper acted on the offender
+	Admin         *AdminChange      // the override, for KindAdmin events
+	Err           error             // the KILL error, if the outcome is OutcomeFailed; why the breaker tripped, if OutcomeTripped
+	Tags          map[string]string // the marginalia or sqlcommenter tags from the statement's comments, for KindProcess events when query_tags is on
+	DB            string            // the name of the sniper's database
+	Kind          string            // one of the Kind* values
+	Outcome       string            // one of the Outcome* values
+	Rule          string            // the name of the matching kill policy rule, if any
+	Action        string            // one of the configuration.RuleAction* values: how the offender was (or would have been) killed, or only logged
+	User          string            // the user running the offender
+	Schema        string            // the offender's current schema
+	Command       string            // the processlist command
+	DigestText    string            // the digested query text (params removed)
+	Explain       string            // the JSON plan of the statement captured just before it was killed, for KindProcess events when capture_explain is on
+	Runtime       time.Duration     // how long the offender had been running; for KindIdleTransaction, how long it had been idle
+	ProcessID     int               // the processlist id
+	TransactionID int               // the transaction id, for KindTransaction and KindIdleTransaction events
+	Waiters       int               // the number of sessions waiting on the offender's locks, for KindBlocker and KindMetadataLock events
+	DryRun        bool              // whether the sniper was in dry run (or safe) mode
+}
+
+// AdminChange describes a runtime override applied through the admin API: who applied it, and the
+// state it changed. The states are empty when the API doesn't know them.
+type AdminChange struct {
+	Caller   string `json:"caller"`              // the name of the admin token the request was made with
+	Action   string `json:"action"`              // pause, resume, reset_breaker, set_dry_run, clear_dry_run, set_safe_mode or clear_safe_mode
+	OldState string `json:"old_state,omitempty"` // the state before the override, e.g. running, or dry_run=false
+	NewState string `json:"new_state,omitempty"` // the state after it
+}
+
+// transition returns the change of state as "old -> new", or only the new state if the old one isn't
+// known.
+func (change AdminChange) transition() string {
+	if change.OldState == "" {
+		return change.NewState
+	}
+
+	return change.OldState + " -> " + change.NewState
+}
+
+// Notifier delivers events to an external service.
+type Notifier interface {
+	// Notify delivers the events from a single KillProcesses or KillTransactions call. It's called
+	// from the sniper's loop, so implementations must not block for long.
+	Notify(ctx context.Context, events []Event) error
+}
+
+// Runner is implemented by notifiers that need a background goroutine.
+type Runner interface {
+	// Run blocks until the context is cancelled.
+	Run(ctx context.Context)
+}
+
+// Notifiers fans events out to several notifiers.
+type Notifiers []Notifier
+
+// New returns the notifiers that are enabled in settings.
+func New(settings *configuration.Config) Notifiers {
+	var notifiers Notifiers
+
+	if settings.Notifications.Slack.WebhookURL != "" {
+		notifiers = append(notifiers, NewSlack(settings.Notifications.Slack))
+	}
+
+	if settings.Notifications.PagerDuty.RoutingKey != "" {
+		notifiers = append(notifiers, NewPagerDuty(settings.Notifications.PagerDuty))
+	}
+
+	if settings.Notifications.Datadog.Address != "" {
+		notifiers = append(notifiers, NewDatadog(settings.Notifications.Datadog))
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(settings.Notifications.Webhooks)) {
+		webhook, err := NewWebhook(name, settings.Notifications.Webhooks[name])
+		if err != nil {
+			// the config has already been validated, so this shouldn't happen.
+			slog.Error("Error creating webhook notifier", slog.String("webhook", name), slog.Any("err", err))
+
+			continue
+		}
+
+		notifiers = append(notifiers, webhook)
+	}
+
+	if settings.Audit.File.Path != "" {
+		notifiers = append(notifiers, NewAuditLog(settings.Audit.File))
+	}
+
+	if settings.AuditDatabase.Enabled() {
+		notifiers = append(notifiers, NewAuditTable(settings.AuditDatabase, settings.AuditDSN()))
+	}
+
+	return notifiers
+}
+
+// Audit returns the audit sinks among the notifiers: the audit log and the audit table. They are the
+// only notifiers that followers write to, and that receive OutcomePending events.
+func (notifiers Notifiers) Audit() Notifiers {
+	var audit Notifiers
+
+	for _, notifier := range notifiers {
+		switch notifier.(type) {
+		case *AuditLog, *AuditTable:
+			audit = append(audit, notifier)
+		}
+	}
+
+	return audit
+}
+
+// Notify delivers the events to every notifier, and returns all of their errors joined together.
+func (notifiers Notifiers) Notify(ctx context.Context, events []Event) error {
+	var errs []error
+
+	for _, notifier := range notifiers {
+		err := notifier.Notify(ctx, events)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// postJSON posts the payload as JSON to url, and returns a *StatusError if the response isn't a 2xx.
+func postJSON(ctx context.Context, client *http.Client, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshalling payload: %w", err)
+	}
+
+	return post(ctx, client, url, body, nil)
+}
+
+// post posts the JSON body to url with the extra headers, and returns a *StatusError if the response
+// isn't a 2xx.
+func post(ctx context.Context, client *http.Client, url string, body []byte, headers http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	return nil
+}
+
+// Run runs every notifier that is a Runner, and blocks until they have all returned.
+func (notifiers Notifiers) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for _, notifier := range notifiers {
+		if runner, ok := notifier.(Runner); ok {
+			wg.Go(func() {
+				runner.Run(ctx)
+			})
+		}
+	}
+
+	wg.Wait()
+}
+
+// StatusError is returned when an external service responds with an unexpected HTTP status code.
+type StatusError struct {
+	StatusCode int
+}
+
+func (err *StatusError) Error() string {
+	return "unexpected status code " + strconv.Itoa(err.StatusCode) + " " + http.StatusText(err.StatusCode)
+}
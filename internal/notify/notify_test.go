@@ -0,0 +1,141 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+	"go.uber.org/goleak"
+)
+
+var errTestNotifier = errors.New("test notifier failed")
+
+// fakeNotifier records the events it's given, and returns err.
+type fakeNotifier struct {
+	err    error
+	events []Event
+}
+
+func (notifier *fakeNotifier) Notify(_ context.Context, events []Event) error {
+	notifier.events = append(notifier.events, events...)
+
+	return notifier.err
+}
+
+func TestNotifiers_Notify(t *testing.T) {
+	t.Parallel()
+
+	ok := &fakeNotifier{}
+	failing := &fakeNotifier{err: errTestNotifier}
+	notifiers := Notifiers{failing, ok}
+
+	events := []Event{{DB: "primary", Outcome: OutcomeKilled}, {DB: "primary", Outcome: OutcomeFailed}}
+
+	err := notifiers.Notify(context.Background(), events)
+	if !errors.Is(err, errTestNotifier) {
+		t.Errorf("Notify() error = %v, want %v", err, errTestNotifier)
+	}
+
+	// a failing notifier must not stop the others from receiving the events.
+	if len(ok.events) != len(events) || len(failing.events) != len(events) {
+		t.Errorf("Notify() delivered %d and %d events, want %d each", len(failing.events), len(ok.events), len(events))
+	}
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	settings := &configuration.Config{}
+
+	if notifiers := New(settings); len(notifiers) != 0 {
+		t.Errorf("New() returned %d notifiers with nothing configured, want 0", len(notifiers))
+	}
+
+	settings.Notifications.Slack.WebhookURL = "https://hooks.slack.com/services/T000/B000/XXXX"
+
+	notifiers := New(settings)
+	if len(notifiers) != 1 {
+		t.Fatalf("New() returned %d notifiers, want 1", len(notifiers))
+	}
+
+	if _, ok := notifiers[0].(*Slack); !ok {
+		t.Errorf("New() returned %T, want *Slack", notifiers[0])
+	}
+
+	settings.Notifications.PagerDuty.RoutingKey = "routing-key"
+
+	notifiers = New(settings)
+	if len(notifiers) != 2 {
+		t.Fatalf("New() returned %d notifiers, want 2", len(notifiers))
+	}
+
+	if _, ok := notifiers[1].(*PagerDuty); !ok {
+		t.Errorf("New() returned %T, want *PagerDuty", notifiers[1])
+	}
+
+	settings.Notifications.Datadog.Address = "127.0.0.1:8125"
+
+	notifiers = New(settings)
+	if len(notifiers) != 3 {
+		t.Fatalf("New() returned %d notifiers, want 3", len(notifiers))
+	}
+
+	if _, ok := notifiers[2].(*Datadog); !ok {
+		t.Errorf("New() returned %T, want *Datadog", notifiers[2])
+	}
+
+	settings.Notifications.Webhooks = map[string]configuration.WebhookConfig{
+		"tickets": {URL: "https://tickets.internal/hooks/sniper"},
+		"owners":  {URL: "https://owners.internal/hooks/sniper"},
+	}
+
+	notifiers = New(settings)
+	if len(notifiers) != 5 {
+		t.Fatalf("New() returned %d notifiers, want 5", len(notifiers))
+	}
+
+	// webhooks are added in name order.
+	if webhook, ok := notifiers[3].(*Webhook); !ok || webhook.name != "owners" {
+		t.Errorf("New() returned %T, want the owners *Webhook", notifiers[3])
+	}
+
+	settings.Audit.File.Path = "/var/log/query-sniper/audit.jsonl"
+
+	notifiers = New(settings)
+	if len(notifiers) != 6 {
+		t.Fatalf("New() returned %d notifiers, want 6", len(notifiers))
+	}
+
+	if _, ok := notifiers[5].(*AuditLog); !ok {
+		t.Errorf("New() returned %T, want *AuditLog", notifiers[5])
+	}
+}
+
+func TestNotifiers_Audit(t *testing.T) {
+	t.Parallel()
+
+	settings := &configuration.Config{}
+	settings.Notifications.Slack.WebhookURL = "https://hooks.slack.com/services/T000/B000/XXXX"
+	settings.Notifications.Datadog.Address = "127.0.0.1:8125"
+
+	if audit := New(settings).Audit(); len(audit) != 0 {
+		t.Errorf("Audit() returned %d notifiers with no audit sinks configured, want 0", len(audit))
+	}
+
+	settings.Audit.File.Path = "/var/log/query-sniper/audit.jsonl"
+
+	audit := New(settings).Audit()
+	if len(audit) != 1 {
+		t.Fatalf("Audit() returned %d notifiers, want 1", len(audit))
+	}
+
+	if _, ok := audit[0].(*AuditLog); !ok {
+		t.Errorf("Audit() returned %T, want *AuditLog", audit[0])
+	}
+}
+
+// TestMain is used to verify that there are no leaks during the tests.
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
@@ -0,0 +1,293 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+)
+
+const (
+	// DefaultPagerDutyWindow is the window that kills are counted over when window isn't set.
+	DefaultPagerDutyWindow = time.Minute
+
+	// DefaultPagerDutySeverity is the incident severity when severity isn't set.
+	DefaultPagerDutySeverity = "critical"
+
+	pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+	pagerDutyTimeout   = 5 * time.Second
+
+	// pagerDutyCheckInterval is how often open incidents are checked to see if they can be resolved.
+	pagerDutyCheckInterval = 15 * time.Second
+
+	// pagerDutyQueueSize is the number of incidents that can be waiting to be opened. Each database has
+	// at most one waiting, so the queue only fills up with more databases than this over the threshold.
+	pagerDutyQueueSize = 64
+)
+
+// ErrPagerDutyQueueFull is returned when an incident is dropped because the trigger queue is full.
+var ErrPagerDutyQueueFull = errors.New("pagerduty trigger queue is full")
+
+// PagerDuty opens an incident through the Events API v2 when a database's kills in the last Window
+// exceed KillThreshold, and resolves it once they drop back to the threshold. Incidents are deduped
+// on the database name, so each database has at most one open incident. Kills in dry run mode only
+// count if CountDryRun is set.
+// Notify only counts the kills and queues the incidents; they're opened and resolved by Run.
+type PagerDuty struct {
+	now         func() time.Time
+	client      *http.Client
+	kills       map[string][]time.Time // kill times in the window, per database
+	triggered   map[string]bool        // databases with an open incident
+	pending     map[string]bool        // databases with an incident waiting in the queue
+	triggers    chan pagerDutyTrigger
+	url         string
+	key         string
+	severity    string
+	window      time.Duration
+	threshold   int
+	mu          sync.Mutex
+	countDryRun bool
+}
+
+// pagerDutyTrigger is an incident waiting to be opened by Run.
+type pagerDutyTrigger struct {
+	db     string
+	dryRun bool
+}
+
+// pagerDutyEvent is the payload for the Events API v2.
+type pagerDutyEvent struct {
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+}
+
+type pagerDutyPayload struct {
+	CustomDetails map[string]any `json:"custom_details"`
+	Summary       string         `json:"summary"`
+	Source        string         `json:"source"`
+	Severity      string         `json:"severity"`
+	Component     string         `json:"component"`
+	Group         string         `json:"group"`
+}
+
+// NewPagerDuty creates a new PagerDuty notifier from the given config.
+func NewPagerDuty(config configuration.PagerDutyConfig) *PagerDuty {
+	window := config.Window
+	if window == 0 {
+		window = DefaultPagerDutyWindow
+	}
+
+	severity := config.Severity
+	if severity == "" {
+		severity = DefaultPagerDutySeverity
+	}
+
+	return &PagerDuty{
+		client:      &http.Client{Timeout: pagerDutyTimeout},
+		countDryRun: config.CountDryRun,
+		key:         config.RoutingKey,
+		kills:       make(map[string][]time.Time),
+		now:         time.Now,
+		pending:     make(map[string]bool),
+		severity:    severity,
+		threshold:   config.KillThreshold,
+		triggered:   make(map[string]bool),
+		triggers:    make(chan pagerDutyTrigger, pagerDutyQueueSize),
+		url:         pagerDutyEventsURL,
+		window:      window,
+	}
+}
+
+// Notify counts the kills in events, and queues an incident for the database if they push it over
+// the threshold. It never blocks; if the queue is full, the incident is dropped and
+// ErrPagerDutyQueueFull is returned, and the next kill tries again.
+func (pagerDuty *PagerDuty) Notify(_ context.Context, events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	// every call comes from a single sniper, or the admin API, so all of the events are for the same
+	// database; admin events never count as kills.
+	db := events[0].DB
+	now := pagerDuty.now()
+
+	pagerDuty.mu.Lock()
+
+	for _, event := range events {
+		if event.Outcome == OutcomeKilled || (pagerDuty.countDryRun && event.Outcome == OutcomeDryRun) {
+			pagerDuty.kills[db] = append(pagerDuty.kills[db], now)
+		}
+	}
+
+	trigger := !pagerDuty.triggered[db] && !pagerDuty.pending[db] && pagerDuty.count(db, now) > pagerDuty.threshold
+	if trigger {
+		pagerDuty.pending[db] = true
+	}
+
+	pagerDuty.mu.Unlock()
+
+	if !trigger {
+		return nil
+	}
+
+	select {
+	case pagerDuty.triggers <- pagerDutyTrigger{db: db, dryRun: events[0].DryRun}:
+		return nil
+
+	default:
+		pagerDuty.mu.Lock()
+		delete(pagerDuty.pending, db)
+		pagerDuty.mu.Unlock()
+
+		return fmt.Errorf("%w: dropped the incident for %s", ErrPagerDutyQueueFull, db)
+	}
+}
+
+// Run opens the queued incidents, and resolves the open ones once their database's kills drop back
+// to the threshold, until the context is cancelled.
+func (pagerDuty *PagerDuty) Run(ctx context.Context) {
+	ticker := time.NewTicker(pagerDutyCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case trigger := <-pagerDuty.triggers:
+			err := pagerDuty.trigger(ctx, trigger.db, trigger.dryRun)
+			if err != nil {
+				slog.Error("Error opening pagerduty incident", slog.String("db", trigger.db), slog.Any("err", err))
+			}
+
+		case <-ticker.C:
+			err := pagerDuty.resolve(ctx)
+			if err != nil {
+				slog.Error("Error resolving pagerduty incidents", slog.Any("err", err))
+			}
+		}
+	}
+}
+
+// count prunes the kills that have fallen out of the window, and returns the number left. The
+// caller must hold the lock.
+func (pagerDuty *PagerDuty) count(db string, now time.Time) int {
+	kills := pagerDuty.kills[db]
+
+	cutoff := now.Add(-pagerDuty.window)
+	for len(kills) > 0 && !kills[0].After(cutoff) {
+		kills = kills[1:]
+	}
+
+	if len(kills) == 0 {
+		delete(pagerDuty.kills, db)
+	} else {
+		pagerDuty.kills[db] = kills
+	}
+
+	return len(kills)
+}
+
+// trigger opens the incident for the database. If it fails, the incident isn't open, so the next
+// kill queues it again.
+func (pagerDuty *PagerDuty) trigger(ctx context.Context, db string, dryRun bool) error {
+	pagerDuty.mu.Lock()
+	kills := len(pagerDuty.kills[db])
+	pagerDuty.mu.Unlock()
+
+	summary := fmt.Sprintf("query-sniper killed %d queries on %s in the last %s", kills, db, pagerDuty.window)
+	if dryRun {
+		summary = fmt.Sprintf("query-sniper would have killed %d queries on %s in the last %s (dry run)", kills, db, pagerDuty.window)
+	}
+
+	err := postJSON(ctx, pagerDuty.client, pagerDuty.url, pagerDutyEvent{
+		RoutingKey:  pagerDuty.key,
+		EventAction: "trigger",
+		DedupKey:    pagerDutyDedupKey(db),
+		Payload: &pagerDutyPayload{
+			Summary:   summary,
+			Source:    db,
+			Severity:  pagerDuty.severity,
+			Component: "mysql",
+			Group:     "query-sniper",
+			CustomDetails: map[string]any{
+				"db":        db,
+				"dry_run":   dryRun,
+				"kills":     kills,
+				"threshold": pagerDuty.threshold,
+				"window":    pagerDuty.window.String(),
+			},
+		},
+	})
+
+	pagerDuty.mu.Lock()
+	delete(pagerDuty.pending, db)
+
+	if err == nil {
+		pagerDuty.triggered[db] = true
+	}
+
+	pagerDuty.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("error triggering pagerduty incident for %s: %w", db, err)
+	}
+
+	slog.Warn("Opened pagerduty incident for "+db,
+		slog.String("db", db),
+		slog.Int("kills", kills),
+		slog.Int("threshold", pagerDuty.threshold),
+		slog.Duration("window", pagerDuty.window),
+	)
+
+	return nil
+}
+
+// resolve resolves the open incidents for databases that are back at or below the threshold. An
+// incident that fails to resolve stays open, and is retried on the next call.
+func (pagerDuty *PagerDuty) resolve(ctx context.Context) error {
+	now := pagerDuty.now()
+
+	pagerDuty.mu.Lock()
+
+	var resolve []string
+
+	for db := range pagerDuty.triggered {
+		if pagerDuty.count(db, now) <= pagerDuty.threshold {
+			resolve = append(resolve, db)
+		}
+	}
+
+	pagerDuty.mu.Unlock()
+
+	for _, db := range resolve {
+		err := postJSON(ctx, pagerDuty.client, pagerDuty.url, pagerDutyEvent{
+			RoutingKey:  pagerDuty.key,
+			EventAction: "resolve",
+			DedupKey:    pagerDutyDedupKey(db),
+		})
+		if err != nil {
+			return fmt.Errorf("error resolving pagerduty incident for %s: %w", db, err)
+		}
+
+		pagerDuty.mu.Lock()
+		delete(pagerDuty.triggered, db)
+		pagerDuty.mu.Unlock()
+
+		slog.Info("Resolved pagerduty incident for "+db, slog.String("db", db))
+	}
+
+	return nil
+}
+
+// pagerDutyDedupKey returns the dedup key for the database's incident.
+func pagerDutyDedupKey(db string) string {
+	return "query-sniper-" + db
+}
@@ -0,0 +1,370 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+)
+
+// pagerDutyRecorder is a fake events API that records the events posted to it.
+type pagerDutyRecorder struct {
+	events []pagerDutyEvent
+	status int
+	mu     sync.Mutex
+}
+
+func (recorder *pagerDutyRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var event pagerDutyEvent
+
+	err := json.NewDecoder(r.Body).Decode(&event)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	recorder.events = append(recorder.events, event)
+
+	w.WriteHeader(recorder.status)
+}
+
+func (recorder *pagerDutyRecorder) actions() []string {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	actions := make([]string, 0, len(recorder.events))
+	for _, event := range recorder.events {
+		actions = append(actions, event.EventAction)
+	}
+
+	return actions
+}
+
+func newTestPagerDuty(t *testing.T, config configuration.PagerDutyConfig) (*PagerDuty, *pagerDutyRecorder) {
+	t.Helper()
+
+	recorder := &pagerDutyRecorder{status: http.StatusAccepted}
+	server := httptest.NewServer(recorder)
+	t.Cleanup(server.Close)
+
+	pagerDuty := NewPagerDuty(config)
+	pagerDuty.client = server.Client()
+	pagerDuty.url = server.URL
+
+	return pagerDuty, recorder
+}
+
+func killEvents(db string, count int) []Event {
+	return outcomeEvents(db, OutcomeKilled, count)
+}
+
+func outcomeEvents(db, outcome string, count int) []Event {
+	events := make([]Event, count)
+	for i := range events {
+		events[i] = testEvent(db, outcome)
+	}
+
+	return events
+}
+
+// sendTriggers opens the queued incidents, as Run does, and returns the first error.
+func sendTriggers(ctx context.Context, pagerDuty *PagerDuty) error {
+	var errs []error
+
+	for {
+		select {
+		case trigger := <-pagerDuty.triggers:
+			errs = append(errs, pagerDuty.trigger(ctx, trigger.db, trigger.dryRun))
+
+		default:
+			return errors.Join(errs...)
+		}
+	}
+}
+
+func TestNewPagerDuty_Defaults(t *testing.T) {
+	t.Parallel()
+
+	pagerDuty := NewPagerDuty(configuration.PagerDutyConfig{RoutingKey: "key", KillThreshold: 5})
+
+	if pagerDuty.window != DefaultPagerDutyWindow {
+		t.Errorf("window = %v, want %v", pagerDuty.window, DefaultPagerDutyWindow)
+	}
+
+	if pagerDuty.severity != DefaultPagerDutySeverity {
+		t.Errorf("severity = %q, want %q", pagerDuty.severity, DefaultPagerDutySeverity)
+	}
+}
+
+func TestPagerDuty_TriggerAndResolve(t *testing.T) {
+	t.Parallel()
+
+	pagerDuty, recorder := newTestPagerDuty(t, configuration.PagerDutyConfig{
+		RoutingKey:    "routing-key",
+		Severity:      "error",
+		Window:        time.Minute,
+		KillThreshold: 5,
+	})
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	pagerDuty.now = func() time.Time { return now }
+
+	ctx := context.Background()
+
+	// 5 kills is at the threshold, which doesn't open an incident.
+	err := pagerDuty.Notify(ctx, killEvents("primary", 5))
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	// logged and failed offenders aren't kills.
+	err = pagerDuty.Notify(ctx, []Event{testEvent("primary", OutcomeLogged), testEvent("primary", OutcomeFailed)})
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	if actions := recorder.actions(); len(actions) != 0 {
+		t.Fatalf("posted %v at the threshold, want nothing", actions)
+	}
+
+	now = now.Add(10 * time.Second)
+
+	err = pagerDuty.Notify(ctx, killEvents("primary", 1))
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	// Notify only queues the incident.
+	if actions := recorder.actions(); len(actions) != 0 {
+		t.Fatalf("Notify() posted %v, want the trigger queued for Run", actions)
+	}
+
+	// more kills don't queue a second incident, and other databases are counted separately.
+	err = pagerDuty.Notify(ctx, killEvents("primary", 10))
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	err = pagerDuty.Notify(ctx, killEvents("replica", 3))
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	err = sendTriggers(ctx, pagerDuty)
+	if err != nil {
+		t.Fatalf("trigger() error = %v", err)
+	}
+
+	// nor do kills once the incident is open.
+	err = pagerDuty.Notify(ctx, killEvents("primary", 1))
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	if len(pagerDuty.triggers) != 0 {
+		t.Fatalf("queued %d triggers for an open incident, want none", len(pagerDuty.triggers))
+	}
+
+	if actions := recorder.actions(); len(actions) != 1 || actions[0] != "trigger" {
+		t.Fatalf("posted %v, want a single trigger", actions)
+	}
+
+	event := recorder.events[0]
+	if event.RoutingKey != "routing-key" || event.DedupKey != "query-sniper-primary" {
+		t.Errorf("trigger = %+v, want routing key %q and dedup key %q", event, "routing-key", "query-sniper-primary")
+	}
+
+	if event.Payload == nil || event.Payload.Severity != "error" || event.Payload.Source != "primary" {
+		t.Errorf("trigger payload = %+v, want severity error for primary", event.Payload)
+	}
+
+	// still over the threshold, so the incident stays open.
+	err = pagerDuty.resolve(ctx)
+	if err != nil {
+		t.Fatalf("resolve() error = %v", err)
+	}
+
+	if actions := recorder.actions(); len(actions) != 1 {
+		t.Fatalf("posted %v while still over the threshold, want a single trigger", actions)
+	}
+
+	// once the kills fall out of the window, the incident is resolved.
+	now = now.Add(time.Minute)
+
+	err = pagerDuty.resolve(ctx)
+	if err != nil {
+		t.Fatalf("resolve() error = %v", err)
+	}
+
+	actions := recorder.actions()
+	if len(actions) != 2 || actions[1] != "resolve" {
+		t.Fatalf("posted %v, want a trigger and a resolve", actions)
+	}
+
+	if recorder.events[1].DedupKey != "query-sniper-primary" || recorder.events[1].Payload != nil {
+		t.Errorf("resolve = %+v, want dedup key %q and no payload", recorder.events[1], "query-sniper-primary")
+	}
+
+	// a new burst opens a new incident.
+	err = pagerDuty.Notify(ctx, killEvents("primary", 6))
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	err = sendTriggers(ctx, pagerDuty)
+	if err != nil {
+		t.Fatalf("trigger() error = %v", err)
+	}
+
+	if actions := recorder.actions(); len(actions) != 3 || actions[2] != "trigger" {
+		t.Fatalf("posted %v, want a second trigger", actions)
+	}
+}
+
+func TestPagerDuty_TriggerFailureRetries(t *testing.T) {
+	t.Parallel()
+
+	pagerDuty, recorder := newTestPagerDuty(t, configuration.PagerDutyConfig{
+		RoutingKey:    "routing-key",
+		KillThreshold: 1,
+	})
+
+	recorder.status = http.StatusTooManyRequests
+
+	ctx := context.Background()
+
+	err := pagerDuty.Notify(ctx, killEvents("primary", 2))
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	err = sendTriggers(ctx, pagerDuty)
+	if err == nil {
+		t.Fatal("trigger() error = nil, want an error")
+	}
+
+	recorder.mu.Lock()
+	recorder.status = http.StatusAccepted
+	recorder.mu.Unlock()
+
+	// the incident wasn't opened, so the next kill tries again.
+	err = pagerDuty.Notify(ctx, killEvents("primary", 1))
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	err = sendTriggers(ctx, pagerDuty)
+	if err != nil {
+		t.Fatalf("trigger() error = %v", err)
+	}
+
+	if actions := recorder.actions(); len(actions) != 2 {
+		t.Errorf("posted %v, want two triggers", actions)
+	}
+}
+
+func TestPagerDuty_DryRun(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		wantActions int
+		countDryRun bool
+	}{
+		{name: "dry run kills don't count by default", countDryRun: false, wantActions: 0},
+		{name: "dry run kills count when enabled", countDryRun: true, wantActions: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			pagerDuty, recorder := newTestPagerDuty(t, configuration.PagerDutyConfig{
+				RoutingKey:    "routing-key",
+				KillThreshold: 1,
+				CountDryRun:   tt.countDryRun,
+			})
+
+			ctx := context.Background()
+
+			err := pagerDuty.Notify(ctx, outcomeEvents("primary", OutcomeDryRun, 5))
+			if err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+
+			err = sendTriggers(ctx, pagerDuty)
+			if err != nil {
+				t.Fatalf("trigger() error = %v", err)
+			}
+
+			if actions := recorder.actions(); len(actions) != tt.wantActions {
+				t.Errorf("posted %v, want %d triggers", actions, tt.wantActions)
+			}
+		})
+	}
+}
+
+func TestPagerDuty_RunTriggers(t *testing.T) {
+	t.Parallel()
+
+	pagerDuty, recorder := newTestPagerDuty(t, configuration.PagerDutyConfig{RoutingKey: "routing-key", KillThreshold: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		pagerDuty.Run(ctx)
+	}()
+
+	err := pagerDuty.Notify(ctx, killEvents("primary", 2))
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(recorder.actions()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+
+	if actions := recorder.actions(); len(actions) != 1 || actions[0] != "trigger" {
+		t.Errorf("Run() posted %v, want a trigger", actions)
+	}
+}
+
+func TestPagerDuty_Run(t *testing.T) {
+	t.Parallel()
+
+	pagerDuty := NewPagerDuty(configuration.PagerDutyConfig{RoutingKey: "routing-key", KillThreshold: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		Notifiers{pagerDuty}.Run(ctx)
+	}()
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run() did not return after the context was cancelled")
+	}
+}
@@ -0,0 +1,248 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+)
+
+const (
+	// DefaultSlackMinInterval is the minimum time between messages to a channel when min_interval isn't set.
+	DefaultSlackMinInterval = time.Minute
+
+	slackTimeout = 5 * time.Second
+
+	// slackQueueSize is the number of batches that can be waiting to be posted before new ones are dropped.
+	slackQueueSize = 64
+
+	// slackMaxEvents is the number of events listed in a message; the rest are summarized.
+	slackMaxEvents = 10
+
+	// slackMaxExplainLength is how much of a plan is posted; the full plan is in the audit log and webhooks.
+	slackMaxExplainLength = 1000
+)
+
+// ErrSlackQueueFull is returned when events are dropped because the post queue is full.
+var ErrSlackQueueFull = errors.New("slack post queue is full")
+
+// Slack posts events to a slack incoming webhook. All of the events from a single call to Notify
+// are batched into one message, and messages to each channel are rate limited to one per
+// MinInterval; events that are rate limited are counted and summarized in the next message. A
+// circuit breaker trip is never rate limited.
+// Notify only queues the batches; they're posted by Run, so a slow or unreachable webhook never
+// blocks a sniper. Batches are dropped when the queue is full.
+type Slack struct {
+	now        func() time.Time
+	client     *http.Client
+	channels   map[string]string
+	lastSent   map[string]time.Time // when a message was last posted to each channel
+	suppressed map[string]int       // the events rate limited since then, per channel
+	queue      chan []Event
+	webhookURL string
+	channel    string
+	interval   time.Duration
+}
+
+// slackMessage is the payload for the slack incoming webhook.
+type slackMessage struct {
+	Channel string `json:"channel,omitempty"`
+	Text    string `json:"text"`
+}
+
+// NewSlack creates a new Slack notifier from the given config.
+func NewSlack(config configuration.SlackConfig) *Slack {
+	interval := config.MinInterval
+	if interval == 0 {
+		interval = DefaultSlackMinInterval
+	}
+
+	return &Slack{
+		channel:    config.Channel,
+		channels:   config.Channels,
+		client:     &http.Client{Timeout: slackTimeout},
+		interval:   interval,
+		lastSent:   make(map[string]time.Time),
+		now:        time.Now,
+		queue:      make(chan []Event, slackQueueSize),
+		suppressed: make(map[string]int),
+		webhookURL: config.WebhookURL,
+	}
+}
+
+// Notify queues the events to be posted as one message. It never blocks; if the queue is full, the
+// events are dropped and ErrSlackQueueFull is returned.
+func (slack *Slack) Notify(_ context.Context, events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	select {
+	case slack.queue <- events:
+		return nil
+
+	default:
+		return fmt.Errorf("%w: dropped %d events for %s", ErrSlackQueueFull, len(events), events[0].DB)
+	}
+}
+
+// Run posts the queued events until the context is cancelled.
+func (slack *Slack) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case events := <-slack.queue:
+			err := slack.send(ctx, events)
+			if err != nil {
+				slog.Error("Error posting to slack",
+					slog.String("db", events[0].DB),
+					slog.Int("events", len(events)),
+					slog.Any("err", err),
+				)
+			}
+		}
+	}
+}
+
+// send posts the events to the channel for their database, unless the channel is rate limited. A
+// failed post doesn't count towards the rate limit, so the next events are posted right away.
+func (slack *Slack) send(ctx context.Context, events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	// every call comes from a single sniper, so all of the events are for the same database.
+	channel := slack.channel
+	if override, ok := slack.channels[events[0].DB]; ok {
+		channel = override
+	}
+
+	urgent := slices.ContainsFunc(events, func(event Event) bool {
+		return event.Kind == KindCircuitBreaker || event.Kind == KindAdmin
+	})
+
+	now := slack.now()
+	if last, ok := slack.lastSent[channel]; ok && now.Sub(last) < slack.interval && !urgent {
+		slack.suppressed[channel] += len(events)
+
+		return nil
+	}
+
+	err := postJSON(ctx, slack.client, slack.webhookURL, slackMessage{
+		Channel: channel,
+		Text:    formatSlackMessage(events, slack.suppressed[channel]),
+	})
+	if err != nil {
+		return fmt.Errorf("error posting to slack: %w", err)
+	}
+
+	slack.suppressed[channel] = 0
+	slack.lastSent[channel] = now
+
+	return nil
+}
+
+// formatSlackMessage formats the events, and the number of events that were rate limited since the
+// last message, as slack mrkdwn.
+func formatSlackMessage(events []Event, suppressed int) string {
+	counts := make(map[string]int)
+	for _, event := range events {
+		counts[event.Outcome]++
+	}
+
+	var summary []string
+
+	for _, outcome := range []string{OutcomeTripped, OutcomeApplied, OutcomeKilled, OutcomeDryRun, OutcomeLogged, OutcomeFailed} {
+		if counts[outcome] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[outcome], strings.ReplaceAll(outcome, "_", " ")))
+		}
+	}
+
+	var text strings.Builder
+
+	// safe mode is the only override that isn't for a single database.
+	db := "`" + events[0].DB + "`"
+	if events[0].DB == "" {
+		db = "all databases"
+	}
+
+	fmt.Fprintf(&text, ":dart: *query-sniper* on %s: %s\n", db, strings.Join(summary, ", "))
+
+	for i, event := range events {
+		if i == slackMaxEvents {
+			fmt.Fprintf(&text, "_...and %d more_\n", len(events)-slackMaxEvents)
+
+			break
+		}
+
+		if event.Kind == KindCircuitBreaker {
+			fmt.Fprintf(&text, "• :rotating_light: *CIRCUIT BREAKER TRIPPED* %v\n", event.Err)
+
+			continue
+		}
+
+		if event.Kind == KindAdmin && event.Admin != nil {
+			fmt.Fprintf(&text, "• :wrench: *ADMIN* `%s` applied `%s`", event.Admin.Caller, event.Admin.Action)
+
+			if transition := event.Admin.transition(); transition != "" {
+				fmt.Fprintf(&text, ": `%s`", transition)
+			}
+
+			text.WriteString("\n")
+
+			continue
+		}
+
+		fmt.Fprintf(&text, "• *%s* %s `%d` user=`%s` schema=`%s` runtime=%s",
+			strings.ToUpper(strings.ReplaceAll(event.Outcome, "_", " ")),
+			event.Kind, event.ProcessID, event.User, event.Schema, event.Runtime)
+
+		if event.Waiters > 0 {
+			fmt.Fprintf(&text, " waiters=%d", event.Waiters)
+		}
+
+		for _, key := range slices.Sorted(maps.Keys(event.Tags)) {
+			fmt.Fprintf(&text, " %s=`%s`", key, event.Tags[key])
+		}
+
+		text.WriteString("\n")
+
+		if event.DigestText != "" {
+			fmt.Fprintf(&text, "```%s```\n", event.DigestText)
+		}
+
+		if event.Explain != "" {
+			fmt.Fprintf(&text, "plan:```%s```\n", truncateExplain(event.Explain))
+		}
+	}
+
+	if suppressed > 0 {
+		fmt.Fprintf(&text, "_%d earlier events were not posted because of the rate limit_\n", suppressed)
+	}
+
+	return text.String()
+}
+
+// truncateExplain cuts the plan to slackMaxExplainLength bytes, without splitting a character.
+func truncateExplain(plan string) string {
+	if len(plan) <= slackMaxExplainLength {
+		return plan
+	}
+
+	cut := slackMaxExplainLength
+	for cut > 0 && !utf8.RuneStart(plan[cut]) {
+		cut--
+	}
+
+	return plan[:cut] + "..."
+}
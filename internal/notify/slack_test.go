@@ -0,0 +1,414 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+)
+
+// slackRecorder is a fake slack webhook that records the messages posted to it.
+type slackRecorder struct {
+	messages []slackMessage
+	status   int
+	mu       sync.Mutex
+}
+
+func (recorder *slackRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var message slackMessage
+
+	err := json.NewDecoder(r.Body).Decode(&message)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	recorder.messages = append(recorder.messages, message)
+
+	w.WriteHeader(recorder.status)
+}
+
+func newTestSlack(t *testing.T, config configuration.SlackConfig, status int) (*Slack, *slackRecorder) {
+	t.Helper()
+
+	recorder := &slackRecorder{status: status}
+	server := httptest.NewServer(recorder)
+	t.Cleanup(server.Close)
+
+	config.WebhookURL = server.URL
+
+	slack := NewSlack(config)
+	slack.client = server.Client()
+
+	return slack, recorder
+}
+
+func testEvent(db, outcome string) Event {
+	return Event{
+		DB:         db,
+		Kind:       KindProcess,
+		Outcome:    outcome,
+		User:       "app",
+		Schema:     "web",
+		DigestText: "SELECT SLEEP (?)",
+		Runtime:    90 * time.Second,
+		ProcessID:  42,
+	}
+}
+
+func TestSlack_Send(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		events      []Event
+		wantChannel string
+		wantText    []string
+		wantPosts   int
+	}{
+		{
+			name:      "no events",
+			events:    nil,
+			wantPosts: 0,
+		},
+		{
+			name:        "default channel",
+			events:      []Event{testEvent("primary", OutcomeKilled)},
+			wantChannel: "#db-alerts",
+			wantText:    []string{"`primary`", "1 killed", "KILLED", "`42`", "SELECT SLEEP (?)"},
+			wantPosts:   1,
+		},
+		{
+			name:        "per database channel",
+			events:      []Event{testEvent("replica", OutcomeDryRun), testEvent("replica", OutcomeLogged)},
+			wantChannel: "#replica-alerts",
+			wantText:    []string{"`replica`", "1 dry run", "1 logged", "DRY RUN", "LOGGED"},
+			wantPosts:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			slack, recorder := newTestSlack(t, configuration.SlackConfig{
+				Channel:  "#db-alerts",
+				Channels: map[string]string{"replica": "#replica-alerts"},
+			}, http.StatusOK)
+
+			err := slack.send(context.Background(), tt.events)
+			if err != nil {
+				t.Fatalf("send() error = %v", err)
+			}
+
+			if len(recorder.messages) != tt.wantPosts {
+				t.Fatalf("send() posted %d messages, want %d", len(recorder.messages), tt.wantPosts)
+			}
+
+			if tt.wantPosts == 0 {
+				return
+			}
+
+			message := recorder.messages[0]
+			if message.Channel != tt.wantChannel {
+				t.Errorf("send() channel = %q, want %q", message.Channel, tt.wantChannel)
+			}
+
+			for _, want := range tt.wantText {
+				if !strings.Contains(message.Text, want) {
+					t.Errorf("send() text = %q, want it to contain %q", message.Text, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSlack_Run(t *testing.T) {
+	t.Parallel()
+
+	slack, recorder := newTestSlack(t, configuration.SlackConfig{Channel: "#db-alerts"}, http.StatusOK)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	// Notify only queues the events.
+	err := slack.Notify(ctx, []Event{testEvent("primary", OutcomeKilled), testEvent("primary", OutcomeKilled)})
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	recorder.mu.Lock()
+	posted := len(recorder.messages)
+	recorder.mu.Unlock()
+
+	if posted != 0 {
+		t.Fatalf("Notify() posted %d messages, want them queued for Run", posted)
+	}
+
+	go func() {
+		defer close(done)
+
+		slack.Run(ctx)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		recorder.mu.Lock()
+		posted = len(recorder.messages)
+		recorder.mu.Unlock()
+
+		if posted > 0 {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+
+	if posted != 1 || !strings.Contains(recorder.messages[0].Text, "2 killed") {
+		t.Errorf("Run() posted %+v, want the queued events in one message", recorder.messages)
+	}
+}
+
+func TestSlack_QueueFull(t *testing.T) {
+	t.Parallel()
+
+	slack, _ := newTestSlack(t, configuration.SlackConfig{}, http.StatusOK)
+
+	for range slackQueueSize {
+		err := slack.Notify(context.Background(), []Event{testEvent("primary", OutcomeKilled)})
+		if err != nil {
+			t.Fatalf("Notify() error = %v", err)
+		}
+	}
+
+	err := slack.Notify(context.Background(), []Event{testEvent("primary", OutcomeKilled)})
+	if !errors.Is(err, ErrSlackQueueFull) {
+		t.Errorf("Notify() error = %v, want %v", err, ErrSlackQueueFull)
+	}
+}
+
+func TestSlack_FailedPostIsNotRateLimited(t *testing.T) {
+	t.Parallel()
+
+	slack, recorder := newTestSlack(t, configuration.SlackConfig{MinInterval: time.Minute}, http.StatusServiceUnavailable)
+
+	ctx := context.Background()
+
+	err := slack.send(ctx, []Event{testEvent("primary", OutcomeKilled)})
+	if err == nil {
+		t.Fatal("send() error = nil, want an error")
+	}
+
+	recorder.mu.Lock()
+	recorder.status = http.StatusOK
+	recorder.mu.Unlock()
+
+	// the failed post didn't count towards the rate limit.
+	err = slack.send(ctx, []Event{testEvent("primary", OutcomeKilled)})
+	if err != nil {
+		t.Fatalf("send() error = %v", err)
+	}
+
+	if len(recorder.messages) != 2 {
+		t.Fatalf("send() posted %d messages, want 2", len(recorder.messages))
+	}
+
+	// the successful one did.
+	err = slack.send(ctx, []Event{testEvent("primary", OutcomeKilled)})
+	if err != nil {
+		t.Fatalf("send() error = %v", err)
+	}
+
+	if len(recorder.messages) != 2 {
+		t.Errorf("send() posted %d messages, want the third rate limited", len(recorder.messages))
+	}
+}
+
+func TestSlack_RateLimit(t *testing.T) {
+	t.Parallel()
+
+	slack, recorder := newTestSlack(t, configuration.SlackConfig{MinInterval: time.Minute}, http.StatusOK)
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	slack.now = func() time.Time { return now }
+
+	ctx := context.Background()
+
+	for _, step := range []struct {
+		advance   time.Duration
+		events    int
+		wantPosts int
+	}{
+		{advance: 0, events: 1, wantPosts: 1},
+		{advance: 10 * time.Second, events: 2, wantPosts: 1},          // rate limited
+		{advance: 10 * time.Second, events: 1, wantPosts: 1},          // still rate limited
+		{advance: time.Minute, events: 1, wantPosts: 2},               // posted, with the 3 suppressed events
+		{advance: 0, events: 1, wantPosts: 2},                         // rate limited again
+		{advance: time.Minute + time.Second, events: 1, wantPosts: 3}, // posted, with 1 suppressed event
+	} {
+		now = now.Add(step.advance)
+
+		events := make([]Event, step.events)
+		for i := range events {
+			events[i] = testEvent("primary", OutcomeKilled)
+		}
+
+		err := slack.send(ctx, events)
+		if err != nil {
+			t.Fatalf("send() error = %v", err)
+		}
+
+		if len(recorder.messages) != step.wantPosts {
+			t.Fatalf("send() posted %d messages, want %d", len(recorder.messages), step.wantPosts)
+		}
+	}
+
+	if !strings.Contains(recorder.messages[1].Text, "_3 earlier events") {
+		t.Errorf("second message = %q, want it to summarize 3 suppressed events", recorder.messages[1].Text)
+	}
+
+	if !strings.Contains(recorder.messages[2].Text, "_1 earlier events") {
+		t.Errorf("third message = %q, want it to summarize 1 suppressed event", recorder.messages[2].Text)
+	}
+}
+
+func TestSlack_StatusError(t *testing.T) {
+	t.Parallel()
+
+	slack, _ := newTestSlack(t, configuration.SlackConfig{}, http.StatusForbidden)
+
+	err := slack.send(context.Background(), []Event{testEvent("primary", OutcomeKilled)})
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("send() error = %v, want a *StatusError", err)
+	}
+
+	if statusErr.StatusCode != http.StatusForbidden {
+		t.Errorf("StatusError.StatusCode = %d, want %d", statusErr.StatusCode, http.StatusForbidden)
+	}
+}
+
+func TestFormatSlackMessage_Explain(t *testing.T) {
+	t.Parallel()
+
+	event := testEvent("primary", OutcomeKilled)
+	event.Explain = `{"query_block":{"select_id":1,"table":{"table_name":"orders","access_type":"ALL"}}}`
+
+	text := formatSlackMessage([]Event{event}, 0)
+	if !strings.Contains(text, "plan:```"+event.Explain+"```") {
+		t.Errorf("formatSlackMessage() = %q, want the plan in a code block", text)
+	}
+
+	// long plans are truncated, so that a batch of kills still fits in a message.
+	event.Explain = `{"query_block":"` + strings.Repeat("x", 2*slackMaxExplainLength) + `"}`
+
+	text = formatSlackMessage([]Event{event}, 0)
+	if !strings.Contains(text, event.Explain[:slackMaxExplainLength]+"...```") || strings.Contains(text, event.Explain) {
+		t.Errorf("formatSlackMessage() = %q, want the plan truncated to %d bytes", text, slackMaxExplainLength)
+	}
+
+	// events without a plan have no plan block.
+	if text = formatSlackMessage([]Event{testEvent("primary", OutcomeKilled)}, 0); strings.Contains(text, "plan:") {
+		t.Errorf("formatSlackMessage() = %q, want no plan block without a plan", text)
+	}
+}
+
+func TestFormatSlackMessage_Tags(t *testing.T) {
+	t.Parallel()
+
+	event := testEvent("primary", OutcomeKilled)
+	event.Tags = map[string]string{"controller": "books", "action": "index"}
+
+	text := formatSlackMessage([]Event{event}, 0)
+	if !strings.Contains(text, "runtime=1m30s action=`index` controller=`books`\n") {
+		t.Errorf("formatSlackMessage() = %q, want the tags inline, sorted by key", text)
+	}
+}
+
+func TestFormatSlackMessage_Admin(t *testing.T) {
+	t.Parallel()
+
+	text := formatSlackMessage([]Event{{
+		Kind:    KindAdmin,
+		Outcome: OutcomeApplied,
+		Admin:   &AdminChange{Caller: "alice", Action: "set_safe_mode", OldState: "safe_mode=configured", NewState: "safe_mode=true"},
+	}}, 0)
+
+	want := ":dart: *query-sniper* on all databases: 1 applied\n" +
+		"• :wrench: *ADMIN* `alice` applied `set_safe_mode`: `safe_mode=configured -> safe_mode=true`\n"
+	if text != want {
+		t.Errorf("formatSlackMessage() = %q, want %q", text, want)
+	}
+}
+
+func TestFormatSlackMessage_Truncates(t *testing.T) {
+	t.Parallel()
+
+	events := make([]Event, slackMaxEvents+5)
+	for i := range events {
+		events[i] = testEvent("primary", OutcomeKilled)
+	}
+
+	text := formatSlackMessage(events, 0)
+
+	if got := strings.Count(text, "• "); got != slackMaxEvents {
+		t.Errorf("formatSlackMessage() listed %d events, want %d", got, slackMaxEvents)
+	}
+
+	if !strings.Contains(text, "...and 5 more") {
+		t.Errorf("formatSlackMessage() = %q, want it to summarize the remaining events", text)
+	}
+}
+
+// breakerEvent returns a circuit breaker trip event.
+func breakerEvent(db string) Event {
+	return Event{
+		DB:      db,
+		DryRun:  true,
+		Err:     errors.New("kill budget exceeded: more than 10 kills in the last minute"),
+		Kind:    KindCircuitBreaker,
+		Outcome: OutcomeTripped,
+	}
+}
+
+func TestSlack_CircuitBreakerIsNotRateLimited(t *testing.T) {
+	t.Parallel()
+
+	slack, recorder := newTestSlack(t, configuration.SlackConfig{MinInterval: time.Minute}, http.StatusOK)
+
+	ctx := context.Background()
+
+	err := slack.send(ctx, []Event{testEvent("primary", OutcomeKilled)})
+	if err != nil {
+		t.Fatalf("send() error = %v", err)
+	}
+
+	err = slack.send(ctx, []Event{breakerEvent("primary")})
+	if err != nil {
+		t.Fatalf("send() error = %v", err)
+	}
+
+	if len(recorder.messages) != 2 {
+		t.Fatalf("send() posted %d messages, want 2", len(recorder.messages))
+	}
+
+	text := recorder.messages[1].Text
+	if !strings.Contains(text, "1 tripped") || !strings.Contains(text, "*CIRCUIT BREAKER TRIPPED* kill budget exceeded") {
+		t.Errorf("second message = %q, want the circuit breaker trip", text)
+	}
+}
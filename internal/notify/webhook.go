@@ -0,0 +1,278 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+)
+
+const (
+	// DefaultWebhookMaxRetries is the number of retries when max_retries isn't set.
+	DefaultWebhookMaxRetries = 3
+
+	// DefaultWebhookRetryBackoff is the delay before the first retry when retry_backoff isn't set.
+	DefaultWebhookRetryBackoff = time.Second
+
+	// WebhookSignatureHeader carries the hex encoded HMAC-SHA256 of the timestamp and the request body,
+	// prefixed with "sha256="; see Sign.
+	WebhookSignatureHeader = "X-Query-Sniper-Signature"
+
+	// WebhookTimestampHeader carries the unix time the request was signed at, so that consumers can
+	// reject replayed requests.
+	WebhookTimestampHeader = "X-Query-Sniper-Timestamp"
+
+	webhookTimeout = 5 * time.Second
+
+	// webhookQueueSize is the number of events that can be waiting to be sent before new ones are dropped.
+	webhookQueueSize = 256
+)
+
+// ErrWebhookQueueFull is returned when events are dropped because the send queue is full.
+var ErrWebhookQueueFull = errors.New("webhook send queue is full")
+
+// Webhook POSTs a JSON payload for every event to a URL, signed with an HMAC-SHA256 of the timestamp
+// and the body.
+// Notify only queues the events; they're sent by Run, which retries failed requests with an
+// exponential backoff. Events are dropped when the queue is full.
+type Webhook struct {
+	now      func() time.Time
+	template *template.Template
+	client   *http.Client
+	queue    chan Event
+	headers  map[string]string
+	name     string
+	url      string
+	secret   []byte
+	backoff  time.Duration
+	retries  int
+}
+
+// WebhookPayload is the default request body, and the data that payload templates are executed with.
+// It has the same fields that KillProcesses and KillTransactions log.
+type WebhookPayload struct {
+	Timestamp     time.Time         `json:"timestamp"`
+	Admin         *AdminChange      `json:"admin,omitempty"` // who applied the override, and the state it changed, for admin events
+	Tags          map[string]string `json:"tags,omitempty"`  // the marginalia or sqlcommenter tags, when query_tags is on
+	DB            string            `json:"db"`
+	Kind          string            `json:"kind"`
+	Outcome       string            `json:"outcome"`
+	Rule          string            `json:"rule"`
+	User          string            `json:"user"`
+	Schema        string            `json:"schema"`
+	Command       string            `json:"command"`
+	DigestText    string            `json:"digest_text"`
+	Explain       string            `json:"explain,omitempty"` // the JSON plan, captured just before the kill when capture_explain is on
+	Error         string            `json:"error,omitempty"`
+	Time          int               `json:"time"` // the runtime in seconds
+	ProcessID     int               `json:"process_id"`
+	TransactionID int               `json:"transaction_id,omitempty"`
+	Waiters       int               `json:"waiters,omitempty"` // the sessions waiting on a blocker's locks
+	DryRun        bool              `json:"dry_run"`
+}
+
+// NewWebhook creates a new Webhook notifier from the given config. The config must have been
+// validated, so that the template parses.
+func NewWebhook(name string, config configuration.WebhookConfig) (*Webhook, error) {
+	webhook := &Webhook{
+		backoff: config.RetryBackoff,
+		client:  &http.Client{Timeout: webhookTimeout},
+		headers: config.Headers,
+		name:    name,
+		now:     time.Now,
+		queue:   make(chan Event, webhookQueueSize),
+		retries: DefaultWebhookMaxRetries,
+		secret:  []byte(config.Secret),
+		url:     config.URL,
+	}
+
+	if webhook.backoff == 0 {
+		webhook.backoff = DefaultWebhookRetryBackoff
+	}
+
+	if config.MaxRetries != nil {
+		webhook.retries = *config.MaxRetries
+	}
+
+	if config.Template != "" {
+		tmpl, err := template.New(name).Funcs(configuration.WebhookTemplateFuncs).Option("missingkey=error").Parse(config.Template)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing template for webhook %s: %w", name, err)
+		}
+
+		webhook.template = tmpl
+	}
+
+	return webhook, nil
+}
+
+// Notify queues the events to be sent. It never blocks; if the queue is full, the events are
+// dropped and ErrWebhookQueueFull is returned.
+func (webhook *Webhook) Notify(_ context.Context, events []Event) error {
+	dropped := 0
+
+	for _, event := range events {
+		select {
+		case webhook.queue <- event:
+		default:
+			dropped++
+		}
+	}
+
+	if dropped > 0 {
+		return fmt.Errorf("%w: webhook %s dropped %d events", ErrWebhookQueueFull, webhook.name, dropped)
+	}
+
+	return nil
+}
+
+// Run sends the queued events until the context is cancelled.
+func (webhook *Webhook) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case event := <-webhook.queue:
+			err := webhook.send(ctx, event)
+			if err != nil {
+				slog.Error("Error sending webhook",
+					slog.String("webhook", webhook.name),
+					slog.String("db", event.DB),
+					slog.Int("process_id", event.ProcessID),
+					slog.Any("err", err),
+				)
+			}
+		}
+	}
+}
+
+// send POSTs the event, retrying with an exponential backoff if the request fails with a network
+// error, a 429 or a 5xx.
+func (webhook *Webhook) send(ctx context.Context, event Event) error {
+	body, err := webhook.body(event)
+	if err != nil {
+		return err
+	}
+
+	backoff := webhook.backoff
+
+	for attempt := 0; ; attempt++ {
+		err = webhook.post(ctx, body)
+		if err == nil || attempt == webhook.retries || !retryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gave up after %d attempts: %w", attempt+1, err)
+
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+	}
+}
+
+// post makes a single signed request. Every attempt is signed with its own timestamp.
+func (webhook *Webhook) post(ctx context.Context, body []byte) error {
+	headers := make(http.Header, len(webhook.headers)+2) //nolint:mnd // the signature and timestamp
+	for name, value := range webhook.headers {
+		headers.Set(name, value)
+	}
+
+	if len(webhook.secret) > 0 {
+		timestamp := strconv.FormatInt(webhook.now().Unix(), 10)
+
+		headers.Set(WebhookTimestampHeader, timestamp)
+		headers.Set(WebhookSignatureHeader, "sha256="+Sign(webhook.secret, timestamp, body))
+	}
+
+	return post(ctx, webhook.client, webhook.url, body, headers)
+}
+
+// body renders the request body for the event, using the template if there is one.
+func (webhook *Webhook) body(event Event) ([]byte, error) {
+	payload := newWebhookPayload(event)
+
+	if webhook.template == nil {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("error marshalling payload: %w", err)
+		}
+
+		return body, nil
+	}
+
+	var body bytes.Buffer
+
+	err := webhook.template.Execute(&body, payload)
+	if err != nil {
+		return nil, fmt.Errorf("error executing template: %w", err)
+	}
+
+	return body.Bytes(), nil
+}
+
+// newWebhookPayload converts an event to its payload.
+func newWebhookPayload(event Event) WebhookPayload {
+	payload := WebhookPayload{
+		Timestamp:     event.Time,
+		Admin:         event.Admin,
+		DB:            event.DB,
+		Kind:          event.Kind,
+		Outcome:       event.Outcome,
+		Rule:          event.Rule,
+		User:          event.User,
+		Schema:        event.Schema,
+		Command:       event.Command,
+		DigestText:    event.DigestText,
+		Explain:       event.Explain,
+		Tags:          event.Tags,
+		Time:          int(event.Runtime.Seconds()),
+		ProcessID:     event.ProcessID,
+		TransactionID: event.TransactionID,
+		Waiters:       event.Waiters,
+		DryRun:        event.DryRun,
+	}
+
+	if event.Err != nil {
+		payload.Error = event.Err.Error()
+	}
+
+	return payload
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of timestamp + "." + body, which consumers can compare
+// against the signature header to verify that a request came from query-sniper. As the timestamp is
+// signed too, consumers should also reject requests whose timestamp header is more than a few minutes
+// old, so that a captured request can't be replayed.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryable reports whether a failed request should be retried.
+func retryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= http.StatusInternalServerError
+	}
+
+	// anything else is a network error.
+	return true
+}
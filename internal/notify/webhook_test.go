@@ -0,0 +1,298 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+)
+
+// webhookRequest is a request received by the fake webhook.
+type webhookRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// webhookRecorder is a fake webhook that records the requests made to it, and responds with the
+// status codes in statuses, then 200s.
+type webhookRecorder struct {
+	requests []webhookRequest
+	statuses []int
+	mu       sync.Mutex
+}
+
+func (recorder *webhookRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	recorder.requests = append(recorder.requests, webhookRequest{header: r.Header, body: body})
+
+	status := http.StatusOK
+	if len(recorder.statuses) > 0 {
+		status = recorder.statuses[0]
+		recorder.statuses = recorder.statuses[1:]
+	}
+
+	w.WriteHeader(status)
+}
+
+func newTestWebhook(t *testing.T, config configuration.WebhookConfig, statuses ...int) (*Webhook, *webhookRecorder) {
+	t.Helper()
+
+	recorder := &webhookRecorder{statuses: statuses}
+	server := httptest.NewServer(recorder)
+	t.Cleanup(server.Close)
+
+	config.URL = server.URL
+
+	webhook, err := NewWebhook("test", config)
+	if err != nil {
+		t.Fatalf("NewWebhook() error = %v", err)
+	}
+
+	webhook.client = server.Client()
+
+	return webhook, recorder
+}
+
+func TestWebhook_DefaultPayload(t *testing.T) {
+	t.Parallel()
+
+	webhook, recorder := newTestWebhook(t, configuration.WebhookConfig{
+		Secret:  "shh",
+		Headers: map[string]string{"x-team": "dba"},
+	})
+	webhook.now = func() time.Time { return time.Unix(1700000000, 0) }
+
+	event := testEvent("primary", OutcomeFailed)
+	event.Err = errors.New("Unknown thread id: 42")
+	event.Rule = "web"
+	event.Tags = map[string]string{"controller": "books", "action": "index"}
+
+	err := webhook.send(context.Background(), event)
+	if err != nil {
+		t.Fatalf("send() error = %v", err)
+	}
+
+	if len(recorder.requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(recorder.requests))
+	}
+
+	request := recorder.requests[0]
+
+	var payload WebhookPayload
+
+	err = json.Unmarshal(request.body, &payload)
+	if err != nil {
+		t.Fatalf("body %q is not a valid payload: %v", request.body, err)
+	}
+
+	want := WebhookPayload{
+		DB:         "primary",
+		Kind:       KindProcess,
+		Outcome:    OutcomeFailed,
+		Rule:       "web",
+		User:       "app",
+		Schema:     "web",
+		DigestText: "SELECT SLEEP (?)",
+		Error:      "Unknown thread id: 42",
+		Time:       90,
+		ProcessID:  42,
+		Tags:       map[string]string{"controller": "books", "action": "index"},
+	}
+
+	if !reflect.DeepEqual(payload, want) {
+		t.Errorf("payload = %+v, want %+v", payload, want)
+	}
+
+	if got := request.header.Get(WebhookTimestampHeader); got != "1700000000" {
+		t.Errorf("timestamp = %q, want %q", got, "1700000000")
+	}
+
+	if got, want := request.header.Get(WebhookSignatureHeader), "sha256="+Sign([]byte("shh"), "1700000000", request.body); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+
+	// the same body with another timestamp has another signature, so a request can't be replayed with a
+	// fresh timestamp.
+	if got := request.header.Get(WebhookSignatureHeader); got == "sha256="+Sign([]byte("shh"), "1700000300", request.body) {
+		t.Errorf("signature = %q, want it to depend on the timestamp", got)
+	}
+
+	if got := request.header.Get("X-Team"); got != "dba" {
+		t.Errorf("X-Team header = %q, want %q", got, "dba")
+	}
+}
+
+func TestWebhook_Template(t *testing.T) {
+	t.Parallel()
+
+	webhook, recorder := newTestWebhook(t, configuration.WebhookConfig{
+		Template: `{"summary": {{ printf "%s %s on %s" .Outcome .Kind .DB | json }}, "owner": {{ json .User }}, "seconds": {{ .Time }}}`,
+	})
+
+	err := webhook.send(context.Background(), testEvent("primary", OutcomeKilled))
+	if err != nil {
+		t.Fatalf("send() error = %v", err)
+	}
+
+	want := `{"summary": "killed process on primary", "owner": "app", "seconds": 90}`
+	if got := string(recorder.requests[0].body); got != want {
+		t.Errorf("body = %s, want %s", got, want)
+	}
+
+	// unsigned, because there's no secret.
+	if got := recorder.requests[0].header.Get(WebhookSignatureHeader); got != "" {
+		t.Errorf("signature = %q, want none", got)
+	}
+
+	if got := recorder.requests[0].header.Get(WebhookTimestampHeader); got != "" {
+		t.Errorf("timestamp = %q, want none", got)
+	}
+}
+
+func TestWebhook_Retries(t *testing.T) {
+	t.Parallel()
+
+	two, zero := 2, 0
+
+	tests := []struct {
+		maxRetries   *int
+		name         string
+		statuses     []int
+		wantRequests int
+		wantErr      bool
+	}{
+		{
+			name:         "succeeds after retrying server errors",
+			maxRetries:   &two,
+			statuses:     []int{http.StatusBadGateway, http.StatusTooManyRequests},
+			wantRequests: 3,
+			wantErr:      false,
+		},
+		{
+			name:         "gives up after max retries",
+			maxRetries:   &two,
+			statuses:     []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError},
+			wantRequests: 3,
+			wantErr:      true,
+		},
+		{
+			name:         "client errors are not retried",
+			maxRetries:   &two,
+			statuses:     []int{http.StatusBadRequest},
+			wantRequests: 1,
+			wantErr:      true,
+		},
+		{
+			name:         "defaults to 3 retries",
+			maxRetries:   nil,
+			statuses:     []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError},
+			wantRequests: 4,
+			wantErr:      true,
+		},
+		{
+			name:         "an explicit 0 turns retries off",
+			maxRetries:   &zero,
+			statuses:     []int{http.StatusInternalServerError},
+			wantRequests: 1,
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			webhook, recorder := newTestWebhook(t, configuration.WebhookConfig{
+				MaxRetries:   tt.maxRetries,
+				RetryBackoff: time.Millisecond,
+			}, tt.statuses...)
+
+			err := webhook.send(context.Background(), testEvent("primary", OutcomeKilled))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if len(recorder.requests) != tt.wantRequests {
+				t.Errorf("got %d requests, want %d", len(recorder.requests), tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestWebhook_Run(t *testing.T) {
+	t.Parallel()
+
+	webhook, recorder := newTestWebhook(t, configuration.WebhookConfig{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		webhook.Run(ctx)
+	}()
+
+	err := webhook.Notify(ctx, []Event{testEvent("primary", OutcomeDryRun), testEvent("primary", OutcomeLogged)})
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		recorder.mu.Lock()
+		received := len(recorder.requests)
+		recorder.mu.Unlock()
+
+		if received == 2 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d requests, want 2", received)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+}
+
+func TestWebhook_NotifyNeverBlocks(t *testing.T) {
+	t.Parallel()
+
+	webhook, err := NewWebhook("test", configuration.WebhookConfig{URL: "http://127.0.0.1:1"})
+	if err != nil {
+		t.Fatalf("NewWebhook() error = %v", err)
+	}
+
+	// Run is never started, so nothing drains the queue.
+	events := make([]Event, webhookQueueSize+1)
+
+	err = webhook.Notify(context.Background(), events)
+	if !errors.Is(err, ErrWebhookQueueFull) {
+		t.Errorf("Notify() error = %v, want %v", err, ErrWebhookQueueFull)
+	}
+}
+
+func TestNewWebhook_InvalidTemplate(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewWebhook("test", configuration.WebhookConfig{URL: "http://127.0.0.1:1", Template: "{{ .Nope "})
+	if err == nil {
+		t.Error("NewWebhook() error = nil, want an error")
+	}
+}
@@ -0,0 +1,339 @@
+// Package redact removes PII from raw SQL statements, so that the text of a live query (pl.info) can
+// be logged. The pipeline strips string and numeric literals and comments, replaces anything matching
+// the built-in email and SSN patterns or the configured ones, replaces the values compared to or
+// assigned to the configured columns, and truncates what's left. Quoted identifiers, optimizer hints
+// and version comments are kept, so the statement keeps its table and predicate structure.
+package redact
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultMaxLength is how many characters the redacted statement is truncated to when max_length isn't set.
+	DefaultMaxLength = 1024
+
+	// Placeholder replaces the values of the redacted columns and the pattern matches. Literals and
+	// comments are replaced with ?, like literals are in digests.
+	Placeholder = "[REDACTED]"
+
+	// truncated marks a statement that was cut at the max length.
+	truncated = "..."
+)
+
+var (
+	ErrInvalidPattern = errors.New("invalid redaction pattern")
+	ErrInvalidColumn  = errors.New("invalid redaction column")
+	ErrInvalidLength  = errors.New("invalid max length")
+)
+
+// builtinPatterns are always redacted, on top of the configured patterns: email addresses and US social
+// security numbers.
+var builtinPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+}
+
+// Redactor runs statements through the redaction pipeline. It's safe for concurrent use.
+type Redactor struct {
+	columns      *regexp.Regexp // matches the configured column names; nil if there are none
+	columnValues *regexp.Regexp // matches a configured column, an operator, and the value it's compared to or assigned
+	patterns     []*regexp.Regexp
+	maxLength    int
+}
+
+// New creates a Redactor that replaces the values of the given columns and the matches of the given
+// regex patterns, and truncates to maxLength characters (DefaultMaxLength if 0).
+func New(columns, patterns []string, maxLength int) (*Redactor, error) {
+	if maxLength < 0 {
+		return nil, fmt.Errorf("%w: %d must not be negative", ErrInvalidLength, maxLength)
+	}
+
+	if maxLength == 0 {
+		maxLength = DefaultMaxLength
+	}
+
+	redactor := &Redactor{
+		maxLength: maxLength,
+		patterns:  append([]*regexp.Regexp{}, builtinPatterns...),
+	}
+
+	for _, pattern := range patterns {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidPattern, err)
+		}
+
+		redactor.patterns = append(redactor.patterns, compiled)
+	}
+
+	if len(columns) > 0 {
+		names := make([]string, 0, len(columns))
+
+		for _, column := range columns {
+			if strings.TrimSpace(column) == "" {
+				return nil, fmt.Errorf("%w: column names must not be empty", ErrInvalidColumn)
+			}
+
+			names = append(names, regexp.QuoteMeta(column))
+		}
+
+		// the names are matched as whole identifiers, quoted or not, and case insensitively, like MySQL does.
+		column := "(?i)`(?:" + strings.Join(names, "|") + ")`|\\b(?:" + strings.Join(names, "|") + ")\\b"
+		redactor.columns = regexp.MustCompile(column)
+
+		// the value is whatever follows a comparison or assignment: a parenthesized list, a function
+		// call, or a single operand.
+		redactor.columnValues = regexp.MustCompile(
+			`(` + column + `)(\s*(?:<=>|<=|>=|<>|!=|=|<|>|\bNOT\s+LIKE\b|\bLIKE\b|\bNOT\s+IN\b|\bIN\b)\s*)` +
+				`(\w+\s*\([^)]*\)|\([^)]*\)|[^\s,;)]+)`)
+	}
+
+	return redactor, nil
+}
+
+// Redact returns the statement with its literals, comments, PII and the values of the configured
+// columns redacted, truncated to the max length. The column names are kept, so that the statement
+// still shows what it filters on.
+func (redactor *Redactor) Redact(statement string) string {
+	redacted := StripLiterals(statement)
+
+	for _, pattern := range redactor.patterns {
+		redacted = pattern.ReplaceAllLiteralString(redacted, Placeholder)
+	}
+
+	if redactor.columnValues != nil {
+		redacted = redactor.columnValues.ReplaceAllString(redacted, "${1}${2}"+Placeholder)
+	}
+
+	return truncate(redacted, redactor.maxLength)
+}
+
+// RedactTag returns the value of a marginalia or sqlcommenter tag with anything matching the built-in
+// or configured patterns replaced, or entirely replaced if the key is one of the configured columns.
+// Literals are kept, as tag values are literals.
+func (redactor *Redactor) RedactTag(key string, value string) string {
+	if redactor.columns != nil {
+		if match := redactor.columns.FindString(key); match == key || match == "`"+key+"`" {
+			return Placeholder
+		}
+	}
+
+	for _, pattern := range redactor.patterns {
+		value = pattern.ReplaceAllLiteralString(value, Placeholder)
+	}
+
+	return value
+}
+
+// StripLiterals replaces the string and numeric literals in the statement, and the bodies of its
+// comments, with ?. Comments are free text, so they can carry anything; the marginalia and sqlcommenter
+// tags in them are parsed out of the raw statement instead. Quoted identifiers are kept as they are, and
+// so are optimizer hints (/*+ ... */) and version comments (/*! ... */), which are part of the statement,
+// but with their literals stripped too.
+func StripLiterals(statement string) string {
+	var stripped strings.Builder
+
+	stripped.Grow(len(statement))
+
+	for i := 0; i < len(statement); {
+		c := statement[i]
+
+		switch {
+		case c == '\'' || c == '"':
+			i = skipQuoted(statement, i)
+
+			stripped.WriteByte('?')
+
+		case c == '`':
+			end := skipQuoted(statement, i)
+			stripped.WriteString(statement[i:end])
+			i = end
+
+		case strings.HasPrefix(statement[i:], "/*"):
+			body := i + 2 //nolint:mnd // past the /*
+
+			end := strings.Index(statement[body:], "*/")
+			if end < 0 {
+				end = len(statement)
+			} else {
+				end += body
+			}
+
+			if body < len(statement) && (statement[body] == '+' || statement[body] == '!') {
+				// the server version of a version comment isn't a literal.
+				version := body + 1
+				for statement[body] == '!' && version < end && isDigit(statement[version]) {
+					version++
+				}
+
+				stripped.WriteString("/*" + statement[body:version] + StripLiterals(statement[version:end]) + "*/")
+			} else {
+				stripped.WriteString("/* ? */")
+			}
+
+			i = min(end+2, len(statement)) //nolint:mnd // past the */
+
+		case c == '#' || strings.HasPrefix(statement[i:], "-- "):
+			end := strings.IndexByte(statement[i:], '\n')
+			if end < 0 {
+				end = len(statement)
+			} else {
+				end += i
+			}
+
+			if c == '#' {
+				stripped.WriteString("# ?")
+			} else {
+				stripped.WriteString("-- ?")
+			}
+
+			i = end
+
+		case startsNumber(statement, i):
+			end := skipNumber(statement, i)
+
+			// MySQL identifiers can start with digits, like 1st_quarter; those aren't numbers.
+			if end < len(statement) && isIdentifierByte(statement[end]) {
+				for end < len(statement) && isIdentifierByte(statement[end]) {
+					end++
+				}
+
+				stripped.WriteString(statement[i:end])
+			} else {
+				stripped.WriteByte('?')
+			}
+
+			i = end
+
+		default:
+			stripped.WriteByte(c)
+			i++
+		}
+	}
+
+	return stripped.String()
+}
+
+// skipQuoted returns the index just past the quoted string or identifier starting at start. Quotes are
+// escaped by doubling them, and in strings, with a backslash. An unterminated quote runs to the end.
+func skipQuoted(statement string, start int) int {
+	quote := statement[start]
+
+	for i := start + 1; i < len(statement); i++ {
+		switch {
+		case statement[i] == '\\' && quote != '`':
+			i++
+
+		case statement[i] == quote:
+			if i+1 < len(statement) && statement[i+1] == quote {
+				i++
+
+				continue
+			}
+
+			return i + 1
+		}
+	}
+
+	return len(statement)
+}
+
+// startsNumber returns whether a numeric literal starts at i: a digit, or a . followed by one, that
+// isn't part of an identifier like t1.
+func startsNumber(statement string, i int) bool {
+	if i > 0 && (isIdentifierByte(statement[i-1]) || statement[i-1] == '`') {
+		return false
+	}
+
+	switch {
+	case isDigit(statement[i]):
+		return true
+	case statement[i] == '.':
+		return i+1 < len(statement) && isDigit(statement[i+1])
+	default:
+		return false
+	}
+}
+
+// skipNumber returns the index just past the number starting at start: an integer, a decimal, a float
+// with an exponent, or a 0x hex or 0b binary literal.
+func skipNumber(statement string, start int) int {
+	i := start
+
+	if strings.HasPrefix(statement[i:], "0x") || strings.HasPrefix(statement[i:], "0b") {
+		i += 2
+
+		for i < len(statement) && isHexDigit(statement[i]) {
+			i++
+		}
+
+		return i
+	}
+
+	for i < len(statement) && isDigit(statement[i]) {
+		i++
+	}
+
+	if i < len(statement) && statement[i] == '.' {
+		i++
+
+		for i < len(statement) && isDigit(statement[i]) {
+			i++
+		}
+	}
+
+	if i+1 < len(statement) && (statement[i] == 'e' || statement[i] == 'E') {
+		exponent := i + 1
+		if statement[exponent] == '+' || statement[exponent] == '-' {
+			exponent++
+		}
+
+		if exponent < len(statement) && isDigit(statement[exponent]) {
+			i = exponent
+
+			for i < len(statement) && isDigit(statement[i]) {
+				i++
+			}
+		}
+	}
+
+	return i
+}
+
+// truncate cuts the statement to maxLength characters, marking it as truncated.
+func truncate(statement string, maxLength int) string {
+	if utf8.RuneCountInString(statement) <= maxLength {
+		return statement
+	}
+
+	runes := 0
+
+	for i := range statement {
+		if runes == maxLength {
+			return statement[:i] + truncated
+		}
+
+		runes++
+	}
+
+	return statement
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// isIdentifierByte returns whether c can be part of an unquoted identifier: letters, digits, _, $ and
+// anything outside of ASCII.
+func isIdentifierByte(c byte) bool {
+	return isDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '$' || c >= utf8.RuneSelf
+}
@@ -0,0 +1,227 @@
+package redact
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func TestStripLiterals(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		statement string
+		want      string
+	}{
+		{
+			name:      "strings and numbers",
+			statement: "SELECT * FROM users WHERE name = 'O''Brien' AND age > 42 AND score < -1.5e3",
+			want:      "SELECT * FROM users WHERE name = ? AND age > ? AND score < -?",
+		},
+		{
+			name:      "escaped quotes",
+			statement: `UPDATE notes SET body = 'it\'s "here"', title = "say \"hi\"" WHERE id = 7`,
+			want:      "UPDATE notes SET body = ?, title = ? WHERE id = ?",
+		},
+		{
+			name:      "in lists",
+			statement: "SELECT id FROM orders WHERE id IN (1, 2, 3) AND total > .5",
+			want:      "SELECT id FROM orders WHERE id IN (?, ?, ?) AND total > ?",
+		},
+		{
+			name:      "hex and binary",
+			statement: "SELECT * FROM blobs WHERE hash = 0xDEADbeef OR flags = 0b101 OR raw = X'0F'",
+			want:      "SELECT * FROM blobs WHERE hash = ? OR flags = ? OR raw = X?",
+		},
+		{
+			name:      "identifiers with digits are kept",
+			statement: "SELECT t1.col2, 1st_quarter, `weird 'name' 3` FROM t1 JOIN t2 ON t1.id = t2.id",
+			want:      "SELECT t1.col2, 1st_quarter, `weird 'name' 3` FROM t1 JOIN t2 ON t1.id = t2.id",
+		},
+		{
+			name:      "comments are stripped",
+			statement: "SELECT /* for jane@example.com */ * FROM orders WHERE id = 5 -- trailing 'comment'\nAND total > 1 # ssn 123-45-6789\nLIMIT 10",
+			want:      "SELECT /* ? */ * FROM orders WHERE id = ? -- ?\nAND total > ? # ?\nLIMIT ?",
+		},
+		{
+			name:      "optimizer hints and version comments are kept, without their literals",
+			statement: "SELECT /*+ MAX_EXECUTION_TIME(1000) */ /*!40001 SQL_NO_CACHE */ * FROM orders /*!80000 WHERE note = 'x' */",
+			want:      "SELECT /*+ MAX_EXECUTION_TIME(?) */ /*!40001 SQL_NO_CACHE */ * FROM orders /*!80000 WHERE note = ? */",
+		},
+		{
+			name:      "unterminated comment",
+			statement: "SELECT * FROM orders /* jane@example.com",
+			want:      "SELECT * FROM orders /* ? */",
+		},
+		{
+			name:      "unterminated string",
+			statement: "SELECT * FROM users WHERE name = 'trunc",
+			want:      "SELECT * FROM users WHERE name = ?",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := StripLiterals(tt.statement); got != tt.want {
+				t.Errorf("StripLiterals() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactor_Redact(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		statement string
+		want      string
+		columns   []string
+		patterns  []string
+		maxLength int
+	}{
+		{
+			name:      "literals only",
+			statement: "SELECT * FROM users WHERE email = 'jane@example.com'",
+			want:      "SELECT * FROM users WHERE email = ?",
+		},
+		{
+			name:      "emails and SSNs outside of literals",
+			statement: "SELECT `jane@example.com`, `123-45-6789` FROM users WHERE id = 1",
+			want:      "SELECT `[REDACTED]`, `[REDACTED]` FROM users WHERE id = ?",
+		},
+		{
+			name:      "comments",
+			statement: "SELECT * FROM users /* for jane@example.com, 123-45-6789 */ WHERE id = 1",
+			want:      "SELECT * FROM users /* ? */ WHERE id = ?",
+		},
+		{
+			name:      "column values, but not their names",
+			columns:   []string{"diagnosis", "hiv_status"},
+			statement: "SELECT p.Diagnosis, `hiv_status`, diagnosis_code FROM patients p WHERE p.hiv_status = 1 AND diagnosis_code = 2",
+			want:      "SELECT p.Diagnosis, `hiv_status`, diagnosis_code FROM patients p WHERE p.hiv_status = [REDACTED] AND diagnosis_code = ?",
+		},
+		{
+			name:      "column values in every form",
+			columns:   []string{"ssn", "diagnosis"},
+			statement: "UPDATE patients SET `SSN`=UNHEX('ab'), diagnosis = @dx WHERE ssn IN (1, 2) OR ssn NOT LIKE 'x%' OR ssn<>other_ssn",
+			want:      "UPDATE patients SET `SSN`=[REDACTED], diagnosis = [REDACTED] WHERE ssn IN [REDACTED] OR ssn NOT LIKE [REDACTED] OR ssn<>[REDACTED]",
+		},
+		{
+			name:      "patterns",
+			patterns:  []string{`acct_[0-9a-f]{8}`},
+			statement: "SELECT * FROM acct_0badf00d WHERE id = 1",
+			want:      "SELECT * FROM [REDACTED] WHERE id = ?",
+		},
+		{
+			name:      "truncated",
+			maxLength: 20,
+			statement: "SELECT * FROM orders WHERE id = 1",
+			want:      "SELECT * FROM orders...",
+		},
+		{
+			name:      "truncated on a character",
+			maxLength: 12,
+			statement: "SELECT 'é', `日本語` FROM t",
+			want:      "SELECT ?, `日...",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			redactor, err := New(tt.columns, tt.patterns, tt.maxLength)
+			if err != nil {
+				t.Fatalf("New() unexpected error = %v", err)
+			}
+
+			if got := redactor.Redact(tt.statement); got != tt.want {
+				t.Errorf("Redact() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactor_RedactTag(t *testing.T) {
+	t.Parallel()
+
+	redactor, err := New([]string{"email"}, []string{`acct_[0-9a-f]{8}`}, 0)
+	if err != nil {
+		t.Fatalf("New() unexpected error = %v", err)
+	}
+
+	tests := []struct {
+		key   string
+		value string
+		want  string
+	}{
+		{key: "controller", value: "books", want: "books"},
+		{key: "job_id", value: "42", want: "42"},
+		{key: "user", value: "jane@example.com", want: Placeholder},
+		{key: "account", value: "acct_0badf00d", want: Placeholder},
+		{key: "Email", value: "not-an-address", want: Placeholder},
+		{key: "email_domain", value: "example.com", want: "example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			t.Parallel()
+
+			if got := redactor.RedactTag(tt.key, tt.value); got != tt.want {
+				t.Errorf("RedactTag(%q, %q) = %q, want %q", tt.key, tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactor_DefaultMaxLength(t *testing.T) {
+	t.Parallel()
+
+	redactor, err := New(nil, nil, 0)
+	if err != nil {
+		t.Fatalf("New() unexpected error = %v", err)
+	}
+
+	got := redactor.Redact("SELECT " + strings.Repeat("a, ", DefaultMaxLength))
+	if want := DefaultMaxLength + len("..."); len(got) != want {
+		t.Errorf("Redact() length = %d, want %d", len(got), want)
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		wantErr   error
+		name      string
+		columns   []string
+		patterns  []string
+		maxLength int
+	}{
+		{name: "bad pattern", patterns: []string{"("}, wantErr: ErrInvalidPattern},
+		{name: "empty column", columns: []string{"email", " "}, wantErr: ErrInvalidColumn},
+		{name: "negative max length", maxLength: -1, wantErr: ErrInvalidLength},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := New(tt.columns, tt.patterns, tt.maxLength)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("New() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestMain is used to verify that there are no leaks during the tests.
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
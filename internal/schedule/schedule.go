@@ -0,0 +1,212 @@
+// Package schedule parses the cron expressions of the scheduled threshold profiles, and tells when
+// their windows are open. Only the standard five field syntax is supported: minute, hour, day of
+// month, month and day of week, each a *, a number, a range (1-5), a list (1,3,5) or a step (*/15
+// or 9-17/2). Named months and days, and the @hourly style shortcuts, aren't.
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // the container image has no zoneinfo, so embed it for time.LoadLocation
+)
+
+var (
+	ErrInvalidCron     = errors.New("invalid cron expression")
+	ErrInvalidTimezone = errors.New("invalid timezone")
+	ErrInvalidDuration = errors.New("invalid window duration")
+)
+
+// field is the range of values a cron field can take.
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = [5]field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12},
+	{name: "day of week", min: 0, max: 7}, // 0 and 7 are both Sunday
+}
+
+// Cron is a parsed cron expression. Each field is a bitset of the values it matches.
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool // the day fields were *, which changes how they combine
+}
+
+// Parse parses a five field cron expression.
+func Parse(expr string) (Cron, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return Cron{}, fmt.Errorf("%w: %q must have %d fields", ErrInvalidCron, expr, len(fields))
+	}
+
+	var sets [5]uint64
+
+	for i, part := range parts {
+		set, err := parseField(part, fields[i])
+		if err != nil {
+			return Cron{}, fmt.Errorf("%w: %q: %w", ErrInvalidCron, expr, err)
+		}
+
+		sets[i] = set
+	}
+
+	cron := Cron{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		domAny: parts[2] == "*",
+		dowAny: parts[4] == "*",
+	}
+
+	// Sunday can be written as either 0 or 7.
+	if cron.dow&(1<<7) != 0 {
+		cron.dow |= 1
+	}
+
+	return cron, nil
+}
+
+// parseField parses a single, comma separated, cron field into a bitset.
+func parseField(expr string, f field) (uint64, error) {
+	var set uint64
+
+	for part := range strings.SplitSeq(expr, ",") {
+		rangeExpr, stepExpr, hasStep := strings.Cut(part, "/")
+
+		step := 1
+
+		if hasStep {
+			n, err := strconv.Atoi(stepExpr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s step %q must be a positive number", f.name, stepExpr)
+			}
+
+			step = n
+		}
+
+		low, high := f.min, f.max
+
+		switch {
+		case rangeExpr == "*":
+		case strings.Contains(rangeExpr, "-"):
+			lowExpr, highExpr, _ := strings.Cut(rangeExpr, "-")
+
+			var err error
+
+			low, err = parseValue(lowExpr, f)
+			if err != nil {
+				return 0, err
+			}
+
+			high, err = parseValue(highExpr, f)
+			if err != nil {
+				return 0, err
+			}
+
+			if low > high {
+				return 0, fmt.Errorf("%s range %q is backwards", f.name, rangeExpr)
+			}
+		default:
+			value, err := parseValue(rangeExpr, f)
+			if err != nil {
+				return 0, err
+			}
+
+			// a single value with a step, eg 5/15, runs from that value to the end of the range.
+			low = value
+			if !hasStep {
+				high = value
+			}
+		}
+
+		for value := low; value <= high; value += step {
+			set |= 1 << value
+		}
+	}
+
+	return set, nil
+}
+
+// parseValue parses a single number in a cron field, and checks that it's in range.
+func parseValue(expr string, f field) (int, error) {
+	value, err := strconv.Atoi(expr)
+	if err != nil {
+		return 0, fmt.Errorf("%s %q is not a number", f.name, expr)
+	}
+
+	if value < f.min || value > f.max {
+		return 0, fmt.Errorf("%s %d must be between %d and %d", f.name, value, f.min, f.max)
+	}
+
+	return value, nil
+}
+
+// Matches reports whether the cron expression fires at the minute of t, in t's location. As in
+// standard cron, if both day fields are restricted, a day matches if either of them does.
+func (cron Cron) Matches(t time.Time) bool {
+	if cron.minute&(1<<t.Minute()) == 0 || cron.hour&(1<<t.Hour()) == 0 || cron.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+
+	dom := cron.dom&(1<<t.Day()) != 0
+	dow := cron.dow&(1<<int(t.Weekday())) != 0
+
+	switch {
+	case cron.domAny || cron.dowAny:
+		return dom && dow
+	default:
+		return dom || dow
+	}
+}
+
+// Window is a cron schedule that stays open for a duration every time it fires, eg every weekday at
+// 01:00 for 4 hours.
+type Window struct {
+	location *time.Location
+	cron     Cron
+	duration time.Duration
+}
+
+// NewWindow returns the window that opens on the cron expression, evaluated in the named timezone
+// (UTC if it's empty), and stays open for duration.
+func NewWindow(expr string, timezone string, duration time.Duration) (Window, error) {
+	cron, err := Parse(expr)
+	if err != nil {
+		return Window{}, err
+	}
+
+	if duration < time.Minute {
+		return Window{}, fmt.Errorf("%w: %v must be at least 1m", ErrInvalidDuration, duration)
+	}
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return Window{}, fmt.Errorf("%w: %w", ErrInvalidTimezone, err)
+	}
+
+	return Window{location: location, cron: cron, duration: duration}, nil
+}
+
+// Active reports whether the window is open at t: if the cron expression fired in the duration
+// before it. The minutes are walked back in absolute time, so a window still lasts its full duration
+// across a daylight saving change.
+func (window Window) Active(t time.Time) bool {
+	now := t.In(window.location).Truncate(time.Minute)
+
+	for start := now; now.Sub(start) < window.duration; start = start.Add(-time.Minute) {
+		if window.cron.Matches(start) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,156 @@
+package schedule
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestParse_Invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{name: "empty", expr: ""},
+		{name: "too few fields", expr: "0 1 * *"},
+		{name: "too many fields", expr: "0 1 * * * *"},
+		{name: "not a number", expr: "0 one * * *"},
+		{name: "minute out of range", expr: "60 1 * * *"},
+		{name: "day of month out of range", expr: "0 1 0 * *"},
+		{name: "backwards range", expr: "0 17-9 * * *"},
+		{name: "zero step", expr: "*/0 * * * *"},
+		{name: "named day", expr: "0 1 * * MON"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Parse(tt.expr)
+			if !errors.Is(err, ErrInvalidCron) {
+				t.Errorf("Parse(%q) error = %v, want %v", tt.expr, err, ErrInvalidCron)
+			}
+		})
+	}
+}
+
+func TestCron_Matches(t *testing.T) {
+	t.Parallel()
+
+	// 2025-06-02 is a Monday.
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2025, time.June, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		time time.Time
+		name string
+		expr string
+		want bool
+	}{
+		{name: "every minute", expr: "* * * * *", time: at(2, 13, 37), want: true},
+		{name: "exact time", expr: "30 1 * * *", time: at(2, 1, 30), want: true},
+		{name: "wrong minute", expr: "30 1 * * *", time: at(2, 1, 31), want: false},
+		{name: "hour range", expr: "0 9-17 * * *", time: at(2, 17, 0), want: true},
+		{name: "outside hour range", expr: "0 9-17 * * *", time: at(2, 18, 0), want: false},
+		{name: "step", expr: "*/15 * * * *", time: at(2, 4, 45), want: true},
+		{name: "off step", expr: "*/15 * * * *", time: at(2, 4, 50), want: false},
+		{name: "value with step", expr: "5/20 * * * *", time: at(2, 4, 45), want: true},
+		{name: "list", expr: "0 1,13 * * *", time: at(2, 13, 0), want: true},
+		{name: "weekdays", expr: "0 9 * * 1-5", time: at(6, 9, 0), want: true},
+		{name: "weekend", expr: "0 9 * * 1-5", time: at(7, 9, 0), want: false},
+		{name: "sunday as 7", expr: "0 9 * * 7", time: at(8, 9, 0), want: true},
+		{name: "sunday as 0", expr: "0 9 * * 0", time: at(8, 9, 0), want: true},
+		{name: "month", expr: "0 0 1 7 *", time: at(1, 0, 0), want: false},
+		{name: "either day field", expr: "0 0 15 * 1", time: at(2, 0, 0), want: true},
+		{name: "neither day field", expr: "0 0 15 * 1", time: at(3, 0, 0), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cron, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q) unexpected error = %v", tt.expr, err)
+			}
+
+			if got := cron.Matches(tt.time); got != tt.want {
+				t.Errorf("Parse(%q).Matches(%v) = %v, want %v", tt.expr, tt.time, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWindow_Active(t *testing.T) {
+	t.Parallel()
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("LoadLocation() unexpected error = %v", err)
+	}
+
+	// nightly at 01:00 New York time, for 4 hours.
+	window, err := NewWindow("0 1 * * *", "America/New_York", 4*time.Hour)
+	if err != nil {
+		t.Fatalf("NewWindow() unexpected error = %v", err)
+	}
+
+	tests := []struct {
+		time time.Time
+		name string
+		want bool
+	}{
+		{name: "before the window", time: time.Date(2025, time.June, 2, 0, 59, 0, 0, newYork), want: false},
+		{name: "as it opens", time: time.Date(2025, time.June, 2, 1, 0, 0, 0, newYork), want: true},
+		{name: "inside the window", time: time.Date(2025, time.June, 2, 3, 30, 15, 0, newYork), want: true},
+		{name: "as it closes", time: time.Date(2025, time.June, 2, 5, 0, 0, 0, newYork), want: false},
+		{name: "in another timezone", time: time.Date(2025, time.June, 2, 6, 0, 0, 0, time.UTC), want: true},
+		{name: "utc 01:00 is the previous evening", time: time.Date(2025, time.June, 2, 1, 0, 0, 0, time.UTC), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := window.Active(tt.time); got != tt.want {
+				t.Errorf("Active(%v) = %v, want %v", tt.time, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewWindow_Invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		wantErr  error
+		name     string
+		expr     string
+		timezone string
+		duration time.Duration
+	}{
+		{name: "bad cron", expr: "0 25 * * *", duration: time.Hour, wantErr: ErrInvalidCron},
+		{name: "bad timezone", expr: "0 1 * * *", timezone: "Mars/Olympus_Mons", duration: time.Hour, wantErr: ErrInvalidTimezone},
+		{name: "no duration", expr: "0 1 * * *", wantErr: ErrInvalidDuration},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewWindow(tt.expr, tt.timezone, tt.duration)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("NewWindow() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/notify"
+	"github.com/persona-id/query-sniper/internal/sniper"
+)
+
+// Admin applies runtime overrides to the running snipers; it's implemented by *sniper.Manager.
+type Admin interface {
+	Pause(name string) error
+	Resume(name string) error
+	SetDryRun(name string, dryRun *bool) error
+	SetSafeMode(safeMode *bool)
+	ResetBreaker(name string) error
+	Overrides() sniper.Overrides
+	Notify(ctx context.Context, events []notify.Event) error
+}
+
+// adminHandlerFunc is an admin endpoint, called with the name of the authenticated caller.
+type adminHandlerFunc func(w http.ResponseWriter, r *http.Request, caller string)
+
+// NewAdminHandler returns the http.Handler that serves the admin API, which pauses and resumes
+// snipers, resets their kill circuit breakers, and overrides their dry_run and the safe-mode flag at runtime. Every request must carry
+// one of the tokens as a bearer token, and every change is logged, and sent to the notifiers as an admin
+// event, with the name of its token's caller and the state before and after.
+// Every endpoint responds with the overrides in effect after the request.
+func NewAdminHandler(admin Admin, tokens map[string]string) http.Handler {
+	authenticated := func(handler adminHandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			caller, ok := authenticate(r, tokens)
+			if !ok {
+				slog.Warn("Admin API: rejected an unauthenticated request",
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+					slog.String("remote_addr", r.RemoteAddr),
+				)
+
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+
+				return
+			}
+
+			handler(w, r, caller)
+		}
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /admin/overrides", authenticated(func(w http.ResponseWriter, _ *http.Request, _ string) {
+		writeOverrides(w, admin)
+	}))
+
+	mux.HandleFunc("POST /admin/snipers/{name}/pause", authenticated(func(w http.ResponseWriter, r *http.Request, caller string) {
+		name := r.PathValue("name")
+		before := admin.Overrides()
+
+		if !applied(w, admin.Pause(name)) {
+			return
+		}
+
+		audit(r, admin, caller, "pause", name, pausedState(before, name), pausedState(admin.Overrides(), name))
+		writeOverrides(w, admin)
+	}))
+
+	mux.HandleFunc("POST /admin/snipers/{name}/resume", authenticated(func(w http.ResponseWriter, r *http.Request, caller string) {
+		name := r.PathValue("name")
+		before := admin.Overrides()
+
+		if !applied(w, admin.Resume(name)) {
+			return
+		}
+
+		audit(r, admin, caller, "resume", name, pausedState(before, name), pausedState(admin.Overrides(), name))
+		writeOverrides(w, admin)
+	}))
+
+	mux.HandleFunc("POST /admin/snipers/{name}/reset-breaker", authenticated(func(w http.ResponseWriter, r *http.Request, caller string) {
+		name := r.PathValue("name")
+		if !applied(w, admin.ResetBreaker(name)) {
+			return
+		}
+
+		// the sniper resets its breaker on its next tick, so the API doesn't know whether it was open.
+		audit(r, admin, caller, "reset_breaker", name, "", "breaker_reset_requested")
+		writeOverrides(w, admin)
+	}))
+
+	mux.HandleFunc("PUT /admin/snipers/{name}/dry-run", authenticated(func(w http.ResponseWriter, r *http.Request, caller string) {
+		enabled, ok := parseEnabled(w, r)
+		if !ok {
+			return
+		}
+
+		name := r.PathValue("name")
+		before := admin.Overrides()
+
+		if !applied(w, admin.SetDryRun(name, &enabled)) {
+			return
+		}
+
+		audit(r, admin, caller, "set_dry_run", name, dryRunState(before, name), dryRunState(admin.Overrides(), name))
+		writeOverrides(w, admin)
+	}))
+
+	mux.HandleFunc("DELETE /admin/snipers/{name}/dry-run", authenticated(func(w http.ResponseWriter, r *http.Request, caller string) {
+		name := r.PathValue("name")
+		before := admin.Overrides()
+
+		if !applied(w, admin.SetDryRun(name, nil)) {
+			return
+		}
+
+		audit(r, admin, caller, "clear_dry_run", name, dryRunState(before, name), dryRunState(admin.Overrides(), name))
+		writeOverrides(w, admin)
+	}))
+
+	mux.HandleFunc("PUT /admin/safe-mode", authenticated(func(w http.ResponseWriter, r *http.Request, caller string) {
+		enabled, ok := parseEnabled(w, r)
+		if !ok {
+			return
+		}
+
+		before := admin.Overrides()
+		admin.SetSafeMode(&enabled)
+
+		audit(r, admin, caller, "set_safe_mode", "", safeModeState(before), safeModeState(admin.Overrides()))
+		writeOverrides(w, admin)
+	}))
+
+	mux.HandleFunc("DELETE /admin/safe-mode", authenticated(func(w http.ResponseWriter, r *http.Request, caller string) {
+		before := admin.Overrides()
+		admin.SetSafeMode(nil)
+
+		audit(r, admin, caller, "clear_safe_mode", "", safeModeState(before), safeModeState(admin.Overrides()))
+		writeOverrides(w, admin)
+	}))
+
+	return mux
+}
+
+// authenticate returns the caller whose token the request's bearer token matches. Every token is
+// compared in constant time, so the response time doesn't leak which one was close.
+func authenticate(r *http.Request, tokens map[string]string) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return "", false
+	}
+
+	caller, found := "", false
+
+	for name, expected := range tokens {
+		if expected != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1 {
+			caller, found = name, true
+		}
+	}
+
+	return caller, found
+}
+
+// parseEnabled parses the request's "enabled" query parameter, or responds with 400 if it isn't a bool.
+func parseEnabled(w http.ResponseWriter, r *http.Request) (bool, bool) {
+	enabled, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+	if err != nil {
+		http.Error(w, "the enabled query parameter must be true or false", http.StatusBadRequest)
+
+		return false, false
+	}
+
+	return enabled, true
+}
+
+// applied reports whether an override was applied, or responds with the error if it wasn't.
+func applied(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, sniper.ErrUnknownSniper):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+
+	return false
+}
+
+// audit logs a runtime override, who made it, and the state before and after, and sends it to the
+// notifiers as an admin event, so that it's also in the audit log and wherever the kills are posted. db
+// is empty for the overrides that apply to every database.
+func audit(r *http.Request, admin Admin, caller string, action string, db string, oldState string, newState string) {
+	slog.Warn("Admin API: "+caller+" applied "+action,
+		slog.String("caller", caller),
+		slog.String("action", action),
+		slog.String("db", db),
+		slog.String("old_state", oldState),
+		slog.String("new_state", newState),
+		slog.String("remote_addr", r.RemoteAddr),
+	)
+
+	// the change has been made, so it's recorded even if the caller has gone away.
+	err := admin.Notify(context.WithoutCancel(r.Context()), []notify.Event{{
+		Admin: &notify.AdminChange{
+			Caller:   caller,
+			Action:   action,
+			OldState: oldState,
+			NewState: newState,
+		},
+		DB:      db,
+		Kind:    notify.KindAdmin,
+		Outcome: notify.OutcomeApplied,
+		Time:    time.Now(),
+	}})
+	if err != nil {
+		slog.Error("Error notifying of an admin API change",
+			slog.String("caller", caller),
+			slog.String("action", action),
+			slog.Any("err", err),
+		)
+	}
+}
+
+// pausedState returns whether the named sniper is paused or running, per the overrides.
+func pausedState(overrides sniper.Overrides, name string) string {
+	if slices.Contains(overrides.Paused, name) {
+		return "paused"
+	}
+
+	return "running"
+}
+
+// dryRunState returns the named sniper's dry_run override, or dry_run=configured if it has none.
+func dryRunState(overrides sniper.Overrides, name string) string {
+	dryRun, ok := overrides.DryRun[name]
+	if !ok {
+		return "dry_run=configured"
+	}
+
+	return "dry_run=" + strconv.FormatBool(dryRun)
+}
+
+// safeModeState returns the safe-mode override, or safe_mode=configured if there's none.
+func safeModeState(overrides sniper.Overrides) string {
+	if overrides.SafeMode == nil {
+		return "safe_mode=configured"
+	}
+
+	return "safe_mode=" + strconv.FormatBool(*overrides.SafeMode)
+}
+
+// writeOverrides responds with the overrides in effect.
+func writeOverrides(w http.ResponseWriter, admin Admin) {
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(admin.Overrides())
+	if err != nil {
+		slog.Error("Error encoding the admin overrides", slog.Any("err", err))
+	}
+}
@@ -0,0 +1,189 @@
+// Package server runs the HTTP server that exposes the sniper's operational endpoints.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/metrics"
+	"github.com/persona-id/query-sniper/internal/sniper"
+)
+
+const (
+	readHeaderTimeout = 5 * time.Second
+	shutdownTimeout   = 5 * time.Second
+)
+
+// DefaultReadyIntervals is how many intervals a sniper may go without a successful hunt before
+// /readyz reports it as not ready, if http.ready_intervals isn't set.
+const DefaultReadyIntervals = 3
+
+// Snipers reports the status of the running snipers, keyed by database name; it's implemented by
+// *sniper.Manager.
+type Snipers interface {
+	Status() map[string]sniper.Status
+}
+
+// sniperStatus is a sniper's entry on the /status page.
+// NB: this struct is sorted by datatype to satisfy the fieldalignment linter.
+type sniperStatus struct {
+	Since            time.Time      `json:"since"`
+	RetryAt          time.Time      `json:"retry_at,omitzero"`
+	LastTick         time.Time      `json:"last_tick,omitzero"`
+	LastSuccess      time.Time      `json:"last_success,omitzero"`
+	Kills            map[string]int `json:"kills"`
+	Name             string         `json:"name"`
+	State            string         `json:"state"`
+	LastError        string         `json:"last_error,omitempty"`
+	Interval         string         `json:"interval"`
+	QueryLimit       string         `json:"query_limit"`
+	TransactionLimit string         `json:"transaction_limit"`
+	Failures         int            `json:"failures"`
+	DryRun           bool           `json:"dry_run"`
+	Paused           bool           `json:"paused"`
+	Ready            bool           `json:"ready"`
+}
+
+// NewHandler returns the http.Handler that serves all of the sniper's HTTP endpoints. readyIntervals
+// is how many intervals a sniper may go without a successful hunt before /readyz fails; if it's not
+// positive, DefaultReadyIntervals is used.
+func NewHandler(snipers Snipers, readyIntervals int) http.Handler {
+	if readyIntervals <= 0 {
+		readyIntervals = DefaultReadyIntervals
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler())
+
+	// the process is alive as long as it can serve this.
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprintln(w, "ok")
+	})
+
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, _ *http.Request) {
+		ready(w, snipers.Status(), time.Now(), readyIntervals)
+	})
+
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, _ *http.Request) {
+		status(w, snipers.Status(), time.Now(), readyIntervals)
+	})
+
+	return mux
+}
+
+// ready serves /readyz: 200 once every sniper has connected and hunted successfully within the last
+// readyIntervals intervals, or 503 listing the snipers that haven't.
+func ready(w http.ResponseWriter, snipers map[string]sniper.Status, now time.Time, readyIntervals int) {
+	if len(snipers) == 0 {
+		http.Error(w, "not ready: no snipers are running", http.StatusServiceUnavailable)
+
+		return
+	}
+
+	var unready []string
+
+	for _, name := range slices.Sorted(maps.Keys(snipers)) {
+		s := snipers[name]
+		if s.Ready(now, readyIntervals) {
+			continue
+		}
+
+		reason := s.State
+		if s.LastError != "" {
+			reason += ": " + s.LastError
+		}
+
+		unready = append(unready, name+" ("+reason+")")
+	}
+
+	if len(unready) > 0 {
+		http.Error(w, "not ready: "+strings.Join(unready, ", "), http.StatusServiceUnavailable)
+
+		return
+	}
+
+	_, _ = fmt.Fprintln(w, "ready")
+}
+
+// status serves /status: a JSON list of the snipers, sorted by name.
+func status(w http.ResponseWriter, snipers map[string]sniper.Status, now time.Time, readyIntervals int) {
+	page := struct {
+		Snipers []sniperStatus `json:"snipers"`
+	}{Snipers: make([]sniperStatus, 0, len(snipers))}
+
+	for _, name := range slices.Sorted(maps.Keys(snipers)) {
+		s := snipers[name]
+
+		page.Snipers = append(page.Snipers, sniperStatus{
+			Name:             name,
+			State:            s.State,
+			Since:            s.Since,
+			RetryAt:          s.RetryAt,
+			LastError:        s.LastError,
+			Failures:         s.Failures,
+			Ready:            s.Ready(now, readyIntervals),
+			DryRun:           s.DryRun,
+			Paused:           s.Paused,
+			Interval:         s.Interval.String(),
+			QueryLimit:       s.QueryLimit.String(),
+			TransactionLimit: s.TransactionLimit.String(),
+			LastTick:         s.LastTick,
+			LastSuccess:      s.LastSuccess,
+			Kills:            s.Kills,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(page)
+	if err != nil {
+		slog.Error("Error encoding the status page", slog.Any("err", err))
+	}
+}
+
+// Serve runs the HTTP server on the given address with the given handler until the context is
+// cancelled, at which point the server is gracefully shut down.
+func Serve(ctx context.Context, address string, handler http.Handler) error {
+	srv := &http.Server{
+		Addr:              address,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	errChan := make(chan error, 1)
+
+	go func() {
+		slog.Info("Starting HTTP server", slog.String("address", address))
+
+		errChan <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errChan:
+		return fmt.Errorf("error running HTTP server: %w", err)
+
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+		defer cancel()
+
+		err := srv.Shutdown(shutdownCtx)
+		if err != nil {
+			return fmt.Errorf("error shutting down HTTP server: %w", err)
+		}
+
+		err = <-errChan
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("error running HTTP server: %w", err)
+		}
+
+		return nil
+	}
+}
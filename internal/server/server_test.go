@@ -0,0 +1,248 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+
+	"github.com/persona-id/query-sniper/internal/sniper"
+)
+
+// fakeSnipers is a fixed set of sniper statuses.
+type fakeSnipers map[string]sniper.Status
+
+func (snipers fakeSnipers) Status() map[string]sniper.Status {
+	return snipers
+}
+
+// healthySniper is the status of a sniper that hunted successfully just now.
+func healthySniper() sniper.Status {
+	now := time.Now()
+
+	return sniper.Status{
+		Health:           sniper.Health{State: sniper.HealthHealthy, Since: now.Add(-time.Hour)},
+		Interval:         time.Second,
+		QueryLimit:       10 * time.Second,
+		TransactionLimit: 30 * time.Second,
+		LastTick:         now,
+		LastSuccess:      now,
+		Kills:            map[string]int{"process": 2},
+	}
+}
+
+func TestNewHandler(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{
+			name:       "metrics endpoint",
+			method:     http.MethodGet,
+			path:       "/metrics",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "metrics endpoint only supports GET",
+			method:     http.MethodPost,
+			path:       "/metrics",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "liveness endpoint",
+			method:     http.MethodGet,
+			path:       "/healthz",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "readiness endpoint",
+			method:     http.MethodGet,
+			path:       "/readyz",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "status endpoint",
+			method:     http.MethodGet,
+			path:       "/status",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "unknown path",
+			method:     http.MethodGet,
+			path:       "/nope",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			NewHandler(fakeSnipers{"primary": healthySniper()}, 0).ServeHTTP(rec, httptest.NewRequestWithContext(t.Context(), tt.method, tt.path, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("NewHandler() %s %s status = %d, want %d", tt.method, tt.path, rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	t.Parallel()
+
+	stale := healthySniper()
+	stale.LastSuccess = time.Now().Add(-time.Minute)
+
+	down := healthySniper()
+	down.State = sniper.HealthDown
+	down.LastError = "error pinging the database: connection refused"
+
+	starting := sniper.Status{Health: sniper.Health{State: sniper.HealthStarting}, Interval: time.Second}
+
+	tests := []struct {
+		snipers    fakeSnipers
+		name       string
+		wantBody   string
+		wantStatus int
+	}{
+		{
+			name:       "every sniper hunted recently",
+			snipers:    fakeSnipers{"primary": healthySniper(), "replica": healthySniper()},
+			wantStatus: http.StatusOK,
+			wantBody:   "ready",
+		},
+		{
+			name:       "no snipers",
+			snipers:    fakeSnipers{},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "no snipers are running",
+		},
+		{
+			name:       "a sniper that hasn't hunted yet",
+			snipers:    fakeSnipers{"primary": healthySniper(), "replica": starting},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "not ready: replica (starting)",
+		},
+		{
+			name:       "a sniper without a recent successful hunt",
+			snipers:    fakeSnipers{"primary": stale},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "not ready: primary (healthy)",
+		},
+		{
+			name:       "a sniper that is down",
+			snipers:    fakeSnipers{"primary": down, "replica": starting},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "not ready: primary (down: error pinging the database: connection refused), replica (starting)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := httptest.NewRecorder()
+			NewHandler(tt.snipers, 0).ServeHTTP(rec, httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/readyz", nil))
+
+			if rec.Code != tt.wantStatus || !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("GET /readyz = %d %q, want %d containing %q", rec.Code, rec.Body.String(), tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	t.Parallel()
+
+	replica := healthySniper()
+	replica.DryRun = true
+	replica.LastSuccess = time.Now().Add(-time.Minute)
+
+	rec := httptest.NewRecorder()
+	NewHandler(fakeSnipers{"replica": replica, "primary": healthySniper()}, 0).
+		ServeHTTP(rec, httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/status", nil))
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("GET /status = %d %s, want 200 application/json", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	var page struct {
+		Snipers []struct {
+			Kills            map[string]int `json:"kills"`
+			Name             string         `json:"name"`
+			State            string         `json:"state"`
+			QueryLimit       string         `json:"query_limit"`
+			TransactionLimit string         `json:"transaction_limit"`
+			LastTick         string         `json:"last_tick"`
+			DryRun           bool           `json:"dry_run"`
+			Ready            bool           `json:"ready"`
+		} `json:"snipers"`
+	}
+
+	err := json.Unmarshal(rec.Body.Bytes(), &page)
+	if err != nil {
+		t.Fatalf("GET /status body %q isn't JSON: %v", rec.Body.String(), err)
+	}
+
+	if len(page.Snipers) != 2 || page.Snipers[0].Name != "primary" || page.Snipers[1].Name != "replica" {
+		t.Fatalf("GET /status snipers = %+v, want primary and replica, in that order", page.Snipers)
+	}
+
+	primary := page.Snipers[0]
+	if primary.State != sniper.HealthHealthy || primary.QueryLimit != "10s" || primary.TransactionLimit != "30s" ||
+		primary.LastTick == "" || primary.Kills["process"] != 2 || !primary.Ready || primary.DryRun {
+		t.Errorf("GET /status primary = %+v, want the healthy, ready sniper", primary)
+	}
+
+	if got := page.Snipers[1]; !got.DryRun || got.Ready {
+		t.Errorf("GET /status replica = %+v, want a dry run sniper that isn't ready", got)
+	}
+}
+
+func TestServe_Shutdown(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- Serve(ctx, "127.0.0.1:0", http.NotFoundHandler())
+	}()
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Serve() returned error after shutdown: %v", err)
+		}
+
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve() did not return after the context was cancelled")
+	}
+}
+
+func TestServe_InvalidAddress(t *testing.T) {
+	t.Parallel()
+
+	err := Serve(t.Context(), "not-an-address", http.NotFoundHandler())
+	if err == nil {
+		t.Error("Serve() with an invalid address should return an error")
+	}
+}
+
+// TestMain is used to verify that there are no leaks during the tests.
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
@@ -0,0 +1,177 @@
+package sniper
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+	"github.com/persona-id/query-sniper/internal/metrics"
+)
+
+// DefaultAdaptiveMinLimit is the floor of the adaptive limits when adaptive.min_limit isn't set.
+const DefaultAdaptiveMinLimit = time.Second
+
+// serverLoadQuery reads the status variables that the adaptive thresholds scale the limits by.
+const serverLoadQuery = `SHOW GLOBAL STATUS WHERE Variable_name IN ('Threads_running', 'Innodb_row_lock_current_waits')`
+
+// serverLoad is the load on the server, as read by serverLoadQuery.
+type serverLoad struct {
+	threadsRunning int
+	rowLockWaits   int
+}
+
+// readServerLoad reads the server's current load.
+func (sniper QuerySniper) readServerLoad(ctx context.Context) (serverLoad, error) {
+	rows, err := sniper.Connection.QueryContext(ctx, serverLoadQuery)
+	if err != nil {
+		return serverLoad{}, fmt.Errorf("error getting server status: %w", err)
+	}
+	defer rows.Close()
+
+	var load serverLoad
+
+	for rows.Next() {
+		var (
+			name, value string
+			count       int
+		)
+
+		err = rows.Scan(&name, &value)
+		if err != nil {
+			return serverLoad{}, fmt.Errorf("error scanning row: %w", err)
+		}
+
+		count, err = strconv.Atoi(value)
+		if err != nil {
+			return serverLoad{}, fmt.Errorf("error parsing %s: %w", name, err)
+		}
+
+		switch name {
+		case "Threads_running":
+			load.threadsRunning = count
+		case "Innodb_row_lock_current_waits":
+			load.rowLockWaits = count
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return serverLoad{}, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return load, nil
+}
+
+// loadScale returns the factor the limits are scaled by for the given load: the lowest scale of the
+// steps that the load has reached, or 1 if it hasn't reached any of them.
+func (sniper QuerySniper) loadScale(load serverLoad) float64 {
+	scale := 1.0
+
+	for _, step := range sniper.adaptive.Steps {
+		reached := (step.ThreadsRunning > 0 && load.threadsRunning >= step.ThreadsRunning) ||
+			(step.RowLockWaits > 0 && load.rowLockWaits >= step.RowLockWaits)
+
+		if reached {
+			scale = min(scale, step.Scale)
+		}
+	}
+
+	return scale
+}
+
+// scaled returns a copy of the sniper with its long query and transaction limits, and those of its
+// rules, multiplied by scale, and the hunter queries regenerated to match. A limit is never scaled
+// below the adaptive min_limit, but a limit that's already below it is left alone. The per-query
+// timeouts from query hints aren't scaled; they're the query's own.
+func (sniper QuerySniper) scaled(scale float64) (QuerySniper, error) {
+	if scale >= 1 {
+		return sniper, nil
+	}
+
+	floor := sniper.adaptive.MinLimit
+
+	scaleLimit := func(limit time.Duration) time.Duration {
+		return max(time.Duration(float64(limit)*scale), min(limit, floor))
+	}
+
+	sniper.QueryLimit = scaleLimit(sniper.QueryLimit)
+	sniper.TransactionLimit = scaleLimit(sniper.TransactionLimit)
+
+	// the rules are shared with the unscaled sniper, so they're copied before they're changed.
+	sniper.policy = slices.Clone(sniper.policy)
+
+	for i := range sniper.policy {
+		r := &sniper.policy[i]
+		r.LongQueryLimit = scaleLimit(r.LongQueryLimit)
+		r.LongTransactionLimit = scaleLimit(r.LongTransactionLimit)
+	}
+
+	query, txn, err := sniper.generateHunterQueries()
+	if err != nil {
+		return QuerySniper{}, fmt.Errorf("error generating hunter queries: %w", err)
+	}
+
+	sniper.LRQQuery = query
+	sniper.LRTXNQuery = txn
+
+	return sniper, nil
+}
+
+// adapt returns the sniper to hunt with on this tick, with its limits scaled for the server's current
+// load, and the scale that was applied. previous is the scale of the last tick, so that only changes
+// are logged. If the load can't be read, the limits aren't scaled.
+func (sniper QuerySniper) adapt(ctx context.Context, previous float64) (QuerySniper, float64) {
+	load, err := sniper.readServerLoad(ctx)
+	if err != nil {
+		slog.Error("Error reading server load, using the configured limits",
+			slog.String("db", sniper.Name),
+			slog.Any("err", err),
+		)
+
+		metrics.AdaptiveScale.WithLabelValues(sniper.Name).Set(1)
+
+		return sniper, 1
+	}
+
+	scale := sniper.loadScale(load)
+
+	hunter, err := sniper.scaled(scale)
+	if err != nil {
+		slog.Error("Error scaling limits, using the configured limits",
+			slog.String("db", sniper.Name),
+			slog.Float64("scale", scale),
+			slog.Any("err", err),
+		)
+
+		scale, hunter = 1, sniper
+	}
+
+	metrics.AdaptiveScale.WithLabelValues(sniper.Name).Set(scale)
+
+	if scale != previous {
+		slog.Info("Server load changed the limits on "+sniper.Name,
+			slog.String("db", sniper.Name),
+			slog.Int("threads_running", load.threadsRunning),
+			slog.Int("row_lock_waits", load.rowLockWaits),
+			slog.Float64("scale", scale),
+			slog.Float64("previous_scale", previous),
+			slog.Duration("query_limit", hunter.QueryLimit),
+			slog.Duration("transaction_limit", hunter.TransactionLimit),
+		)
+	}
+
+	return hunter, scale
+}
+
+// adaptiveSettings returns the adaptive settings of the database, with the min_limit defaulted.
+func adaptiveSettings(config configuration.AdaptiveConfig) configuration.AdaptiveConfig {
+	if config.MinLimit == 0 {
+		config.MinLimit = DefaultAdaptiveMinLimit
+	}
+
+	return config
+}
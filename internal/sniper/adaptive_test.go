@@ -0,0 +1,157 @@
+package sniper
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+)
+
+func TestLoadScale(t *testing.T) {
+	t.Parallel()
+
+	sniper := QuerySniper{
+		adaptive: configuration.AdaptiveConfig{
+			Enabled: true,
+			Steps: []configuration.AdaptiveStep{
+				{ThreadsRunning: 50, Scale: 0.5},
+				{ThreadsRunning: 200, RowLockWaits: 20, Scale: 0.25},
+				{RowLockWaits: 5, Scale: 0.75},
+			},
+		},
+	}
+
+	tests := []struct {
+		name string
+		load serverLoad
+		want float64
+	}{
+		{
+			name: "idle",
+			load: serverLoad{threadsRunning: 8},
+			want: 1,
+		},
+		{
+			name: "first step",
+			load: serverLoad{threadsRunning: 50},
+			want: 0.5,
+		},
+		{
+			name: "highest step reached by threads running",
+			load: serverLoad{threadsRunning: 400},
+			want: 0.25,
+		},
+		{
+			name: "step reached by row lock waits",
+			load: serverLoad{threadsRunning: 8, rowLockWaits: 5},
+			want: 0.75,
+		},
+		{
+			name: "lowest scale of the reached steps",
+			load: serverLoad{threadsRunning: 60, rowLockWaits: 25},
+			want: 0.25,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := sniper.loadScale(tt.load); got != tt.want {
+				t.Errorf("loadScale(%+v) = %v, want %v", tt.load, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScaled(t *testing.T) {
+	t.Parallel()
+
+	rules, err := newPolicy([]configuration.Rule{
+		{Name: "reporting", User: "reporting", LongQueryLimit: time.Minute},
+		{Name: "fast", User: "fast", LongQueryLimit: 3 * time.Second},
+		{Name: "default limits", User: "web"},
+	})
+	if err != nil {
+		t.Fatalf("newPolicy() unexpected error = %v", err)
+	}
+
+	sniper := QuerySniper{
+		QueryLimit:       10 * time.Second,
+		TransactionLimit: 30 * time.Second,
+		adaptive:         configuration.AdaptiveConfig{Enabled: true, MinLimit: 4 * time.Second},
+		policy:           rules,
+	}
+
+	sniper.LRQQuery, sniper.LRTXNQuery, err = sniper.generateHunterQueries()
+	if err != nil {
+		t.Fatalf("generateHunterQueries() unexpected error = %v", err)
+	}
+
+	unscaled, err := sniper.scaled(1)
+	if err != nil {
+		t.Fatalf("scaled(1) unexpected error = %v", err)
+	}
+
+	if unscaled.QueryLimit != sniper.QueryLimit || unscaled.LRQQuery != sniper.LRQQuery {
+		t.Errorf("scaled(1) = %v, %q, want the limits unchanged", unscaled.QueryLimit, unscaled.LRQQuery)
+	}
+
+	hunter, err := sniper.scaled(0.25)
+	if err != nil {
+		t.Fatalf("scaled(0.25) unexpected error = %v", err)
+	}
+
+	// 10s * 0.25 is below the 4s floor, while 30s * 0.25 isn't.
+	if hunter.QueryLimit != 4*time.Second || hunter.TransactionLimit != 7500*time.Millisecond {
+		t.Errorf("scaled(0.25) limits = %v, %v, want 4s, 7.5s", hunter.QueryLimit, hunter.TransactionLimit)
+	}
+
+	wantRules := []time.Duration{15 * time.Second, 3 * time.Second, 0}
+	for i, want := range wantRules {
+		if got := hunter.policy[i].LongQueryLimit; got != want {
+			t.Errorf("scaled(0.25) rule %s limit = %v, want %v", hunter.policy[i].Name, got, want)
+		}
+	}
+
+	if sniper.policy[0].LongQueryLimit != time.Minute {
+		t.Errorf("scaled(0.25) changed the unscaled rule's limit to %v", sniper.policy[0].LongQueryLimit)
+	}
+
+	// the lowest limit is now the fast rule's own 3s, which is below the floor and so isn't scaled.
+	if !strings.Contains(hunter.LRQQuery, "AND pl.time >= 3") {
+		t.Errorf("scaled(0.25) LRQQuery = %q, want it regenerated with the 3s limit", hunter.LRQQuery)
+	}
+
+	if !strings.Contains(hunter.LRTXNQuery, ">= 7") || !strings.Contains(sniper.LRTXNQuery, ">= 30") {
+		t.Errorf("scaled(0.25) LRTXNQuery = %q, want it regenerated with the 7.5s limit", hunter.LRTXNQuery)
+	}
+}
+
+func TestWithSettings_Adaptive(t *testing.T) {
+	t.Parallel()
+
+	settings := managerTestSettings("primary")
+
+	config := settings.Databases["primary"]
+	config.Adaptive = configuration.AdaptiveConfig{
+		Enabled: true,
+		Steps:   []configuration.AdaptiveStep{{ThreadsRunning: 100, Scale: 0.5}},
+	}
+	settings.Databases["primary"] = config
+
+	retuned, err := QuerySniper{Name: "primary"}.withSettings(settings)
+	if err != nil {
+		t.Fatalf("withSettings() unexpected error = %v", err)
+	}
+
+	if !retuned.adaptive.Enabled || retuned.adaptive.MinLimit != DefaultAdaptiveMinLimit || len(retuned.adaptive.Steps) != 1 {
+		t.Errorf("withSettings() adaptive = %+v, want it enabled with the default min_limit", retuned.adaptive)
+	}
+
+	// the configured limits are still baked into the queries, for the ticks where the server isn't busy.
+	if retuned.QueryLimit != 10*time.Second || !strings.Contains(retuned.LRQQuery, "AND pl.time >= 10") {
+		t.Errorf("withSettings() QueryLimit = %v, LRQQuery = %q, want the unscaled 10s limit", retuned.QueryLimit, retuned.LRQQuery)
+	}
+}
@@ -0,0 +1,171 @@
+package sniper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/metrics"
+	"github.com/persona-id/query-sniper/internal/notify"
+)
+
+// DefaultBreakerCooldown is how long the kill circuit breaker stays open when breaker_cooldown isn't set.
+const DefaultBreakerCooldown = 5 * time.Minute
+
+// killBudgetWindow is the window that max_kills_per_minute is counted over.
+const killBudgetWindow = time.Minute
+
+// ErrKillBudgetExceeded is the reason given in the notification when the circuit breaker trips.
+var ErrKillBudgetExceeded = errors.New("kill budget exceeded")
+
+// killBudget is a sniper's kill circuit breaker. It counts the real KILLs in the last minute, and once
+// a kill would go over max_kills_per_minute, it trips open and the sniper stays in dry run until the
+// cooldown has passed or the configuration is reloaded. This keeps a bad deploy that makes every
+// query slow from turning into a mass KILL that makes the outage worse.
+//
+// As with sightings, the sniper holds a pointer to its budget so that the copies made by withSettings
+// share it. It's only used from the sniper's own Loop, so it isn't safe for concurrent use.
+type killBudget struct {
+	now      func() time.Time
+	openedAt time.Time   // when the breaker tripped; zero while it's closed
+	kills    []time.Time // the kills in the last minute, oldest first
+}
+
+func newKillBudget() *killBudget {
+	return &killBudget{now: time.Now}
+}
+
+// spend records a kill, and returns false if the breaker is open or the kill would go over limit, in
+// which case the kill must not happen. tripped is true if this call tripped the breaker. A nil budget,
+// or a limit of 0, allows every kill.
+func (budget *killBudget) spend(limit int) (allowed bool, tripped bool) {
+	if budget == nil || limit <= 0 {
+		return true, false
+	}
+
+	if !budget.openedAt.IsZero() {
+		return false, false
+	}
+
+	now := budget.now()
+
+	cutoff := now.Add(-killBudgetWindow)
+	for len(budget.kills) > 0 && !budget.kills[0].After(cutoff) {
+		budget.kills = budget.kills[1:]
+	}
+
+	if len(budget.kills) >= limit {
+		budget.openedAt = now
+		budget.kills = nil
+
+		return false, true
+	}
+
+	budget.kills = append(budget.kills, now)
+
+	return true, false
+}
+
+// refund gives back the most recent kill, when its KILL failed. Failed kills, which are usually
+// "Unknown thread id" races with an offender that just finished, mustn't trip the breaker.
+func (budget *killBudget) refund(limit int) {
+	if budget == nil || limit <= 0 || len(budget.kills) == 0 {
+		return
+	}
+
+	budget.kills = budget.kills[:len(budget.kills)-1]
+}
+
+// cooledDown closes the breaker if it has been open for at least cooldown, and reports whether it did.
+func (budget *killBudget) cooledDown(cooldown time.Duration) bool {
+	if budget == nil || budget.openedAt.IsZero() || budget.now().Sub(budget.openedAt) < cooldown {
+		return false
+	}
+
+	budget.openedAt = time.Time{}
+
+	return true
+}
+
+// reset closes the breaker and forgets the recent kills, and reports whether the breaker was open.
+func (budget *killBudget) reset() bool {
+	if budget == nil {
+		return false
+	}
+
+	wasOpen := !budget.openedAt.IsZero()
+
+	budget.openedAt = time.Time{}
+	budget.kills = nil
+
+	return wasOpen
+}
+
+// spendKill spends a kill from the sniper's budget, and returns false if the offender must not be
+// killed, because the circuit breaker is open. The caller then handles the offender as if the sniper
+// were in dry run. When this call trips the breaker, it's logged and notified as loudly as possible.
+func (sniper QuerySniper) spendKill(ctx context.Context, kind string) bool {
+	allowed, tripped := sniper.budget.spend(sniper.MaxKillsPerMinute)
+	if !tripped {
+		return allowed
+	}
+
+	metrics.CircuitBreakerTrips.WithLabelValues(sniper.Name).Inc()
+	metrics.CircuitBreakerOpen.WithLabelValues(sniper.Name).Set(1)
+
+	reason := fmt.Errorf("%w: more than %d kills in the last minute on %s, dry run for the next %s",
+		ErrKillBudgetExceeded, sniper.MaxKillsPerMinute, sniper.Name, sniper.BreakerCooldown)
+
+	slog.Error("Kill circuit breaker tripped on "+sniper.Name+", dropping into dry run",
+		slog.String("db", sniper.Name),
+		slog.String("kind", kind),
+		slog.Int("max_kills_per_minute", sniper.MaxKillsPerMinute),
+		slog.Duration("breaker_cooldown", sniper.BreakerCooldown),
+		slog.Any("err", reason),
+	)
+
+	sniper.notify(ctx, []notify.Event{{
+		DB:      sniper.Name,
+		DryRun:  true,
+		Err:     reason,
+		Kind:    notify.KindCircuitBreaker,
+		Outcome: notify.OutcomeTripped,
+		Time:    time.Now(),
+	}})
+
+	return false
+}
+
+// refundKill gives back the kill spent by spendKill, when the KILL failed.
+func (sniper QuerySniper) refundKill() {
+	sniper.budget.refund(sniper.MaxKillsPerMinute)
+}
+
+// resetBreaker closes the circuit breaker if a reset was requested through the admin API. It's called
+// at the start of every tick, as the budget is only used from the sniper's own Loop.
+func (sniper QuerySniper) resetBreaker() {
+	if !sniper.overrides.takeBreakerReset(sniper.Name) || !sniper.budget.reset() {
+		return
+	}
+
+	metrics.CircuitBreakerOpen.WithLabelValues(sniper.Name).Set(0)
+
+	slog.Warn("Kill circuit breaker reset through the admin API on "+sniper.Name+", resuming kills", slog.String("db", sniper.Name))
+}
+
+// closeBreaker closes the circuit breaker once its cooldown has passed. It's called at the start of
+// every tick.
+func (sniper QuerySniper) closeBreaker() {
+	if !sniper.budget.cooledDown(sniper.BreakerCooldown) {
+		return
+	}
+
+	metrics.CircuitBreakerOpen.WithLabelValues(sniper.Name).Set(0)
+
+	slog.Warn("Kill circuit breaker closed on "+sniper.Name+" after its cooldown, resuming kills",
+		slog.String("db", sniper.Name),
+		slog.Duration("breaker_cooldown", sniper.BreakerCooldown),
+	)
+}
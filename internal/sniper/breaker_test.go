@@ -0,0 +1,174 @@
+package sniper
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/notify"
+)
+
+func TestKillBudget(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	budget := &killBudget{now: func() time.Time { return now }}
+
+	for _, step := range []struct {
+		name        string
+		advance     time.Duration
+		wantAllowed bool
+		wantTripped bool
+	}{
+		{name: "first kill", advance: 0, wantAllowed: true},
+		{name: "second kill", advance: 20 * time.Second, wantAllowed: true},
+		{name: "first kill falls out of the window", advance: 41 * time.Second, wantAllowed: true},
+		{name: "over the budget trips the breaker", advance: time.Second, wantAllowed: false, wantTripped: true},
+		{name: "open breaker refuses kills", advance: 10 * time.Minute, wantAllowed: false},
+	} {
+		now = now.Add(step.advance)
+
+		allowed, tripped := budget.spend(2)
+		if allowed != step.wantAllowed || tripped != step.wantTripped {
+			t.Errorf("%s: spend() = %v, %v, want %v, %v", step.name, allowed, tripped, step.wantAllowed, step.wantTripped)
+		}
+	}
+
+	if budget.cooledDown(time.Hour) {
+		t.Error("cooledDown() closed the breaker before its cooldown")
+	}
+
+	if !budget.cooledDown(10 * time.Minute) {
+		t.Error("cooledDown() didn't close the breaker after its cooldown")
+	}
+
+	if allowed, _ := budget.spend(2); !allowed {
+		t.Error("spend() refused a kill after the breaker closed")
+	}
+
+	var disabled *killBudget
+	if allowed, _ := disabled.spend(2); !allowed {
+		t.Error("spend() on a nil budget refused a kill")
+	}
+}
+
+func TestKillBudget_Reset(t *testing.T) {
+	t.Parallel()
+
+	budget := newKillBudget()
+
+	if _, tripped := budget.spend(1); tripped {
+		t.Fatal("spend() tripped on the first kill")
+	}
+
+	if _, tripped := budget.spend(1); !tripped {
+		t.Fatal("spend() didn't trip over the budget")
+	}
+
+	if !budget.reset() {
+		t.Error("reset() = false, want true for an open breaker")
+	}
+
+	if budget.reset() {
+		t.Error("reset() = true, want false for a closed breaker")
+	}
+}
+
+func TestKillBudget_Refund(t *testing.T) {
+	t.Parallel()
+
+	budget := newKillBudget()
+
+	// a failed KILL gives its kill back, so it can't trip the breaker.
+	for range 3 {
+		if allowed, tripped := budget.spend(1); !allowed || tripped {
+			t.Fatalf("spend() = %v, %v after refunds, want the kill allowed", allowed, tripped)
+		}
+
+		budget.refund(1)
+	}
+
+	if _, tripped := budget.spend(1); tripped {
+		t.Error("spend() tripped on the only successful kill")
+	}
+
+	if _, tripped := budget.spend(1); !tripped {
+		t.Error("spend() didn't trip over the budget")
+	}
+
+	// refunds don't do anything without a budget.
+	var disabled *killBudget
+	disabled.refund(1)
+}
+
+func TestResetBreaker(t *testing.T) {
+	t.Parallel()
+
+	budget := newKillBudget()
+	budget.spend(1)
+	budget.spend(1)
+
+	overrides := newOverrides()
+	sniper := QuerySniper{Name: "test_reset_breaker", MaxKillsPerMinute: 1, budget: budget, overrides: overrides}
+
+	// without a request, the breaker stays open.
+	sniper.resetBreaker()
+
+	if budget.openedAt.IsZero() {
+		t.Fatal("resetBreaker() closed the breaker without a reset request")
+	}
+
+	overrides.requestBreakerReset(sniper.Name)
+	sniper.resetBreaker()
+
+	if !budget.openedAt.IsZero() || len(budget.kills) != 0 {
+		t.Errorf("resetBreaker() left the breaker open, or kept the recent kills: %+v", budget)
+	}
+
+	if overrides.takeBreakerReset(sniper.Name) {
+		t.Error("resetBreaker() didn't clear the reset request")
+	}
+}
+
+func TestKillProcesses_CircuitBreaker(t *testing.T) {
+	t.Parallel()
+
+	// the budget has already been spent, so the next kill trips the breaker, and the sniper has to
+	// fall back to dry run; the nil connection would panic on a real KILL.
+	budget := newKillBudget()
+	budget.kills = []time.Time{time.Now()}
+
+	notifier := &recordingNotifier{}
+	sniper := QuerySniper{
+		Name:              "test_breaker",
+		BreakerCooldown:   time.Minute,
+		MaxKillsPerMinute: 1,
+		QueryLimit:        10 * time.Second,
+		budget:            budget,
+		notifier:          notifier,
+	}
+
+	processes := []MysqlProcess{
+		{ID: 1, Command: "Query", Time: 30, User: sql.NullString{String: "app", Valid: true}},
+		{ID: 2, Command: "Query", Time: 30, User: sql.NullString{String: "app", Valid: true}},
+	}
+
+	if killed := sniper.KillProcesses(context.Background(), processes); killed != 2 {
+		t.Errorf("KillProcesses() killed = %d, want 2 dry run kills", killed)
+	}
+
+	if len(notifier.events) != 3 {
+		t.Fatalf("Notify() got %d events, want the trip and 2 dry run kills: %+v", len(notifier.events), notifier.events)
+	}
+
+	if trip := notifier.events[0]; trip.Kind != notify.KindCircuitBreaker || trip.Outcome != notify.OutcomeTripped || trip.Err == nil {
+		t.Errorf("first event = %+v, want the circuit breaker trip", trip)
+	}
+
+	for _, event := range notifier.events[1:] {
+		if event.Outcome != notify.OutcomeDryRun || !event.DryRun {
+			t.Errorf("event = %+v, want a dry run kill", event)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package sniper
+
+import (
+	"log/slog"
+	"maps"
+	"slices"
+
+	"github.com/persona-id/query-sniper/internal/metrics"
+)
+
+// Offender is a session that a hunter found over its limit, for the state dump. It never includes the
+// raw query text, which may contain PII.
+// NB: this struct is sorted by datatype to satisfy the fieldalignment linter.
+type Offender struct {
+	Kind       string `json:"kind"` // one of the metrics.Kind* values
+	User       string `json:"user"`
+	Schema     string `json:"schema"`
+	Host       string `json:"host"`
+	DigestText string `json:"digest_text"`
+	ID         int    `json:"id"`   // the processlist id
+	Time       int    `json:"time"` // how long it has been running, or waiting for a metadata lock, in seconds
+}
+
+func processOffenders(processes []MysqlProcess) []Offender {
+	offenders := make([]Offender, 0, len(processes))
+
+	for _, process := range processes {
+		offenders = append(offenders, Offender{
+			Kind:       metrics.KindProcess,
+			ID:         process.ID,
+			User:       process.User.String,
+			Schema:     process.Schema.String,
+			Host:       process.Host.String,
+			Time:       process.Time,
+			DigestText: process.DigestText.String,
+		})
+	}
+
+	return offenders
+}
+
+func transactionOffenders(transactions []MysqlTransaction) []Offender {
+	offenders := make([]Offender, 0, len(transactions))
+
+	for _, transaction := range transactions {
+		offenders = append(offenders, Offender{
+			Kind:       metrics.KindTransaction,
+			ID:         transaction.ProcessID,
+			User:       transaction.User.String,
+			Schema:     transaction.Schema.String,
+			Host:       transaction.Host.String,
+			Time:       transaction.Time,
+			DigestText: transaction.DigestText.String,
+		})
+	}
+
+	return offenders
+}
+
+func idleTransactionOffenders(transactions []MysqlIdleTransaction) []Offender {
+	offenders := make([]Offender, 0, len(transactions))
+
+	for _, transaction := range transactions {
+		offenders = append(offenders, Offender{
+			Kind:       metrics.KindIdleTransaction,
+			ID:         transaction.ProcessID,
+			User:       transaction.User.String,
+			Schema:     transaction.Schema.String,
+			Host:       transaction.Host.String,
+			Time:       transaction.Time,
+			DigestText: transaction.DigestText.String,
+		})
+	}
+
+	return offenders
+}
+
+func blockerOffenders(blockers []MysqlBlocker) []Offender {
+	offenders := make([]Offender, 0, len(blockers))
+
+	for _, blocker := range blockers {
+		offenders = append(offenders, Offender{
+			Kind:       metrics.KindBlocker,
+			ID:         blocker.ID,
+			User:       blocker.User.String,
+			Schema:     blocker.Schema.String,
+			Host:       blocker.Host.String,
+			Time:       blocker.Time,
+			DigestText: blocker.DigestText.String,
+		})
+	}
+
+	return offenders
+}
+
+// metadataLockOffenders returns the DDL statements waiting on the metadata locks; the holders are only
+// offenders once they're killed.
+func metadataLockOffenders(locks []MysqlMetadataLock) []Offender {
+	offenders := make([]Offender, 0, len(locks))
+
+	for _, lock := range locks {
+		offenders = append(offenders, Offender{
+			Kind:       metrics.KindMetadataLock,
+			ID:         lock.Waiter.ID,
+			User:       lock.Waiter.User.String,
+			Schema:     lock.Waiter.Schema.String,
+			Host:       lock.Waiter.Host.String,
+			Time:       lock.Waiter.Time,
+			DigestText: lock.Waiter.DigestText.String,
+		})
+	}
+
+	return offenders
+}
+
+// Dump queues a dump of every sniper's state to the log, which Run writes between reloads.
+// If a dump is already pending, this one is dropped.
+func (manager *Manager) Dump() {
+	select {
+	case manager.dumps <- struct{}{}:
+	default:
+		slog.Warn("A state dump is already pending, ignoring this one")
+	}
+}
+
+// dump logs the state of every running sniper: its configuration, with the password redacted, its
+// status and kill counts, and what its hunters found on the last tick.
+func (manager *Manager) dump() {
+	redacted := manager.settings.Redact()
+	statuses := manager.Status()
+	overrides := manager.Overrides()
+
+	slog.Info("State dump",
+		slog.Int("snipers", len(statuses)),
+		slog.Bool("safe_mode", manager.settings.SafeMode),
+		slog.Any("overrides", overrides),
+	)
+
+	for _, name := range slices.Sorted(maps.Keys(statuses)) {
+		status := statuses[name]
+
+		slog.Info("State dump of sniper "+name,
+			slog.String("db", name),
+			slog.Any("config", redacted.Databases[name]),
+			slog.Group("status",
+				slog.String("state", status.State),
+				slog.Time("since", status.Since),
+				slog.String("last_error", status.LastError),
+				slog.Int("failures", status.Failures),
+				slog.Bool("paused", status.Paused),
+			),
+			slog.Group("settings",
+				slog.Duration("interval", status.Interval),
+				slog.Duration("query_limit", status.QueryLimit),
+				slog.Duration("transaction_limit", status.TransactionLimit),
+				slog.Bool("dry_run", status.DryRun),
+			),
+			slog.Any("kills", status.Kills),
+			slog.Time("last_tick", status.LastTick),
+			slog.Time("last_success", status.LastSuccess),
+			slog.Any("offenders", status.Offenders),
+		)
+	}
+}
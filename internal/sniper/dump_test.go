@@ -0,0 +1,103 @@
+package sniper
+
+import (
+	"database/sql"
+	"slices"
+	"testing"
+
+	"github.com/persona-id/query-sniper/internal/metrics"
+)
+
+func TestOffenders(t *testing.T) {
+	t.Parallel()
+
+	user := sql.NullString{String: "app", Valid: true}
+	schema := sql.NullString{String: "orders", Valid: true}
+	host := sql.NullString{String: "10.0.0.1:5432", Valid: true}
+	digest := sql.NullString{String: "SELECT * FROM `orders` WHERE `id` = ?", Valid: true}
+
+	process := MysqlProcess{ID: 7, User: user, Schema: schema, Host: host, DigestText: digest, Time: 12, Info: sql.NullString{String: "SELECT * FROM orders WHERE id = 42", Valid: true}}
+	transaction := MysqlTransaction{ID: 99, ProcessID: 8, User: user, Schema: schema, Host: host, DigestText: digest, Time: 40}
+
+	tests := []struct {
+		name string
+		got  []Offender
+		want Offender
+	}{
+		{
+			name: "process",
+			got:  processOffenders([]MysqlProcess{process}),
+			want: Offender{Kind: metrics.KindProcess, ID: 7, User: "app", Schema: "orders", Host: "10.0.0.1:5432", DigestText: digest.String, Time: 12},
+		},
+		{
+			name: "transactions are identified by their process",
+			got:  transactionOffenders([]MysqlTransaction{transaction}),
+			want: Offender{Kind: metrics.KindTransaction, ID: 8, User: "app", Schema: "orders", Host: "10.0.0.1:5432", DigestText: digest.String, Time: 40},
+		},
+		{
+			name: "idle transaction",
+			got:  idleTransactionOffenders([]MysqlIdleTransaction{{MysqlTransaction: transaction, IdleTime: 30}}),
+			want: Offender{Kind: metrics.KindIdleTransaction, ID: 8, User: "app", Schema: "orders", Host: "10.0.0.1:5432", DigestText: digest.String, Time: 40},
+		},
+		{
+			name: "blocker",
+			got:  blockerOffenders([]MysqlBlocker{{ID: 9, User: user, Schema: schema, Host: host, DigestText: digest, Time: 50, Waiters: 3}}),
+			want: Offender{Kind: metrics.KindBlocker, ID: 9, User: "app", Schema: "orders", Host: "10.0.0.1:5432", DigestText: digest.String, Time: 50},
+		},
+		{
+			name: "metadata locks are the waiting DDL",
+			got:  metadataLockOffenders([]MysqlMetadataLock{{Waiter: process, Holders: []MysqlProcess{{ID: 1}}}}),
+			want: Offender{Kind: metrics.KindMetadataLock, ID: 7, User: "app", Schema: "orders", Host: "10.0.0.1:5432", DigestText: digest.String, Time: 12},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if !slices.Equal(tt.got, []Offender{tt.want}) {
+				t.Errorf("offenders = %+v, want %+v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHealth_Spotted(t *testing.T) {
+	t.Parallel()
+
+	h := newHealth("test_spotted")
+
+	h.spotted([]Offender{{Kind: metrics.KindProcess, ID: 1}, {Kind: metrics.KindTransaction, ID: 2}})
+
+	status := h.snapshot()
+	if len(status.Offenders) != 2 {
+		t.Fatalf("snapshot() offenders = %+v, want the two spotted", status.Offenders)
+	}
+
+	// the snapshot's offenders are a copy.
+	status.Offenders[0].ID = 100
+
+	h.spotted(nil)
+
+	if got := h.snapshot().Offenders; len(got) != 0 {
+		t.Errorf("snapshot() offenders = %+v, want none after a tick that found nothing", got)
+	}
+}
+
+func TestManager_Dump(t *testing.T) {
+	t.Parallel()
+
+	manager := NewManager(managerTestSettings("primary"))
+
+	manager.Dump()
+	manager.Dump()
+
+	if len(manager.dumps) != 1 {
+		t.Errorf("Dump() queued %d dumps, want the second dropped while the first is pending", len(manager.dumps))
+	}
+
+	<-manager.dumps
+
+	// the dump itself only logs, even for snipers that haven't ticked yet.
+	manager.dump()
+}
@@ -0,0 +1,64 @@
+package sniper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// explainTimeout bounds EXPLAIN FOR CONNECTION, so that capturing a plan never holds up a kill for long.
+const explainTimeout = time.Second
+
+// explain returns the JSON execution plan of the statement that the process is running, as MySQL is
+// executing it, or "" if capture_explain is off or the plan couldn't be captured. It's called just
+// before the process is killed, as the plan is gone once it is; a failure never stops the kill.
+func (sniper QuerySniper) explain(ctx context.Context, processID int) string {
+	if !sniper.CaptureExplain {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, explainTimeout)
+	defer cancel()
+
+	var plan []byte
+
+	err := sniper.Connection.QueryRowContext(ctx, "EXPLAIN FORMAT=JSON FOR CONNECTION "+strconv.Itoa(processID)).Scan(&plan)
+	if err != nil {
+		// the statement may have finished, or not be explainable; either way, there's nothing to capture.
+		slog.Debug("Couldn't capture the plan of mysql process",
+			slog.String("db", sniper.Name),
+			slog.Int("process_id", processID),
+			slog.Any("err", err),
+		)
+
+		return ""
+	}
+
+	return compactPlan(plan)
+}
+
+// compactPlan returns the plan without the indentation MySQL formats it with, to keep log lines and
+// notifications short.
+func compactPlan(plan []byte) string {
+	var compacted bytes.Buffer
+
+	err := json.Compact(&compacted, plan)
+	if err != nil {
+		return string(plan)
+	}
+
+	return compacted.String()
+}
+
+// explainAttr returns the log attribute for the plan, or an empty attribute, which slog drops, if
+// there's no plan.
+func explainAttr(plan string) slog.Attr {
+	if plan == "" {
+		return slog.Attr{}
+	}
+
+	return slog.String("explain", plan)
+}
@@ -0,0 +1,57 @@
+package sniper
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+)
+
+func TestCompactPlan(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		plan string
+		want string
+	}{
+		{
+			name: "indented",
+			plan: "{\n  \"query_block\": {\n    \"select_id\": 1,\n    \"table\": {\"table_name\": \"orders\", \"access_type\": \"ALL\"}\n  }\n}",
+			want: `{"query_block":{"select_id":1,"table":{"table_name":"orders","access_type":"ALL"}}}`,
+		},
+		{
+			name: "not JSON",
+			plan: "not a plan",
+			want: "not a plan",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := compactPlan([]byte(tt.plan)); got != tt.want {
+				t.Errorf("compactPlan() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExplain_Disabled(t *testing.T) {
+	t.Parallel()
+
+	// without capture_explain, the connection (nil here) is never used.
+	sniper := QuerySniper{Name: "test_explain"}
+
+	if plan := sniper.explain(context.Background(), 42); plan != "" {
+		t.Errorf("explain() = %q, want no plan with capture_explain off", plan)
+	}
+
+	if attr := explainAttr(""); !attr.Equal(slog.Attr{}) {
+		t.Errorf("explainAttr(\"\") = %v, want an empty attribute", attr)
+	}
+
+	if attr := explainAttr(`{"query_block":{}}`); attr.Key != "explain" {
+		t.Errorf("explainAttr() key = %q, want explain", attr.Key)
+	}
+}
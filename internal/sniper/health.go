@@ -0,0 +1,315 @@
+package sniper
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/metrics"
+)
+
+// Health states of a sniper.
+const (
+	HealthStarting = "starting" // the sniper hasn't connected or hunted yet
+	HealthHealthy  = "healthy"  // every hunter succeeded on the last tick
+	HealthDegraded = "degraded" // the database is reachable, but a hunter failed on the last tick
+	HealthDown     = "down"     // the database is unreachable, or the sniper couldn't be created
+)
+
+// healthStates is every health state, for resetting the health metric.
+var healthStates = []string{HealthStarting, HealthHealthy, HealthDegraded, HealthDown}
+
+// DefaultMaxBackoff caps the exponential backoff between attempts to reach a database that is down.
+const DefaultMaxBackoff = 5 * time.Minute
+
+// initialBackoff is the delay before retrying a sniper that couldn't be created.
+const initialBackoff = time.Second
+
+// Health is a snapshot of a sniper's health.
+// NB: this struct is sorted by datatype to satisfy the fieldalignment linter.
+type Health struct {
+	Since     time.Time `json:"since"`                // when the sniper entered its current state
+	RetryAt   time.Time `json:"retry_at,omitzero"`    // when a sniper that is down will next try to reach its database
+	State     string    `json:"state"`                // one of the Health* states
+	LastError string    `json:"last_error,omitempty"` // the error that made the sniper degraded or down
+	Failures  int       `json:"failures"`             // consecutive failed ticks or connection attempts
+}
+
+// Status is a snapshot of a sniper's health, the settings it hunted with on its last tick, and what it
+// has killed, for the status endpoint.
+// NB: this struct is sorted by datatype to satisfy the fieldalignment linter.
+type Status struct {
+	LastTick         time.Time      // when the sniper last hunted; zero until its first tick
+	LastSuccess      time.Time      // when every hunter last succeeded; zero until then
+	Kills            map[string]int // kills since the sniper started, by metrics.Kind*; dry run kills are counted too
+	Offenders        []Offender     // what the hunters found on the last tick
+	Name             string
+	Health           // the sniper's current health
+	Interval         time.Duration
+	QueryLimit       time.Duration // after any scheduled profile and adaptive scaling
+	TransactionLimit time.Duration // after any scheduled profile and adaptive scaling
+	DryRun           bool          // whether the sniper was in dry run, for any reason
+	Paused           bool          // whether the sniper was paused through the admin API
+}
+
+// Ready reports whether the sniper is connected, and has hunted successfully within the last
+// intervals ticks as of now. A paused sniper is always ready, since it was paused on purpose.
+func (status Status) Ready(now time.Time, intervals int) bool {
+	if status.Paused {
+		return true
+	}
+
+	if status.State == HealthDown || status.LastSuccess.IsZero() {
+		return false
+	}
+
+	return now.Sub(status.LastSuccess) <= time.Duration(intervals)*status.Interval
+}
+
+// health tracks a sniper's health and status. It's written by the sniper's goroutine and read by the
+// Manager for the health endpoints, so unlike the sniper's other shared state, it's safe for concurrent
+// use. A nil health tracks nothing.
+type health struct {
+	status Status
+	mu     sync.Mutex
+}
+
+func newHealth(name string) *health {
+	setHealthMetric(name, HealthStarting)
+
+	return &health{
+		status: Status{
+			Name:   name,
+			Health: Health{State: HealthStarting, Since: time.Now()},
+			Kills:  make(map[string]int),
+		},
+	}
+}
+
+// get returns the current health.
+func (h *health) get() Health {
+	if h == nil {
+		return Health{}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.status.Health
+}
+
+// snapshot returns the current status.
+func (h *health) snapshot() Status {
+	if h == nil {
+		return Status{}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	status := h.status
+	status.Kills = maps.Clone(h.status.Kills)
+	status.Offenders = slices.Clone(h.status.Offenders)
+
+	return status
+}
+
+// configured records the settings the sniper hunts with.
+func (h *health) configured(sniper QuerySniper) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.status.Interval = sniper.Interval
+	h.status.QueryLimit = sniper.QueryLimit
+	h.status.TransactionLimit = sniper.TransactionLimit
+	h.status.DryRun = sniper.DryRun
+}
+
+// ticked records a hunt by the given hunter, and its outcome.
+func (h *health) ticked(hunter QuerySniper, err error) {
+	if h == nil {
+		return
+	}
+
+	h.configured(hunter)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.status.LastTick = time.Now()
+
+	if err == nil {
+		h.status.LastSuccess = h.status.LastTick
+	}
+}
+
+// spotted records what the hunters found on this tick, in place of the last tick's.
+func (h *health) spotted(offenders []Offender) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.status.Offenders = offenders
+}
+
+// killed counts kills of the given kind.
+func (h *health) killed(kind string, count int) {
+	if h == nil || count == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.status.Kills[kind] += count
+}
+
+// update records a health check of the named sniper, and logs it if the state changed. err is why the
+// sniper is degraded or down, and retryIn how long it waits before trying again, if it's down.
+func (h *health) update(name string, state string, err error, failures int, retryIn time.Duration) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+
+	previous := h.status.Health
+
+	h.status.State = state
+	h.status.Failures = failures
+	h.status.LastError = ""
+	h.status.RetryAt = time.Time{}
+
+	if err != nil {
+		h.status.LastError = err.Error()
+	}
+
+	if retryIn > 0 {
+		h.status.RetryAt = time.Now().Add(retryIn)
+	}
+
+	if state != previous.State {
+		h.status.Since = time.Now()
+	}
+
+	h.mu.Unlock()
+
+	if state == previous.State {
+		return
+	}
+
+	setHealthMetric(name, state)
+
+	attrs := []any{
+		slog.String("db", name),
+		slog.String("state", state),
+		slog.String("previous_state", previous.State),
+		slog.Int("failures", failures),
+	}
+
+	switch state {
+	case HealthDown:
+		slog.Error("Sniper "+name+" is down, backing off", append(attrs, slog.Duration("retry_in", retryIn), slog.Any("err", err))...)
+	case HealthDegraded:
+		slog.Warn("Sniper "+name+" is degraded", append(attrs, slog.Any("err", err))...)
+	default:
+		slog.Info("Sniper "+name+" is "+state, attrs...)
+	}
+}
+
+// setHealthMetric sets the health metric of the named sniper to its current state.
+func setHealthMetric(name string, state string) {
+	for _, s := range healthStates {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+
+		metrics.SniperHealth.WithLabelValues(name, s).Set(value)
+	}
+}
+
+// backoff returns the delay before the next attempt after the given number of consecutive failures:
+// base, doubled for every failure after the first, up to DefaultMaxBackoff.
+func backoff(base time.Duration, failures int) time.Duration {
+	delay := base
+
+	for i := 1; i < failures && delay < DefaultMaxBackoff; i++ {
+		delay *= 2
+	}
+
+	return min(delay, DefaultMaxBackoff)
+}
+
+// supervision is a sniper's record of its consecutive failures, kept by Loop between ticks.
+type supervision struct {
+	retryAt  time.Time // while the database is down, the ticks before this are skipped
+	failures int
+}
+
+// reachable reports whether the sniper should hunt on this tick. While its database is down, the
+// sniper only pings it once the backoff has passed, rather than running every hunter against a
+// database it can't reach.
+func (sniper QuerySniper) reachable(ctx context.Context, state *supervision) bool {
+	if sniper.health.get().State != HealthDown {
+		return true
+	}
+
+	if time.Now().Before(state.retryAt) {
+		return false
+	}
+
+	err := sniper.Connection.PingContext(ctx)
+	if err != nil {
+		sniper.down(state, fmt.Errorf("error pinging the database: %w", err))
+
+		return false
+	}
+
+	return true
+}
+
+// checked records the outcome of a hunt. A failed hunt makes the sniper degraded if the database is
+// still reachable, in which case it keeps hunting on every tick so the hunters that work aren't held
+// back; otherwise the sniper is down, and backs off.
+func (sniper QuerySniper) checked(ctx context.Context, state *supervision, err error) {
+	if err == nil {
+		state.failures = 0
+
+		sniper.health.update(sniper.Name, HealthHealthy, nil, 0, 0)
+
+		return
+	}
+
+	pingErr := sniper.Connection.PingContext(ctx)
+	if pingErr != nil {
+		sniper.down(state, fmt.Errorf("error pinging the database: %w", pingErr))
+
+		return
+	}
+
+	state.failures++
+
+	sniper.health.update(sniper.Name, HealthDegraded, err, state.failures, 0)
+}
+
+// down marks the sniper as down, and backs off exponentially from its interval.
+func (sniper QuerySniper) down(state *supervision, err error) {
+	state.failures++
+
+	retryIn := backoff(sniper.Interval, state.failures)
+	state.retryAt = time.Now().Add(retryIn)
+
+	sniper.health.update(sniper.Name, HealthDown, err, state.failures, retryIn)
+}
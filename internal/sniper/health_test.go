@@ -0,0 +1,237 @@
+package sniper
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/metrics"
+)
+
+func TestBackoff(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		base     time.Duration
+		failures int
+		want     time.Duration
+	}{
+		{name: "first failure", base: time.Second, failures: 1, want: time.Second},
+		{name: "doubles", base: time.Second, failures: 4, want: 8 * time.Second},
+		{name: "capped", base: time.Second, failures: 20, want: DefaultMaxBackoff},
+		{name: "a long interval is capped too", base: time.Hour, failures: 1, want: DefaultMaxBackoff},
+		{name: "many failures don't overflow", base: time.Second, failures: 1000, want: DefaultMaxBackoff},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := backoff(tt.base, tt.failures); got != tt.want {
+				t.Errorf("backoff(%v, %d) = %v, want %v", tt.base, tt.failures, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHealth_Update(t *testing.T) {
+	t.Parallel()
+
+	h := newHealth("test_health")
+
+	if got := h.get(); got.State != HealthStarting || got.Since.IsZero() {
+		t.Fatalf("newHealth() = %+v, want starting", got)
+	}
+
+	h.update("test_health", HealthDown, errors.New("connection refused"), 1, time.Minute)
+
+	down := h.get()
+	if down.State != HealthDown || down.LastError != "connection refused" || down.Failures != 1 || down.RetryAt.IsZero() {
+		t.Errorf("update() = %+v, want down with the error and a retry time", down)
+	}
+
+	h.update("test_health", HealthDown, errors.New("connection refused"), 2, 2*time.Minute)
+
+	if got := h.get(); got.Failures != 2 || !got.Since.Equal(down.Since) {
+		t.Errorf("update() = %+v, want the failures counted without resetting since", got)
+	}
+
+	h.update("test_health", HealthHealthy, nil, 0, 0)
+
+	if got := h.get(); got.State != HealthHealthy || got.LastError != "" || !got.RetryAt.IsZero() || got.Failures != 0 {
+		t.Errorf("update() = %+v, want healthy with the error cleared", got)
+	}
+
+	var unset *health
+
+	unset.update("test_health", HealthDown, nil, 1, 0)
+
+	if got := unset.get(); got.State != "" {
+		t.Errorf("nil health get() = %+v, want the zero value", got)
+	}
+}
+
+func TestHealth_Ticked(t *testing.T) {
+	t.Parallel()
+
+	h := newHealth("test_ticked")
+
+	h.configured(QuerySniper{Interval: time.Second, QueryLimit: 10 * time.Second, TransactionLimit: 30 * time.Second})
+
+	if got := h.snapshot(); got.Name != "test_ticked" || got.QueryLimit != 10*time.Second || !got.LastTick.IsZero() {
+		t.Fatalf("snapshot() = %+v, want the configured settings and no tick", got)
+	}
+
+	// the hunter's settings are recorded, not the sniper's, so a profile or adaptive scaling shows.
+	h.ticked(QuerySniper{Interval: time.Second, QueryLimit: 5 * time.Second, TransactionLimit: 30 * time.Second, DryRun: true}, nil)
+	h.killed(metrics.KindProcess, 2)
+	h.killed(metrics.KindProcess, 1)
+	h.killed(metrics.KindTransaction, 0)
+
+	ok := h.snapshot()
+	if ok.LastTick.IsZero() || !ok.LastSuccess.Equal(ok.LastTick) || ok.QueryLimit != 5*time.Second || !ok.DryRun {
+		t.Errorf("ticked() = %+v, want a successful tick with the hunter's settings", ok)
+	}
+
+	if want := map[string]int{metrics.KindProcess: 3}; !maps.Equal(ok.Kills, want) {
+		t.Errorf("killed() kills = %v, want %v", ok.Kills, want)
+	}
+
+	// the snapshot's kills are a copy.
+	ok.Kills[metrics.KindProcess] = 100
+
+	h.ticked(QuerySniper{Interval: time.Second}, errors.New("error getting long running queries"))
+
+	if got := h.snapshot(); !got.LastSuccess.Equal(ok.LastSuccess) || got.LastTick.Before(ok.LastTick) || got.Kills[metrics.KindProcess] != 3 {
+		t.Errorf("ticked() = %+v, want a failed tick that keeps the last success", got)
+	}
+}
+
+func TestStatus_Ready(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, time.June, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		status Status
+		want   bool
+	}{
+		{
+			name:   "never hunted",
+			status: Status{Health: Health{State: HealthStarting}, Interval: time.Second},
+			want:   false,
+		},
+		{
+			name:   "hunted on the last tick",
+			status: Status{Health: Health{State: HealthHealthy}, Interval: time.Second, LastSuccess: now.Add(-time.Second)},
+			want:   true,
+		},
+		{
+			name:   "degraded, but hunted within the intervals",
+			status: Status{Health: Health{State: HealthDegraded}, Interval: time.Second, LastSuccess: now.Add(-3 * time.Second)},
+			want:   true,
+		},
+		{
+			name:   "no successful hunt within the intervals",
+			status: Status{Health: Health{State: HealthDegraded}, Interval: time.Second, LastSuccess: now.Add(-4 * time.Second)},
+			want:   false,
+		},
+		{
+			name:   "down",
+			status: Status{Health: Health{State: HealthDown}, Interval: time.Second, LastSuccess: now.Add(-time.Second)},
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tt.status.Ready(now, 3); got != tt.want {
+				t.Errorf("Ready() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSupervision_Down(t *testing.T) {
+	t.Parallel()
+
+	// nothing listens on port 1, so every ping fails.
+	db, err := sql.Open("mysql", "user:pass@tcp(127.0.0.1:1)/?timeout=1s")
+	if err != nil {
+		t.Fatalf("sql.Open() unexpected error = %v", err)
+	}
+
+	t.Cleanup(func() { _ = db.Close() })
+
+	sniper := QuerySniper{
+		Connection: db,
+		Name:       "test_supervision",
+		Interval:   time.Minute,
+		health:     newHealth("test_supervision"),
+	}
+
+	var state supervision
+
+	if !sniper.reachable(context.Background(), &state) {
+		t.Fatal("reachable() = false before the sniper was ever down, want true")
+	}
+
+	sniper.checked(context.Background(), &state, errors.New("error getting long running queries"))
+
+	got := sniper.health.get()
+	if got.State != HealthDown || got.Failures != 1 || state.retryAt.IsZero() {
+		t.Fatalf("checked() health = %+v, want down after a failed hunt and ping", got)
+	}
+
+	if sniper.reachable(context.Background(), &state) {
+		t.Error("reachable() = true during the backoff, want the tick skipped")
+	}
+
+	sniper.checked(context.Background(), &state, nil)
+
+	if got := sniper.health.get(); got.State != HealthHealthy || state.failures != 0 {
+		t.Errorf("checked() health = %+v, failures = %d, want healthy after a successful hunt", got, state.failures)
+	}
+}
+
+func TestManager_HealthOfUnreachableDatabase(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	manager := NewManager(managerTestSettings("primary"))
+
+	t.Cleanup(func() {
+		cancel()
+		manager.wg.Wait()
+	})
+
+	manager.apply(ctx, manager.settings)
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for manager.Status()["primary"].State != HealthDown {
+		if time.Now().After(deadline) {
+			t.Fatalf("Status() = %+v, want primary down", manager.Status())
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got := manager.Status()["primary"]; got.LastError == "" || got.RetryAt.IsZero() {
+		t.Errorf("Status() primary = %+v, want the ping error and a retry time", got)
+	}
+
+	manager.stop("primary")
+
+	if _, ok := manager.Status()["primary"]; ok {
+		t.Error("Status() still reports the stopped sniper")
+	}
+}
@@ -0,0 +1,80 @@
+package sniper
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// DefaultTimeoutCommentKey is the key of the per-query timeout comment when the config doesn't set one.
+const DefaultTimeoutCommentKey = "sniper_timeout"
+
+// maxExecutionTimeHint matches the MAX_EXECUTION_TIME(n) optimizer hint, where n is in milliseconds.
+var maxExecutionTimeHint = regexp.MustCompile(`(?i)/\*\+[^*]*\bMAX_EXECUTION_TIME\s*\(\s*(\d+)\s*\)`)
+
+// hintParser extracts a query's own timeout from its text, either from a MAX_EXECUTION_TIME
+// optimizer hint or from a comment such as /* sniper_timeout=30s */.
+type hintParser struct {
+	comment    *regexp.Regexp
+	commentKey string
+	ceiling    time.Duration
+}
+
+// newHintParser returns a hintParser for the given comment key, which caps every timeout at ceiling.
+func newHintParser(commentKey string, ceiling time.Duration) *hintParser {
+	if commentKey == "" {
+		commentKey = DefaultTimeoutCommentKey
+	}
+
+	return &hintParser{
+		comment:    regexp.MustCompile(`/\*[^*]*\b` + regexp.QuoteMeta(commentKey) + `\s*[=:]\s*'?([0-9a-zA-Z.]+)'?`),
+		commentKey: commentKey,
+		ceiling:    ceiling,
+	}
+}
+
+// filter returns the condition that the hunter query adds to its time limit, so that it also selects
+// the statements that may carry a timeout, however long they've been running. Their timeouts can be
+// below the lowest limit of the sniper and its rules, which the hunter query filters on otherwise.
+// The comment key is validated by the configuration, so it's safe to use in the LIKE pattern.
+func (p *hintParser) filter() string {
+	return "pl.info LIKE '%MAX_EXECUTION_TIME%' OR pl.info LIKE '%" + p.commentKey + "%'"
+}
+
+// timeout returns the timeout requested by the query text, capped at the ceiling, or 0 if the query
+// doesn't request one. The sniper comment takes precedence over the optimizer hint.
+//
+// NB: info is the raw query text, and may contain PII; it must never be logged.
+func (p *hintParser) timeout(info string) time.Duration {
+	var timeout time.Duration
+
+	if match := p.comment.FindStringSubmatch(info); match != nil {
+		timeout = parseTimeout(match[1])
+	} else if match := maxExecutionTimeHint.FindStringSubmatch(info); match != nil {
+		ms, err := strconv.Atoi(match[1])
+		if err == nil {
+			timeout = time.Duration(ms) * time.Millisecond
+		}
+	}
+
+	if timeout <= 0 {
+		return 0
+	}
+
+	return min(timeout, p.ceiling)
+}
+
+// parseTimeout parses a go duration (30s, 2m), or a bare number of seconds.
+func parseTimeout(value string) time.Duration {
+	duration, err := time.ParseDuration(value)
+	if err == nil {
+		return duration
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	return 0
+}
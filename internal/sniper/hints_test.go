@@ -0,0 +1,199 @@
+package sniper
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+)
+
+func TestHintParserTimeout(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		commentKey string
+		info       string
+		want       time.Duration
+	}{
+		{
+			name: "no hints",
+			info: "SELECT * FROM users WHERE id = 1",
+			want: 0,
+		},
+		{
+			name: "MAX_EXECUTION_TIME optimizer hint in milliseconds",
+			info: "SELECT /*+ MAX_EXECUTION_TIME(30000) */ * FROM reports",
+			want: 30 * time.Second,
+		},
+		{
+			name: "MAX_EXECUTION_TIME alongside other hints",
+			info: "SELECT /*+ BKA(t1) max_execution_time( 45000 ) NO_ICP(t2) */ * FROM t1, t2",
+			want: 45 * time.Second,
+		},
+		{
+			name: "MAX_EXECUTION_TIME in a regular comment is ignored",
+			info: "SELECT /* MAX_EXECUTION_TIME(30000) */ * FROM reports",
+			want: 0,
+		},
+		{
+			name: "default sniper comment",
+			info: "SELECT * FROM reports /* sniper_timeout=20s */",
+			want: 20 * time.Second,
+		},
+		{
+			name: "sniper comment inside a marginalia comment, bare seconds",
+			info: "SELECT * FROM reports /*controller:reports,sniper_timeout:90*/",
+			want: 90 * time.Second,
+		},
+		{
+			name: "sniper comment takes precedence over the optimizer hint",
+			info: "SELECT /*+ MAX_EXECUTION_TIME(30000) */ * FROM reports /* sniper_timeout='10s' */",
+			want: 10 * time.Second,
+		},
+		{
+			name:       "custom comment key",
+			commentKey: "budget",
+			info:       "SELECT * FROM reports /* budget=15s */ /* sniper_timeout=20s */",
+			want:       15 * time.Second,
+		},
+		{
+			name: "capped at the ceiling",
+			info: "SELECT * FROM reports /* sniper_timeout=2h */",
+			want: 10 * time.Minute,
+		},
+		{
+			name: "unparseable comment value",
+			info: "SELECT * FROM reports /* sniper_timeout=soon */",
+			want: 0,
+		},
+		{
+			name: "key in a string literal is ignored",
+			info: "SELECT 'sniper_timeout=20s' FROM reports",
+			want: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			parser := newHintParser(tt.commentKey, 10*time.Minute)
+
+			if got := parser.timeout(tt.info); got != tt.want {
+				t.Errorf("timeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateProcess_Timeout(t *testing.T) {
+	t.Parallel()
+
+	rules, err := newPolicy([]configuration.Rule{
+		{Name: "reporting", User: "reporting", LongQueryLimit: 30 * time.Second, Action: configuration.RuleActionKillQuery},
+	})
+	if err != nil {
+		t.Fatalf("newPolicy() unexpected error = %v", err)
+	}
+
+	sniper := QuerySniper{QueryLimit: 2 * time.Second, policy: rules}
+
+	tests := []struct {
+		name       string
+		user       string
+		wantAction string
+		timeout    time.Duration
+		wantLimit  time.Duration
+	}{
+		{name: "no timeout, default limit", user: "web", wantLimit: 2 * time.Second},
+		{name: "timeout replaces the default limit", user: "web", timeout: time.Minute, wantLimit: time.Minute},
+		{name: "no timeout, rule limit", user: "reporting", wantLimit: 30 * time.Second, wantAction: configuration.RuleActionKillQuery},
+		{name: "timeout replaces the rule limit, but keeps the action", user: "reporting", timeout: 5 * time.Minute, wantLimit: 5 * time.Minute, wantAction: configuration.RuleActionKillQuery},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := sniper.evaluateProcess(MysqlProcess{
+				User:    sql.NullString{String: tt.user, Valid: true},
+				Timeout: tt.timeout,
+			})
+
+			if got.limit != tt.wantLimit {
+				t.Errorf("evaluateProcess() limit = %v, want %v", got.limit, tt.wantLimit)
+			}
+
+			if got.action != tt.wantAction {
+				t.Errorf("evaluateProcess() action = %q, want %q", got.action, tt.wantAction)
+			}
+		})
+	}
+}
+
+func TestGenerateHunterQueries_Hints(t *testing.T) {
+	t.Parallel()
+
+	sniper := QuerySniper{
+		QueryLimit:       30 * time.Second,
+		TransactionLimit: 60 * time.Second,
+		hints:            newHintParser("", 10*time.Minute),
+	}
+
+	query, _, err := sniper.generateHunterQueries()
+	if err != nil {
+		t.Fatalf("generateHunterQueries() unexpected error = %v", err)
+	}
+
+	want := "AND (pl.time >= 30 OR pl.info LIKE '%MAX_EXECUTION_TIME%' OR pl.info LIKE '%sniper_timeout%')"
+	if !strings.Contains(query, want) {
+		t.Errorf("generateHunterQueries() query should also select hinted statements, got %s", query)
+	}
+}
+
+// a timeout below the lowest limit of the sniper and its rules takes effect at the timeout, rather than
+// at that limit.
+func TestKillProcesses_TimeoutBelowLimit(t *testing.T) {
+	t.Parallel()
+
+	sniper := QuerySniper{
+		Name:       "test_hints",
+		DryRun:     true,
+		QueryLimit: 30 * time.Second,
+		hints:      newHintParser("", 10*time.Minute),
+	}
+
+	tests := []struct {
+		name      string
+		timeout   time.Duration
+		time      int
+		wantBelow bool
+		wantKill  bool
+	}{
+		{name: "past a timeout below the limit", timeout: 5 * time.Second, time: 6, wantBelow: false, wantKill: true},
+		{name: "under a timeout below the limit", timeout: 5 * time.Second, time: 4, wantBelow: true, wantKill: false},
+		{name: "no timeout, under the limit", timeout: 0, time: 10, wantBelow: true, wantKill: false},
+		{name: "no timeout, past the limit", timeout: 0, time: 45, wantBelow: false, wantKill: true},
+		{name: "under a timeout above the limit", timeout: time.Minute, time: 45, wantBelow: false, wantKill: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			process := MysqlProcess{ID: 1, Time: tt.time, Timeout: tt.timeout}
+
+			if got := sniper.belowHuntingLimit(process); got != tt.wantBelow {
+				t.Errorf("belowHuntingLimit() = %v, want %v", got, tt.wantBelow)
+			}
+
+			if killed := sniper.KillProcesses(context.Background(), []MysqlProcess{process}); (killed == 1) != tt.wantKill {
+				t.Errorf("KillProcesses() killed = %d, want a kill: %v", killed, tt.wantKill)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package sniper
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/metrics"
+	"github.com/persona-id/query-sniper/internal/notify"
+)
+
+// MysqlIdleTransaction is a session that is sleeping with an open transaction, which is almost always
+// a connection leaked by an application that forgot to commit or roll back. It holds its locks and
+// its undo history until the connection is closed.
+// NB: this struct is sorted by datatype to satisfy the fieldalignment linter.
+type MysqlIdleTransaction struct {
+	MysqlTransaction     // Time is how long the transaction has been open; Command is always Sleep
+	IdleTime         int `db:"idle_time"` // how long the session has been sleeping, in seconds
+}
+
+// FindIdleTransactions finds the sessions that have been sleeping with an open transaction for longer
+// than the idle transaction limit.
+func (sniper QuerySniper) FindIdleTransactions(ctx context.Context) ([]MysqlIdleTransaction, error) {
+	defer metrics.ObserveHunter(sniper.Name, metrics.HunterIdleTransactions, time.Now())
+
+	rows, err := sniper.Connection.QueryContext(ctx, sniper.IdleTXNQuery)
+	if err != nil {
+		return nil, fmt.Errorf("error getting idle transactions: %w", err)
+	}
+	defer rows.Close()
+
+	var transactions []MysqlIdleTransaction
+
+	for rows.Next() {
+		var transaction MysqlIdleTransaction
+
+		err = rows.Scan(&transaction.ID, &transaction.ProcessID, &transaction.State, &transaction.Time, &transaction.IdleTime, &transaction.User, &transaction.Schema, &transaction.DigestText, &transaction.Host, &transaction.Command)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+
+		transactions = append(transactions, transaction)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return []MysqlIdleTransaction{}, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// withoutIdle drops the transactions of the sessions that the idle transaction hunter returned on this
+// tick, whatever it did with them, so that a sleeping session left alive by dry run, a log rule, a failed
+// kill or the sightings isn't reported, counted and killed a second time as a long running transaction.
+func withoutIdle(transactions []MysqlTransaction, idle []MysqlIdleTransaction) []MysqlTransaction {
+	if len(idle) == 0 {
+		return transactions
+	}
+
+	handled := make(map[int]bool, len(idle))
+	for _, transaction := range idle {
+		handled[transaction.ProcessID] = true
+	}
+
+	return slices.DeleteFunc(transactions, func(transaction MysqlTransaction) bool {
+		return handled[transaction.ProcessID]
+	})
+}
+
+// KillIdleTransactions kills the given idle transactions, or logs them if running in dry run or safe
+// mode. The sessions are killed with KILL CONNECTION, since a sleeping session has no query to kill;
+// closing the connection rolls the transaction back.
+func (sniper QuerySniper) KillIdleTransactions(ctx context.Context, transactions []MysqlIdleTransaction) int {
+	k := sniper.newKiller(metrics.KindIdleTransaction, "idle mysql transaction", "Idle mysql transaction",
+		sniper.idleSightings, metrics.IdleTransactionsDetected, metrics.IdleTransactionsKilled)
+
+	for _, transaction := range transactions {
+		if transaction.ProcessID <= 0 {
+			continue
+		}
+
+		verdict := sniper.evaluateIdleTransaction(transaction)
+
+		// the host is logged so the leaking application can be tracked down.
+		k.kill(ctx, killTarget{
+			attrs: []any{
+				slog.String("user", transaction.User.String),
+				slog.String("host", transaction.Host.String),
+				slog.Int("idle_time", transaction.IdleTime),
+				slog.Int("time", transaction.Time),
+				slog.Int("transaction_id", transaction.ID),
+				slog.Int("process_id", transaction.ProcessID),
+				slog.String("schema", transaction.Schema.String),
+				slog.String("digest_text", transaction.DigestText.String),
+			},
+			elapsed: transaction.IdleTime,
+			event:   idleTransactionEvent(transaction, verdict),
+			key:     sightingKey{id: transaction.ProcessID, statement: transaction.ID},
+			// a kill_query rule action is ignored here, because there's no query to kill.
+			statement: fmt.Sprintf("KILL CONNECTION %d", transaction.ProcessID),
+			verdict:   verdict,
+		})
+	}
+
+	return k.done(ctx)
+}
+
+// idleTransactionEvent returns the notification event for an idle transaction, for a killer to fill in.
+// Its runtime is how long the session had been idle.
+func idleTransactionEvent(transaction MysqlIdleTransaction, verdict policyVerdict) notify.Event {
+	return notify.Event{
+		Action:        verdict.connectionAction(),
+		Command:       transaction.Command,
+		DigestText:    transaction.DigestText.String,
+		Kind:          notify.KindIdleTransaction,
+		ProcessID:     transaction.ProcessID,
+		Rule:          verdict.rule,
+		Runtime:       time.Duration(transaction.IdleTime) * time.Second,
+		Schema:        transaction.Schema.String,
+		TransactionID: transaction.ID,
+		User:          transaction.User.String,
+	}
+}
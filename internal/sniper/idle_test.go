@@ -0,0 +1,209 @@
+package sniper
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+	"github.com/persona-id/query-sniper/internal/notify"
+)
+
+func TestGenerateIdleTransactionQuery(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name            string
+		wantContains    []string
+		wantNotContains []string
+		sniper          QuerySniper
+	}{
+		{
+			name:   "no schema",
+			sniper: QuerySniper{IdleTransactionLimit: 30 * time.Second},
+			wantContains: []string{
+				"FROM INFORMATION_SCHEMA.INNODB_TRX trx",
+				"LEFT JOIN performance_schema.events_statements_current es ON es.thread_id = t.thread_id",
+				"WHERE pl.command = 'Sleep'",
+				"AND pl.time >= 30",
+				"ORDER BY pl.time DESC",
+			},
+			wantNotContains: []string{"AND pl.db IN ("},
+		},
+		{
+			name:   "with schema",
+			sniper: QuerySniper{IdleTransactionLimit: 2 * time.Minute, Schema: "web"},
+			wantContains: []string{
+				"AND pl.time >= 120",
+				"AND pl.db IN ('web')",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			query, err := tt.sniper.generateIdleTransactionQuery()
+			if err != nil {
+				t.Fatalf("generateIdleTransactionQuery() unexpected error = %v", err)
+			}
+
+			for _, want := range tt.wantContains {
+				if !strings.Contains(query, want) {
+					t.Errorf("generateIdleTransactionQuery() = %q, want it to contain %q", query, want)
+				}
+			}
+
+			for _, unwanted := range tt.wantNotContains {
+				if strings.Contains(query, unwanted) {
+					t.Errorf("generateIdleTransactionQuery() = %q, want it not to contain %q", query, unwanted)
+				}
+			}
+		})
+	}
+}
+
+func TestKillIdleTransactions_DryRun(t *testing.T) {
+	t.Parallel()
+
+	rules, err := newPolicy([]configuration.Rule{
+		{Name: "etl", User: "etl", Exempt: true},
+		{Name: "audit", User: "audit", Action: configuration.RuleActionLog},
+		// the rules' limits don't apply to idle transactions.
+		{Name: "reporting", User: "reporting", LongTransactionLimit: time.Hour},
+	})
+	if err != nil {
+		t.Fatalf("newPolicy() unexpected error = %v", err)
+	}
+
+	notifier := &recordingNotifier{}
+	sniper := QuerySniper{
+		Name:                 "test_idle",
+		DryRun:               true,
+		IdleTransactionLimit: 30 * time.Second,
+		notifier:             notifier,
+		policy:               rules,
+	}
+
+	idle := func(id, processID, idleTime int, user string) MysqlIdleTransaction {
+		return MysqlIdleTransaction{
+			MysqlTransaction: MysqlTransaction{
+				Command:   "Sleep",
+				User:      sql.NullString{String: user, Valid: true},
+				ID:        id,
+				ProcessID: processID,
+				Time:      600,
+			},
+			IdleTime: idleTime,
+		}
+	}
+
+	transactions := []MysqlIdleTransaction{
+		idle(1, 11, 10, "web"),       // under the limit
+		idle(2, 12, 60, "etl"),       // exempt
+		idle(3, 13, 60, "audit"),     // log only
+		idle(4, 14, 60, "reporting"), // killed
+		idle(5, 0, 60, "web"),        // invalid process id
+	}
+
+	if killed := sniper.KillIdleTransactions(context.Background(), transactions); killed != 1 {
+		t.Errorf("KillIdleTransactions() killed = %d, want 1", killed)
+	}
+
+	if len(notifier.events) != 2 {
+		t.Fatalf("Notify() got %d events, want 2", len(notifier.events))
+	}
+
+	logged, dryRun := notifier.events[0], notifier.events[1]
+
+	if logged.ProcessID != 13 || logged.Outcome != notify.OutcomeLogged || logged.Rule != "audit" {
+		t.Errorf("first event = %+v, want the logged audit transaction", logged)
+	}
+
+	if dryRun.ProcessID != 14 || dryRun.TransactionID != 4 || dryRun.Outcome != notify.OutcomeDryRun ||
+		dryRun.Kind != notify.KindIdleTransaction || dryRun.Runtime != time.Minute {
+		t.Errorf("second event = %+v, want the dry run kill of transaction 4, idle for 1m", dryRun)
+	}
+}
+
+func TestWithSettings_IdleTransactionLimit(t *testing.T) {
+	t.Parallel()
+
+	settings := managerTestSettings("primary")
+
+	config := settings.Databases["primary"]
+	config.IdleTransactionLimit = 45 * time.Second
+	settings.Databases["primary"] = config
+
+	retuned, err := QuerySniper{Name: "primary"}.withSettings(settings)
+	if err != nil {
+		t.Fatalf("withSettings() unexpected error = %v", err)
+	}
+
+	if retuned.IdleTransactionLimit != 45*time.Second {
+		t.Errorf("withSettings() IdleTransactionLimit = %v, want 45s", retuned.IdleTransactionLimit)
+	}
+
+	if !strings.Contains(retuned.IdleTXNQuery, "AND pl.time >= 45") {
+		t.Errorf("withSettings() IdleTXNQuery = %q, want it regenerated with the 45s limit", retuned.IdleTXNQuery)
+	}
+}
+
+func TestWithoutIdle(t *testing.T) {
+	t.Parallel()
+
+	notifier := &recordingNotifier{}
+	sniper := QuerySniper{
+		Name:                 "test_idle_overlap",
+		DryRun:               true,
+		IdleTransactionLimit: 30 * time.Second,
+		TransactionLimit:     5 * time.Minute,
+		notifier:             notifier,
+	}
+
+	user := sql.NullString{String: "web", Valid: true}
+
+	// the dry run idle hunter leaves the session alive, and its transaction is also past the limit.
+	idle := []MysqlIdleTransaction{
+		{MysqlTransaction: MysqlTransaction{Command: "Sleep", User: user, ID: 1, ProcessID: 11, Time: 600}, IdleTime: 60},
+	}
+
+	if killed := sniper.KillIdleTransactions(context.Background(), idle); killed != 1 {
+		t.Fatalf("KillIdleTransactions() killed = %d, want 1", killed)
+	}
+
+	txns := []MysqlTransaction{
+		{Command: "Sleep", User: user, ID: 1, ProcessID: 11, Time: 600},
+		{Command: "Query", User: user, ID: 2, ProcessID: 12, Time: 600},
+	}
+
+	txns = withoutIdle(txns, idle)
+	if len(txns) != 1 || txns[0].ProcessID != 12 {
+		t.Fatalf("withoutIdle() = %+v, want only the transaction of process 12", txns)
+	}
+
+	if killed := sniper.KillTransactions(context.Background(), txns); killed != 1 {
+		t.Errorf("KillTransactions() killed = %d, want 1", killed)
+	}
+
+	kinds := map[int][]string{}
+	for _, event := range notifier.events {
+		kinds[event.ProcessID] = append(kinds[event.ProcessID], event.Kind)
+	}
+
+	if got := kinds[11]; len(got) != 1 || got[0] != notify.KindIdleTransaction {
+		t.Errorf("process 11 events = %v, want a single idle_transaction event", got)
+	}
+
+	if got := kinds[12]; len(got) != 1 || got[0] != notify.KindTransaction {
+		t.Errorf("process 12 events = %v, want a single transaction event", got)
+	}
+
+	// without idle sessions, the transactions are left alone.
+	if got := withoutIdle(txns, nil); len(got) != 1 {
+		t.Errorf("withoutIdle() with no idle sessions = %+v, want the transactions unchanged", got)
+	}
+}
@@ -0,0 +1,194 @@
+package sniper
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+	"github.com/persona-id/query-sniper/internal/metrics"
+	"github.com/persona-id/query-sniper/internal/notify"
+)
+
+// killer kills the offenders of one hunter for one call of its Kill method: it checks each offender
+// against its verdict, waits for the hunter's sightings to confirm it, spends the kill budget, kills
+// it (or logs it, in dry run or for a log rule), and counts and records what it did. Offenders that are
+// still waiting for confirmation are recorded as pending, for the audit sinks. The hunters only supply
+// their offenders and metrics.
+//
+// The killer holds its own copy of the sniper, so once the circuit breaker trips, the rest of the
+// hunter's offenders are only logged.
+// NB: this struct is sorted by datatype to satisfy the fieldalignment linter.
+type killer struct {
+	sightings *sightings             // confirms the offenders before they're killed; nil to kill them on the first sighting
+	detected  *prometheus.CounterVec // counts the confirmed offenders; nil if the hunter counts them itself
+	killed    *prometheus.CounterVec // counts the kills, and the would-be kills in dry run
+	kind      string                 // one of the metrics.Kind* values, for the kill budget and the kill failures
+	noun      string                 // how the logs refer to an offender, e.g. "mysql blocker"
+	offense   string                 // how the logs describe an offender that a rule only allows logging
+	events    []notify.Event
+	pending   []notify.Event // the offenders waiting for confirmation, for the audit sinks only
+	sniper    QuerySniper
+	count     int // the number of offenders killed, or that would have been in dry run
+}
+
+// killTarget is an offender handed to a killer by its hunter.
+// NB: this struct is sorted by datatype to satisfy the fieldalignment linter.
+type killTarget struct {
+	onKill    func(sniper QuerySniper) // counts a kill (or a would-be kill) in the hunter's own metrics; may be nil
+	statement string                   // the KILL statement
+	attrs     []any                    // the log attributes describing the offender
+	verdict   policyVerdict
+	event     notify.Event // the notification event, without its outcome
+	key       sightingKey  // identifies the offender to the sightings
+	elapsed   int          // the offender's time, in seconds, to compare with the verdict's limit
+	explain   bool         // capture the offender's plan before killing it
+}
+
+// newKiller returns a killer for the hunter of the given metrics.Kind* kind.
+func (sniper QuerySniper) newKiller(kind, noun, offense string, seen *sightings, detected, killed *prometheus.CounterVec) *killer {
+	return &killer{
+		detected:  detected,
+		kind:      kind,
+		killed:    killed,
+		noun:      noun,
+		offense:   offense,
+		sightings: seen,
+		sniper:    sniper,
+	}
+}
+
+// kill kills the target, or logs it, and returns the outcome of the notification event it recorded,
+// or "" if the target was under its limit, exempt or not confirmed yet. A target that isn't confirmed
+// yet is only recorded as pending.
+func (k *killer) kill(ctx context.Context, target killTarget) string {
+	verdict := target.verdict
+
+	// the hunter queries filter on the lowest limit of all the rules, so check the limit of the
+	// rule that actually applies to the offender.
+	if target.elapsed < int(verdict.limit.Seconds()) {
+		return ""
+	}
+
+	attrs := append([]any{
+		slog.String("db", k.sniper.Name),
+		slog.String("rule", verdict.rule),
+		slog.Duration("limit", verdict.limit),
+	}, target.attrs...)
+
+	if verdict.exempt {
+		slog.Debug("Skipping "+k.noun+" exempted by rule", attrs...)
+
+		return ""
+	}
+
+	seen := k.sightings.see(target.key)
+	if seen < k.sniper.RequiredSightings {
+		slog.Debug("Waiting for confirmation before killing "+k.noun+" over its limit",
+			append(attrs,
+				slog.Int("sightings", seen),
+				slog.Int("required_sightings", k.sniper.RequiredSightings),
+			)...,
+		)
+
+		k.pending = append(k.pending, k.event(target.event, notify.OutcomePending, nil))
+
+		return ""
+	}
+
+	// once the kill budget runs out, the circuit breaker keeps the sniper in dry run until it closes.
+	if !k.sniper.DryRun && verdict.action != configuration.RuleActionLog && !k.sniper.spendKill(ctx, k.kind) {
+		k.sniper.DryRun = true
+	}
+
+	attrs = append(attrs, slog.Bool("dry_run", k.sniper.DryRun))
+	labels := metrics.OffenderLabels(k.sniper.Name, target.event.Schema, target.event.User, k.sniper.DryRun)
+
+	if k.detected != nil {
+		k.detected.WithLabelValues(labels...).Inc()
+	}
+
+	if verdict.action == configuration.RuleActionLog {
+		slog.Warn(k.offense+" on "+k.sniper.Name+", rule only allows logging it", attrs...)
+
+		return k.record(target.event, notify.OutcomeLogged, nil)
+	}
+
+	// if sniper is configured to be dry run (or if safe mode is active), only log what would be killed
+	if k.sniper.DryRun {
+		slog.Info("DRY RUN - Would kill "+k.noun+" on "+k.sniper.Name, attrs...)
+
+		k.counted(target, labels)
+
+		return k.record(target.event, notify.OutcomeDryRun, nil)
+	}
+
+	// the plan has to be captured before the KILL, as it's gone once the statement is.
+	if target.explain {
+		target.event.Explain = k.sniper.explain(ctx, target.event.ProcessID)
+		attrs = append(attrs, explainAttr(target.event.Explain))
+	}
+
+	_, err := k.sniper.Connection.ExecContext(ctx, target.statement)
+	if err != nil {
+		// we log here, rather than returning err, because we don't want to stop killing the other offenders.
+		slog.Error("Error killing "+k.noun, append(attrs, slog.Any("err", err))...)
+
+		metrics.KillFailures.WithLabelValues(k.sniper.Name, k.kind).Inc()
+		k.sniper.refundKill()
+
+		return k.record(target.event, notify.OutcomeFailed, err)
+	}
+
+	message := "Killed " + k.noun + " on " + k.sniper.Name
+	if target.event.Waiters > 0 {
+		message += ", unblocking " + strconv.Itoa(target.event.Waiters) + " sessions"
+	}
+
+	slog.Info(message, append(attrs, slog.String("kill", target.statement))...)
+
+	k.counted(target, labels)
+
+	return k.record(target.event, notify.OutcomeKilled, nil)
+}
+
+// counted counts a kill, or a would-be kill in dry run.
+func (k *killer) counted(target killTarget, labels []string) {
+	k.killed.WithLabelValues(labels...).Inc()
+
+	if target.onKill != nil {
+		target.onKill(k.sniper)
+	}
+
+	k.count++
+}
+
+// record records the notification event for the outcome, and returns the outcome.
+func (k *killer) record(event notify.Event, outcome string, err error) string {
+	k.events = append(k.events, k.event(event, outcome, err))
+
+	return outcome
+}
+
+// event fills in the parts of a hunter's event that the killer knows.
+func (k *killer) event(event notify.Event, outcome string, err error) notify.Event {
+	event.DB = k.sniper.Name
+	event.DryRun = k.sniper.DryRun
+	event.Err = err
+	event.Outcome = outcome
+	event.Time = time.Now()
+
+	return event
+}
+
+// done sends the recorded events to the notifier, and the pending ones to the audit sinks, and returns
+// the number of offenders killed, or that would have been in dry run.
+func (k *killer) done(ctx context.Context) int {
+	k.sniper.audit(ctx, k.pending)
+	k.sniper.notify(ctx, k.events)
+
+	return k.count
+}
@@ -0,0 +1,151 @@
+package sniper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+	"github.com/persona-id/query-sniper/internal/metrics"
+	"github.com/persona-id/query-sniper/internal/notify"
+)
+
+func TestKiller_Kill(t *testing.T) {
+	t.Parallel()
+
+	limit := policyVerdict{limit: 10 * time.Second}
+
+	tests := []struct {
+		name        string
+		wantOutcome string
+		verdict     policyVerdict
+		elapsed     int
+		sightings   int // the number of ticks the target is seen on
+		required    int
+		wantKilled  int
+		wantPending int // the events sent to the audit sinks only
+	}{
+		{
+			name:        "over the limit",
+			verdict:     limit,
+			elapsed:     11,
+			sightings:   1,
+			required:    1,
+			wantOutcome: notify.OutcomeDryRun,
+			wantKilled:  1,
+		},
+		{
+			name:      "under the limit",
+			verdict:   limit,
+			elapsed:   9,
+			sightings: 1,
+			required:  1,
+		},
+		{
+			name:      "exempt",
+			verdict:   policyVerdict{limit: 10 * time.Second, rule: "etl", exempt: true},
+			elapsed:   11,
+			sightings: 1,
+			required:  1,
+		},
+		{
+			name:        "log rule",
+			verdict:     policyVerdict{limit: 10 * time.Second, rule: "audit", action: configuration.RuleActionLog},
+			elapsed:     11,
+			sightings:   1,
+			required:    1,
+			wantOutcome: notify.OutcomeLogged,
+		},
+		{
+			name:        "not confirmed yet",
+			verdict:     limit,
+			elapsed:     11,
+			sightings:   1,
+			required:    2,
+			wantPending: 1,
+		},
+		{
+			name:        "confirmed",
+			verdict:     limit,
+			elapsed:     11,
+			sightings:   2,
+			required:    2,
+			wantOutcome: notify.OutcomeDryRun,
+			wantKilled:  1,
+			wantPending: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			notifier := &recordingNotifier{}
+			auditor := &recordingNotifier{}
+			sniper := QuerySniper{
+				Name:              "test_killer",
+				DryRun:            true,
+				RequiredSightings: tt.required,
+				auditor:           auditor,
+				notifier:          notifier,
+			}
+
+			seen := &sightings{}
+			target := killTarget{
+				elapsed: tt.elapsed,
+				event:   notify.Event{Kind: notify.KindBlocker, ProcessID: 42},
+				key:     sightingKey{id: 42},
+				verdict: tt.verdict,
+			}
+
+			var outcome string
+
+			killed := 0
+
+			for range tt.sightings {
+				k := sniper.newKiller(metrics.KindBlocker, "mysql blocker", "Mysql session blocking other sessions",
+					seen, metrics.BlockersDetected, metrics.BlockersKilled)
+				outcome = k.kill(context.Background(), target)
+				killed = k.done(context.Background())
+				seen.next()
+			}
+
+			if outcome != tt.wantOutcome {
+				t.Errorf("kill() = %q, want %q", outcome, tt.wantOutcome)
+			}
+
+			if killed != tt.wantKilled {
+				t.Errorf("done() = %d, want %d", killed, tt.wantKilled)
+			}
+
+			// an offender waiting for confirmation is only recorded for the audit sinks, on every tick it waits.
+			if len(auditor.events) != tt.wantPending {
+				t.Fatalf("audit got %d events, want %d", len(auditor.events), tt.wantPending)
+			}
+
+			for _, event := range auditor.events {
+				if event.Outcome != notify.OutcomePending || event.DB != "test_killer" || event.ProcessID != 42 || event.Time.IsZero() {
+					t.Errorf("audit event = %+v, want a pending event for process 42 on test_killer", event)
+				}
+			}
+
+			if tt.wantOutcome == "" {
+				if len(notifier.events) != 0 {
+					t.Errorf("Notify() got %d events, want none", len(notifier.events))
+				}
+
+				return
+			}
+
+			if len(notifier.events) != 1 {
+				t.Fatalf("Notify() got %d events, want 1", len(notifier.events))
+			}
+
+			// the killer fills in what the hunter leaves out of the event.
+			event := notifier.events[0]
+			if event.DB != "test_killer" || event.Outcome != tt.wantOutcome || !event.DryRun || event.Time.IsZero() || event.ProcessID != 42 {
+				t.Errorf("event = %+v, want a dry run %s event for process 42 on test_killer", event, tt.wantOutcome)
+			}
+		})
+	}
+}
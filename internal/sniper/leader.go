@@ -0,0 +1,142 @@
+package sniper
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/metrics"
+)
+
+// minLeaderSessionTimeout is the shortest wait_timeout set on the leader lock's connection.
+const minLeaderSessionTimeout = 10 * time.Second
+
+// leaderLock is a sniper's leadership of its database when several replicas of the sniper run for
+// high availability. The leader holds a GET_LOCK advisory lock on a dedicated connection, and MySQL
+// releases it when that connection's session ends, so a follower takes over on its next tick after
+// the leader stops, crashes or loses its connection.
+//
+// As with sightings, the sniper holds a pointer to its lock so that the copies made by withSettings
+// share it. A nil lock is always the leader. It's only used from the sniper's own Loop, so it isn't
+// safe for concurrent use.
+type leaderLock struct {
+	conn *sql.Conn // the connection holding the lock; nil while this replica is a follower
+	name string
+}
+
+func newLeaderLock(name string) *leaderLock {
+	return &leaderLock{name: name}
+}
+
+// acquire checks that this replica still holds the lock, or tries to take it if it doesn't, and
+// reports whether it's the leader. The lock is taken without waiting, so a follower never blocks a
+// tick. The session's wait_timeout is lowered to a few intervals, so that MySQL drops the lock of a
+// leader that vanished without closing its connection.
+func (lock *leaderLock) acquire(ctx context.Context, db *sql.DB, interval time.Duration) (bool, error) {
+	if lock == nil {
+		return true, nil
+	}
+
+	if lock.conn != nil {
+		var held sql.NullBool
+
+		err := lock.conn.QueryRowContext(ctx, "SELECT IS_USED_LOCK(?) = CONNECTION_ID()", lock.name).Scan(&held)
+		if err == nil && held.Bool {
+			return true, nil
+		}
+
+		// the connection died, or the lock was taken from it (by a KILL, say), so start over.
+		lock.release()
+
+		if err != nil {
+			return false, fmt.Errorf("error checking the leader lock: %w", err)
+		}
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return false, fmt.Errorf("error opening the leader lock connection: %w", err)
+	}
+
+	lock.conn = conn
+
+	timeout := max(3*interval, minLeaderSessionTimeout)
+
+	_, err = conn.ExecContext(ctx, "SET SESSION wait_timeout = ?", int(timeout.Seconds()))
+	if err != nil {
+		lock.release()
+
+		return false, fmt.Errorf("error setting the leader lock session timeout: %w", err)
+	}
+
+	var acquired sql.NullInt64
+
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", lock.name).Scan(&acquired)
+	if err != nil || acquired.Int64 != 1 {
+		lock.release()
+
+		if err != nil {
+			return false, fmt.Errorf("error taking the leader lock: %w", err)
+		}
+
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// release gives up the lock, if this replica holds it. The connection is closed, rather than returned
+// to the pool, which ends its session and releases the lock with it.
+func (lock *leaderLock) release() {
+	if lock == nil || lock.conn == nil {
+		return
+	}
+
+	// returning driver.ErrBadConn from Raw makes database/sql close the connection.
+	_ = lock.conn.Raw(func(any) error { return driver.ErrBadConn })
+	_ = lock.conn.Close()
+
+	lock.conn = nil
+}
+
+// elect returns the sniper to hunt with on this tick, and whether this replica is the leader. A
+// follower hunts in observe-only mode: it logs what it finds as a dry run, but doesn't kill or notify,
+// which would duplicate the leader's notifications. It still writes to the audit sinks, so that the
+// audit trail doesn't depend on which replica leads. previous is whether it was the leader on the last
+// tick, so that changes are logged. If the lock can't be checked, the replica is a follower.
+func (sniper QuerySniper) elect(ctx context.Context, previous bool) (QuerySniper, bool) {
+	leading, err := sniper.leader.acquire(ctx, sniper.Connection, sniper.Interval)
+	if err != nil {
+		slog.Error("Error electing the leader, observing only",
+			slog.String("db", sniper.Name),
+			slog.Any("err", err),
+		)
+	}
+
+	if leading {
+		metrics.Leader.WithLabelValues(sniper.Name).Set(1)
+	} else {
+		metrics.Leader.WithLabelValues(sniper.Name).Set(0)
+
+		sniper.DryRun = true
+		sniper.notifier = sniper.auditor
+	}
+
+	switch {
+	case leading && !previous:
+		slog.Info("This replica is now the leader on "+sniper.Name+", killing",
+			slog.String("db", sniper.Name),
+			slog.String("lock", sniper.leader.name),
+		)
+	case !leading && previous:
+		slog.Warn("This replica is no longer the leader on "+sniper.Name+", observing only",
+			slog.String("db", sniper.Name),
+			slog.String("lock", sniper.leader.name),
+		)
+	}
+
+	return sniper, leading
+}
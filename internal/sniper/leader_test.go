@@ -0,0 +1,79 @@
+package sniper
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+)
+
+func TestLeaderLock_Nil(t *testing.T) {
+	t.Parallel()
+
+	var lock *leaderLock
+
+	leading, err := lock.acquire(context.Background(), nil, time.Second)
+	if err != nil || !leading {
+		t.Errorf("acquire() = %v, %v, want a nil lock to always lead", leading, err)
+	}
+
+	lock.release()
+}
+
+func TestElect_Follower(t *testing.T) {
+	t.Parallel()
+
+	// nothing listens on port 1, so the lock can't be taken.
+	db, err := sql.Open("mysql", "user:pass@tcp(127.0.0.1:1)/?timeout=1s")
+	if err != nil {
+		t.Fatalf("sql.Open() unexpected error = %v", err)
+	}
+
+	t.Cleanup(func() { _ = db.Close() })
+
+	sniper := QuerySniper{
+		Connection:     db,
+		Name:           "test_leader",
+		Interval:       time.Second,
+		leader:         newLeaderLock(configuration.LeaderLockName("test_leader")),
+		leaderElection: true,
+		auditor:        &recordingNotifier{},
+		notifier:       &recordingNotifier{},
+	}
+
+	hunter, leading := sniper.elect(context.Background(), true)
+	if leading {
+		t.Fatal("elect() leading = true, want a follower when the lock can't be taken")
+	}
+
+	// a follower still writes to the audit sinks.
+	if !hunter.DryRun || hunter.notifier != sniper.auditor {
+		t.Errorf("elect() dry run = %v, notifier = %v, want a follower to observe only, and audit", hunter.DryRun, hunter.notifier)
+	}
+
+	if sniper.DryRun || sniper.notifier == sniper.auditor {
+		t.Error("elect() changed the sniper itself, want only the returned copy to observe only")
+	}
+
+	if sniper.leader.conn != nil {
+		t.Error("elect() kept the connection of a lock it didn't take")
+	}
+}
+
+func TestWithSettings_LeaderElection(t *testing.T) {
+	t.Parallel()
+
+	settings := managerTestSettings("primary")
+	settings.LeaderElection = true
+
+	retuned, err := QuerySniper{Name: "primary"}.withSettings(settings)
+	if err != nil {
+		t.Fatalf("withSettings() unexpected error = %v", err)
+	}
+
+	if !retuned.leaderElection {
+		t.Error("withSettings() leaderElection = false, want true")
+	}
+}
@@ -0,0 +1,211 @@
+package sniper
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/metrics"
+	"github.com/persona-id/query-sniper/internal/notify"
+)
+
+// MysqlLockWait is an edge in the InnoDB wait-for graph: a session waiting on a row lock held by
+// another session, along with the blocking session's details.
+// NB: this struct is sorted by datatype to satisfy the fieldalignment linter.
+type MysqlLockWait struct {
+	Command    string         `db:"command"`         // the blocking session's command
+	Schema     sql.NullString `db:"current_schema"`  // the blocking session's current schema
+	DigestText sql.NullString `db:"digest_text"`     // the blocking session's current (or last) digested statement
+	User       sql.NullString `db:"user"`            // the blocking session's user
+	Host       sql.NullString `db:"host"`            // the blocking session's client host (host:port)
+	WaitingID  int            `db:"waiting_id"`      // the processlist id of the waiting session
+	BlockingID int            `db:"blocking_id"`     // the processlist id of the blocking session
+	WaitTime   int            `db:"wait_time"`       // how long the waiting session has been waiting, in seconds
+	Time       int            `db:"time"`            // how long the blocking session's transaction has been running, in seconds
+	TrxID      int            `db:"blocking_trx_id"` // the id of the blocking session's transaction
+}
+
+// MysqlBlocker is the root of a lock wait chain: a session holding locks that other sessions are
+// waiting on, which isn't waiting on anyone itself.
+// NB: this struct is sorted by datatype to satisfy the fieldalignment linter.
+type MysqlBlocker struct {
+	Command    string         // the processlist command; usually Sleep, for a session idle in its transaction
+	Schema     sql.NullString // the current schema
+	DigestText sql.NullString // the current (or last) digested statement
+	User       sql.NullString // the user that owns the session
+	Host       sql.NullString // the client host (host:port)
+	ID         int            // the processlist id
+	Time       int            // how long its transaction has been running, in seconds
+	TrxID      int            // the id of its transaction
+	WaitTime   int            // the longest that any of its waiters has been waiting, in seconds
+	Waiters    int            // the number of sessions waiting on it, directly or further down the chain
+}
+
+// FindBlockers finds the root blockers of the current lock wait chains. Only blockers in the sniper's
+// schema are returned, if it has one.
+func (sniper QuerySniper) FindBlockers(ctx context.Context) ([]MysqlBlocker, error) {
+	defer metrics.ObserveHunter(sniper.Name, metrics.HunterLockWaits, time.Now())
+
+	rows, err := sniper.Connection.QueryContext(ctx, lockWaitQuery)
+	if err != nil {
+		return nil, fmt.Errorf("error getting lock waits: %w", err)
+	}
+	defer rows.Close()
+
+	var waits []MysqlLockWait
+
+	for rows.Next() {
+		var wait MysqlLockWait
+
+		err = rows.Scan(&wait.WaitingID, &wait.BlockingID, &wait.WaitTime, &wait.Time, &wait.TrxID, &wait.User, &wait.Schema, &wait.Command, &wait.Host, &wait.DigestText)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+
+		waits = append(waits, wait)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return []MysqlBlocker{}, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	// the schema filter is applied to the roots rather than in the query, so that a chain that passes
+	// through another schema is still walked all the way to its root.
+	blockers := rootBlockers(waits)
+	if sniper.Schema != "" {
+		blockers = slices.DeleteFunc(blockers, func(blocker MysqlBlocker) bool {
+			return blocker.Schema.String != sniper.Schema
+		})
+	}
+
+	return blockers, nil
+}
+
+// rootBlockers walks the wait-for graph and returns the sessions at the root of each chain, with the
+// sessions waiting on them, sorted by the number of waiters. Sessions that are themselves waiting
+// aren't roots; that includes deadlocks, which InnoDB resolves on its own.
+func rootBlockers(waits []MysqlLockWait) []MysqlBlocker {
+	waitTimes := make(map[int]int)         // waiting session -> how long it has been waiting
+	waitedOnBy := make(map[int][]int)      // blocking session -> the sessions waiting on it
+	blocking := make(map[int]MysqlBlocker) // blocking session -> its details
+
+	for _, wait := range waits {
+		waitTimes[wait.WaitingID] = max(waitTimes[wait.WaitingID], wait.WaitTime)
+
+		// a session can wait on several locks held by the same blocker.
+		if !slices.Contains(waitedOnBy[wait.BlockingID], wait.WaitingID) {
+			waitedOnBy[wait.BlockingID] = append(waitedOnBy[wait.BlockingID], wait.WaitingID)
+		}
+
+		blocking[wait.BlockingID] = MysqlBlocker{
+			Command:    wait.Command,
+			DigestText: wait.DigestText,
+			Host:       wait.Host,
+			ID:         wait.BlockingID,
+			Schema:     wait.Schema,
+			Time:       wait.Time,
+			TrxID:      wait.TrxID,
+			User:       wait.User,
+		}
+	}
+
+	var blockers []MysqlBlocker
+
+	for id, blocker := range blocking {
+		if _, waiting := waitTimes[id]; waiting {
+			continue
+		}
+
+		// breadth first walk of everyone waiting on the root, directly or not.
+		seen := map[int]bool{id: true}
+		queue := []int{id}
+
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+
+			for _, waiter := range waitedOnBy[current] {
+				if seen[waiter] {
+					continue
+				}
+
+				seen[waiter] = true
+				queue = append(queue, waiter)
+
+				blocker.Waiters++
+				blocker.WaitTime = max(blocker.WaitTime, waitTimes[waiter])
+			}
+		}
+
+		blockers = append(blockers, blocker)
+	}
+
+	slices.SortFunc(blockers, func(a, b MysqlBlocker) int {
+		return cmp.Or(cmp.Compare(b.Waiters, a.Waiters), cmp.Compare(a.ID, b.ID))
+	})
+
+	return blockers
+}
+
+// KillBlockers kills the given root blockers once their waiters have been waiting for longer than the
+// lock wait limit, or logs them if running in dry run or safe mode. Blockers are killed with KILL
+// CONNECTION, since killing only the current statement wouldn't roll back the transaction or release
+// its locks.
+func (sniper QuerySniper) KillBlockers(ctx context.Context, blockers []MysqlBlocker) int {
+	k := sniper.newKiller(metrics.KindBlocker, "mysql blocker", "Mysql session blocking other sessions",
+		sniper.blockerSightings, metrics.BlockersDetected, metrics.BlockersKilled)
+
+	for _, blocker := range blockers {
+		if blocker.ID <= 0 {
+			continue
+		}
+
+		verdict := sniper.evaluateBlocker(blocker)
+
+		k.kill(ctx, killTarget{
+			attrs: []any{
+				slog.String("user", blocker.User.String),
+				slog.Int("time", blocker.Time),
+				slog.Int("wait_time", blocker.WaitTime),
+				slog.Int("waiters", blocker.Waiters),
+				slog.Int("process_id", blocker.ID),
+				slog.String("command", blocker.Command),
+				slog.String("schema", blocker.Schema.String),
+				slog.String("digest_text", blocker.DigestText.String),
+			},
+			elapsed: blocker.WaitTime,
+			event:   blockerEvent(blocker, verdict),
+			key:     sightingKey{id: blocker.ID, statement: blocker.TrxID},
+			onKill: func(sniper QuerySniper) {
+				metrics.WaitersUnblocked.WithLabelValues(sniper.Name, strconv.FormatBool(sniper.DryRun)).Add(float64(blocker.Waiters))
+			},
+			// a kill_query rule action is ignored here, because it wouldn't release the locks.
+			statement: fmt.Sprintf("KILL CONNECTION %d", blocker.ID),
+			verdict:   verdict,
+		})
+	}
+
+	return k.done(ctx)
+}
+
+// blockerEvent returns the notification event for a blocker, for a killer to fill in.
+func blockerEvent(blocker MysqlBlocker, verdict policyVerdict) notify.Event {
+	return notify.Event{
+		Action:     verdict.connectionAction(),
+		Command:    blocker.Command,
+		DigestText: blocker.DigestText.String,
+		Kind:       notify.KindBlocker,
+		ProcessID:  blocker.ID,
+		Rule:       verdict.rule,
+		Runtime:    time.Duration(blocker.Time) * time.Second,
+		Schema:     blocker.Schema.String,
+		User:       blocker.User.String,
+		Waiters:    blocker.Waiters,
+	}
+}
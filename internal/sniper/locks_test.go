@@ -0,0 +1,174 @@
+package sniper
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+	"github.com/persona-id/query-sniper/internal/notify"
+)
+
+// lockWait returns a wait-for edge from waiting to blocking.
+func lockWait(waiting, blocking, waitTime int) MysqlLockWait {
+	return MysqlLockWait{
+		Command:    "Sleep",
+		Schema:     sql.NullString{String: "web", Valid: true},
+		User:       sql.NullString{String: "app", Valid: true},
+		WaitingID:  waiting,
+		BlockingID: blocking,
+		WaitTime:   waitTime,
+		Time:       120,
+	}
+}
+
+func TestRootBlockers(t *testing.T) {
+	t.Parallel()
+
+	type root struct {
+		id       int
+		waiters  int
+		waitTime int
+	}
+
+	tests := []struct {
+		name  string
+		waits []MysqlLockWait
+		want  []root
+	}{
+		{
+			name:  "no lock waits",
+			waits: nil,
+			want:  nil,
+		},
+		{
+			name:  "single waiter",
+			waits: []MysqlLockWait{lockWait(2, 1, 5)},
+			want:  []root{{id: 1, waiters: 1, waitTime: 5}},
+		},
+		{
+			name: "chain counts every session down the chain",
+			// 4 waits on 3, which waits on 2, which waits on 1
+			waits: []MysqlLockWait{lockWait(4, 3, 2), lockWait(3, 2, 30), lockWait(2, 1, 10)},
+			want:  []root{{id: 1, waiters: 3, waitTime: 30}},
+		},
+		{
+			name: "waiter on several locks of the same blocker is counted once",
+			waits: []MysqlLockWait{
+				lockWait(2, 1, 5), lockWait(2, 1, 5), lockWait(3, 1, 8),
+			},
+			want: []root{{id: 1, waiters: 2, waitTime: 8}},
+		},
+		{
+			name: "separate chains are sorted by waiters",
+			waits: []MysqlLockWait{
+				lockWait(11, 10, 60),
+				lockWait(21, 20, 5), lockWait(22, 20, 5), lockWait(23, 21, 5),
+			},
+			want: []root{{id: 20, waiters: 3, waitTime: 5}, {id: 10, waiters: 1, waitTime: 60}},
+		},
+		{
+			name: "waiter blocked by two roots counts for both",
+			waits: []MysqlLockWait{
+				lockWait(3, 1, 5), lockWait(3, 2, 5),
+			},
+			want: []root{{id: 1, waiters: 1, waitTime: 5}, {id: 2, waiters: 1, waitTime: 5}},
+		},
+		{
+			name:  "deadlocks have no root",
+			waits: []MysqlLockWait{lockWait(1, 2, 3), lockWait(2, 1, 3)},
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := rootBlockers(tt.waits)
+			if len(got) != len(tt.want) {
+				t.Fatalf("rootBlockers() returned %d blockers, want %d: %+v", len(got), len(tt.want), got)
+			}
+
+			for i, blocker := range got {
+				if blocker.ID != tt.want[i].id || blocker.Waiters != tt.want[i].waiters || blocker.WaitTime != tt.want[i].waitTime {
+					t.Errorf("blocker %d = {id: %d, waiters: %d, wait_time: %d}, want {id: %d, waiters: %d, wait_time: %d}",
+						i, blocker.ID, blocker.Waiters, blocker.WaitTime, tt.want[i].id, tt.want[i].waiters, tt.want[i].waitTime)
+				}
+
+				if blocker.Command != "Sleep" || blocker.User.String != "app" || blocker.Time != 120 {
+					t.Errorf("blocker %d = %+v, want the blocking session's details", i, blocker)
+				}
+			}
+		})
+	}
+}
+
+func TestKillBlockers_DryRun(t *testing.T) {
+	t.Parallel()
+
+	rules, err := newPolicy([]configuration.Rule{
+		{Name: "etl", User: "etl", Exempt: true},
+		{Name: "audit", User: "audit", Action: configuration.RuleActionLog},
+		// the rules' limits don't apply to blockers.
+		{Name: "reporting", User: "reporting", LongTransactionLimit: time.Hour},
+	})
+	if err != nil {
+		t.Fatalf("newPolicy() unexpected error = %v", err)
+	}
+
+	notifier := &recordingNotifier{}
+	sniper := QuerySniper{
+		Name:          "test_blockers",
+		DryRun:        true,
+		LockWaitLimit: 10 * time.Second,
+		notifier:      notifier,
+		policy:        rules,
+	}
+
+	blockers := []MysqlBlocker{
+		{ID: 1, WaitTime: 5, Waiters: 3, User: sql.NullString{String: "web", Valid: true}},        // under the limit
+		{ID: 2, WaitTime: 15, Waiters: 2, User: sql.NullString{String: "etl", Valid: true}},       // exempt
+		{ID: 3, WaitTime: 15, Waiters: 1, User: sql.NullString{String: "audit", Valid: true}},     // log only
+		{ID: 4, WaitTime: 15, Waiters: 4, User: sql.NullString{String: "reporting", Valid: true}}, // killed
+		{ID: 0, WaitTime: 15, Waiters: 1}, // invalid id
+	}
+
+	if killed := sniper.KillBlockers(context.Background(), blockers); killed != 1 {
+		t.Errorf("KillBlockers() killed = %d, want 1", killed)
+	}
+
+	if len(notifier.events) != 2 {
+		t.Fatalf("Notify() got %d events, want 2", len(notifier.events))
+	}
+
+	logged, dryRun := notifier.events[0], notifier.events[1]
+
+	if logged.ProcessID != 3 || logged.Outcome != notify.OutcomeLogged || logged.Rule != "audit" {
+		t.Errorf("first event = %+v, want the logged audit blocker", logged)
+	}
+
+	if dryRun.ProcessID != 4 || dryRun.Outcome != notify.OutcomeDryRun || dryRun.Kind != notify.KindBlocker || dryRun.Waiters != 4 {
+		t.Errorf("second event = %+v, want the dry run kill of blocker 4 with 4 waiters", dryRun)
+	}
+}
+
+func TestWithSettings_LockWaitLimit(t *testing.T) {
+	t.Parallel()
+
+	settings := managerTestSettings("primary")
+
+	config := settings.Databases["primary"]
+	config.LockWaitLimit = 20 * time.Second
+	settings.Databases["primary"] = config
+
+	retuned, err := QuerySniper{Name: "primary"}.withSettings(settings)
+	if err != nil {
+		t.Fatalf("withSettings() unexpected error = %v", err)
+	}
+
+	if retuned.LockWaitLimit != 20*time.Second {
+		t.Errorf("withSettings() LockWaitLimit = %v, want 20s", retuned.LockWaitLimit)
+	}
+}
@@ -0,0 +1,337 @@
+package sniper
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+	"github.com/persona-id/query-sniper/internal/notify"
+)
+
+// Manager runs a sniper for each configured database, and applies reloaded configurations to
+// the running snipers without restarting the ones that didn't need it.
+type Manager struct {
+	notifier  notify.Notifier
+	auditor   notify.Notifier // the audit sinks among the notifiers
+	overrides *overrides      // the runtime overrides set through the admin API
+	settings  *configuration.Config
+	reloads   chan *configuration.Config
+	dumps     chan struct{} // queued state dumps, written by Run
+	snipers   map[string]*runningSniper
+	health    map[string]*health // the health of each running sniper, guarded by healthMu for Status
+	wg        sync.WaitGroup
+	healthMu  sync.RWMutex
+}
+
+// runningSniper tracks a sniper that has been started by the Manager.
+type runningSniper struct {
+	cancel  context.CancelFunc
+	reloads chan *configuration.Config
+	done    chan struct{}
+	health  *health
+	dsn     string
+}
+
+// NewManager creates a new Manager for the given settings. The snipers are not started until
+// Run is called. The notifiers are built once from these settings, and are not changed by reloads.
+func NewManager(settings *configuration.Config) *Manager {
+	notifiers := notify.New(settings)
+
+	return &Manager{
+		notifier:  notifiers,
+		auditor:   notifiers.Audit(),
+		health:    make(map[string]*health),
+		overrides: newOverrides(),
+		reloads:   make(chan *configuration.Config, 1),
+		dumps:     make(chan struct{}, 1),
+		settings:  settings,
+		snipers:   make(map[string]*runningSniper),
+	}
+}
+
+// Run starts a sniper for each database in the settings, and then applies any reloaded
+// configurations and writes any queued state dumps until the context is cancelled. It returns once all snipers have stopped.
+func (manager *Manager) Run(ctx context.Context) {
+	if runner, ok := manager.notifier.(notify.Runner); ok {
+		manager.wg.Go(func() {
+			runner.Run(ctx)
+		})
+	}
+
+	manager.apply(ctx, manager.settings)
+
+	for {
+		select {
+		case <-ctx.Done():
+			manager.wg.Wait()
+
+			return
+
+		case settings := <-manager.reloads:
+			manager.apply(ctx, settings)
+
+		case <-manager.dumps:
+			manager.dump()
+		}
+	}
+}
+
+// Reload queues new settings to be applied by Run. The settings must already have been validated;
+// snipers for removed databases are stopped, snipers for new databases are started, and the rest
+// are retuned in place. If a reload is already pending, the new settings are dropped.
+func (manager *Manager) Reload(settings *configuration.Config) {
+	select {
+	case manager.reloads <- settings:
+	default:
+		slog.Warn("A configuration reload is already pending, ignoring this one")
+	}
+}
+
+// apply reconciles the running snipers with the given settings.
+func (manager *Manager) apply(ctx context.Context, settings *configuration.Config) {
+	for name, running := range manager.snipers {
+		_, exists := settings.Databases[name]
+
+		switch {
+		case !exists:
+			manager.stop(name)
+			manager.overrides.forget(name)
+
+			slog.Info("Stopped sniper for removed database", slog.String("db", name))
+
+		case running.dsn != buildDSN(settings, name):
+			// connection settings can't be changed on an open *sql.DB, so restart the sniper.
+			manager.stop(name)
+
+			slog.Info("Connection settings changed, restarting sniper", slog.String("db", name))
+
+		default:
+			running.reload(settings)
+		}
+	}
+
+	for name := range settings.Databases {
+		if _, exists := manager.snipers[name]; exists {
+			continue
+		}
+
+		manager.start(ctx, name, settings)
+	}
+
+	manager.settings = settings
+}
+
+// reload hands the settings to the sniper without blocking the Manager. A sniper that hasn't picked up
+// its previous settings yet, because it's in a long tick or waiting to reconnect, gets these instead, so
+// the latest configuration always wins.
+func (running *runningSniper) reload(settings *configuration.Config) {
+	select {
+	case <-running.reloads:
+	default:
+	}
+
+	// the Manager is the only sender, so there's room once the pending settings have been drained.
+	select {
+	case running.reloads <- settings:
+	default:
+	}
+}
+
+// start supervises the sniper for the named database in a new goroutine.
+func (manager *Manager) start(ctx context.Context, name string, settings *configuration.Config) {
+	sniperCtx, cancel := context.WithCancel(ctx)
+
+	running := &runningSniper{
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		dsn:     buildDSN(settings, name),
+		health:  newHealth(name),
+		reloads: make(chan *configuration.Config, 1),
+	}
+
+	manager.snipers[name] = running
+
+	manager.healthMu.Lock()
+	manager.health[name] = running.health
+	manager.healthMu.Unlock()
+
+	// uses the new go 1.25 wg.Go() syntax
+	manager.wg.Go(func() {
+		defer close(running.done)
+
+		manager.supervise(sniperCtx, name, settings, running)
+	})
+}
+
+// supervise creates the sniper for the named database, pings its database, and runs it until the
+// context is cancelled. A sniper that can't be created or can't reach its database is down, and is
+// retried with exponential backoff; reloads that arrive in the meantime are used for the next attempt.
+func (manager *Manager) supervise(ctx context.Context, name string, settings *configuration.Config, running *runningSniper) {
+	for failures := 1; ; failures++ {
+		sniper, err := connect(ctx, name, settings)
+		if err == nil {
+			sniper.health = running.health
+			sniper.notifier = manager.notifier
+			sniper.auditor = manager.auditor
+			sniper.overrides = manager.overrides
+			sniper.reloads = running.reloads
+
+			sniper.Loop(ctx)
+
+			err = sniper.Connection.Close()
+			if err != nil {
+				slog.Error("Error closing sniper connection", slog.String("db", name), slog.Any("err", err))
+			}
+
+			return
+		}
+
+		retryIn := backoff(initialBackoff, failures)
+
+		running.health.update(name, HealthDown, err, failures, retryIn)
+
+		timer := time.NewTimer(retryIn)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return
+
+		case settings = <-running.reloads:
+			timer.Stop()
+
+		case <-timer.C:
+		}
+	}
+}
+
+// connect creates the sniper for the named database, and checks that its database is reachable.
+func connect(ctx context.Context, name string, settings *configuration.Config) (QuerySniper, error) {
+	sniper, err := New(name, settings)
+	if err != nil {
+		return QuerySniper{}, err
+	}
+
+	err = sniper.Connection.PingContext(ctx)
+	if err != nil {
+		_ = sniper.Connection.Close()
+
+		return QuerySniper{}, fmt.Errorf("error pinging the database: %w", err)
+	}
+
+	return sniper, nil
+}
+
+// Status returns the status of each running sniper, keyed by database name. It's safe to call while
+// the Manager is running.
+func (manager *Manager) Status() map[string]Status {
+	manager.healthMu.RLock()
+	defer manager.healthMu.RUnlock()
+
+	snapshot := make(map[string]Status, len(manager.health))
+
+	for name, h := range manager.health {
+		status := h.snapshot()
+		status.Paused = manager.overrides.isPaused(name)
+
+		snapshot[name] = status
+	}
+
+	return snapshot
+}
+
+// Pause stops the named sniper from hunting, without stopping its goroutine or closing its connection,
+// until it's resumed.
+func (manager *Manager) Pause(name string) error {
+	if !manager.running(name) {
+		return fmt.Errorf("%w: %s", ErrUnknownSniper, name)
+	}
+
+	manager.overrides.setPaused(name, true)
+
+	return nil
+}
+
+// Resume lets a paused sniper hunt again from its next tick.
+func (manager *Manager) Resume(name string) error {
+	if !manager.running(name) {
+		return fmt.Errorf("%w: %s", ErrUnknownSniper, name)
+	}
+
+	manager.overrides.setPaused(name, false)
+
+	return nil
+}
+
+// SetDryRun overrides the dry_run of the named sniper, including that of its scheduled profiles, or
+// clears the override if dryRun is nil. Safe mode still wins over it.
+func (manager *Manager) SetDryRun(name string, dryRun *bool) error {
+	if !manager.running(name) {
+		return fmt.Errorf("%w: %s", ErrUnknownSniper, name)
+	}
+
+	manager.overrides.setDryRun(name, dryRun)
+
+	return nil
+}
+
+// ResetBreaker closes the named sniper's kill circuit breaker and forgets its recent kills, on its next
+// tick, rather than waiting out the breaker_cooldown.
+func (manager *Manager) ResetBreaker(name string) error {
+	if !manager.running(name) {
+		return fmt.Errorf("%w: %s", ErrUnknownSniper, name)
+	}
+
+	manager.overrides.requestBreakerReset(name)
+
+	return nil
+}
+
+// SetSafeMode overrides the safe-mode flag for every sniper, or clears the override if safeMode is nil.
+func (manager *Manager) SetSafeMode(safeMode *bool) {
+	manager.overrides.setSafeMode(safeMode)
+}
+
+// Notify delivers events that don't come from a sniper, like the changes made through the admin API, to
+// the notifiers.
+func (manager *Manager) Notify(ctx context.Context, events []notify.Event) error {
+	if manager.notifier == nil {
+		return nil
+	}
+
+	return manager.notifier.Notify(ctx, events)
+}
+
+// Overrides returns the current runtime overrides.
+func (manager *Manager) Overrides() Overrides {
+	return manager.overrides.snapshot()
+}
+
+// running reports whether the Manager is running a sniper for the named database. It's safe to call
+// while the Manager is running.
+func (manager *Manager) running(name string) bool {
+	manager.healthMu.RLock()
+	defer manager.healthMu.RUnlock()
+
+	_, ok := manager.health[name]
+
+	return ok
+}
+
+// stop cancels the named sniper and waits for it to exit.
+func (manager *Manager) stop(name string) {
+	running := manager.snipers[name]
+
+	running.cancel()
+	<-running.done
+
+	delete(manager.snipers, name)
+
+	manager.healthMu.Lock()
+	delete(manager.health, name)
+	manager.healthMu.Unlock()
+}
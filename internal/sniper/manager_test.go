@@ -0,0 +1,212 @@
+package sniper
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+)
+
+// managerTestSettings returns settings with a database entry for each of the given names. The
+// databases point at a port nothing listens on, and use an interval long enough that the
+// snipers never tick during the tests.
+func managerTestSettings(names ...string) *configuration.Config {
+	settings := &configuration.Config{
+		Databases: map[string]configuration.DatabaseConfig{},
+	}
+
+	for _, name := range names {
+		config := settings.Databases[name]
+		config.Address = "127.0.0.1"
+		config.Port = 1
+		config.Schema = "test"
+		config.Username = "user"
+		config.Password = "pass"
+		config.Interval = time.Hour
+		config.LongQueryLimit = 10 * time.Second
+		config.LongTransactionLimit = 30 * time.Second
+		config.DryRun = true
+		settings.Databases[name] = config
+	}
+
+	return settings
+}
+
+func TestManager_Apply(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	manager := NewManager(managerTestSettings("primary", "replica"))
+
+	t.Cleanup(func() {
+		cancel()
+		manager.wg.Wait()
+	})
+
+	manager.apply(ctx, manager.settings)
+
+	if got := slices.Sorted(maps.Keys(manager.snipers)); !slices.Equal(got, []string{"primary", "replica"}) {
+		t.Fatalf("apply() running snipers = %v, want [primary replica]", got)
+	}
+
+	primary := manager.snipers["primary"]
+	replica := manager.snipers["replica"]
+
+	// drop replica, add analytics, retune primary in place, and move replica's port.
+	reloaded := managerTestSettings("primary", "analytics")
+
+	config := reloaded.Databases["primary"]
+	config.LongQueryLimit = time.Second
+	config.DryRun = false
+	reloaded.Databases["primary"] = config
+
+	manager.apply(ctx, reloaded)
+
+	if got := slices.Sorted(maps.Keys(manager.snipers)); !slices.Equal(got, []string{"analytics", "primary"}) {
+		t.Fatalf("apply() running snipers after reload = %v, want [analytics primary]", got)
+	}
+
+	if manager.snipers["primary"] != primary {
+		t.Error("apply() restarted primary, but only its tunable settings changed")
+	}
+
+	select {
+	case <-replica.done:
+	default:
+		t.Error("apply() did not stop the sniper for the removed database")
+	}
+
+	if manager.settings != reloaded {
+		t.Error("apply() did not store the reloaded settings")
+	}
+
+	// changing the connection settings requires a new connection, so the sniper is restarted.
+	moved := managerTestSettings("primary", "analytics")
+
+	config = moved.Databases["analytics"]
+	config.Port = 2
+	moved.Databases["analytics"] = config
+
+	analytics := manager.snipers["analytics"]
+
+	manager.apply(ctx, moved)
+
+	if manager.snipers["analytics"] == analytics {
+		t.Error("apply() did not restart the sniper whose connection settings changed")
+	}
+}
+
+func TestManager_ApplyToBusySniper(t *testing.T) {
+	t.Parallel()
+
+	settings := managerTestSettings("primary")
+
+	// a sniper that's stuck in a long tick, and never reads its reloads.
+	busy := &runningSniper{
+		dsn:     buildDSN(settings, "primary"),
+		reloads: make(chan *configuration.Config, 1),
+	}
+
+	manager := NewManager(settings)
+	manager.snipers["primary"] = busy
+
+	first := managerTestSettings("primary")
+	second := managerTestSettings("primary")
+
+	applied := make(chan struct{})
+
+	go func() {
+		defer close(applied)
+
+		manager.apply(context.Background(), first)
+		manager.apply(context.Background(), second)
+	}()
+
+	select {
+	case <-applied:
+	case <-time.After(5 * time.Second):
+		t.Fatal("apply() blocked on a sniper that isn't reading its reloads")
+	}
+
+	if got := <-busy.reloads; got != second {
+		t.Error("apply() left stale settings queued for the sniper, want the latest ones")
+	}
+}
+
+func TestManager_RunAndReload(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	manager := NewManager(managerTestSettings("primary"))
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		manager.Run(ctx)
+	}()
+
+	manager.Reload(managerTestSettings("primary", "replica"))
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after the context was cancelled")
+	}
+}
+
+func TestWithSettings(t *testing.T) {
+	t.Parallel()
+
+	settings := managerTestSettings("primary")
+
+	sniper := QuerySniper{Name: "primary"}
+
+	retuned, err := sniper.withSettings(settings)
+	if err != nil {
+		t.Fatalf("withSettings() unexpected error = %v", err)
+	}
+
+	if retuned.QueryLimit != 10*time.Second || retuned.TransactionLimit != 30*time.Second {
+		t.Errorf("withSettings() limits = %v/%v, want 10s/30s", retuned.QueryLimit, retuned.TransactionLimit)
+	}
+
+	if retuned.Interval != time.Hour {
+		t.Errorf("withSettings() Interval = %v, want 1h", retuned.Interval)
+	}
+
+	if !retuned.DryRun {
+		t.Error("withSettings() DryRun = false, want true")
+	}
+
+	if retuned.LRQQuery == "" || retuned.LRTXNQuery == "" {
+		t.Error("withSettings() did not generate the hunter queries")
+	}
+
+	if sniper.QueryLimit != 0 {
+		t.Error("withSettings() modified the receiver")
+	}
+
+	// safe mode overrides the per-database dry_run setting on reload too.
+	config := settings.Databases["primary"]
+	config.DryRun = false
+	settings.Databases["primary"] = config
+	settings.SafeMode = true
+
+	retuned, err = sniper.withSettings(settings)
+	if err != nil {
+		t.Fatalf("withSettings() unexpected error = %v", err)
+	}
+
+	if !retuned.DryRun {
+		t.Error("withSettings() DryRun = false with safe mode enabled, want true")
+	}
+}
@@ -0,0 +1,199 @@
+package sniper
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+	"github.com/persona-id/query-sniper/internal/metrics"
+	"github.com/persona-id/query-sniper/internal/notify"
+)
+
+// MysqlMetadataLock is a DDL statement waiting for a table metadata lock, and the sessions holding a
+// lock on that table. Every new query on the table queues behind the DDL, so a single long
+// transaction holding the table can stall all traffic to it.
+// NB: this struct is sorted by datatype to satisfy the fieldalignment linter.
+type MysqlMetadataLock struct {
+	ObjectSchema string         // the schema of the locked table
+	ObjectName   string         // the locked table
+	Holders      []MysqlProcess // the sessions holding a lock on the table; Time is how long they've been in their current state
+	Waiter       MysqlProcess   // the waiting DDL statement; Time is how long it has been waiting
+	Queued       int            // the number of other sessions waiting for a lock on the table
+}
+
+// FindMetadataLocks finds the DDL statements waiting for a table metadata lock. Only locks on tables in
+// the sniper's schema are returned, if it has one.
+func (sniper QuerySniper) FindMetadataLocks(ctx context.Context) ([]MysqlMetadataLock, error) {
+	defer metrics.ObserveHunter(sniper.Name, metrics.HunterMetadataLock, time.Now())
+
+	rows, err := sniper.Connection.QueryContext(ctx, metadataLockQuery)
+	if err != nil {
+		return nil, fmt.Errorf("error getting metadata locks: %w", err)
+	}
+	defer rows.Close()
+
+	var locks []MysqlMetadataLock
+
+	for rows.Next() {
+		var (
+			lock   MysqlMetadataLock
+			holder MysqlProcess
+		)
+
+		waiter := &lock.Waiter
+
+		err = rows.Scan(&lock.ObjectSchema, &lock.ObjectName,
+			&waiter.ID, &waiter.User, &waiter.Schema, &waiter.Command, &waiter.Time, &waiter.Host, &waiter.DigestText,
+			&holder.ID, &holder.User, &holder.Schema, &holder.Command, &holder.Time, &holder.Host, &holder.DigestText,
+			&lock.Queued)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+
+		if sniper.Schema != "" && lock.ObjectSchema != sniper.Schema {
+			continue
+		}
+
+		lock.Holders = []MysqlProcess{holder}
+		locks = append(locks, lock)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return []MysqlMetadataLock{}, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return groupMetadataLocks(locks), nil
+}
+
+// groupMetadataLocks merges the rows of the metadata lock query, which have one holder each, into one
+// lock per waiting DDL statement, keeping the order of the rows. A session holding several locks on
+// the table is only listed once.
+func groupMetadataLocks(rows []MysqlMetadataLock) []MysqlMetadataLock {
+	var locks []MysqlMetadataLock
+
+	index := make(map[int]int) // waiting session -> its position in locks
+
+	for _, row := range rows {
+		i, seen := index[row.Waiter.ID]
+		if !seen {
+			index[row.Waiter.ID] = len(locks)
+			locks = append(locks, MysqlMetadataLock{
+				ObjectSchema: row.ObjectSchema,
+				ObjectName:   row.ObjectName,
+				Waiter:       row.Waiter,
+				Queued:       row.Queued,
+			})
+			i = len(locks) - 1
+		}
+
+		for _, holder := range row.Holders {
+			held := slices.ContainsFunc(locks[i].Holders, func(process MysqlProcess) bool {
+				return process.ID == holder.ID
+			})
+
+			if !held {
+				locks[i].Holders = append(locks[i].Holders, holder)
+			}
+		}
+	}
+
+	return locks
+}
+
+// KillMetadataLocks clears the given metadata locks once their DDL statement has been waiting for
+// longer than the metadata lock limit, or logs them if running in dry run or safe mode. Depending on
+// the database's metadata_lock_action, either the DDL statement is killed with KILL QUERY, which fails
+// the statement and lets the queued sessions through, or every holder of the lock is killed with KILL
+// CONNECTION, which lets the DDL run. Returns the number of sessions killed.
+func (sniper QuerySniper) KillMetadataLocks(ctx context.Context, locks []MysqlMetadataLock) int {
+	// the locks are counted by KillMetadataLocks itself, rather than for every session killed.
+	k := sniper.newKiller(metrics.KindMetadataLock, "mysql session to clear a metadata lock", "Mysql DDL waiting for a metadata lock",
+		sniper.lockSightings, nil, metrics.MetadataLocksKilled)
+
+	for _, lock := range locks {
+		if lock.Waiter.ID <= 0 {
+			continue
+		}
+
+		targets := lock.Holders
+		if sniper.MetadataLockAction != configuration.MetadataLockActionKillHolder {
+			targets = []MysqlProcess{lock.Waiter}
+		}
+
+		detected := false
+
+		for _, target := range targets {
+			if target.ID <= 0 {
+				continue
+			}
+
+			outcome := k.kill(ctx, sniper.metadataLockTarget(lock, target))
+
+			// the lock is counted once, against the DDL statement, however many of its holders are killed.
+			if outcome != "" && !detected {
+				metrics.MetadataLocksDetected.WithLabelValues(
+					metrics.OffenderLabels(sniper.Name, lock.ObjectSchema, lock.Waiter.User.String, k.sniper.DryRun)...,
+				).Inc()
+
+				detected = true
+			}
+		}
+	}
+
+	return k.done(ctx)
+}
+
+// metadataLockTarget returns the kill target for a session of a metadata lock, either its DDL
+// statement or one of its holders. The schema of its event is the locked table's.
+func (sniper QuerySniper) metadataLockTarget(lock MysqlMetadataLock, target MysqlProcess) killTarget {
+	verdict := sniper.evaluateMetadataLock(target)
+
+	// killing the DDL unblocks the sessions queued behind it; killing a holder also unblocks the DDL.
+	waiters := lock.Queued
+	action := verdict.actionOr(configuration.RuleActionKillQuery)
+	statement := verdict.killStatement(target.ID, "KILL QUERY %d")
+
+	if target.ID != lock.Waiter.ID {
+		waiters++
+
+		// a holder's lock lasts until its transaction ends, so killing only its statement won't do.
+		action = verdict.connectionAction()
+		statement = fmt.Sprintf("KILL CONNECTION %d", target.ID)
+	}
+
+	return killTarget{
+		attrs: []any{
+			slog.String("action", sniper.MetadataLockAction),
+			slog.String("table", lock.ObjectSchema+"."+lock.ObjectName),
+			slog.String("user", target.User.String),
+			slog.Int("time", target.Time),
+			slog.Int("wait_time", lock.Waiter.Time),
+			slog.Int("waiters", waiters),
+			slog.Int("process_id", target.ID),
+			slog.Int("ddl_process_id", lock.Waiter.ID),
+			slog.String("command", target.Command),
+			slog.String("schema", target.Schema.String),
+			slog.String("digest_text", target.DigestText.String),
+		},
+		elapsed: lock.Waiter.Time,
+		key:     sightingKey{id: target.ID, statement: lock.Waiter.ID},
+		event: notify.Event{
+			Action:     action,
+			Command:    target.Command,
+			DigestText: target.DigestText.String,
+			Kind:       notify.KindMetadataLock,
+			ProcessID:  target.ID,
+			Rule:       verdict.rule,
+			Runtime:    time.Duration(target.Time) * time.Second,
+			Schema:     lock.ObjectSchema,
+			User:       target.User.String,
+			Waiters:    waiters,
+		},
+		statement: statement,
+		verdict:   verdict,
+	}
+}
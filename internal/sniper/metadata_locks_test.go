@@ -0,0 +1,199 @@
+package sniper
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+	"github.com/persona-id/query-sniper/internal/notify"
+)
+
+// mdlSession returns a session for the metadata lock fixtures.
+func mdlSession(id int, user string, seconds int) MysqlProcess {
+	return MysqlProcess{
+		Command: "Sleep",
+		Schema:  sql.NullString{String: "web", Valid: true},
+		User:    sql.NullString{String: user, Valid: true},
+		ID:      id,
+		Time:    seconds,
+	}
+}
+
+// mdlRow returns a row of the metadata lock query, for the given waiting DDL and holder.
+func mdlRow(waiter, holder MysqlProcess, queued int) MysqlMetadataLock {
+	return MysqlMetadataLock{
+		ObjectSchema: "web",
+		ObjectName:   "users",
+		Holders:      []MysqlProcess{holder},
+		Waiter:       waiter,
+		Queued:       queued,
+	}
+}
+
+func TestGroupMetadataLocks(t *testing.T) {
+	t.Parallel()
+
+	alter := mdlSession(10, "migrations", 30)
+	rename := mdlSession(20, "migrations", 5)
+
+	rows := []MysqlMetadataLock{
+		mdlRow(alter, mdlSession(1, "app", 300), 7),
+		mdlRow(alter, mdlSession(2, "app", 120), 7),
+		mdlRow(alter, mdlSession(2, "app", 120), 7), // a holder with several locks on the table
+		mdlRow(rename, mdlSession(3, "app", 60), 0),
+	}
+
+	got := groupMetadataLocks(rows)
+	if len(got) != 2 {
+		t.Fatalf("groupMetadataLocks() returned %d locks, want 2: %+v", len(got), got)
+	}
+
+	holderIDs := func(lock MysqlMetadataLock) []int {
+		var ids []int
+
+		for _, holder := range lock.Holders {
+			ids = append(ids, holder.ID)
+		}
+
+		return ids
+	}
+
+	if got[0].Waiter.ID != 10 || got[0].Queued != 7 || !slices.Equal(holderIDs(got[0]), []int{1, 2}) {
+		t.Errorf("first lock = %+v, want the ALTER held by 1 and 2 with 7 queued", got[0])
+	}
+
+	if got[1].Waiter.ID != 20 || got[1].Queued != 0 || !slices.Equal(holderIDs(got[1]), []int{3}) {
+		t.Errorf("second lock = %+v, want the RENAME held by 3", got[1])
+	}
+}
+
+func TestKillMetadataLocks_DryRun(t *testing.T) {
+	t.Parallel()
+
+	rules, err := newPolicy([]configuration.Rule{
+		{Name: "etl", User: "etl", Exempt: true},
+		{Name: "audit", User: "audit", Action: configuration.RuleActionLog},
+	})
+	if err != nil {
+		t.Fatalf("newPolicy() unexpected error = %v", err)
+	}
+
+	locks := groupMetadataLocks([]MysqlMetadataLock{
+		// under the limit
+		mdlRow(mdlSession(10, "migrations", 5), mdlSession(1, "app", 300), 4),
+		// past the limit, held by a killable, an exempt and a log only session
+		mdlRow(mdlSession(20, "migrations", 60), mdlSession(2, "app", 300), 4),
+		mdlRow(mdlSession(20, "migrations", 60), mdlSession(3, "etl", 300), 4),
+		mdlRow(mdlSession(20, "migrations", 60), mdlSession(4, "audit", 300), 4),
+		// past the limit, but the DDL itself is exempt
+		mdlRow(mdlSession(30, "etl", 60), mdlSession(5, "app", 300), 0),
+	})
+
+	tests := []struct {
+		name       string
+		action     string
+		wantEvents []notify.Event // only the fields checked below
+		wantKilled int
+	}{
+		{
+			name:   "kill waiter",
+			action: configuration.MetadataLockActionKillWaiter,
+			wantEvents: []notify.Event{
+				{ProcessID: 20, Outcome: notify.OutcomeDryRun, Waiters: 4},
+			},
+			wantKilled: 1,
+		},
+		{
+			name:   "kill holder",
+			action: configuration.MetadataLockActionKillHolder,
+			wantEvents: []notify.Event{
+				{ProcessID: 2, Outcome: notify.OutcomeDryRun, Waiters: 5},
+				{ProcessID: 4, Outcome: notify.OutcomeLogged, Waiters: 5},
+				{ProcessID: 5, Outcome: notify.OutcomeDryRun, Waiters: 1},
+			},
+			wantKilled: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			notifier := &recordingNotifier{}
+			sniper := QuerySniper{
+				Name:               "test_metadata_locks",
+				DryRun:             true,
+				MetadataLockAction: tt.action,
+				MetadataLockLimit:  30 * time.Second,
+				notifier:           notifier,
+				policy:             rules,
+			}
+
+			if killed := sniper.KillMetadataLocks(context.Background(), locks); killed != tt.wantKilled {
+				t.Errorf("KillMetadataLocks() killed = %d, want %d", killed, tt.wantKilled)
+			}
+
+			if len(notifier.events) != len(tt.wantEvents) {
+				t.Fatalf("Notify() got %d events, want %d: %+v", len(notifier.events), len(tt.wantEvents), notifier.events)
+			}
+
+			for i, event := range notifier.events {
+				want := tt.wantEvents[i]
+				if event.ProcessID != want.ProcessID || event.Outcome != want.Outcome || event.Waiters != want.Waiters {
+					t.Errorf("event %d = %+v, want process %d %s with %d waiters", i, event, want.ProcessID, want.Outcome, want.Waiters)
+				}
+
+				if event.Kind != notify.KindMetadataLock || event.Schema != "web" {
+					t.Errorf("event %d = %+v, want a metadata lock event on the web schema", i, event)
+				}
+			}
+		})
+	}
+}
+
+func TestWithSettings_MetadataLock(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		action     string
+		wantAction string
+	}{
+		{
+			name:       "defaults to killing the waiter",
+			action:     "",
+			wantAction: configuration.MetadataLockActionKillWaiter,
+		},
+		{
+			name:       "kill holder",
+			action:     configuration.MetadataLockActionKillHolder,
+			wantAction: configuration.MetadataLockActionKillHolder,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			settings := managerTestSettings("primary")
+
+			config := settings.Databases["primary"]
+			config.MetadataLockLimit = time.Minute
+			config.MetadataLockAction = tt.action
+			settings.Databases["primary"] = config
+
+			retuned, err := QuerySniper{Name: "primary"}.withSettings(settings)
+			if err != nil {
+				t.Fatalf("withSettings() unexpected error = %v", err)
+			}
+
+			if retuned.MetadataLockLimit != time.Minute || retuned.MetadataLockAction != tt.wantAction {
+				t.Errorf("withSettings() metadata lock = %v, %q, want 1m0s, %q",
+					retuned.MetadataLockLimit, retuned.MetadataLockAction, tt.wantAction)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package sniper
+
+import (
+	"errors"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// ErrUnknownSniper is returned when a runtime override names a database without a running sniper.
+var ErrUnknownSniper = errors.New("unknown sniper")
+
+// Overrides is a snapshot of the runtime overrides set through the admin API.
+// NB: this struct is sorted by datatype to satisfy the fieldalignment linter.
+type Overrides struct {
+	SafeMode *bool           `json:"safe_mode,omitempty"` // replaces the safe-mode flag; nil if not overridden
+	DryRun   map[string]bool `json:"dry_run"`             // replaces the dry_run of each database, by name
+	Paused   []string        `json:"paused"`              // the databases whose snipers are paused, sorted
+}
+
+// overrides are the runtime overrides of the Manager's snipers. They're set by the admin API and read
+// by the snipers on every tick, so unlike the sniper's other shared state, they're safe for concurrent
+// use. They survive configuration reloads, and last until they're cleared or the process restarts. A
+// nil overrides overrides nothing.
+type overrides struct {
+	safeMode      *bool
+	dryRun        map[string]bool
+	paused        map[string]bool
+	breakerResets map[string]bool // circuit breaker resets requested, and not yet applied by the sniper
+	mu            sync.RWMutex
+}
+
+func newOverrides() *overrides {
+	return &overrides{
+		breakerResets: make(map[string]bool),
+		dryRun:        make(map[string]bool),
+		paused:        make(map[string]bool),
+	}
+}
+
+// isPaused reports whether the named sniper is paused.
+func (o *overrides) isPaused(name string) bool {
+	if o == nil {
+		return false
+	}
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	return o.paused[name]
+}
+
+// getSafeMode returns the safe mode override, and whether there is one.
+func (o *overrides) getSafeMode() (bool, bool) {
+	if o == nil {
+		return false, false
+	}
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	if o.safeMode == nil {
+		return false, false
+	}
+
+	return *o.safeMode, true
+}
+
+// getDryRun returns the named sniper's dry run override, and whether there is one.
+func (o *overrides) getDryRun(name string) (bool, bool) {
+	if o == nil {
+		return false, false
+	}
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	dryRun, ok := o.dryRun[name]
+
+	return dryRun, ok
+}
+
+// setPaused pauses or resumes the named sniper.
+func (o *overrides) setPaused(name string, paused bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if paused {
+		o.paused[name] = true
+	} else {
+		delete(o.paused, name)
+	}
+}
+
+// setDryRun overrides the named sniper's dry run, or clears the override if dryRun is nil.
+func (o *overrides) setDryRun(name string, dryRun *bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if dryRun != nil {
+		o.dryRun[name] = *dryRun
+	} else {
+		delete(o.dryRun, name)
+	}
+}
+
+// setSafeMode overrides the safe-mode flag, or clears the override if safeMode is nil.
+func (o *overrides) setSafeMode(safeMode *bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if safeMode != nil {
+		value := *safeMode
+		safeMode = &value
+	}
+
+	o.safeMode = safeMode
+}
+
+// requestBreakerReset asks the named sniper to reset its circuit breaker on its next tick.
+func (o *overrides) requestBreakerReset(name string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.breakerResets[name] = true
+}
+
+// takeBreakerReset reports whether a circuit breaker reset was requested for the named sniper, and
+// clears the request.
+func (o *overrides) takeBreakerReset(name string) bool {
+	if o == nil {
+		return false
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	requested := o.breakerResets[name]
+	delete(o.breakerResets, name)
+
+	return requested
+}
+
+// forget clears the overrides of the named sniper.
+func (o *overrides) forget(name string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	delete(o.breakerResets, name)
+	delete(o.dryRun, name)
+	delete(o.paused, name)
+}
+
+// snapshot returns the current overrides.
+func (o *overrides) snapshot() Overrides {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	snapshot := Overrides{
+		DryRun: maps.Clone(o.dryRun),
+		Paused: slices.Sorted(maps.Keys(o.paused)),
+	}
+
+	if o.safeMode != nil {
+		value := *o.safeMode
+		snapshot.SafeMode = &value
+	}
+
+	return snapshot
+}
+
+// withSafeMode returns a copy of the sniper with the safe mode override, if any, in place of the
+// safe-mode flag. It's applied before the scheduled profiles, which safe mode still wins over.
+func (sniper QuerySniper) withSafeMode() QuerySniper {
+	safeMode, ok := sniper.overrides.getSafeMode()
+	if !ok || safeMode == sniper.safeMode {
+		return sniper
+	}
+
+	sniper.safeMode = safeMode
+	sniper.DryRun = sniper.configuredDryRun || safeMode
+
+	return sniper
+}
+
+// withDryRun returns a copy of the sniper with its dry run override, if any, in place of the dry_run of
+// the database and its scheduled profile. Safe mode still wins over a dry run override, as do the
+// circuit breaker and leader election, which are applied after it.
+func (sniper QuerySniper) withDryRun() QuerySniper {
+	dryRun, ok := sniper.overrides.getDryRun(sniper.Name)
+	if !ok {
+		return sniper
+	}
+
+	sniper.DryRun = dryRun || sniper.safeMode
+
+	return sniper
+}
+
+// paused reports whether the sniper is paused, and logs the skipped tick.
+func (sniper QuerySniper) paused() bool {
+	if !sniper.overrides.isPaused(sniper.Name) {
+		return false
+	}
+
+	slog.Debug("Sniper "+sniper.Name+" is paused, skipping this tick", slog.String("db", sniper.Name))
+
+	return true
+}
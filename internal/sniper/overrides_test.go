@@ -0,0 +1,186 @@
+package sniper
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestOverrides_DryRun(t *testing.T) {
+	t.Parallel()
+
+	yes, no := true, false
+
+	tests := []struct {
+		safeMode         *bool // the safe mode override
+		dryRun           *bool // the sniper's dry run override
+		name             string
+		configuredDryRun bool
+		configSafeMode   bool
+		profileDryRun    bool // the dry run set by the scheduled profile, between the two overrides
+		wantDryRun       bool
+	}{
+		{
+			name:       "no overrides",
+			wantDryRun: false,
+		},
+		{
+			name:             "configured dry run",
+			configuredDryRun: true,
+			wantDryRun:       true,
+		},
+		{
+			name:       "dry run override",
+			dryRun:     &yes,
+			wantDryRun: true,
+		},
+		{
+			name:             "the override turns dry run off",
+			configuredDryRun: true,
+			dryRun:           &no,
+			wantDryRun:       false,
+		},
+		{
+			name:          "the override wins over the profile",
+			profileDryRun: true,
+			dryRun:        &no,
+			wantDryRun:    false,
+		},
+		{
+			name:       "safe mode override",
+			safeMode:   &yes,
+			wantDryRun: true,
+		},
+		{
+			name:       "safe mode wins over the dry run override",
+			safeMode:   &yes,
+			dryRun:     &no,
+			wantDryRun: true,
+		},
+		{
+			name:           "the safe mode override turns the safe-mode flag off",
+			configSafeMode: true,
+			safeMode:       &no,
+			wantDryRun:     false,
+		},
+		{
+			name:             "the database's own dry run survives the safe mode override",
+			configSafeMode:   true,
+			configuredDryRun: true,
+			safeMode:         &no,
+			wantDryRun:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			o := newOverrides()
+			o.setSafeMode(tt.safeMode)
+			o.setDryRun("test_overrides", tt.dryRun)
+
+			sniper := QuerySniper{
+				Name:             "test_overrides",
+				DryRun:           tt.configuredDryRun || tt.configSafeMode,
+				configuredDryRun: tt.configuredDryRun,
+				safeMode:         tt.configSafeMode,
+				overrides:        o,
+			}
+
+			hunter := sniper.withSafeMode()
+			if tt.profileDryRun {
+				hunter.DryRun = true
+			}
+
+			if got := hunter.withDryRun().DryRun; got != tt.wantDryRun {
+				t.Errorf("withSafeMode().withDryRun() dry run = %v, want %v", got, tt.wantDryRun)
+			}
+		})
+	}
+}
+
+func TestOverrides_NilOverridesNothing(t *testing.T) {
+	t.Parallel()
+
+	sniper := QuerySniper{Name: "test_nil_overrides", DryRun: true, configuredDryRun: true}
+
+	if sniper.paused() || !sniper.withSafeMode().withDryRun().DryRun {
+		t.Error("a sniper without overrides was paused or had its dry run changed")
+	}
+}
+
+func TestManager_Overrides(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	manager := NewManager(managerTestSettings("primary", "replica"))
+
+	t.Cleanup(func() {
+		cancel()
+		manager.wg.Wait()
+	})
+
+	manager.apply(ctx, manager.settings)
+
+	err := manager.Pause("missing")
+	if !errors.Is(err, ErrUnknownSniper) {
+		t.Errorf("Pause() of an unknown sniper error = %v, want %v", err, ErrUnknownSniper)
+	}
+
+	if err = manager.Pause("primary"); err != nil {
+		t.Fatalf("Pause() unexpected error = %v", err)
+	}
+
+	dryRun := false
+	if err = manager.SetDryRun("replica", &dryRun); err != nil {
+		t.Fatalf("SetDryRun() unexpected error = %v", err)
+	}
+
+	safeMode := true
+	manager.SetSafeMode(&safeMode)
+
+	if err = manager.ResetBreaker("missing"); !errors.Is(err, ErrUnknownSniper) {
+		t.Errorf("ResetBreaker() of an unknown sniper error = %v, want %v", err, ErrUnknownSniper)
+	}
+
+	if err = manager.ResetBreaker("replica"); err != nil {
+		t.Fatalf("ResetBreaker() unexpected error = %v", err)
+	}
+
+	overrides := manager.Overrides()
+	if !slices.Equal(overrides.Paused, []string{"primary"}) || overrides.DryRun["replica"] ||
+		overrides.SafeMode == nil || !*overrides.SafeMode {
+		t.Errorf("Overrides() = %+v, want primary paused, replica killing and safe mode on", overrides)
+	}
+
+	if status := manager.Status(); !status["primary"].Paused || !status["primary"].Ready(time.Now(), 3) {
+		t.Errorf("Status() primary = %+v, want paused and ready", status["primary"])
+	}
+
+	// the overrides of a removed database are forgotten, but reloads don't clear the others.
+	manager.apply(ctx, managerTestSettings("replica"))
+
+	overrides = manager.Overrides()
+	if len(overrides.Paused) != 0 {
+		t.Errorf("Overrides() paused = %v after primary was removed, want none", overrides.Paused)
+	}
+
+	if _, ok := overrides.DryRun["replica"]; !ok {
+		t.Error("Overrides() lost the dry run override of replica on reload")
+	}
+
+	if err = manager.SetDryRun("replica", nil); err != nil {
+		t.Fatalf("SetDryRun(nil) unexpected error = %v", err)
+	}
+
+	manager.SetSafeMode(nil)
+
+	overrides = manager.Overrides()
+	if len(overrides.DryRun) != 0 || overrides.SafeMode != nil {
+		t.Errorf("Overrides() = %+v after clearing, want none", overrides)
+	}
+}
@@ -0,0 +1,238 @@
+package sniper
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+)
+
+// rule is a configuration.Rule with its digest regex compiled.
+type rule struct {
+	digest *regexp.Regexp
+	configuration.Rule
+}
+
+// policy is the ordered list of rules for a sniper.
+type policy []rule
+
+// policyVerdict is the outcome of evaluating a sniper's policy against a process or transaction.
+type policyVerdict struct {
+	rule   string        // the name of the matching rule; empty if no rule matched
+	action string        // one of the configuration.RuleAction* values; empty for the default KILL
+	limit  time.Duration // the runtime limit that applies to the offender
+	exempt bool          // the offender must never be killed
+}
+
+// newPolicy compiles the given rules into a policy. Rules without a name are named after their
+// position in the list, so they can be identified in the logs.
+func newPolicy(rules []configuration.Rule) (policy, error) {
+	compiled := make(policy, 0, len(rules))
+
+	for i, cfg := range rules {
+		r := rule{Rule: cfg}
+
+		if r.Name == "" {
+			r.Name = "rule-" + strconv.Itoa(i)
+		}
+
+		if r.Digest != "" {
+			digest, err := regexp.Compile(r.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("error compiling digest for rule %s: %w", r.Name, err)
+			}
+
+			r.digest = digest
+		}
+
+		compiled = append(compiled, r)
+	}
+
+	return compiled, nil
+}
+
+// match returns the first rule that matches the given attributes, or nil if none of them do.
+func (p policy) match(user string, schema string, host string, command string, digest string) *rule {
+	// the processlist reports the host as host:port, but the rules only care about the host.
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	for i := range p {
+		r := &p[i]
+
+		switch {
+		case r.User != "" && r.User != user,
+			r.Schema != "" && r.Schema != schema,
+			r.Host != "" && r.Host != host,
+			r.Command != "" && !strings.EqualFold(r.Command, command),
+			r.StatementPrefix != "" && !hasPrefixFold(digest, r.StatementPrefix),
+			r.digest != nil && !r.digest.MatchString(digest):
+			continue
+		}
+
+		return r
+	}
+
+	return nil
+}
+
+// minQueryLimit returns the smallest query limit of the default and all non-exempt rules, which is
+// what the hunter query has to filter on so that no rule misses a process.
+func (p policy) minQueryLimit(defaultLimit time.Duration) time.Duration {
+	return p.minLimit(defaultLimit, func(r rule) time.Duration { return r.LongQueryLimit })
+}
+
+// minTransactionLimit is minQueryLimit, for transactions.
+func (p policy) minTransactionLimit(defaultLimit time.Duration) time.Duration {
+	return p.minLimit(defaultLimit, func(r rule) time.Duration { return r.LongTransactionLimit })
+}
+
+func (p policy) minLimit(defaultLimit time.Duration, limit func(rule) time.Duration) time.Duration {
+	lowest := defaultLimit
+
+	for _, r := range p {
+		if r.Exempt || limit(r) <= 0 {
+			continue
+		}
+
+		lowest = min(lowest, limit(r))
+	}
+
+	return lowest
+}
+
+// evaluateProcess returns the verdict of the sniper's policy for the given process. A timeout
+// requested by the query itself replaces the limit of the database or the matching rule.
+func (sniper QuerySniper) evaluateProcess(process MysqlProcess) policyVerdict {
+	v := policyVerdict{limit: sniper.QueryLimit}
+
+	r := sniper.policy.match(process.User.String, process.Schema.String, process.Host.String, process.Command, process.DigestText.String)
+	if r != nil {
+		v.rule = r.Name
+		v.action = r.Action
+		v.exempt = r.Exempt
+
+		if r.LongQueryLimit > 0 {
+			v.limit = r.LongQueryLimit
+		}
+	}
+
+	if process.Timeout > 0 {
+		v.limit = process.Timeout
+	}
+
+	return v
+}
+
+// evaluateTransaction returns the verdict of the sniper's policy for the given transaction.
+func (sniper QuerySniper) evaluateTransaction(transaction MysqlTransaction) policyVerdict {
+	v := policyVerdict{limit: sniper.TransactionLimit}
+
+	r := sniper.policy.match(transaction.User.String, transaction.Schema.String, transaction.Host.String, transaction.Command, transaction.DigestText.String)
+	if r == nil {
+		return v
+	}
+
+	v.rule = r.Name
+	v.action = r.Action
+	v.exempt = r.Exempt
+
+	if r.LongTransactionLimit > 0 {
+		v.limit = r.LongTransactionLimit
+	}
+
+	return v
+}
+
+// evaluateIdleTransaction returns the verdict of the sniper's policy for the given idle transaction.
+// The rules only decide whether it's exempt or only logged; the limit is always the database's
+// idle_transaction_limit, which is compared against how long the session has been idle.
+func (sniper QuerySniper) evaluateIdleTransaction(transaction MysqlIdleTransaction) policyVerdict {
+	v := policyVerdict{limit: sniper.IdleTransactionLimit}
+
+	r := sniper.policy.match(transaction.User.String, transaction.Schema.String, transaction.Host.String, transaction.Command, transaction.DigestText.String)
+	if r != nil {
+		v.rule = r.Name
+		v.action = r.Action
+		v.exempt = r.Exempt
+	}
+
+	return v
+}
+
+// evaluateBlocker returns the verdict of the sniper's policy for the given lock chain blocker. The
+// rules only decide whether a blocker is exempt or only logged; the limit is always the database's
+// lock_wait_limit, which is compared against how long the blocker's waiters have been waiting.
+func (sniper QuerySniper) evaluateBlocker(blocker MysqlBlocker) policyVerdict {
+	v := policyVerdict{limit: sniper.LockWaitLimit}
+
+	r := sniper.policy.match(blocker.User.String, blocker.Schema.String, blocker.Host.String, blocker.Command, blocker.DigestText.String)
+	if r != nil {
+		v.rule = r.Name
+		v.action = r.Action
+		v.exempt = r.Exempt
+	}
+
+	return v
+}
+
+// evaluateMetadataLock returns the verdict of the sniper's policy for a session that would be killed to
+// clear a metadata lock: the waiting DDL statement or one of the lock's holders, depending on the
+// database's metadata_lock_action. As with blockers, the rules only decide whether the session is
+// exempt or only logged; the limit is always the database's metadata_lock_limit.
+func (sniper QuerySniper) evaluateMetadataLock(session MysqlProcess) policyVerdict {
+	v := policyVerdict{limit: sniper.MetadataLockLimit}
+
+	r := sniper.policy.match(session.User.String, session.Schema.String, session.Host.String, session.Command, session.DigestText.String)
+	if r != nil {
+		v.rule = r.Name
+		v.action = r.Action
+		v.exempt = r.Exempt
+	}
+
+	return v
+}
+
+// actionOr returns the verdict's action, or defaultAction (one of the configuration.RuleAction* values)
+// if the verdict doesn't specify one, for the notification events.
+func (v policyVerdict) actionOr(defaultAction string) string {
+	if v.action == "" {
+		return defaultAction
+	}
+
+	return v.action
+}
+
+// connectionAction returns the action for an offender that is always killed with KILL CONNECTION,
+// unless the verdict only allows logging it.
+func (v policyVerdict) connectionAction() string {
+	if v.action == configuration.RuleActionLog {
+		return configuration.RuleActionLog
+	}
+
+	return configuration.RuleActionKillConnection
+}
+
+// killStatement returns the KILL statement for the verdict's action, or defaultFormat if the
+// verdict doesn't specify one.
+func (v policyVerdict) killStatement(processID int, defaultFormat string) string {
+	switch v.action {
+	case configuration.RuleActionKillQuery:
+		return fmt.Sprintf("KILL QUERY %d", processID)
+
+	case configuration.RuleActionKillConnection:
+		return fmt.Sprintf("KILL CONNECTION %d", processID)
+
+	default:
+		return fmt.Sprintf(defaultFormat, processID)
+	}
+}
+
+func hasPrefixFold(s string, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
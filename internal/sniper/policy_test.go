@@ -0,0 +1,307 @@
+package sniper
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+	"github.com/persona-id/query-sniper/internal/notify"
+)
+
+func TestPolicyMatch(t *testing.T) {
+	t.Parallel()
+
+	rules, err := newPolicy([]configuration.Rule{
+		{Name: "reporting", User: "reporting", LongQueryLimit: 30 * time.Second},
+		{Name: "migrations", Digest: `^ALTER TABLE`, Exempt: true},
+		{Name: "batch-host", Host: "10.0.0.5", Action: configuration.RuleActionLog},
+		{Name: "web-selects", User: "web", Schema: "app", StatementPrefix: "select", Command: "query"},
+		{User: "web"},
+	})
+	if err != nil {
+		t.Fatalf("newPolicy() unexpected error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		user     string
+		schema   string
+		host     string
+		command  string
+		digest   string
+		wantRule string
+	}{
+		{
+			name:     "first matching rule wins",
+			user:     "reporting",
+			digest:   "ALTER TABLE `t` ADD COLUMN `c` INT",
+			wantRule: "reporting",
+		},
+		{
+			name:     "digest regex",
+			user:     "admin",
+			digest:   "ALTER TABLE `t` ADD COLUMN `c` INT",
+			wantRule: "migrations",
+		},
+		{
+			name:     "host is matched without the port",
+			user:     "admin",
+			host:     "10.0.0.5:51234",
+			wantRule: "batch-host",
+		},
+		{
+			name:     "all fields must match, prefix and command are case insensitive",
+			user:     "web",
+			schema:   "app",
+			command:  "Query",
+			digest:   "SELECT * FROM `users`",
+			wantRule: "web-selects",
+		},
+		{
+			name:     "falls through to later rules; unnamed rules are named by position",
+			user:     "web",
+			schema:   "app",
+			command:  "Query",
+			digest:   "UPDATE `users` SET `name` = ?",
+			wantRule: "rule-4",
+		},
+		{
+			name:     "no match",
+			user:     "nobody",
+			host:     "10.0.0.6:51234",
+			wantRule: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := rules.match(tt.user, tt.schema, tt.host, tt.command, tt.digest)
+
+			gotRule := ""
+			if got != nil {
+				gotRule = got.Name
+			}
+
+			if gotRule != tt.wantRule {
+				t.Errorf("match() = %q, want %q", gotRule, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestNewPolicy_InvalidDigest(t *testing.T) {
+	t.Parallel()
+
+	_, err := newPolicy([]configuration.Rule{{Digest: "("}})
+	if err == nil {
+		t.Error("newPolicy() with an invalid digest regex should return an error")
+	}
+}
+
+func TestPolicyMinLimits(t *testing.T) {
+	t.Parallel()
+
+	rules, err := newPolicy([]configuration.Rule{
+		{User: "web", LongQueryLimit: 2 * time.Second},
+		{User: "reporting", LongQueryLimit: 30 * time.Second, LongTransactionLimit: 5 * time.Second},
+		{User: "etl", LongQueryLimit: time.Second, Exempt: true},
+	})
+	if err != nil {
+		t.Fatalf("newPolicy() unexpected error = %v", err)
+	}
+
+	if got := rules.minQueryLimit(10 * time.Second); got != 2*time.Second {
+		t.Errorf("minQueryLimit() = %v, want 2s (exempt rules are ignored)", got)
+	}
+
+	if got := rules.minTransactionLimit(60 * time.Second); got != 5*time.Second {
+		t.Errorf("minTransactionLimit() = %v, want 5s", got)
+	}
+
+	if got := policy(nil).minQueryLimit(10 * time.Second); got != 10*time.Second {
+		t.Errorf("minQueryLimit() without rules = %v, want 10s", got)
+	}
+}
+
+func TestKillStatement(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		action string
+		want   string
+	}{
+		{action: "", want: "KILL 42"},
+		{action: configuration.RuleActionKillQuery, want: "KILL QUERY 42"},
+		{action: configuration.RuleActionKillConnection, want: "KILL CONNECTION 42"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			t.Parallel()
+
+			got := policyVerdict{action: tt.action}.killStatement(42, "KILL %d")
+			if got != tt.want {
+				t.Errorf("killStatement() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateHunterQueries_Rules(t *testing.T) {
+	t.Parallel()
+
+	rules, err := newPolicy([]configuration.Rule{
+		{User: "web", LongQueryLimit: 2 * time.Second, LongTransactionLimit: 4 * time.Second},
+	})
+	if err != nil {
+		t.Fatalf("newPolicy() unexpected error = %v", err)
+	}
+
+	sniper := QuerySniper{
+		QueryLimit:       30 * time.Second,
+		TransactionLimit: 60 * time.Second,
+		policy:           rules,
+	}
+
+	query, txn, err := sniper.generateHunterQueries()
+	if err != nil {
+		t.Fatalf("generateHunterQueries() unexpected error = %v", err)
+	}
+
+	if !strings.Contains(query, "AND pl.time >= 2") {
+		t.Errorf("generateHunterQueries() query should filter on the lowest rule limit, got %s", query)
+	}
+
+	if !strings.Contains(txn, "NOW()) >= 4") {
+		t.Errorf("generateHunterQueries() transaction query should filter on the lowest rule limit, got %s", txn)
+	}
+}
+
+func TestKillProcesses_Rules(t *testing.T) {
+	t.Parallel()
+
+	rules, err := newPolicy([]configuration.Rule{
+		{Name: "reporting", User: "reporting", LongQueryLimit: 30 * time.Second},
+		{Name: "etl", User: "etl", Exempt: true},
+		{Name: "audit", User: "audit", Action: configuration.RuleActionLog},
+	})
+	if err != nil {
+		t.Fatalf("newPolicy() unexpected error = %v", err)
+	}
+
+	sniper := QuerySniper{
+		Name:       "test_rules",
+		DryRun:     true,
+		QueryLimit: 2 * time.Second,
+		policy:     rules,
+	}
+
+	processes := []MysqlProcess{
+		{ID: 1, Time: 10, User: sql.NullString{String: "reporting", Valid: true}}, // under the rule's 30s limit
+		{ID: 2, Time: 45, User: sql.NullString{String: "reporting", Valid: true}}, // over the rule's limit
+		{ID: 3, Time: 90, User: sql.NullString{String: "etl", Valid: true}},       // exempt
+		{ID: 4, Time: 90, User: sql.NullString{String: "audit", Valid: true}},     // log only
+		{ID: 5, Time: 1, User: sql.NullString{String: "web", Valid: true}},        // under the default limit
+		{ID: 6, Time: 3, User: sql.NullString{String: "web", Valid: true}},        // over the default limit
+	}
+
+	if killed := sniper.KillProcesses(context.Background(), processes); killed != 2 {
+		t.Errorf("KillProcesses() killed = %d, want 2", killed)
+	}
+
+	transactions := []MysqlTransaction{
+		{ID: 1, ProcessID: 1, Time: 90, User: sql.NullString{String: "etl", Valid: true}},
+		{ID: 2, ProcessID: 2, Time: 90, User: sql.NullString{String: "web", Valid: true}},
+	}
+
+	if killed := sniper.KillTransactions(context.Background(), transactions); killed != 1 {
+		t.Errorf("KillTransactions() killed = %d, want 1", killed)
+	}
+}
+
+// recordingNotifier records the events it's given.
+type recordingNotifier struct {
+	events []notify.Event
+	calls  int
+}
+
+func (notifier *recordingNotifier) Notify(_ context.Context, events []notify.Event) error {
+	notifier.calls++
+	notifier.events = append(notifier.events, events...)
+
+	return nil
+}
+
+func TestKillProcesses_Notify(t *testing.T) {
+	t.Parallel()
+
+	rules, err := newPolicy([]configuration.Rule{
+		{Name: "etl", User: "etl", Exempt: true},
+		{Name: "audit", User: "audit", Action: configuration.RuleActionLog},
+	})
+	if err != nil {
+		t.Fatalf("newPolicy() unexpected error = %v", err)
+	}
+
+	notifier := &recordingNotifier{}
+	sniper := QuerySniper{
+		Name:             "test_notify",
+		DryRun:           true,
+		QueryLimit:       2 * time.Second,
+		TransactionLimit: 2 * time.Second,
+		notifier:         notifier,
+		policy:           rules,
+	}
+
+	processes := []MysqlProcess{
+		{ID: 1, Time: 90, User: sql.NullString{String: "etl", Valid: true}},   // exempt, not notified
+		{ID: 2, Time: 90, User: sql.NullString{String: "audit", Valid: true}}, // log only
+		{ID: 3, Time: 1, User: sql.NullString{String: "web", Valid: true}},    // under the limit, not notified
+		{ID: 4, Time: 3, User: sql.NullString{String: "web", Valid: true}},
+	}
+
+	sniper.KillProcesses(context.Background(), processes)
+
+	// all of the events from one call are delivered together.
+	if notifier.calls != 1 {
+		t.Fatalf("Notify() called %d times, want 1", notifier.calls)
+	}
+
+	want := []struct {
+		outcome string
+		rule    string
+		id      int
+	}{
+		{id: 2, outcome: notify.OutcomeLogged, rule: "audit"},
+		{id: 4, outcome: notify.OutcomeDryRun, rule: ""},
+	}
+
+	if len(notifier.events) != len(want) {
+		t.Fatalf("Notify() got %d events, want %d", len(notifier.events), len(want))
+	}
+
+	for i, event := range notifier.events {
+		if event.ProcessID != want[i].id || event.Outcome != want[i].outcome || event.Rule != want[i].rule {
+			t.Errorf("event %d = {id: %d, outcome: %s, rule: %q}, want {id: %d, outcome: %s, rule: %q}",
+				i, event.ProcessID, event.Outcome, event.Rule, want[i].id, want[i].outcome, want[i].rule)
+		}
+
+		if event.DB != "test_notify" || event.Kind != notify.KindProcess || !event.DryRun {
+			t.Errorf("event %d = %+v, want a dry run process event for test_notify", i, event)
+		}
+	}
+
+	// nothing to report, so the notifier isn't called.
+	sniper.KillTransactions(context.Background(), []MysqlTransaction{
+		{ID: 1, ProcessID: 1, Time: 90, User: sql.NullString{String: "etl", Valid: true}},
+	})
+
+	if notifier.calls != 1 {
+		t.Errorf("Notify() called %d times after an exempt transaction, want 1", notifier.calls)
+	}
+}
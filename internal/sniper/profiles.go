@@ -0,0 +1,125 @@
+package sniper
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+	"github.com/persona-id/query-sniper/internal/schedule"
+)
+
+// profile is a scheduled threshold profile, with its window parsed.
+type profile struct {
+	configuration.ScheduleConfig
+	window schedule.Window
+}
+
+// newProfiles parses the windows of the given schedules.
+func newProfiles(configs []configuration.ScheduleConfig) ([]profile, error) {
+	profiles := make([]profile, 0, len(configs))
+
+	for _, config := range configs {
+		window, err := config.Window()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing schedule %s: %w", config.Name, err)
+		}
+
+		profiles = append(profiles, profile{ScheduleConfig: config, window: window})
+	}
+
+	return profiles, nil
+}
+
+// activeProfile returns the first profile whose window is open at now, or nil if none of them are.
+func (sniper QuerySniper) activeProfile(now time.Time) *profile {
+	for i := range sniper.profiles {
+		if sniper.profiles[i].window.Active(now) {
+			return &sniper.profiles[i]
+		}
+	}
+
+	return nil
+}
+
+// withProfile returns a copy of the sniper with the settings of the profile active at now in place of
+// the database's, and the hunter queries regenerated to match, along with the profile's name. The
+// limits of the rules are scaled by the same ratio as the database's, so that they keep their
+// proportion to it. Global safe mode still overrides a profile's dry_run.
+func (sniper QuerySniper) withProfile(now time.Time) (QuerySniper, string, error) {
+	active := sniper.activeProfile(now)
+	if active == nil {
+		return sniper, configuration.DefaultProfile, nil
+	}
+
+	queryRatio, transactionRatio := 1.0, 1.0
+
+	if active.LongQueryLimit > 0 {
+		queryRatio = float64(active.LongQueryLimit) / float64(sniper.QueryLimit)
+		sniper.QueryLimit = active.LongQueryLimit
+	}
+
+	if active.LongTransactionLimit > 0 {
+		transactionRatio = float64(active.LongTransactionLimit) / float64(sniper.TransactionLimit)
+		sniper.TransactionLimit = active.LongTransactionLimit
+	}
+
+	if queryRatio != 1 || transactionRatio != 1 {
+		// the rules are shared with the sniper outside of the profile, so they're copied before they're changed.
+		sniper.policy = slices.Clone(sniper.policy)
+
+		for i := range sniper.policy {
+			r := &sniper.policy[i]
+			r.LongQueryLimit = time.Duration(float64(r.LongQueryLimit) * queryRatio)
+			r.LongTransactionLimit = time.Duration(float64(r.LongTransactionLimit) * transactionRatio)
+		}
+	}
+
+	if active.DryRun != nil {
+		sniper.DryRun = *active.DryRun || sniper.safeMode
+	}
+
+	query, txn, err := sniper.generateHunterQueries()
+	if err != nil {
+		return QuerySniper{}, "", fmt.Errorf("error generating hunter queries: %w", err)
+	}
+
+	sniper.LRQQuery = query
+	sniper.LRTXNQuery = txn
+
+	return sniper, active.Name, nil
+}
+
+// scheduled returns the sniper to hunt with on this tick, with the active profile's settings, and the
+// profile's name. previous is the profile of the last tick, so that changes are logged at INFO; the
+// active profile is logged on every tick at DEBUG. If the profile can't be applied, the database's own
+// settings are used.
+func (sniper QuerySniper) scheduled(now time.Time, previous string) (QuerySniper, string) {
+	hunter, name, err := sniper.withProfile(now)
+	if err != nil {
+		slog.Error("Error applying the scheduled profile, using the configured settings",
+			slog.String("db", sniper.Name),
+			slog.Any("err", err),
+		)
+
+		hunter, name = sniper, configuration.DefaultProfile
+	}
+
+	attrs := []any{
+		slog.String("db", sniper.Name),
+		slog.String("profile", name),
+		slog.String("previous_profile", previous),
+		slog.Duration("query_limit", hunter.QueryLimit),
+		slog.Duration("transaction_limit", hunter.TransactionLimit),
+		slog.Bool("dry_run", hunter.DryRun),
+	}
+
+	if name != previous {
+		slog.Info("Scheduled profile "+name+" is now active on "+sniper.Name, attrs...)
+	} else {
+		slog.Debug("Scheduled profile "+name+" is active on "+sniper.Name, attrs...)
+	}
+
+	return hunter, name
+}
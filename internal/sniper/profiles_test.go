@@ -0,0 +1,222 @@
+package sniper
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+)
+
+func TestWithProfile(t *testing.T) {
+	t.Parallel()
+
+	dryRun, killing := true, false
+
+	profiles, err := newProfiles([]configuration.ScheduleConfig{
+		{
+			Name:           "nightly-batch",
+			Cron:           "0 1 * * *",
+			Timezone:       "America/New_York",
+			Duration:       4 * time.Hour,
+			LongQueryLimit: 10 * time.Minute,
+		},
+		{
+			Name:     "migration",
+			Cron:     "0 0 * * 6",
+			Duration: 24 * time.Hour,
+			DryRun:   &dryRun,
+		},
+		{
+			Name:                 "business-hours",
+			Cron:                 "0 9 * * 1-5",
+			Timezone:             "America/New_York",
+			Duration:             8 * time.Hour,
+			LongQueryLimit:       2 * time.Second,
+			LongTransactionLimit: 5 * time.Second,
+			DryRun:               &killing,
+		},
+	})
+	if err != nil {
+		t.Fatalf("newProfiles() unexpected error = %v", err)
+	}
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("LoadLocation() unexpected error = %v", err)
+	}
+
+	// 2025-06-02 is a Monday, and 2025-06-07 a Saturday.
+	tests := []struct {
+		now                  time.Time
+		name                 string
+		wantProfile          string
+		wantQuery            string // the regenerated long query filter, if the profile changes the query limit
+		wantQueryLimit       time.Duration
+		wantTransactionLimit time.Duration
+		safeMode             bool
+		wantDryRun           bool
+	}{
+		{
+			name:                 "no window open",
+			now:                  time.Date(2025, time.June, 2, 7, 0, 0, 0, newYork),
+			wantProfile:          configuration.DefaultProfile,
+			wantQueryLimit:       10 * time.Second,
+			wantTransactionLimit: 30 * time.Second,
+			wantDryRun:           false,
+		},
+		{
+			name:                 "only overrides the query limit",
+			now:                  time.Date(2025, time.June, 2, 2, 0, 0, 0, newYork),
+			wantProfile:          "nightly-batch",
+			wantQuery:            "AND pl.time >= 600",
+			wantQueryLimit:       10 * time.Minute,
+			wantTransactionLimit: 30 * time.Second,
+			wantDryRun:           false,
+		},
+		{
+			name:                 "no kills during the migration",
+			now:                  time.Date(2025, time.June, 7, 12, 0, 0, 0, time.UTC),
+			wantProfile:          "migration",
+			wantQueryLimit:       10 * time.Second,
+			wantTransactionLimit: 30 * time.Second,
+			wantDryRun:           true,
+		},
+		{
+			name:                 "business hours",
+			now:                  time.Date(2025, time.June, 2, 16, 59, 0, 0, newYork),
+			wantProfile:          "business-hours",
+			wantQuery:            "AND pl.time >= 2 ",
+			wantQueryLimit:       2 * time.Second,
+			wantTransactionLimit: 5 * time.Second,
+			wantDryRun:           false,
+		},
+		{
+			name:                 "safe mode wins over the profile",
+			now:                  time.Date(2025, time.June, 2, 16, 59, 0, 0, newYork),
+			safeMode:             true,
+			wantProfile:          "business-hours",
+			wantQuery:            "AND pl.time >= 2 ",
+			wantQueryLimit:       2 * time.Second,
+			wantTransactionLimit: 5 * time.Second,
+			wantDryRun:           true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sniper := QuerySniper{
+				QueryLimit:       10 * time.Second,
+				TransactionLimit: 30 * time.Second,
+				DryRun:           tt.safeMode,
+				profiles:         profiles,
+				safeMode:         tt.safeMode,
+			}
+
+			hunter, name, err := sniper.withProfile(tt.now)
+			if err != nil {
+				t.Fatalf("withProfile() unexpected error = %v", err)
+			}
+
+			if name != tt.wantProfile {
+				t.Errorf("withProfile() profile = %q, want %q", name, tt.wantProfile)
+			}
+
+			if hunter.QueryLimit != tt.wantQueryLimit || hunter.TransactionLimit != tt.wantTransactionLimit || hunter.DryRun != tt.wantDryRun {
+				t.Errorf("withProfile() = %v, %v, dry run %v, want %v, %v, dry run %v",
+					hunter.QueryLimit, hunter.TransactionLimit, hunter.DryRun,
+					tt.wantQueryLimit, tt.wantTransactionLimit, tt.wantDryRun)
+			}
+
+			if !strings.Contains(hunter.LRQQuery, tt.wantQuery) {
+				t.Errorf("withProfile() LRQQuery = %q, want it to contain %q", hunter.LRQQuery, tt.wantQuery)
+			}
+		})
+	}
+}
+
+func TestWithSettings_Schedules(t *testing.T) {
+	t.Parallel()
+
+	settings := managerTestSettings("primary")
+
+	config := settings.Databases["primary"]
+	config.Schedules = []configuration.ScheduleConfig{
+		{Name: "nightly-batch", Cron: "0 1 * * *", Duration: time.Hour, LongQueryLimit: 10 * time.Minute},
+	}
+	settings.Databases["primary"] = config
+	settings.SafeMode = true
+
+	retuned, err := QuerySniper{Name: "primary"}.withSettings(settings)
+	if err != nil {
+		t.Fatalf("withSettings() unexpected error = %v", err)
+	}
+
+	if len(retuned.profiles) != 1 || retuned.profiles[0].Name != "nightly-batch" || !retuned.safeMode {
+		t.Errorf("withSettings() profiles = %+v, safe mode %v, want the nightly-batch profile in safe mode",
+			retuned.profiles, retuned.safeMode)
+	}
+}
+
+func TestWithProfile_Rules(t *testing.T) {
+	t.Parallel()
+
+	profiles, err := newProfiles([]configuration.ScheduleConfig{
+		{Name: "nightly-batch", Cron: "0 1 * * *", Duration: 4 * time.Hour, LongQueryLimit: 10 * time.Minute},
+	})
+	if err != nil {
+		t.Fatalf("newProfiles() unexpected error = %v", err)
+	}
+
+	rules, err := newPolicy([]configuration.Rule{
+		{Name: "reporting", User: "reporting", LongQueryLimit: 30 * time.Second, LongTransactionLimit: time.Minute},
+	})
+	if err != nil {
+		t.Fatalf("newPolicy() unexpected error = %v", err)
+	}
+
+	sniper := QuerySniper{
+		Name:             "test_profile_rules",
+		DryRun:           true,
+		QueryLimit:       10 * time.Second,
+		TransactionLimit: 30 * time.Second,
+		policy:           rules,
+		profiles:         profiles,
+	}
+
+	hunter, name, err := sniper.withProfile(time.Date(2025, time.June, 2, 2, 0, 0, 0, time.UTC))
+	if err != nil || name != "nightly-batch" {
+		t.Fatalf("withProfile() = %q, %v, want the nightly-batch profile", name, err)
+	}
+
+	// the profile raises the query limit 60x, and so the rule's; the transaction limits are left alone.
+	reporting := MysqlProcess{ID: 1, Time: 45, User: sql.NullString{String: "reporting", Valid: true}}
+	if verdict := hunter.evaluateProcess(reporting); verdict.limit != 30*time.Minute {
+		t.Errorf("evaluateProcess() limit = %v, want the rule's limit scaled to %v", verdict.limit, 30*time.Minute)
+	}
+
+	if killed := hunter.KillProcesses(context.Background(), []MysqlProcess{reporting}); killed != 0 {
+		t.Errorf("KillProcesses() killed = %d, want the rule limited process spared under the profile", killed)
+	}
+
+	if got := hunter.policy[0].LongTransactionLimit; got != time.Minute {
+		t.Errorf("rule LongTransactionLimit = %v, want it unchanged at %v", got, time.Minute)
+	}
+
+	if !strings.Contains(hunter.LRQQuery, "AND pl.time >= 600") {
+		t.Errorf("withProfile() LRQQuery = %q, want it to filter on the scaled limits", hunter.LRQQuery)
+	}
+
+	// the sniper outside of the profile keeps the rule's own limit.
+	if verdict := sniper.evaluateProcess(reporting); verdict.limit != 30*time.Second {
+		t.Errorf("evaluateProcess() limit = %v, want the rule's own %v outside of the profile", verdict.limit, 30*time.Second)
+	}
+
+	if killed := sniper.KillProcesses(context.Background(), []MysqlProcess{reporting}); killed != 1 {
+		t.Errorf("KillProcesses() killed = %d, want 1 outside of the profile", killed)
+	}
+}
@@ -0,0 +1,53 @@
+package sniper
+
+// sightingKey identifies an offender across ticks. Processlist ids aren't reused while the server is
+// up, so the id alone identifies the connection; the second half changes when the connection moves
+// on to another statement (for processes), transaction (for transactions, idle transactions and
+// blockers) or DDL statement (for the sessions of a metadata lock).
+type sightingKey struct {
+	id        int // the processlist id
+	statement int // the statement's event id, the transaction id, or the processlist id of the waiting DDL
+}
+
+// sightings counts the consecutive ticks on which each offender of a hunter has been seen over its
+// limit, so that a single slow performance_schema sample right at the limit doesn't get anything
+// killed. The snipers' methods have value receivers, so the sniper holds a pointer to its sightings,
+// which is shared by every copy of it, including the ones made by withSettings on a reload.
+//
+// A nil *sightings never waits for confirmation. It's only used from the sniper's own Loop, so it
+// isn't safe for concurrent use.
+type sightings struct {
+	previous map[sightingKey]int // the counts as of the last tick
+	current  map[sightingKey]int // the counts of the offenders seen so far on this tick
+}
+
+// see records a sighting of the offender on the current tick, and returns the number of consecutive
+// ticks (including this one) that it has been seen on.
+func (s *sightings) see(key sightingKey) int {
+	if s == nil {
+		return 1
+	}
+
+	if s.current == nil {
+		s.current = make(map[sightingKey]int)
+	}
+
+	// an offender seen twice on the same tick (say, by two hunts before next is called) isn't counted twice.
+	if count, ok := s.current[key]; ok {
+		return count
+	}
+
+	s.current[key] = s.previous[key] + 1
+
+	return s.current[key]
+}
+
+// next ends the current tick. Offenders that weren't seen on it, because they finished, moved on to
+// another statement, or dropped under their limit, start over from zero.
+func (s *sightings) next() {
+	if s == nil {
+		return
+	}
+
+	s.previous, s.current = s.current, nil
+}
@@ -0,0 +1,242 @@
+package sniper
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+)
+
+func TestSightings(t *testing.T) {
+	t.Parallel()
+
+	first := sightingKey{id: 1, statement: 100}
+	next := sightingKey{id: 1, statement: 101} // the same process, on its next statement
+	other := sightingKey{id: 2, statement: 200}
+
+	tests := []struct {
+		name  string
+		ticks [][]sightingKey // the offenders seen on each tick
+		key   sightingKey
+		want  int // the count for key on the last tick
+	}{
+		{
+			name:  "consecutive ticks",
+			ticks: [][]sightingKey{{first}, {first, other}, {first}},
+			key:   first,
+			want:  3,
+		},
+		{
+			name:  "seen twice on a tick counts once",
+			ticks: [][]sightingKey{{first, first}, {first, first}},
+			key:   first,
+			want:  2,
+		},
+		{
+			name:  "disappearing resets the count",
+			ticks: [][]sightingKey{{first}, {other}, {first}},
+			key:   first,
+			want:  1,
+		},
+		{
+			name:  "changing statement resets the count",
+			ticks: [][]sightingKey{{first}, {first}, {next}},
+			key:   next,
+			want:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := &sightings{}
+
+			var got int
+
+			for i, tick := range tt.ticks {
+				for _, key := range tick {
+					count := s.see(key)
+					if key == tt.key && i == len(tt.ticks)-1 {
+						got = count
+					}
+				}
+
+				s.next()
+			}
+
+			if got != tt.want {
+				t.Errorf("see() = %d on the last tick, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSightings_Nil(t *testing.T) {
+	t.Parallel()
+
+	var s *sightings
+
+	if got := s.see(sightingKey{id: 1}); got != 1 {
+		t.Errorf("see() on nil sightings = %d, want 1", got)
+	}
+
+	s.next()
+}
+
+func TestKillProcesses_RequiredSightings(t *testing.T) {
+	t.Parallel()
+
+	notifier := &recordingNotifier{}
+	sniper := QuerySniper{
+		Name:              "test_sightings",
+		DryRun:            true,
+		QueryLimit:        10 * time.Second,
+		RequiredSightings: 2,
+		notifier:          notifier,
+		processSightings:  &sightings{},
+	}
+
+	process := func(id, eventID int) MysqlProcess {
+		return MysqlProcess{
+			Command:    "Query",
+			DigestText: sql.NullString{String: "SELECT SLEEP (?)", Valid: true},
+			ID:         id,
+			EventID:    eventID,
+			Time:       30,
+		}
+	}
+
+	ticks := []struct {
+		processes  []MysqlProcess
+		wantKilled int
+	}{
+		{processes: []MysqlProcess{process(1, 100), process(2, 200)}, wantKilled: 0}, // first sightings
+		{processes: []MysqlProcess{process(1, 100), process(2, 201)}, wantKilled: 1}, // 2 moved on to another statement
+		{processes: []MysqlProcess{process(2, 201)}, wantKilled: 1},
+	}
+
+	for i, tick := range ticks {
+		if killed := sniper.KillProcesses(context.Background(), tick.processes); killed != tick.wantKilled {
+			t.Errorf("tick %d: KillProcesses() killed = %d, want %d", i, killed, tick.wantKilled)
+		}
+
+		sniper.processSightings.next()
+	}
+
+	if len(notifier.events) != 2 || notifier.events[0].ProcessID != 1 || notifier.events[1].ProcessID != 2 {
+		t.Errorf("Notify() got %+v, want dry run kills of processes 1 and then 2", notifier.events)
+	}
+}
+
+func TestKillHunters_RequiredSightings(t *testing.T) {
+	t.Parallel()
+
+	user := sql.NullString{String: "app", Valid: true}
+	holder := MysqlProcess{ID: 7, Command: "Sleep", Time: 300, User: user}
+
+	tests := []struct {
+		kill func(ctx context.Context, sniper QuerySniper) int
+		next func(sniper QuerySniper)
+		name string
+	}{
+		{
+			name: "blockers",
+			kill: func(ctx context.Context, sniper QuerySniper) int {
+				return sniper.KillBlockers(ctx, []MysqlBlocker{{ID: 5, TrxID: 500, Time: 60, User: user, WaitTime: 30, Waiters: 2}})
+			},
+			next: func(sniper QuerySniper) { sniper.blockerSightings.next() },
+		},
+		{
+			name: "idle transactions",
+			kill: func(ctx context.Context, sniper QuerySniper) int {
+				return sniper.KillIdleTransactions(ctx, []MysqlIdleTransaction{
+					{MysqlTransaction: MysqlTransaction{ID: 600, ProcessID: 6, Time: 90, User: user}, IdleTime: 30},
+				})
+			},
+			next: func(sniper QuerySniper) { sniper.idleSightings.next() },
+		},
+		{
+			name: "metadata locks",
+			kill: func(ctx context.Context, sniper QuerySniper) int {
+				return sniper.KillMetadataLocks(ctx, []MysqlMetadataLock{{
+					ObjectSchema: "app",
+					ObjectName:   "users",
+					Holders:      []MysqlProcess{holder},
+					Waiter:       MysqlProcess{ID: 8, Command: "Query", Time: 30, User: user},
+				}})
+			},
+			next: func(sniper QuerySniper) { sniper.lockSightings.next() },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sniper := QuerySniper{
+				Name:                 "test_sightings",
+				DryRun:               true,
+				IdleTransactionLimit: 10 * time.Second,
+				LockWaitLimit:        10 * time.Second,
+				MetadataLockAction:   configuration.MetadataLockActionKillHolder,
+				MetadataLockLimit:    10 * time.Second,
+				RequiredSightings:    2,
+				blockerSightings:     &sightings{},
+				idleSightings:        &sightings{},
+				lockSightings:        &sightings{},
+			}
+
+			for i, want := range []int{0, 1} {
+				if killed := tt.kill(context.Background(), sniper); killed != want {
+					t.Errorf("tick %d: killed = %d, want %d", i, killed, want)
+				}
+
+				tt.next(sniper)
+			}
+		})
+	}
+}
+
+func TestWithSettings_RequiredSightings(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		configured int
+		want       int
+	}{
+		{name: "defaults to a single sighting", configured: 0, want: 1},
+		{name: "configured", configured: 3, want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			settings := managerTestSettings("primary")
+
+			config := settings.Databases["primary"]
+			config.RequiredSightings = tt.configured
+			settings.Databases["primary"] = config
+
+			tracked := &sightings{}
+
+			retuned, err := QuerySniper{Name: "primary", processSightings: tracked}.withSettings(settings)
+			if err != nil {
+				t.Fatalf("withSettings() unexpected error = %v", err)
+			}
+
+			if retuned.RequiredSightings != tt.want {
+				t.Errorf("withSettings() RequiredSightings = %d, want %d", retuned.RequiredSightings, tt.want)
+			}
+
+			// the counts have to survive a reload.
+			if retuned.processSightings != tracked {
+				t.Error("withSettings() replaced the process sightings")
+			}
+		})
+	}
+}
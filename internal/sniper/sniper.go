@@ -7,11 +7,11 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
 	"strconv"
 	"strings"
-	"sync"
 	"text/template" // nosemgrep: go.lang.security.audit.xss.import-text-template.import-text-template
 	"time"
 
@@ -19,30 +19,69 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 
 	"github.com/persona-id/query-sniper/internal/configuration"
+	"github.com/persona-id/query-sniper/internal/metrics"
+	"github.com/persona-id/query-sniper/internal/notify"
+	"github.com/persona-id/query-sniper/internal/redact"
 )
 
 // QuerySniper is a struct that represents a sniper.
 type QuerySniper struct {
-	Connection       *sql.DB
-	Name             string
-	Schema           string
-	LRQQuery         string
-	LRTXNQuery       string
-	Interval         time.Duration
-	QueryLimit       time.Duration
-	TransactionLimit time.Duration
-	DryRun           bool
+	Connection           *sql.DB
+	reloads              chan *configuration.Config // reloaded settings, applied by Loop between ticks
+	hints                *hintParser                // parses per-query timeouts; nil if query hints are disabled
+	redactor             *redact.Redactor           // redacts pl.info for the kill logs; nil unless query_text is enabled
+	tagRedactor          *redact.Redactor           // redacts the values of the query tags; nil unless query_tags is enabled
+	notifier             notify.Notifier            // receives the detections and kills; may be nil
+	auditor              notify.Notifier            // the audit sinks among the notifiers, which also receive the offenders waiting for confirmation; may be nil
+	processSightings     *sightings                 // consecutive sightings of processes over their limit; shared by the copies made by withSettings
+	txnSightings         *sightings                 // consecutive sightings of transactions over their limit; shared by the copies made by withSettings
+	blockerSightings     *sightings                 // consecutive sightings of root blockers over the lock wait limit; shared by the copies made by withSettings
+	lockSightings        *sightings                 // consecutive sightings of metadata lock sessions over their limit; shared by the copies made by withSettings
+	idleSightings        *sightings                 // consecutive sightings of idle transactions over their limit; shared by the copies made by withSettings
+	budget               *killBudget                // the kill circuit breaker; shared by the copies made by withSettings
+	leader               *leaderLock                // the leader lock, used if leaderElection is set; shared by the copies made by withSettings
+	health               *health                    // the sniper's health, read by the Manager; shared by the copies made by withSettings
+	overrides            *overrides                 // the runtime overrides set through the admin API; shared by all of the Manager's snipers
+	Name                 string
+	Schema               string
+	LRQQuery             string
+	LRTXNQuery           string
+	IdleTXNQuery         string
+	MetadataLockAction   string                        // one of the configuration.MetadataLockAction* values
+	policy               policy                        // the kill policy rules, evaluated in order
+	profiles             []profile                     // the scheduled threshold profiles, evaluated in order
+	queryTags            configuration.QueryTagsConfig // whether to parse the tags out of the comments of long running queries, and which to count
+	adaptive             configuration.AdaptiveConfig  // scales QueryLimit and TransactionLimit with the server load on every tick
+	Interval             time.Duration
+	QueryLimit           time.Duration
+	TransactionLimit     time.Duration
+	LockWaitLimit        time.Duration // kill the root blocker of a lock chain once its waiters have waited this long; disabled if 0
+	MetadataLockLimit    time.Duration // act on DDL waiting for a metadata lock this long; disabled if 0
+	IdleTransactionLimit time.Duration // kill sessions sleeping with an open transaction this long; disabled if 0
+	BreakerCooldown      time.Duration // how long the circuit breaker stays open once tripped
+	RequiredSightings    int           // consecutive ticks an offender must be seen over its limit before it's killed
+	MaxKillsPerMinute    int           // trip the circuit breaker into dry run past this many kills a minute; disabled if 0
+	DryRun               bool
+	CaptureExplain       bool // capture the plan of processes with EXPLAIN FOR CONNECTION just before killing them
+	configuredDryRun     bool // the database's own dry_run, before safe mode, for the safe mode override
+	safeMode             bool // global safe mode, which the scheduled profiles can't turn off
+	leaderElection       bool // only kill while this replica holds the leader lock
 }
 
 // MysqlProcess is a struct that represents a mysql process.
 // NB: this struct is sorted by datatype to satisfy the fieldalignment linter.
 type MysqlProcess struct {
-	Command    string         `db:"command"`        // the command being executed
-	Schema     sql.NullString `db:"current_schema"` // the database the query is running in
-	DigestText sql.NullString `db:"digest_text"`    // the digested query text (params removed)
-	User       sql.NullString `db:"user"`           // the user executing the query
-	ID         int            `db:"id"`             // the id of the query
-	Time       int            `db:"time"`           // the length of time that the query has been running
+	Tags       map[string]string // the marginalia or sqlcommenter tags from the query's comments, if query tags are enabled
+	Command    string            `db:"command"`        // the command being executed
+	Schema     sql.NullString    `db:"current_schema"` // the database the query is running in
+	DigestText sql.NullString    `db:"digest_text"`    // the digested query text (params removed)
+	User       sql.NullString    `db:"user"`           // the user executing the query
+	Host       sql.NullString    `db:"host"`           // the client host (host:port) that the query came from
+	Info       sql.NullString    `db:"info"`           // the raw query text; may contain PII, so NEVER log this without redacting it
+	ID         int               `db:"id"`             // the id of the query
+	EventID    int               `db:"event_id"`       // the id of the current statement within its thread; changes with every statement
+	Time       int               `db:"time"`           // the length of time that the query has been running
+	Timeout    time.Duration     // the query's own timeout from its hints or comments, if query hints are enabled
 }
 
 // MysqlTransaction is a struct that represents a mysql transaction.
@@ -53,6 +92,7 @@ type MysqlTransaction struct {
 	Schema     sql.NullString `db:"current_schema"` // the database the transaction is running in
 	State      sql.NullString `db:"trx_state"`      // the state of the transaction
 	User       sql.NullString `db:"user"`           // the user executing the transaction
+	Host       sql.NullString `db:"host"`           // the client host (host:port) that the transaction came from
 	ID         int            `db:"trx_id"`         // the id of the transaction
 	ProcessID  int            `db:"process_id"`     // the process that the transaction is running in
 	Time       int            `db:"time"`           // the length of time that the transaction has been running
@@ -69,10 +109,15 @@ type MysqlTransaction struct {
 //   - State NOT IN ('cleaning up') -- exclude state "cleaning up", which takes under 1ms and rarely actually appears in the processlist
 //
 // Optional filters, which are applied if defined in the generated query:
-//   - QueryTimeLimit -- the time limit for the query; queries older than this are killed
+//   - QueryTimeLimit -- the lowest time limit of the sniper and its rules; the kill path then applies
+//     the limit of the first matching rule to each process. With query hints, the statements that may
+//     carry a timeout are selected too, as their timeouts can be below that limit
 //   - DBFilter -- filter to only include a specific database
+//
+// pl.info is only selected so that FindLongRunningQueries can parse timeout hints out of it, and
+// es.event_id so that KillProcesses can tell when a process has moved on to another statement.
 const longQueryTemplate = `
-	SELECT pl.id, pl.user, pl.db as current_schema, pl.command, pl.time, es.digest_text
+	SELECT pl.id, pl.user, pl.db as current_schema, pl.command, pl.time, es.digest_text, pl.host, pl.info, es.event_id
 	FROM performance_schema.processlist pl
 	INNER JOIN performance_schema.threads t ON t.processlist_id = pl.id
 	INNER JOIN performance_schema.events_statements_current es ON es.thread_id = t.thread_id
@@ -90,10 +135,11 @@ const longQueryTemplate = `
 
 // longTXNTemplate is the template for the long running transaction hunter which is used by
 // generateHunterQueries() to generate the query used to find long running transactions
-// for the specific sniper.
+// for the specific sniper. As with longQueryTemplate, TXNTimeLimit is the lowest limit of the sniper
+// and its rules.
 // FIXME: this might be overwrought. trx.thread_id == process_id? can we just kill the thread id?
 const longTXNTemplate = `
-	SELECT trx.trx_id, pl.id as process_id, trx.trx_state, TIMESTAMPDIFF(SECOND, trx.trx_started, NOW()) AS time, pl.user, pl.db as current_schema, es.digest_text
+	SELECT trx.trx_id, pl.id as process_id, trx.trx_state, TIMESTAMPDIFF(SECOND, trx.trx_started, NOW()) AS time, pl.user, pl.db as current_schema, es.digest_text, pl.host, pl.command
 	FROM INFORMATION_SCHEMA.INNODB_TRX trx
 	INNER JOIN performance_schema.processlist pl ON trx.trx_mysql_thread_id = pl.id
 	INNER JOIN performance_schema.threads t ON t.processlist_id = pl.id
@@ -104,81 +150,112 @@ const longTXNTemplate = `
 	{{end}}
 	ORDER BY time DESC`
 
+// idleTXNTemplate is the template for the idle transaction hunter, which is used by
+// generateIdleTransactionQuery() to generate the query used to find sessions that are sleeping with an
+// open transaction. The processlist time of a sleeping session is how long it has been idle; the
+// transaction's own age is only reported. The statement is usually long finished, hence the LEFT JOIN.
+const idleTXNTemplate = `
+	SELECT trx.trx_id, pl.id as process_id, trx.trx_state, TIMESTAMPDIFF(SECOND, trx.trx_started, NOW()) AS time, pl.time AS idle_time, pl.user, pl.db as current_schema, es.digest_text, pl.host, pl.command
+	FROM INFORMATION_SCHEMA.INNODB_TRX trx
+	INNER JOIN performance_schema.processlist pl ON trx.trx_mysql_thread_id = pl.id
+	INNER JOIN performance_schema.threads t ON t.processlist_id = pl.id
+	LEFT JOIN performance_schema.events_statements_current es ON es.thread_id = t.thread_id
+	WHERE pl.command = 'Sleep'
+	AND pl.time >= {{.IdleTimeLimit}}
+	{{if .DBFilter}}
+		{{.DBFilter}}
+	{{end}}
+	ORDER BY pl.time DESC`
+
+// lockWaitQuery is the query for the lock wait hunter, which reads the InnoDB wait-for graph. Each row
+// is an edge from a session waiting on a row lock to the session holding it, with how long the waiter
+// has been waiting and the details of the blocking session. rootBlockers() then walks the graph to
+// find the sessions at the root of each chain.
+//
+// The blocking session is often idle in its transaction (command Sleep), so the LEFT JOIN gives the
+// digest of its current or last statement, if performance_schema still has it.
+const lockWaitQuery = `
+	SELECT wt.processlist_id AS waiting_id, bt.processlist_id AS blocking_id,
+		TIMESTAMPDIFF(SECOND, r.trx_wait_started, NOW()) AS wait_time,
+		TIMESTAMPDIFF(SECOND, b.trx_started, NOW()) AS time, b.trx_id AS blocking_trx_id,
+		bp.user, bp.db as current_schema, bp.command, bp.host, es.digest_text
+	FROM performance_schema.data_lock_waits w
+	INNER JOIN performance_schema.threads wt ON wt.thread_id = w.requesting_thread_id
+	INNER JOIN performance_schema.threads bt ON bt.thread_id = w.blocking_thread_id
+	INNER JOIN performance_schema.processlist bp ON bp.id = bt.processlist_id
+	INNER JOIN INFORMATION_SCHEMA.INNODB_TRX r ON r.trx_id = w.requesting_engine_transaction_id
+	INNER JOIN INFORMATION_SCHEMA.INNODB_TRX b ON b.trx_id = w.blocking_engine_transaction_id
+	LEFT JOIN performance_schema.events_statements_current es ON es.thread_id = bt.thread_id
+	WHERE r.trx_wait_started IS NOT NULL`
+
+// metadataLockQuery is the query for the metadata lock hunter. Each row is a DDL statement waiting for
+// a table metadata lock, paired with one of the sessions holding a lock on the same table, along with
+// the number of other sessions queued for that table. groupMetadataLocks() then folds the rows into
+// one MysqlMetadataLock per DDL statement.
+//
+// The waiting lock types are the ones taken by DDL (ALTER, RENAME, TRUNCATE, DROP, ...) and LOCK
+// TABLES, and the waiter's processlist time is how long it has been in the waiting state. As with
+// lockWaitQuery, the holders are often idle in a transaction, hence the LEFT JOINs for the digests.
+const metadataLockQuery = `
+	SELECT w.object_schema, w.object_name,
+		wp.id AS waiting_id, wp.user, wp.db as current_schema, wp.command, wp.time AS wait_time, wp.host, wes.digest_text,
+		hp.id AS holding_id, hp.user, hp.db as current_schema, hp.command, hp.time, hp.host, hes.digest_text,
+		(SELECT COUNT(*) FROM performance_schema.metadata_locks q
+			WHERE q.object_type = w.object_type AND q.object_schema = w.object_schema AND q.object_name = w.object_name
+			AND q.lock_status = 'PENDING' AND q.owner_thread_id != w.owner_thread_id) AS queued
+	FROM performance_schema.metadata_locks w
+	INNER JOIN performance_schema.threads wt ON wt.thread_id = w.owner_thread_id
+	INNER JOIN performance_schema.processlist wp ON wp.id = wt.processlist_id
+	INNER JOIN performance_schema.metadata_locks h ON h.object_type = w.object_type
+		AND h.object_schema = w.object_schema AND h.object_name = w.object_name
+		AND h.lock_status = 'GRANTED' AND h.owner_thread_id != w.owner_thread_id
+	INNER JOIN performance_schema.threads ht ON ht.thread_id = h.owner_thread_id
+	INNER JOIN performance_schema.processlist hp ON hp.id = ht.processlist_id
+	LEFT JOIN performance_schema.events_statements_current wes ON wes.thread_id = wt.thread_id
+	LEFT JOIN performance_schema.events_statements_current hes ON hes.thread_id = ht.thread_id
+	WHERE w.object_type = 'TABLE'
+	AND w.lock_status = 'PENDING'
+	AND w.lock_type IN ('EXCLUSIVE', 'SHARED_NO_WRITE', 'SHARED_NO_READ_WRITE')
+	AND wp.state = 'Waiting for table metadata lock'
+	ORDER BY wp.time DESC, wp.id, hp.id`
+
 // Run starts the sniper for each database in the settings. This is the main entry
 // point for the sniper process, and it is responsible for setting up all snipers
 // and then waiting for them to finish.
+//
+// Use a Manager directly when the configuration needs to be reloaded while running.
 func Run(ctx context.Context, settings *configuration.Config) {
-	var wg sync.WaitGroup
-
-	for dbName := range settings.Databases {
-		sniper, err := New(dbName, settings)
-		if err != nil {
-			slog.Error("Error in Run()",
-				slog.String("db_name", dbName),
-				slog.Any("err", err),
-			)
-
-			continue
-		}
-
-		// uses the new go 1.25 wg.Go() syntax
-		wg.Go(func() {
-			sniper.Loop(ctx)
-		})
-	}
-
-	wg.Wait()
+	NewManager(settings).Run(ctx)
 }
 
 // New creates a new sniper for the given database name and settings.
 // This is NOT the entry point for the sniper library.
 func New(name string, settings *configuration.Config) (QuerySniper, error) {
 	config := settings.Databases[name]
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/", config.Username, config.Password, config.Address, config.Port)
-
-	// Configure SSL/TLS based on provided certificates:
-	// - CA-only mode: Just ssl_ca for encrypted connections without client auth
-	// - Mutual TLS mode: All three (ssl_ca, ssl_cert, ssl_key) for mutual authentication
-	// - Invalid partial combinations (cert without CA, etc.) are ignored
-	if config.SSLCA != "" && config.SSLCert == "" && config.SSLKey == "" {
-		// CA-only mode: Basic encrypted connection
-		dsn += "?tls=true&tls_ca=" + config.SSLCA
-	} else if config.SSLCert != "" && config.SSLKey != "" && config.SSLCA != "" {
-		// Mutual TLS mode: Full mutual authentication
-		dsn += fmt.Sprintf("?tls=true&tls_cert=%s&tls_key=%s&tls_ca=%s", config.SSLCert, config.SSLKey, config.SSLCA)
-	}
 
-	db, err := sql.Open("mysql", dsn)
+	db, err := sql.Open("mysql", buildDSN(settings, name))
 	if err != nil {
 		return QuerySniper{}, fmt.Errorf("error opening database: %w", err)
 	}
 
-	// Global safe-mode overrides any per-database dry_run setting
-	// In other words, if settings.SafeMode is true, and a
-	// given sniper.Config.DryRun is set to false,
-	// the sniper will log and NOT kill queries.
-	dryRun := config.DryRun || settings.SafeMode
-
 	sniper := QuerySniper{
 		Connection:       db,
-		DryRun:           dryRun,
-		Interval:         config.Interval,
-		LRQQuery:         "",
-		LRTXNQuery:       "",
 		Name:             name,
-		QueryLimit:       config.LongQueryLimit,
-		Schema:           config.Schema,
-		TransactionLimit: config.LongTransactionLimit,
+		blockerSightings: &sightings{},
+		budget:           newKillBudget(),
+		idleSightings:    &sightings{},
+		leader:           newLeaderLock(configuration.LeaderLockName(name)),
+		lockSightings:    &sightings{},
+		processSightings: &sightings{},
+		reloads:          make(chan *configuration.Config, 1),
+		txnSightings:     &sightings{},
 	}
 
-	query, txn, err := sniper.generateHunterQueries()
+	sniper, err = sniper.withSettings(settings)
 	if err != nil {
-		return QuerySniper{}, fmt.Errorf("error generating hunter queries: %w", err)
+		return QuerySniper{}, err
 	}
 
-	sniper.LRQQuery = query
-	sniper.LRTXNQuery = txn
-
 	slog.Info("Created new sniper: "+sniper.Name,
 		slog.String("name", sniper.Name),
 		slog.String("address", config.Address),
@@ -188,8 +265,21 @@ func New(name string, settings *configuration.Config) (QuerySniper, error) {
 		slog.Duration("interval", sniper.Interval),
 		slog.Duration("query_limit", sniper.QueryLimit),
 		slog.Duration("transaction_limit", sniper.TransactionLimit),
+		slog.Duration("lock_wait_limit", sniper.LockWaitLimit),
+		slog.Duration("idle_transaction_limit", sniper.IdleTransactionLimit),
+		slog.Duration("metadata_lock_limit", sniper.MetadataLockLimit),
+		slog.String("metadata_lock_action", sniper.MetadataLockAction),
+		slog.Int("required_sightings", sniper.RequiredSightings),
+		slog.Int("max_kills_per_minute", sniper.MaxKillsPerMinute),
+		slog.Bool("adaptive", sniper.adaptive.Enabled),
+		slog.Int("schedules", len(sniper.profiles)),
 		slog.Bool("dry_run", sniper.DryRun),
+		slog.Bool("capture_explain", sniper.CaptureExplain),
+		slog.Bool("query_text", sniper.redactor != nil),
+		slog.Bool("query_tags", sniper.queryTags.Enabled),
 		slog.Bool("safe_mode_active", settings.SafeMode),
+		slog.Bool("leader_election", sniper.leaderElection),
+		slog.Int("rules", len(sniper.policy)),
 	)
 
 	// log the queries that will be run by the snipers to DEBUG. this should clean up the logs in normal mode.
@@ -198,16 +288,124 @@ func New(name string, settings *configuration.Config) (QuerySniper, error) {
 		slog.Group("queries",
 			slog.String("long_query", sniper.LRQQuery),
 			slog.String("long_transaction", sniper.LRTXNQuery),
+			slog.String("idle_transaction", sniper.IdleTXNQuery),
 		),
 	)
 
 	return sniper, nil
 }
 
+// buildDSN builds the mysql DSN for the named database in settings.
+func buildDSN(settings *configuration.Config, name string) string {
+	return settings.Databases[name].DSN()
+}
+
+// withSettings returns a copy of the sniper with the tunable settings (interval, limits, schema
+// and dry_run) taken from the sniper's entry in settings, and the hunter queries regenerated to
+// match. The connection is left untouched.
+func (sniper QuerySniper) withSettings(settings *configuration.Config) (QuerySniper, error) {
+	config := settings.Databases[sniper.Name]
+
+	// Global safe-mode overrides any per-database dry_run setting
+	// In other words, if settings.SafeMode is true, and a
+	// given sniper.Config.DryRun is set to false,
+	// the sniper will log and NOT kill queries.
+	sniper.DryRun = config.DryRun || settings.SafeMode
+	sniper.configuredDryRun = config.DryRun
+	sniper.safeMode = settings.SafeMode
+	sniper.leaderElection = settings.LeaderElection
+	sniper.Interval = config.Interval
+	sniper.QueryLimit = config.LongQueryLimit
+	sniper.Schema = config.Schema
+	sniper.TransactionLimit = config.LongTransactionLimit
+	sniper.LockWaitLimit = config.LockWaitLimit
+	sniper.RequiredSightings = max(config.RequiredSightings, 1)
+	sniper.MaxKillsPerMinute = config.MaxKillsPerMinute
+	sniper.BreakerCooldown = config.BreakerCooldown
+	sniper.CaptureExplain = config.CaptureExplain
+
+	if sniper.BreakerCooldown == 0 {
+		sniper.BreakerCooldown = DefaultBreakerCooldown
+	}
+
+	sniper.adaptive = adaptiveSettings(config.Adaptive)
+	sniper.IdleTransactionLimit = config.IdleTransactionLimit
+	sniper.MetadataLockLimit = config.MetadataLockLimit
+	sniper.MetadataLockAction = config.MetadataLockAction
+
+	if sniper.MetadataLockAction == "" {
+		sniper.MetadataLockAction = configuration.MetadataLockActionKillWaiter
+	}
+
+	rules, err := newPolicy(config.Rules)
+	if err != nil {
+		return QuerySniper{}, fmt.Errorf("error compiling rules: %w", err)
+	}
+
+	sniper.policy = rules
+
+	profiles, err := newProfiles(config.Schedules)
+	if err != nil {
+		return QuerySniper{}, fmt.Errorf("error parsing schedules: %w", err)
+	}
+
+	sniper.profiles = profiles
+	sniper.hints = nil
+
+	if config.QueryHints.Enabled {
+		sniper.hints = newHintParser(config.QueryHints.CommentKey, config.QueryHints.MaxLimit)
+	}
+
+	sniper.queryTags = settings.QueryTags
+	sniper.tagRedactor = nil
+
+	// the tags are redacted with the query_text patterns and columns, even if query_text itself is off.
+	if settings.QueryTags.Enabled {
+		sniper.tagRedactor, err = redact.New(settings.QueryText.RedactColumns, settings.QueryText.RedactPatterns, 0)
+		if err != nil {
+			return QuerySniper{}, fmt.Errorf("error compiling query tags redaction: %w", err)
+		}
+	}
+
+	sniper.redactor = nil
+
+	if settings.QueryText.Enabled {
+		sniper.redactor, err = redact.New(settings.QueryText.RedactColumns, settings.QueryText.RedactPatterns, settings.QueryText.MaxLength)
+		if err != nil {
+			return QuerySniper{}, fmt.Errorf("error compiling query text redaction: %w", err)
+		}
+	}
+
+	query, txn, err := sniper.generateHunterQueries()
+	if err != nil {
+		return QuerySniper{}, fmt.Errorf("error generating hunter queries: %w", err)
+	}
+
+	sniper.LRQQuery = query
+	sniper.LRTXNQuery = txn
+
+	idle, err := sniper.generateIdleTransactionQuery()
+	if err != nil {
+		return QuerySniper{}, fmt.Errorf("error generating idle transaction query: %w", err)
+	}
+
+	sniper.IdleTXNQuery = idle
+
+	return sniper, nil
+}
+
 // Loop is the main loop for the sniper. It will find all long running queries and kill them.
 func (sniper QuerySniper) Loop(ctx context.Context) {
 	ticker := time.NewTicker(sniper.Interval)
 
+	scale := 1.0                           // the adaptive scale of the last tick
+	active := configuration.DefaultProfile // the scheduled profile of the last tick
+	leading := false                       // whether this replica was the leader on the last tick
+
+	var state supervision
+
+	sniper.health.configured(sniper)
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -215,46 +413,228 @@ func (sniper QuerySniper) Loop(ctx context.Context) {
 
 			ticker.Stop()
 
+			// hand the leadership over to another replica right away.
+			sniper.leader.release()
+
 			return
 
-		case <-ticker.C:
-			// search for long running transactions
-			txns, err := sniper.FindLongRunningTransactions(ctx)
+		case settings := <-sniper.reloads:
+			// the reload is applied here, between ticks, so the sniper's settings are never
+			// changed while a hunt is in progress.
+			retuned, err := sniper.withSettings(settings)
 			if err != nil {
-				slog.Error("Error in FindLongRunningTransactions()",
+				slog.Error("Error reloading sniper, keeping the current settings",
 					slog.String("db", sniper.Name),
-					slog.String("query", sniper.LRTXNQuery),
 					slog.Any("err", err),
 				)
 
 				continue
 			}
 
-			if len(txns) > 0 {
-				sniper.KillTransactions(ctx, txns)
+			sniper = retuned
+
+			ticker.Reset(sniper.Interval)
+
+			if !sniper.leaderElection {
+				sniper.leader.release()
+
+				leading = false
 			}
 
-			// search for long running queries
-			queries, err := sniper.FindLongRunningQueries(ctx)
-			if err != nil {
-				slog.Error("Error in FindLongRunningQueries()",
-					slog.String("db", sniper.Name),
-					slog.String("query", sniper.LRQQuery),
-					slog.Any("err", err),
-				)
+			// a reload is the operator's way to close a tripped circuit breaker early.
+			if sniper.budget.reset() {
+				metrics.CircuitBreakerOpen.WithLabelValues(sniper.Name).Set(0)
+
+				slog.Warn("Kill circuit breaker reset by configuration reload on "+sniper.Name, slog.String("db", sniper.Name))
+			}
 
+			slog.Info("Reloaded sniper: "+sniper.Name,
+				slog.String("name", sniper.Name),
+				slog.String("schema", sniper.Schema),
+				slog.Duration("interval", sniper.Interval),
+				slog.Duration("query_limit", sniper.QueryLimit),
+				slog.Duration("transaction_limit", sniper.TransactionLimit),
+				slog.Duration("lock_wait_limit", sniper.LockWaitLimit),
+				slog.Duration("idle_transaction_limit", sniper.IdleTransactionLimit),
+				slog.Duration("metadata_lock_limit", sniper.MetadataLockLimit),
+				slog.String("metadata_lock_action", sniper.MetadataLockAction),
+				slog.Int("required_sightings", sniper.RequiredSightings),
+				slog.Int("max_kills_per_minute", sniper.MaxKillsPerMinute),
+				slog.Bool("adaptive", sniper.adaptive.Enabled),
+				slog.Int("schedules", len(sniper.profiles)),
+				slog.Bool("dry_run", sniper.DryRun),
+				slog.Bool("safe_mode_active", settings.SafeMode),
+				slog.Bool("leader_election", sniper.leaderElection),
+			)
+
+		case <-ticker.C:
+			// a sniper paused through the admin API doesn't even ping its database.
+			if sniper.paused() {
 				continue
 			}
 
-			if len(queries) > 0 {
-				sniper.KillProcesses(ctx, queries)
+			// while the database is down, skip the ticks until the backoff has passed.
+			if !sniper.reachable(ctx, &state) {
+				continue
+			}
+
+			sniper.resetBreaker()
+			sniper.closeBreaker()
+
+			// a scheduled profile replaces the database's settings while its window is open, and with
+			// adaptive thresholds, this tick hunts with the limits scaled for the server's load. The
+			// runtime overrides win over both, but not over safe mode.
+			hunter := sniper.withSafeMode()
+			if len(hunter.profiles) > 0 {
+				hunter, active = hunter.scheduled(time.Now(), active)
+			}
+
+			if hunter.adaptive.Enabled {
+				hunter, scale = hunter.adapt(ctx, scale)
 			}
+
+			hunter = hunter.withDryRun()
+
+			// with leader election, a follower hunts in observe-only mode, whatever its profile says.
+			if hunter.leaderElection {
+				hunter, leading = hunter.elect(ctx, leading)
+			}
+
+			err := hunter.hunt(ctx)
+
+			sniper.health.ticked(hunter, err)
+			sniper.checked(ctx, &state, err)
+		}
+	}
+}
+
+// hunt runs the hunters once, and kills (or logs) what they find. The hunters' errors are logged as
+// they happen, and returned together for the sniper's health.
+func (sniper QuerySniper) hunt(ctx context.Context) error {
+	var (
+		errs      []error
+		offenders []Offender
+	)
+
+	// a hunter that fails leaves its offenders out of the state dump, rather than the last tick's.
+	defer func() { sniper.health.spotted(offenders) }()
+
+	// search for lock chains first; the long running queries and transactions are often just
+	// waiting on the root blocker, so killing it may leave nothing else to kill.
+	if sniper.LockWaitLimit > 0 {
+		blockers, err := sniper.FindBlockers(ctx)
+		if err != nil {
+			// don't skip the other hunters; this is usually missing performance_schema grants.
+			slog.Error("Error in FindBlockers()",
+				slog.String("db", sniper.Name),
+				slog.Any("err", err),
+			)
+
+			errs = append(errs, err)
+		} else if len(blockers) > 0 {
+			offenders = append(offenders, blockerOffenders(blockers)...)
+
+			sniper.health.killed(metrics.KindBlocker, sniper.KillBlockers(ctx, blockers))
+		}
+
+		sniper.blockerSightings.next()
+	}
+
+	// then for DDL stuck behind a metadata lock, which every new query on the table queues behind.
+	if sniper.MetadataLockLimit > 0 {
+		locks, err := sniper.FindMetadataLocks(ctx)
+		if err != nil {
+			slog.Error("Error in FindMetadataLocks()",
+				slog.String("db", sniper.Name),
+				slog.Any("err", err),
+			)
+
+			errs = append(errs, err)
+		} else if len(locks) > 0 {
+			offenders = append(offenders, metadataLockOffenders(locks)...)
+
+			sniper.health.killed(metrics.KindMetadataLock, sniper.KillMetadataLocks(ctx, locks))
 		}
+
+		sniper.lockSightings.next()
+	}
+
+	// search for idle transactions before the long running ones, so that they're reported as idle
+	// rather than waiting for the (usually much longer) transaction limit.
+	var idle []MysqlIdleTransaction
+
+	if sniper.IdleTransactionLimit > 0 {
+		var err error
+
+		idle, err = sniper.FindIdleTransactions(ctx)
+		if err != nil {
+			slog.Error("Error in FindIdleTransactions()",
+				slog.String("db", sniper.Name),
+				slog.String("query", sniper.IdleTXNQuery),
+				slog.Any("err", err),
+			)
+
+			errs = append(errs, err)
+		} else if len(idle) > 0 {
+			offenders = append(offenders, idleTransactionOffenders(idle)...)
+
+			sniper.health.killed(metrics.KindIdleTransaction, sniper.KillIdleTransactions(ctx, idle))
+		}
+
+		sniper.idleSightings.next()
+	}
+
+	// search for long running transactions
+	txns, err := sniper.FindLongRunningTransactions(ctx)
+	if err != nil {
+		slog.Error("Error in FindLongRunningTransactions()",
+			slog.String("db", sniper.Name),
+			slog.String("query", sniper.LRTXNQuery),
+			slog.Any("err", err),
+		)
+
+		return errors.Join(append(errs, err)...)
+	}
+
+	// sessions the idle hunter already dealt with on this tick, killed or not, aren't hunted twice.
+	txns = withoutIdle(txns, idle)
+
+	if len(txns) > 0 {
+		offenders = append(offenders, transactionOffenders(txns)...)
+
+		sniper.health.killed(metrics.KindTransaction, sniper.KillTransactions(ctx, txns))
+	}
+
+	// transactions that weren't seen over their limit on this tick start over on the next one.
+	sniper.txnSightings.next()
+
+	// search for long running queries
+	queries, err := sniper.FindLongRunningQueries(ctx)
+	if err != nil {
+		slog.Error("Error in FindLongRunningQueries()",
+			slog.String("db", sniper.Name),
+			slog.String("query", sniper.LRQQuery),
+			slog.Any("err", err),
+		)
+
+		return errors.Join(append(errs, err)...)
 	}
+
+	if len(queries) > 0 {
+		offenders = append(offenders, processOffenders(queries)...)
+
+		sniper.health.killed(metrics.KindProcess, sniper.KillProcesses(ctx, queries))
+	}
+
+	sniper.processSightings.next()
+
+	return errors.Join(errs...)
 }
 
 // FindLongRunningQueries finds all long running queries in the database.
 func (sniper QuerySniper) FindLongRunningQueries(ctx context.Context) ([]MysqlProcess, error) {
+	defer metrics.ObserveHunter(sniper.Name, metrics.HunterQueries, time.Now())
+
 	rows, err := sniper.Connection.QueryContext(ctx, sniper.LRQQuery)
 	if err != nil {
 		return nil, fmt.Errorf("error getting long running queries: %w", err)
@@ -266,11 +646,24 @@ func (sniper QuerySniper) FindLongRunningQueries(ctx context.Context) ([]MysqlPr
 	for rows.Next() {
 		var process MysqlProcess
 
-		err = rows.Scan(&process.ID, &process.User, &process.Schema, &process.Command, &process.Time, &process.DigestText)
+		err = rows.Scan(&process.ID, &process.User, &process.Schema, &process.Command, &process.Time, &process.DigestText, &process.Host, &process.Info, &process.EventID)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning row: %w", err)
 		}
 
+		if sniper.hints != nil {
+			process.Timeout = sniper.hints.timeout(process.Info.String)
+
+			// selected for a timeout that it doesn't have, or hasn't reached.
+			if sniper.belowHuntingLimit(process) {
+				continue
+			}
+		}
+
+		if sniper.queryTags.Enabled {
+			process.Tags = sniper.redactTags(parseQueryTags(process.Info.String))
+		}
+
 		processes = append(processes, process)
 	}
 
@@ -282,8 +675,21 @@ func (sniper QuerySniper) FindLongRunningQueries(ctx context.Context) ([]MysqlPr
 	return processes, nil
 }
 
+// belowHuntingLimit reports whether the process was only selected by the hunter query because it may
+// carry a timeout, and is below both its own timeout and the lowest limit of the sniper and its rules.
+func (sniper QuerySniper) belowHuntingLimit(process MysqlProcess) bool {
+	limit := sniper.policy.minQueryLimit(sniper.QueryLimit)
+	if process.Timeout > 0 {
+		limit = min(limit, process.Timeout)
+	}
+
+	return process.Time < int(limit.Seconds())
+}
+
 // FindLongRunningTransactions finds long running transactions based on the configured transaction limit.
 func (sniper QuerySniper) FindLongRunningTransactions(ctx context.Context) ([]MysqlTransaction, error) {
+	defer metrics.ObserveHunter(sniper.Name, metrics.HunterTransactions, time.Now())
+
 	rows, err := sniper.Connection.QueryContext(ctx, sniper.LRTXNQuery)
 	if err != nil {
 		return nil, fmt.Errorf("error getting long running transactions: %w", err)
@@ -295,7 +701,7 @@ func (sniper QuerySniper) FindLongRunningTransactions(ctx context.Context) ([]My
 	for rows.Next() {
 		var transaction MysqlTransaction
 
-		err = rows.Scan(&transaction.ID, &transaction.ProcessID, &transaction.State, &transaction.Time, &transaction.User, &transaction.Schema, &transaction.DigestText)
+		err = rows.Scan(&transaction.ID, &transaction.ProcessID, &transaction.State, &transaction.Time, &transaction.User, &transaction.Schema, &transaction.DigestText, &transaction.Host, &transaction.Command)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning row: %w", err)
 		}
@@ -313,7 +719,8 @@ func (sniper QuerySniper) FindLongRunningTransactions(ctx context.Context) ([]My
 
 // KillProcesses kills the given processes, or logs them if running in dry run or safe mode.
 func (sniper QuerySniper) KillProcesses(ctx context.Context, processes []MysqlProcess) int {
-	killed := 0
+	k := sniper.newKiller(metrics.KindProcess, "mysql process", "Long running mysql process",
+		sniper.processSightings, metrics.ProcessesDetected, metrics.ProcessesKilled)
 
 	for _, process := range processes {
 		if process.ID <= 0 {
@@ -321,113 +728,134 @@ func (sniper QuerySniper) KillProcesses(ctx context.Context, processes []MysqlPr
 			continue
 		}
 
-		// if sniper is configured to be dry run (or if safe mode is active), only log what would be killed
-		if sniper.DryRun {
-			slog.Info("DRY RUN - Would kill mysql process on "+sniper.Name,
-				slog.String("db", sniper.Name),
-				slog.String("user", process.User.String),
-				slog.Bool("dry_run", sniper.DryRun),
-				slog.Int("time", process.Time),
-				slog.Int("process_id", process.ID),
-				slog.String("command", process.Command),
-				slog.String("schema", process.Schema.String),
-				slog.String("digest_text", process.DigestText.String),
-			)
-
-			killed++
-
-			continue
-		}
-
-		killQuery := fmt.Sprintf("KILL %d", process.ID)
+		verdict := sniper.evaluateProcess(process)
+		tags, traceID := tagsAttrs(process.Tags)
 
-		_, err := sniper.Connection.ExecContext(ctx, killQuery)
-		if err != nil {
-			// we log here, rather than returning err, because we don't want to stop processing all of the other queries.
-			slog.Error("Error killing mysql process",
-				slog.String("db", sniper.Name),
+		// using digest_text instead of raw query info to avoid logging PII
+		k.kill(ctx, killTarget{
+			attrs: []any{
 				slog.String("user", process.User.String),
-				slog.Bool("dry_run", sniper.DryRun),
 				slog.Int("time", process.Time),
 				slog.Int("process_id", process.ID),
 				slog.String("command", process.Command),
 				slog.String("schema", process.Schema.String),
 				slog.String("digest_text", process.DigestText.String),
-				slog.Any("err", err),
-			)
-
-			continue
-		}
-
-		// using digest_text instead of raw query info to avoid logging PII
-		slog.Info("Killed mysql process on "+sniper.Name,
-			slog.String("db", sniper.Name),
-			slog.String("user", process.User.String),
-			slog.Bool("dry_run", sniper.DryRun),
-			slog.Int("time", process.Time),
-			slog.Int("process_id", process.ID),
-			slog.String("command", process.Command),
-			slog.String("schema", process.Schema.String),
-			slog.String("digest_text", process.DigestText.String),
-		)
-
-		killed++
+				sniper.queryTextAttr(process),
+				tags, traceID,
+			},
+			elapsed:   process.Time,
+			event:     processEvent(process, verdict),
+			explain:   true,
+			key:       sightingKey{id: process.ID, statement: process.EventID},
+			onKill:    func(sniper QuerySniper) { sniper.countTags(process) },
+			statement: verdict.killStatement(process.ID, "KILL %d"),
+			verdict:   verdict,
+		})
 	}
 
-	return killed
+	return k.done(ctx)
 }
 
 // KillTransactions kills the given transactions, or logs them if running in dry run or safe mode.
 func (sniper QuerySniper) KillTransactions(ctx context.Context, transactions []MysqlTransaction) int {
-	killed := 0
+	k := sniper.newKiller(metrics.KindTransaction, "mysql transaction", "Long running mysql transaction",
+		sniper.txnSightings, metrics.TransactionsDetected, metrics.TransactionsKilled)
 
 	for _, transaction := range transactions {
 		if transaction.ID <= 0 {
 			continue
 		}
 
-		// if sniper is configured to be dry run (or if safe mode is active), only log what would be killed
-		if sniper.DryRun {
-			slog.Info("DRY RUN - Would kill mysql transaction on "+sniper.Name,
-				slog.String("db", sniper.Name),
+		verdict := sniper.evaluateTransaction(transaction)
+
+		k.kill(ctx, killTarget{
+			attrs: []any{
 				slog.String("user", transaction.User.String),
-				slog.Bool("dry_run", sniper.DryRun),
 				slog.Int("time", transaction.Time),
 				slog.Int("transaction_id", transaction.ID),
+				slog.Int("process_id", transaction.ProcessID),
 				slog.String("command", transaction.Command),
 				slog.String("schema", transaction.Schema.String),
 				slog.String("digest_text", transaction.DigestText.String),
-			)
+			},
+			elapsed:   transaction.Time,
+			event:     transactionEvent(transaction, verdict),
+			key:       sightingKey{id: transaction.ProcessID, statement: transaction.ID},
+			statement: verdict.killStatement(transaction.ProcessID, "KILL CONNECTION %d"),
+			verdict:   verdict,
+		})
+	}
 
-			killed++
+	return k.done(ctx)
+}
 
-			continue
-		}
+// processEvent returns the notification event for a process, for a killer to fill in.
+func processEvent(process MysqlProcess, verdict policyVerdict) notify.Event {
+	return notify.Event{
+		Action:     verdict.actionOr(configuration.RuleActionKillConnection),
+		Command:    process.Command,
+		DigestText: process.DigestText.String,
+		Kind:       notify.KindProcess,
+		ProcessID:  process.ID,
+		Rule:       verdict.rule,
+		Runtime:    time.Duration(process.Time) * time.Second,
+		Schema:     process.Schema.String,
+		Tags:       process.Tags,
+		User:       process.User.String,
+	}
+}
 
-		killQuery := fmt.Sprintf("KILL CONNECTION %d", transaction.ProcessID)
+// queryTextAttr returns the log attribute for the process's redacted query text, or an empty attribute,
+// which slog drops, if query_text isn't enabled.
+func (sniper QuerySniper) queryTextAttr(process MysqlProcess) slog.Attr {
+	if sniper.redactor == nil || !process.Info.Valid {
+		return slog.Attr{}
+	}
 
-		_, err := sniper.Connection.ExecContext(ctx, killQuery)
-		if err != nil {
-			slog.Error("Failed to kill transaction",
-				slog.String("db", sniper.Name),
-				slog.Int("trx_id", transaction.ID),
-				slog.Int("process_id", transaction.ProcessID),
-				slog.Any("err", err),
-			)
+	return slog.String("query_text", sniper.redactor.Redact(process.Info.String))
+}
 
-			continue
-		}
+// transactionEvent returns the notification event for a transaction, for a killer to fill in.
+func transactionEvent(transaction MysqlTransaction, verdict policyVerdict) notify.Event {
+	return notify.Event{
+		Action:        verdict.actionOr(configuration.RuleActionKillConnection),
+		Command:       transaction.Command,
+		DigestText:    transaction.DigestText.String,
+		Kind:          notify.KindTransaction,
+		ProcessID:     transaction.ProcessID,
+		Rule:          verdict.rule,
+		Runtime:       time.Duration(transaction.Time) * time.Second,
+		Schema:        transaction.Schema.String,
+		TransactionID: transaction.ID,
+		User:          transaction.User.String,
+	}
+}
 
-		slog.Info("Killed transaction",
-			slog.String("db", sniper.Name),
-			slog.Int("trx_id", transaction.ID),
-			slog.Int("process_id", transaction.ProcessID),
-		)
+// notify hands the events to the sniper's notifier, if it has one.
+func (sniper QuerySniper) notify(ctx context.Context, events []notify.Event) {
+	sniper.send(ctx, sniper.notifier, events)
+}
+
+// audit hands the events to the sniper's audit sinks only, if it has any.
+func (sniper QuerySniper) audit(ctx context.Context, events []notify.Event) {
+	sniper.send(ctx, sniper.auditor, events)
+}
 
-		killed++
+// send hands the events to the notifier, if there is one. Errors are logged rather than returned,
+// because a notification failure must never stop the sniper.
+func (sniper QuerySniper) send(ctx context.Context, notifier notify.Notifier, events []notify.Event) {
+	if notifier == nil || len(events) == 0 {
+		return
 	}
 
-	return killed
+	err := notifier.Notify(ctx, events)
+	if err != nil {
+		slog.Error("Error sending notifications",
+			slog.String("db", sniper.Name),
+			slog.Int("events", len(events)),
+			slog.Any("err", err),
+		)
+	}
 }
 
 // generateHunterQueries generates the query used to find long running queries
@@ -453,8 +881,13 @@ func (sniper QuerySniper) generateHunterQueries() (string, string, error) {
 	}
 
 	params := QueryParams{
-		QueryTimeLimit: fmt.Sprintf("AND pl.time >= %d", int(sniper.QueryLimit.Seconds())),
-		TXNTimeLimit:   strconv.Itoa(int(sniper.TransactionLimit.Seconds())),
+		QueryTimeLimit: fmt.Sprintf("AND pl.time >= %d", int(sniper.policy.minQueryLimit(sniper.QueryLimit).Seconds())),
+		TXNTimeLimit:   strconv.Itoa(int(sniper.policy.minTransactionLimit(sniper.TransactionLimit).Seconds())),
+	}
+
+	if sniper.hints != nil {
+		params.QueryTimeLimit = fmt.Sprintf("AND (pl.time >= %d OR %s)",
+			int(sniper.policy.minQueryLimit(sniper.QueryLimit).Seconds()), sniper.hints.filter())
 	}
 
 	if sniper.Schema != "" {
@@ -486,3 +919,33 @@ func (sniper QuerySniper) generateHunterQueries() (string, string, error) {
 
 	return query, txn, nil
 }
+
+// generateIdleTransactionQuery generates the query used to find idle transactions for the specific
+// sniper from the idleTXNTemplate template.
+func (sniper QuerySniper) generateIdleTransactionQuery() (string, error) {
+	tmpl := template.Must(
+		template.New("idle transaction hunter").Parse(idleTXNTemplate),
+	)
+
+	type QueryParams struct {
+		DBFilter      string
+		IdleTimeLimit string
+	}
+
+	params := QueryParams{
+		IdleTimeLimit: strconv.Itoa(int(sniper.IdleTransactionLimit.Seconds())),
+	}
+
+	if sniper.Schema != "" {
+		params.DBFilter = fmt.Sprintf("AND pl.db IN ('%s')", sniper.Schema)
+	}
+
+	var queryBytes bytes.Buffer
+
+	err := tmpl.Execute(&queryBytes, params)
+	if err != nil {
+		return "", fmt.Errorf("error executing template: %w", err)
+	}
+
+	return strings.Join(strings.Fields(queryBytes.String()), " "), nil
+}
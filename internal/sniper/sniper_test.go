@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"log/slog"
 	"strings"
 	"testing"
 	"testing/synctest"
@@ -12,6 +13,7 @@ import (
 	"go.uber.org/goleak"
 
 	"github.com/persona-id/query-sniper/internal/configuration"
+	"github.com/persona-id/query-sniper/internal/redact"
 )
 
 func TestGenerateHunterQueries(t *testing.T) {
@@ -183,20 +185,7 @@ func TestCreateSniper(t *testing.T) {
 			dbName: "test_db",
 			settings: &configuration.Config{
 				SafeMode: false,
-				Databases: map[string]struct {
-					Address              string        `mapstructure:"address"`
-					Schema               string        `mapstructure:"schema"`
-					SSLCert              string        `mapstructure:"ssl_cert"`
-					SSLKey               string        `mapstructure:"ssl_key"`
-					SSLCA                string        `mapstructure:"ssl_ca"`
-					Username             string        `mapstructure:"username"`
-					Password             string        `mapstructure:"password"`
-					Interval             time.Duration `mapstructure:"interval"`
-					LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-					LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-					Port                 int           `mapstructure:"port"`
-					DryRun               bool          `mapstructure:"dry_run"`
-				}{
+				Databases: map[string]configuration.DatabaseConfig{
 					"test_db": {
 						Address:              "127.0.0.1",
 						Port:                 3306,
@@ -217,20 +206,7 @@ func TestCreateSniper(t *testing.T) {
 			dbName: "analytics",
 			settings: &configuration.Config{
 				SafeMode: false,
-				Databases: map[string]struct {
-					Address              string        `mapstructure:"address"`
-					Schema               string        `mapstructure:"schema"`
-					SSLCert              string        `mapstructure:"ssl_cert"`
-					SSLKey               string        `mapstructure:"ssl_key"`
-					SSLCA                string        `mapstructure:"ssl_ca"`
-					Username             string        `mapstructure:"username"`
-					Password             string        `mapstructure:"password"`
-					Interval             time.Duration `mapstructure:"interval"`
-					LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-					LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-					Port                 int           `mapstructure:"port"`
-					DryRun               bool          `mapstructure:"dry_run"`
-				}{
+				Databases: map[string]configuration.DatabaseConfig{
 					"analytics": {
 						Address:              "db.example.com",
 						Port:                 3306,
@@ -366,20 +342,7 @@ func TestCreateSniper_SafeModeOverride(t *testing.T) {
 
 			settings := &configuration.Config{
 				SafeMode: tt.safeModeGlobal,
-				Databases: map[string]struct {
-					Address              string        `mapstructure:"address"`
-					Schema               string        `mapstructure:"schema"`
-					SSLCert              string        `mapstructure:"ssl_cert"`
-					SSLKey               string        `mapstructure:"ssl_key"`
-					SSLCA                string        `mapstructure:"ssl_ca"`
-					Username             string        `mapstructure:"username"`
-					Password             string        `mapstructure:"password"`
-					Interval             time.Duration `mapstructure:"interval"`
-					LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-					LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-					Port                 int           `mapstructure:"port"`
-					DryRun               bool          `mapstructure:"dry_run"`
-				}{
+				Databases: map[string]configuration.DatabaseConfig{
 					"test_db": {
 						Address:              "127.0.0.1",
 						Port:                 3306,
@@ -423,20 +386,7 @@ func TestCreateSniper_NonExistentDatabase(t *testing.T) {
 
 	settings := &configuration.Config{
 		SafeMode: false,
-		Databases: map[string]struct {
-			Address              string        `mapstructure:"address"`
-			Schema               string        `mapstructure:"schema"`
-			SSLCert              string        `mapstructure:"ssl_cert"`
-			SSLKey               string        `mapstructure:"ssl_key"`
-			SSLCA                string        `mapstructure:"ssl_ca"`
-			Username             string        `mapstructure:"username"`
-			Password             string        `mapstructure:"password"`
-			Interval             time.Duration `mapstructure:"interval"`
-			LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-			LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-			Port                 int           `mapstructure:"port"`
-			DryRun               bool          `mapstructure:"dry_run"`
-		}{
+		Databases: map[string]configuration.DatabaseConfig{
 			"existing_db": {
 				Address:              "127.0.0.1",
 				Port:                 3306,
@@ -566,20 +516,7 @@ func TestNew_SSLConfiguration(t *testing.T) {
 
 			settings := &configuration.Config{
 				SafeMode: false,
-				Databases: map[string]struct {
-					Address              string        `mapstructure:"address"`
-					Schema               string        `mapstructure:"schema"`
-					SSLCert              string        `mapstructure:"ssl_cert"`
-					SSLKey               string        `mapstructure:"ssl_key"`
-					SSLCA                string        `mapstructure:"ssl_ca"`
-					Username             string        `mapstructure:"username"`
-					Password             string        `mapstructure:"password"`
-					Interval             time.Duration `mapstructure:"interval"`
-					LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-					LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-					Port                 int           `mapstructure:"port"`
-					DryRun               bool          `mapstructure:"dry_run"`
-				}{
+				Databases: map[string]configuration.DatabaseConfig{
 					"ssl_test_db": {
 						Address:              "127.0.0.1",
 						Port:                 3306,
@@ -796,6 +733,36 @@ func TestKillProcesses_DryRunLogging(t *testing.T) {
 	}
 }
 
+func TestQueryTextAttr(t *testing.T) {
+	t.Parallel()
+
+	process := MysqlProcess{
+		ID:   7,
+		Info: sql.NullString{String: "SELECT * FROM users WHERE email = 'jane@example.com' AND ssn = '123-45-6789'", Valid: true},
+	}
+
+	// without query_text, the raw text is never logged.
+	if attr := (QuerySniper{}).queryTextAttr(process); !attr.Equal(slog.Attr{}) {
+		t.Errorf("queryTextAttr() = %v, want an empty attribute with query_text off", attr)
+	}
+
+	redactor, err := redact.New([]string{"ssn"}, nil, 0)
+	if err != nil {
+		t.Fatalf("redact.New() unexpected error = %v", err)
+	}
+
+	sniper := QuerySniper{redactor: redactor}
+
+	want := slog.String("query_text", "SELECT * FROM users WHERE email = ? AND ssn = [REDACTED]")
+	if attr := sniper.queryTextAttr(process); !attr.Equal(want) {
+		t.Errorf("queryTextAttr() = %v, want %v", attr, want)
+	}
+
+	if attr := sniper.queryTextAttr(MysqlProcess{ID: 8}); !attr.Equal(slog.Attr{}) {
+		t.Errorf("queryTextAttr() = %v, want an empty attribute without pl.info", attr)
+	}
+}
+
 func TestKillTransactions_DryRun(t *testing.T) {
 	t.Parallel()
 
@@ -1588,20 +1555,7 @@ func TestKillProcesses_DatabaseExecution(t *testing.T) {
 	testDBAvailable := true
 	settings := &configuration.Config{
 		SafeMode: false,
-		Databases: map[string]struct {
-			Address              string        `mapstructure:"address"`
-			Schema               string        `mapstructure:"schema"`
-			SSLCert              string        `mapstructure:"ssl_cert"`
-			SSLKey               string        `mapstructure:"ssl_key"`
-			SSLCA                string        `mapstructure:"ssl_ca"`
-			Username             string        `mapstructure:"username"`
-			Password             string        `mapstructure:"password"`
-			Interval             time.Duration `mapstructure:"interval"`
-			LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-			LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-			Port                 int           `mapstructure:"port"`
-			DryRun               bool          `mapstructure:"dry_run"`
-		}{
+		Databases: map[string]configuration.DatabaseConfig{
 			"test_db": {
 				Address:              "127.0.0.1",
 				Port:                 3306,
@@ -1838,20 +1792,7 @@ func TestKillTransactions_DatabaseExecution(t *testing.T) {
 	testDBAvailable := true
 	settings := &configuration.Config{
 		SafeMode: false,
-		Databases: map[string]struct {
-			Address              string        `mapstructure:"address"`
-			Schema               string        `mapstructure:"schema"`
-			SSLCert              string        `mapstructure:"ssl_cert"`
-			SSLKey               string        `mapstructure:"ssl_key"`
-			SSLCA                string        `mapstructure:"ssl_ca"`
-			Username             string        `mapstructure:"username"`
-			Password             string        `mapstructure:"password"`
-			Interval             time.Duration `mapstructure:"interval"`
-			LongQueryLimit       time.Duration `mapstructure:"long_query_limit"`
-			LongTransactionLimit time.Duration `mapstructure:"long_transaction_limit"`
-			Port                 int           `mapstructure:"port"`
-			DryRun               bool          `mapstructure:"dry_run"`
-		}{
+		Databases: map[string]configuration.DatabaseConfig{
 			"test_db": {
 				Address:              "127.0.0.1",
 				Port:                 3306,
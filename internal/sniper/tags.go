@@ -0,0 +1,142 @@
+package sniper
+
+import (
+	"log/slog"
+	"maps"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/persona-id/query-sniper/internal/metrics"
+)
+
+const (
+	// maxQueryTags is the most tags kept from a statement, so a runaway comment can't flood the logs.
+	maxQueryTags = 32
+
+	// maxQueryTagLength is the longest tag value kept; longer ones are truncated.
+	maxQueryTagLength = 256
+)
+
+var (
+	// queryComment matches the /* ... */ comments of a statement, but not optimizer hints (/*+ ... */)
+	// or version comments (/*! ... */), which are part of the statement.
+	queryComment = regexp.MustCompile(`/\*([^+!][^*]*(?:\*[^/][^*]*)*)\*/`)
+
+	// sqlcommenterTags matches a whole sqlcommenter comment: key='value' pairs, separated by commas,
+	// with url encoded keys and values, and \' escaped quotes in the values.
+	sqlcommenterTags = regexp.MustCompile(`^\s*[\w.%\-]+='(?:[^'\\]|\\.)*'(?:\s*,\s*[\w.%\-]+='(?:[^'\\]|\\.)*')*\s*$`)
+	sqlcommenterTag  = regexp.MustCompile(`([\w.%\-]+)='((?:[^'\\]|\\.)*)'`)
+
+	// marginaliaTags matches a whole marginalia comment: key:value pairs, separated by commas.
+	marginaliaTags = regexp.MustCompile(`^\s*[\w.\-]+:[^,]*(?:,\s*[\w.\-]+:[^,]*)*\s*$`)
+
+	// traceparent matches a W3C traceparent: version, trace id, parent id and flags.
+	traceparent = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-[0-9a-f]{16}-[0-9a-f]{2}$`)
+)
+
+// parseQueryTags returns the marginalia (/* controller:books,action:index */) and sqlcommenter
+// (/* controller='books',traceparent='00-...' */) tags in the statement's comments, or nil if there are
+// none. Other comments are ignored; if a key is repeated, the last value wins.
+//
+// NB: info is the raw query text, and may contain PII; only the tags parsed out of it may be logged.
+func parseQueryTags(info string) map[string]string {
+	var tags map[string]string
+
+	for _, comment := range queryComment.FindAllStringSubmatch(info, -1) {
+		body := comment[1]
+
+		switch {
+		case sqlcommenterTags.MatchString(body):
+			for _, pair := range sqlcommenterTag.FindAllStringSubmatch(body, -1) {
+				tags = addQueryTag(tags, unescapeSqlcommenter(pair[1]), unescapeSqlcommenter(strings.ReplaceAll(pair[2], `\'`, `'`)))
+			}
+
+		case marginaliaTags.MatchString(body):
+			for pair := range strings.SplitSeq(body, ",") {
+				key, value, _ := strings.Cut(pair, ":")
+				tags = addQueryTag(tags, strings.TrimSpace(key), strings.TrimSpace(value))
+			}
+		}
+	}
+
+	return tags
+}
+
+// addQueryTag adds the tag, creating the map if needed, unless the statement already has too many.
+func addQueryTag(tags map[string]string, key string, value string) map[string]string {
+	if tags == nil {
+		tags = make(map[string]string)
+	}
+
+	if _, ok := tags[key]; !ok && len(tags) >= maxQueryTags {
+		return tags
+	}
+
+	if len(value) > maxQueryTagLength {
+		value = value[:maxQueryTagLength]
+	}
+
+	tags[key] = value
+
+	return tags
+}
+
+// unescapeSqlcommenter url decodes a sqlcommenter key or value, leaving it as is if it doesn't decode.
+func unescapeSqlcommenter(value string) string {
+	unescaped, err := url.PathUnescape(value)
+	if err != nil {
+		return value
+	}
+
+	return unescaped
+}
+
+// redactTags runs the values of the tags through the tag redactor, as they're copied verbatim from the
+// statement, and can carry PII like any other part of it.
+func (sniper QuerySniper) redactTags(tags map[string]string) map[string]string {
+	if sniper.tagRedactor == nil {
+		return tags
+	}
+
+	for key, value := range tags {
+		tags[key] = sniper.tagRedactor.RedactTag(key, value)
+	}
+
+	return tags
+}
+
+// tagsAttrs returns the log attributes for the tags: a tags group, and the trace_id of a valid
+// traceparent, so that the log line can be linked to the trace. They're empty attributes, which slog
+// drops, if there are no tags.
+func tagsAttrs(tags map[string]string) (slog.Attr, slog.Attr) {
+	if len(tags) == 0 {
+		return slog.Attr{}, slog.Attr{}
+	}
+
+	attrs := make([]any, 0, len(tags))
+	for _, key := range slices.Sorted(maps.Keys(tags)) {
+		attrs = append(attrs, slog.String(key, tags[key]))
+	}
+
+	traceID := slog.Attr{}
+	if match := traceparent.FindStringSubmatch(tags["traceparent"]); match != nil {
+		traceID = slog.String("trace_id", match[1])
+	}
+
+	return slog.Group("tags", attrs...), traceID
+}
+
+// countTags counts a killed process (or one that would have been, in dry run) by the values of its
+// tags that are in the metric_labels allowlist.
+func (sniper QuerySniper) countTags(process MysqlProcess) {
+	for _, key := range sniper.queryTags.MetricLabels {
+		value, ok := process.Tags[key]
+		if !ok {
+			continue
+		}
+
+		metrics.CountTaggedKill(sniper.Name, key, value, sniper.DryRun)
+	}
+}
@@ -0,0 +1,176 @@
+package sniper
+
+import (
+	"log/slog"
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/persona-id/query-sniper/internal/configuration"
+	"github.com/persona-id/query-sniper/internal/metrics"
+	"github.com/persona-id/query-sniper/internal/redact"
+)
+
+func TestParseQueryTags(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		want map[string]string
+		name string
+		info string
+	}{
+		{
+			name: "no comments",
+			info: "SELECT * FROM books WHERE id = 1",
+			want: nil,
+		},
+		{
+			name: "marginalia",
+			info: "SELECT * FROM books /*application:Library,controller:books,action:index*/",
+			want: map[string]string{"application": "Library", "controller": "books", "action": "index"},
+		},
+		{
+			name: "marginalia job with spaces and a namespaced value",
+			info: "UPDATE books SET state = 'archived' /* job:Archive::BooksJob, line:/app/jobs/archive.rb:12 */",
+			want: map[string]string{"job": "Archive::BooksJob", "line": "/app/jobs/archive.rb:12"},
+		},
+		{
+			name: "sqlcommenter",
+			info: "SELECT * FROM books /*controller='books',route='%2Fbooks%2F%3Aid',traceparent='00-5bd66ef5095369c7b0d1f8f4bd33716a-c532cb4098ac3dd2-01'*/",
+			want: map[string]string{
+				"controller":  "books",
+				"route":       "/books/:id",
+				"traceparent": "00-5bd66ef5095369c7b0d1f8f4bd33716a-c532cb4098ac3dd2-01",
+			},
+		},
+		{
+			name: "sqlcommenter escaped quote",
+			info: `SELECT * FROM books /*action='O\'Reilly'*/`,
+			want: map[string]string{"action": "O'Reilly"},
+		},
+		{
+			name: "optimizer hints and version comments are ignored",
+			info: "SELECT /*+ MAX_EXECUTION_TIME(1000) */ /*!40001 SQL_NO_CACHE */ * FROM books /* controller:books */",
+			want: map[string]string{"controller": "books"},
+		},
+		{
+			name: "free text comments are ignored",
+			info: "SELECT * FROM books /* slow, see the ticket */ /* TODO fix this */",
+			want: nil,
+		},
+		{
+			name: "comments in several places, last value wins",
+			info: "/* controller:authors */ SELECT * FROM books /*controller='books',action='show'*/",
+			want: map[string]string{"controller": "books", "action": "show"},
+		},
+		{
+			name: "long values are truncated",
+			info: "SELECT * FROM books /* controller:" + strings.Repeat("b", maxQueryTagLength+10) + " */",
+			want: map[string]string{"controller": strings.Repeat("b", maxQueryTagLength)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := parseQueryTags(tt.info); !maps.Equal(got, tt.want) {
+				t.Errorf("parseQueryTags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQueryTags_MaxTags(t *testing.T) {
+	t.Parallel()
+
+	pairs := make([]string, 0, maxQueryTags+5)
+	for i := range maxQueryTags + 5 {
+		pairs = append(pairs, "key"+strings.Repeat("x", i)+":value")
+	}
+
+	if got := parseQueryTags("SELECT 1 /* " + strings.Join(pairs, ",") + " */"); len(got) != maxQueryTags {
+		t.Errorf("parseQueryTags() returned %d tags, want %d", len(got), maxQueryTags)
+	}
+}
+
+func TestRedactTags(t *testing.T) {
+	t.Parallel()
+
+	tags := map[string]string{"controller": "books", "user": "jane@example.com"}
+
+	// without query_tags, there's no redactor, and nothing to redact.
+	if got := (QuerySniper{}).redactTags(maps.Clone(tags)); !maps.Equal(got, tags) {
+		t.Errorf("redactTags() = %v, want %v unchanged", got, tags)
+	}
+
+	settings := managerTestSettings("primary")
+	settings.QueryTags.Enabled = true
+
+	sniper, err := QuerySniper{Name: "primary"}.withSettings(settings)
+	if err != nil {
+		t.Fatalf("withSettings() unexpected error = %v", err)
+	}
+
+	want := map[string]string{"controller": "books", "user": redact.Placeholder}
+	if got := sniper.redactTags(maps.Clone(tags)); !maps.Equal(got, want) {
+		t.Errorf("redactTags() = %v, want %v", got, want)
+	}
+}
+
+func TestTagsAttrs(t *testing.T) {
+	t.Parallel()
+
+	if tags, traceID := tagsAttrs(nil); !tags.Equal(slog.Attr{}) || !traceID.Equal(slog.Attr{}) {
+		t.Errorf("tagsAttrs(nil) = %v, %v, want empty attributes", tags, traceID)
+	}
+
+	tags, traceID := tagsAttrs(map[string]string{
+		"controller":  "books",
+		"action":      "index",
+		"traceparent": "00-5bd66ef5095369c7b0d1f8f4bd33716a-c532cb4098ac3dd2-01",
+	})
+
+	want := slog.Group("tags",
+		slog.String("action", "index"),
+		slog.String("controller", "books"),
+		slog.String("traceparent", "00-5bd66ef5095369c7b0d1f8f4bd33716a-c532cb4098ac3dd2-01"),
+	)
+	if !tags.Equal(want) {
+		t.Errorf("tagsAttrs() tags = %v, want %v", tags, want)
+	}
+
+	if want := slog.String("trace_id", "5bd66ef5095369c7b0d1f8f4bd33716a"); !traceID.Equal(want) {
+		t.Errorf("tagsAttrs() trace_id = %v, want %v", traceID, want)
+	}
+
+	// a malformed traceparent is still logged as a tag, but has no trace_id.
+	if _, traceID := tagsAttrs(map[string]string{"traceparent": "not-a-trace"}); !traceID.Equal(slog.Attr{}) {
+		t.Errorf("tagsAttrs() trace_id = %v, want an empty attribute for a malformed traceparent", traceID)
+	}
+}
+
+func TestCountTags(t *testing.T) {
+	t.Parallel()
+
+	sniper := QuerySniper{
+		Name:      "count-tags-test",
+		DryRun:    true,
+		queryTags: configuration.QueryTagsConfig{Enabled: true, MetricLabels: []string{"controller", "job"}},
+	}
+
+	sniper.countTags(MysqlProcess{ID: 1, Tags: map[string]string{"controller": "books", "action": "index"}})
+	sniper.countTags(MysqlProcess{ID: 2, Tags: map[string]string{"controller": "books"}})
+	sniper.countTags(MysqlProcess{ID: 3})
+
+	if got := testutil.ToFloat64(metrics.TaggedProcessesKilled.WithLabelValues(sniper.Name, "controller", "books", "true")); got != 2 {
+		t.Errorf("tagged_processes_killed_total{tag=controller,value=books} = %v, want 2", got)
+	}
+
+	// tags outside of the allowlist aren't counted.
+	if got := testutil.ToFloat64(metrics.TaggedProcessesKilled.WithLabelValues(sniper.Name, "action", "index", "true")); got != 0 {
+		t.Errorf("tagged_processes_killed_total{tag=action,value=index} = %v, want 0", got)
+	}
+}